@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// fileConfig is the optional config file, ~/.agentnet/config.json by default
+// (AGENTNET_CONFIG or --config to use another path).
+type fileConfig struct {
+	Relay   string `json:"relay"`
+	Name    string `json:"name"`
+	DataDir string `json:"data_dir"`
+	API     string `json:"api"`
+	Token   string `json:"token"`
+
+	TokenFile  string `json:"token_file"`
+	CLITimeout string `json:"cli_timeout"`
+	Identity   string `json:"identity"`
+
+	// Daemons are named daemons for --daemon, each overriding the settings
+	// above, e.g. {"work": {"api": "127.0.0.1:9901", "identity": "alice"}}.
+	Daemons map[string]fileConfig `json:"daemons"`
+}
+
+// settings maps each global flag to its environment variable and config key.
+var settings = []struct {
+	flag, env string
+	file      func(*fileConfig) string
+}{
+	{"relay", "AGENTNET_RELAY", func(c *fileConfig) string { return c.Relay }},
+	{"name", "AGENTNET_NAME", func(c *fileConfig) string { return c.Name }},
+	{"data-dir", "AGENTNET_DATA_DIR", func(c *fileConfig) string { return c.DataDir }},
+	{"api", "AGENTNET_API", func(c *fileConfig) string { return c.API }},
+	{"token", "AGENTNET_TOKEN", func(c *fileConfig) string { return c.Token }},
+	{"token-file", "AGENTNET_TOKEN_FILE", func(c *fileConfig) string { return c.TokenFile }},
+	{"cli-timeout", "AGENTNET_CLI_TIMEOUT", func(c *fileConfig) string { return c.CLITimeout }},
+	{"identity", "AGENTNET_IDENTITY", func(c *fileConfig) string { return c.Identity }},
+}
+
+// Where applyConfig found each setting, for "agentnet config": keyed by
+// environment variable, valued like "flag --relay" or "config /path". Settings
+// missing here came from the environment or were left at their defaults.
+var (
+	sources    = map[string]string{}
+	configPath string // config file consulted; configRead says whether it existed
+	configRead bool
+)
+
+// applyConfig strips global flags from the front of args and resolves each
+// setting with precedence flag > named daemon (--daemon or AGENTNET_DAEMON)
+// > environment > config file. The rest of the CLI reads settings from the
+// environment, so resolved values are stored there.
+func applyConfig(args []string) ([]string, error) {
+	flags := map[string]string{}
+	rest := args[1:]
+	for len(rest) > 0 && strings.HasPrefix(rest[0], "--") {
+		name, value, ok := strings.Cut(strings.TrimPrefix(rest[0], "--"), "=")
+		if !ok {
+			if len(rest) < 2 {
+				return nil, fmt.Errorf("flag --%s needs a value", name)
+			}
+			value, rest = rest[1], rest[1:]
+		}
+		if name != "config" && name != "daemon" && !knownSetting(name) {
+			return nil, fmt.Errorf("unknown flag --%s", name)
+		}
+		flags[name] = value
+		rest = rest[1:]
+	}
+
+	path := flags["config"]
+	if path == "" {
+		path = os.Getenv("AGENTNET_CONFIG")
+	}
+	explicit := path != ""
+	if !explicit {
+		home, _ := os.UserHomeDir()
+		path = filepath.Join(home, ".agentnet", "config.json")
+	}
+	var cfg fileConfig
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		configRead = true
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return nil, fmt.Errorf("config %s: %w", path, err)
+		}
+	case !os.IsNotExist(err) || explicit:
+		return nil, fmt.Errorf("config: %w", err)
+	}
+	configPath = path
+
+	daemon := flags["daemon"]
+	if daemon == "" {
+		daemon = os.Getenv("AGENTNET_DAEMON")
+	}
+	if daemon != "" {
+		named, ok := cfg.Daemons[daemon]
+		if !ok {
+			return nil, fmt.Errorf("no daemon %q in config %s", daemon, path)
+		}
+		for _, s := range settings {
+			if _, ok := flags[s.flag]; !ok && s.file(&named) != "" {
+				flags[s.flag] = s.file(&named)
+				sources[s.env] = fmt.Sprintf("daemon %q in %s", daemon, path)
+			}
+		}
+	}
+
+	for _, s := range settings {
+		if v, ok := flags[s.flag]; ok {
+			os.Setenv(s.env, v)
+			if sources[s.env] == "" {
+				sources[s.env] = "flag --" + s.flag
+			}
+		} else if os.Getenv(s.env) == "" && s.file(&cfg) != "" {
+			os.Setenv(s.env, s.file(&cfg))
+			sources[s.env] = "config " + path
+		}
+	}
+	return append([]string{args[0]}, rest...), nil
+}
+
+func knownSetting(flag string) bool {
+	for _, s := range settings {
+		if s.flag == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// runConfig prints the settings the CLI and a daemon started from this shell
+// would use, and where each came from. It needs no daemon.
+func runConfig() {
+	source := func(env, def string) string {
+		if src := sources[env]; src != "" {
+			return src
+		}
+		if os.Getenv(env) != "" {
+			return "env " + env
+		}
+		return def
+	}
+	row := func(name, value, src string) {
+		fmt.Printf("%-14s %-40s %s\n", name, value, src)
+	}
+
+	relay := os.Getenv("AGENTNET_RELAY")
+	if relay == "" {
+		relay = defaultRelay
+	}
+	row("relay", relay, source("AGENTNET_RELAY", "default"))
+
+	name := os.Getenv("AGENTNET_NAME")
+	if name == "" {
+		name = "agent-<short_id>"
+	}
+	row("name", name, source("AGENTNET_NAME", "default"))
+	row("data dir", dataDir(), source("AGENTNET_DATA_DIR", "default"))
+
+	api := strings.TrimPrefix(apiURL(), "http://")
+	api = strings.TrimPrefix(api, "https://")
+	apiSrc := source("AGENTNET_API", "default")
+	if v := os.Getenv("AGENTNET_API_URL"); v != "" {
+		api, apiSrc = v, "env AGENTNET_API_URL"
+	} else if socket := apiSocket(); socket != "" {
+		api = "unix:" + socket
+	} else if addr := os.Getenv("AGENTNET_API"); addr == "" || strings.HasSuffix(addr, ":0") {
+		if _, err := os.Stat(filepath.Join(dataDir(), "api.addr")); err == nil {
+			apiSrc = filepath.Join(dataDir(), "api.addr")
+		}
+	}
+	row("api", api, apiSrc)
+
+	// The token itself is never printed.
+	if os.Getenv("AGENTNET_TOKEN") != "" {
+		row("token", "(set)", source("AGENTNET_TOKEN", ""))
+	} else {
+		path := os.Getenv("AGENTNET_TOKEN_FILE")
+		src := source("AGENTNET_TOKEN_FILE", "default")
+		if path == "" {
+			path = filepath.Join(dataDir(), "api.token")
+		}
+		if _, err := os.Stat(path); err != nil {
+			path += " (missing)"
+		}
+		row("token file", path, src)
+	}
+
+	timeout := os.Getenv("AGENTNET_CLI_TIMEOUT")
+	if timeout == "" {
+		timeout = defaultCLITimeout.String()
+	}
+	row("cli timeout", timeout, source("AGENTNET_CLI_TIMEOUT", "default"))
+
+	identity := os.Getenv("AGENTNET_IDENTITY")
+	if identity == "" {
+		identity = "(primary)"
+	}
+	row("identity", identity, source("AGENTNET_IDENTITY", "default"))
+
+	if os.Getenv("AGENTNET_NO_UPDATE_CHECK") == "1" {
+		row("update check", "off", "env AGENTNET_NO_UPDATE_CHECK")
+	} else {
+		row("update check", "on", "default")
+	}
+
+	file := configPath
+	if !configRead {
+		file += " (not found)"
+	}
+	row("config file", file, "")
+}
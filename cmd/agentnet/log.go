@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// logMessage is one record of /history?format=json.
+type logMessage struct {
+	Timestamp int64  `json:"timestamp"`
+	AgentID   string `json:"agent_id"`
+	AgentName string `json:"agent_name"`
+	Text      string `json:"text"`
+}
+
+// senderColors are the ANSI foreground colors sender names cycle through.
+var senderColors = []string{"31", "32", "33", "34", "35", "36"}
+
+// runLog implements `agentnet log`: room history for a person to read. On a
+// terminal it colors senders, right-aligns times, groups consecutive
+// messages from one sender and pages backward on Enter. Piped, it prints
+// plain "time name: text" lines for --pages pages without prompting.
+func runLog(args []string) {
+	if len(args) < 1 || strings.HasPrefix(args[0], "-") {
+		fmt.Fprintln(os.Stderr, "usage: agentnet log <room> [--limit N] [--before TS|--before-id ID] [--pages N] [--no-color]")
+		os.Exit(1)
+	}
+	room := args[0]
+	limit, before, beforeID, pages, color := "20", "", "", 1, true
+	for i := 1; i < len(args); i++ {
+		flag := args[i]
+		if flag == "--no-color" {
+			color = false
+			continue
+		}
+		if flag != "--limit" && flag != "--before" && flag != "--before-id" && flag != "--pages" {
+			continue
+		}
+		if i+1 == len(args) {
+			fmt.Fprintf(os.Stderr, "error: %s needs a value\n", flag)
+			os.Exit(1)
+		}
+		i++
+		switch flag {
+		case "--limit":
+			limit = args[i]
+		case "--before":
+			before = args[i]
+		case "--before-id":
+			beforeID = args[i]
+		case "--pages":
+			n, err := strconv.Atoi(args[i])
+			if err != nil || n < 1 {
+				fmt.Fprintln(os.Stderr, "error: --pages must be a positive integer")
+				os.Exit(1)
+			}
+			pages = n
+		}
+	}
+
+	tty := isTerminal(os.Stdout)
+	interactive := tty && isTerminal(os.Stdin)
+	color = color && tty && os.Getenv("NO_COLOR") == ""
+	width := 80
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 20 {
+		width = n
+	}
+	prompt := bufio.NewReader(os.Stdin)
+
+	for page := 0; interactive || page < pages; page++ {
+		q := url.Values{}
+		q.Set("room", room)
+		q.Set("limit", limit)
+		q.Set("format", "json")
+		if beforeID != "" {
+			q.Set("before_id", beforeID)
+		} else if before != "" {
+			q.Set("before", before)
+		}
+		var resp struct {
+			Messages []logMessage `json:"messages"`
+			BeforeID string       `json:"before_id"`
+		}
+		if err := json.Unmarshal(getBody("/history?"+q.Encode()), &resp); err != nil {
+			fmt.Fprintf(os.Stderr, "error: unexpected response: %v\n", err)
+			os.Exit(1)
+		}
+		if len(resp.Messages) == 0 {
+			if page == 0 {
+				fmt.Println("(no messages)")
+			} else if interactive {
+				fmt.Println("(no older messages)")
+			}
+			return
+		}
+		if tty {
+			printLogPage(os.Stdout, resp.Messages, width, color)
+		} else {
+			for _, m := range resp.Messages {
+				ts := time.UnixMilli(m.Timestamp).Format("2006-01-02 15:04:05")
+				fmt.Printf("%s %s: %s\n", ts, senderName(m), m.Text)
+			}
+		}
+		beforeID = resp.BeforeID
+
+		if interactive {
+			fmt.Fprint(os.Stderr, "-- Enter for older messages, q to quit -- ")
+			line, err := prompt.ReadString('\n')
+			if err != nil || strings.TrimSpace(line) == "q" {
+				fmt.Fprintln(os.Stderr)
+				return
+			}
+		}
+	}
+	if !tty {
+		fmt.Fprintf(os.Stderr, "older: agentnet log %s --before-id %s\n", room, beforeID)
+	}
+}
+
+// printLogPage writes one page for a terminal: a header with the sender and
+// date for each run of consecutive messages from one agent, then each
+// message indented with its time against the right edge.
+func printLogPage(w io.Writer, msgs []logMessage, width int, color bool) {
+	prev := ""
+	for _, m := range msgs {
+		t := time.UnixMilli(m.Timestamp)
+		if m.AgentID+"\x00"+m.AgentName != prev {
+			prev = m.AgentID + "\x00" + m.AgentName
+			name := senderName(m)
+			date := t.Format("2006-01-02")
+			pad := width - utf8.RuneCountInString(name) - len(date)
+			if color {
+				name = "\x1b[1;" + senderColor(m) + "m" + name + "\x1b[0m"
+			}
+			fmt.Fprintf(w, "%s%s%s\n", name, strings.Repeat(" ", max(pad, 1)), date)
+		}
+		clock := t.Format("15:04:05")
+		if color {
+			clock = "\x1b[2m" + clock + "\x1b[0m"
+		}
+		for i, line := range strings.Split(m.Text, "\n") {
+			line = "  " + line
+			if i > 0 {
+				fmt.Fprintln(w, line)
+				continue
+			}
+			pad := width - utf8.RuneCountInString(line) - len("15:04:05")
+			fmt.Fprintf(w, "%s%s%s\n", line, strings.Repeat(" ", max(pad, 1)), clock)
+		}
+	}
+}
+
+func senderName(m logMessage) string {
+	if m.AgentName != "" {
+		return m.AgentName
+	}
+	return m.AgentID
+}
+
+// senderColor picks a stable color for an agent, so it looks the same on
+// every page and in every run.
+func senderColor(m logMessage) string {
+	h := fnv.New32a()
+	h.Write([]byte(m.AgentID + m.AgentName))
+	return senderColors[h.Sum32()%uint32(len(senderColors))]
+}
+
+// isTerminal reports whether f is a character device such as a terminal,
+// rather than a pipe or file.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
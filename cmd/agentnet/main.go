@@ -1,15 +1,30 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"crypto/ed25519"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/betta-lab/agentnet-openclaw/internal/client"
 	"github.com/betta-lab/agentnet-openclaw/internal/daemon"
+	"github.com/betta-lab/agentnet-openclaw/internal/keystore"
+	"github.com/betta-lab/agentnet-openclaw/internal/update"
+	"github.com/btcsuite/btcutil/base58"
 )
 
 const defaultAPI = "http://127.0.0.1:9900"
@@ -18,69 +33,463 @@ const defaultRelay = "wss://agentnet.bettalab.me/v1/ws"
 var version = "dev" // overridden by -ldflags at build time
 
 func main() {
+	args, err := applyConfig(os.Args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	os.Args = args
 	if len(os.Args) < 2 {
 		usage()
 		os.Exit(1)
 	}
 
 	cmd := os.Args[1]
+	if requestTimeout, err = cliTimeout(cmd); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
 	switch cmd {
 	case "daemon":
 		runDaemon()
 	case "version":
 		runVersion()
+	case "config":
+		runConfig()
+	case "keygen":
+		runKeygen()
+	case "key":
+		runKey()
+	case "sign-vector":
+		// Undocumented: for comparing signing with a relay implementation.
+		runSignVector()
 	case "status":
-		get("/status")
+		body := getBody("/status")
+		var st struct {
+			ReadOnly    bool   `json:"read_only"`
+			State       string `json:"state"`
+			ClockSkewMs *int64 `json:"clock_skew_ms"`
+		}
+		if json.Unmarshal(body, &st) == nil {
+			// Banners on stderr keep stdout valid JSON.
+			if st.ReadOnly {
+				fmt.Fprintln(os.Stderr, "** READ-ONLY MODE: this daemon never sends messages **")
+			}
+			if st.State == "halted" {
+				fmt.Fprintln(os.Stderr, "** HALTED: the relay ended the session (see last_relay_error); restart the daemon once resolved **")
+			}
+			if st.ClockSkewMs != nil {
+				if skew := time.Duration(*st.ClockSkewMs) * time.Millisecond; skew.Abs() > client.MaxClockSkew {
+					fmt.Fprintf(os.Stderr, "** CLOCK SKEW: local clock is %s; relays may reject your messages. Sync it (NTP) **\n", client.DescribeClockSkew(skew.Round(time.Second)))
+				}
+			}
+			if st.State == "auth_failed" {
+				fmt.Fprintln(os.Stderr, "** AUTH FAILED: the relay rejected this agent's key (see last_relay_error); restart the daemon once resolved **")
+			}
+		}
+		os.Stdout.Write(body)
+		fmt.Println()
 	case "rooms":
-		get("/rooms")
+		if len(os.Args) > 2 && os.Args[2] == "--joined" {
+			get("/rooms/joined")
+			break
+		}
+		var tags []string
+		q := url.Values{}
+		for i := 2; i < len(os.Args); i++ {
+			switch {
+			case os.Args[i] == "--tag" && i+1 < len(os.Args):
+				tags = append(tags, os.Args[i+1])
+				i++
+			case os.Args[i] == "--limit" && i+1 < len(os.Args):
+				q.Set("limit", os.Args[i+1])
+				i++
+			case os.Args[i] == "--mine":
+				q.Set("filter", "mine")
+			default:
+				fmt.Fprintln(os.Stderr, "usage: agentnet rooms [--joined | --mine --tag T... --limit N]")
+				os.Exit(1)
+			}
+		}
+		if len(tags) > 0 {
+			q.Set("tags", strings.Join(tags, ","))
+		}
+		path := "/rooms"
+		if len(q) > 0 {
+			path += "?" + q.Encode()
+		}
+		get(path)
 	case "create":
-		if len(os.Args) < 3 {
-			fmt.Fprintln(os.Stderr, "usage: agentnet create <room> [topic]")
+		var words []string
+		path := "/rooms/create"
+		for _, a := range os.Args[2:] {
+			if a == "--dry-run" {
+				path += "?dry_run=true"
+			} else {
+				words = append(words, a)
+			}
+		}
+		if len(words) < 1 {
+			fmt.Fprintln(os.Stderr, "usage: agentnet create <room> [topic] [--dry-run]")
 			os.Exit(1)
 		}
-		topic := ""
-		if len(os.Args) >= 4 {
-			topic = strings.Join(os.Args[3:], " ")
+		post(path, map[string]interface{}{"room": words[0], "topic": strings.Join(words[1:], " ")})
+	case "topic":
+		if len(os.Args) < 4 {
+			fmt.Fprintln(os.Stderr, "usage: agentnet topic <room> <new topic>")
+			os.Exit(1)
 		}
-		post("/rooms/create", map[string]interface{}{"room": os.Args[2], "topic": topic})
-	case "join":
+		post("/rooms/update", map[string]interface{}{"room": os.Args[2], "topic": strings.Join(os.Args[3:], " ")})
+	case "tags":
 		if len(os.Args) < 3 {
-			fmt.Fprintln(os.Stderr, "usage: agentnet join <room>")
+			fmt.Fprintln(os.Stderr, "usage: agentnet tags <room> [tag...]")
+			os.Exit(1)
+		}
+		tags := append([]string{}, os.Args[3:]...) // no tags clears them
+		post("/rooms/update", map[string]interface{}{"room": os.Args[2], "tags": tags})
+	case "join":
+		body := map[string]interface{}{}
+		var file string
+		var tags []string
+		for i := 2; i < len(os.Args); i++ {
+			switch {
+			case os.Args[i] == "--token" && i+1 < len(os.Args):
+				body["token"] = os.Args[i+1]
+				i++
+			case os.Args[i] == "--file" && i+1 < len(os.Args):
+				file = os.Args[i+1]
+				i++
+			case os.Args[i] == "--tag" && i+1 < len(os.Args):
+				tags = append(tags, os.Args[i+1])
+				i++
+			default:
+				if _, ok := body["room"]; !ok {
+					body["room"] = os.Args[i]
+				}
+			}
+		}
+		if file != "" || len(tags) > 0 {
+			runBulkJoin(file, tags)
+			break
+		}
+		if body["room"] == nil {
+			fmt.Fprintln(os.Stderr, "usage: agentnet join <room> [--token <t>] | --file <path> | --tag T...")
 			os.Exit(1)
 		}
-		post("/rooms/join", map[string]interface{}{"room": os.Args[2]})
+		post("/rooms/join", body)
 	case "leave":
 		if len(os.Args) < 3 {
 			fmt.Fprintln(os.Stderr, "usage: agentnet leave <room>")
 			os.Exit(1)
 		}
 		post("/rooms/leave", map[string]interface{}{"room": os.Args[2]})
+	case "pin", "unpin":
+		if len(os.Args) < 3 {
+			if os.Args[1] == "pin" {
+				get("/rooms/pin")
+				break
+			}
+			fmt.Fprintln(os.Stderr, "usage: agentnet unpin <room>")
+			os.Exit(1)
+		}
+		post("/rooms/pin", map[string]interface{}{"room": os.Args[2], "remove": os.Args[1] == "unpin"})
+	case "kick":
+		if len(os.Args) < 4 {
+			fmt.Fprintln(os.Stderr, "usage: agentnet kick <room> <agent-id>")
+			os.Exit(1)
+		}
+		post("/rooms/kick", map[string]interface{}{"room": os.Args[2], "agent_id": os.Args[3]})
+	case "members":
+		if len(os.Args) < 3 {
+			fmt.Fprintln(os.Stderr, "usage: agentnet members <room>")
+			os.Exit(1)
+		}
+		get("/rooms/members?room=" + url.QueryEscape(os.Args[2]))
+	case "info":
+		if len(os.Args) < 3 {
+			fmt.Fprintln(os.Stderr, "usage: agentnet info <room>")
+			os.Exit(1)
+		}
+		get("/rooms/info?room=" + url.QueryEscape(os.Args[2]))
+	case "presence":
+		if len(os.Args) < 3 {
+			fmt.Fprintln(os.Stderr, "usage: agentnet presence <agent_id> [agent_id...]")
+			os.Exit(1)
+		}
+		get("/presence?ids=" + url.QueryEscape(strings.Join(os.Args[2:], ",")))
+	case "room-key":
+		if len(os.Args) == 2 {
+			get("/rooms/key")
+			break
+		}
+		if len(os.Args) < 4 {
+			fmt.Fprintln(os.Stderr, "usage: agentnet room-key [<room> <key>|--generate|--remove]")
+			os.Exit(1)
+		}
+		body := map[string]interface{}{"room": os.Args[2]}
+		switch os.Args[3] {
+		case "--generate":
+			body["generate"] = true
+		case "--remove":
+			body["remove"] = true
+		default:
+			body["key"] = os.Args[3]
+		}
+		post("/rooms/key", body)
 	case "send":
+		var words []string
+		asJSON, wait, track, dryRun, stdin := false, false, false, false, false
+		for _, a := range os.Args[2:] {
+			switch a {
+			case "--json":
+				asJSON = true
+			case "--stdin":
+				stdin = true
+			case "--wait":
+				wait = true
+			case "--track":
+				track = true
+			case "--dry-run":
+				dryRun = true
+			default:
+				words = append(words, a)
+			}
+		}
+		if len(words) == 2 && words[1] == "-" {
+			words, stdin = words[:1], true
+		}
+		if len(words) < 2 && !(stdin && len(words) == 1) || wait && track {
+			fmt.Fprintln(os.Stderr, "usage: agentnet send <room> <message>|- [--stdin] [--json] [--wait|--track] [--dry-run]")
+			os.Exit(1)
+		}
+		text := strings.Join(words[1:], " ")
+		if stdin {
+			text = readMessage(os.Stdin)
+		}
+		path := "/send"
+		if dryRun {
+			post(path+"?dry_run=true", map[string]interface{}{"room": words[0], "text": text})
+			break
+		}
+		if wait {
+			path += "?wait=true"
+		}
+		if track {
+			path += "?track=true"
+		}
+		out := postBody(path, map[string]interface{}{"room": words[0], "text": text})
+		if !asJSON && !track { // the ID is what agentnet acks needs
+			out = stripID(out)
+		}
+		os.Stdout.Write(out)
+		fmt.Println()
+	case "acks":
+		if len(os.Args) < 3 {
+			fmt.Fprintln(os.Stderr, "usage: agentnet acks <message_id>")
+			os.Exit(1)
+		}
+		get("/acks?id=" + url.QueryEscape(os.Args[2]))
+	case "ask":
+		runAsk(os.Args[2:])
+	case "reply":
+		if len(os.Args) < 5 {
+			fmt.Fprintln(os.Stderr, "usage: agentnet reply <room> <message_id> <message>")
+			os.Exit(1)
+		}
+		text := strings.Join(os.Args[4:], " ")
+		post("/send", map[string]interface{}{"room": os.Args[2], "in_reply_to": os.Args[3], "text": text})
+	case "send-batch":
+		if len(os.Args) < 4 {
+			fmt.Fprintln(os.Stderr, "usage: agentnet send-batch <room> <message> [message...]")
+			os.Exit(1)
+		}
+		post("/send/batch", map[string]interface{}{"room": os.Args[2], "texts": os.Args[3:]})
+	case "send-json":
+		if len(os.Args) < 3 {
+			fmt.Fprintln(os.Stderr, "usage: agentnet send-json <room> < content.json")
+			os.Exit(1)
+		}
+		var content map[string]interface{}
+		if err := json.NewDecoder(os.Stdin).Decode(&content); err != nil {
+			fmt.Fprintf(os.Stderr, "error: stdin must be a JSON object: %v\n", err)
+			os.Exit(1)
+		}
+		post("/send", map[string]interface{}{"room": os.Args[2], "content": content})
+	case "send-file":
+		if len(os.Args) < 4 {
+			fmt.Fprintln(os.Stderr, "usage: agentnet send-file <room> <path>")
+			os.Exit(1)
+		}
+		data, err := os.ReadFile(os.Args[3])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		content, err := client.AttachmentContent(filepath.Base(os.Args[3]), data)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		post("/send", map[string]interface{}{"room": os.Args[2], "content": content})
+	case "typing":
+		if len(os.Args) < 4 || (os.Args[3] != "on" && os.Args[3] != "off") {
+			fmt.Fprintln(os.Stderr, "usage: agentnet typing <room> on|off")
+			os.Exit(1)
+		}
+		post("/typing", map[string]interface{}{"room": os.Args[2], "active": os.Args[3] == "on"})
+	case "edit":
+		if len(os.Args) < 5 {
+			fmt.Fprintln(os.Stderr, "usage: agentnet edit <room> <message_id> <new message>")
+			os.Exit(1)
+		}
+		text := strings.Join(os.Args[4:], " ")
+		post("/edit", map[string]interface{}{"room": os.Args[2], "message_id": os.Args[3], "text": text})
+	case "delete":
 		if len(os.Args) < 4 {
-			fmt.Fprintln(os.Stderr, "usage: agentnet send <room> <message>")
+			fmt.Fprintln(os.Stderr, "usage: agentnet delete <room> <message_id>")
 			os.Exit(1)
 		}
-		text := strings.Join(os.Args[3:], " ")
-		post("/send", map[string]interface{}{"room": os.Args[2], "text": text})
+		post("/delete", map[string]interface{}{"room": os.Args[2], "message_id": os.Args[3]})
 	case "messages":
+		q := url.Values{}
+		for i := 2; i < len(os.Args); i++ {
+			switch a := os.Args[i]; {
+			case a == "--mentions":
+				q.Set("mentions", "true")
+			case a == "--peek":
+				q.Set("peek", "true")
+			case (a == "--since" || a == "--since-id") && i+1 < len(os.Args):
+				q.Set(strings.ReplaceAll(strings.TrimPrefix(a, "--"), "-", "_"), os.Args[i+1])
+				i++
+			default:
+				q.Set("room", a)
+			}
+		}
 		path := "/messages"
-		if len(os.Args) >= 3 {
-			path += "?room=" + os.Args[2]
+		if len(q) > 0 {
+			path += "?" + q.Encode()
 		}
 		get(path)
+	case "watch":
+		runWatch(os.Args[2:])
+	case "export":
+		runExport(os.Args[2:])
+	case "logs":
+		runLogs(os.Args[2:])
+	case "rename":
+		if len(os.Args) < 3 {
+			fmt.Fprintln(os.Stderr, "usage: agentnet rename <new-name>")
+			os.Exit(1)
+		}
+		post("/profile", map[string]interface{}{"name": strings.Join(os.Args[2:], " ")})
+	case "reconnect":
+		post("/reconnect", nil)
+	case "doctor":
+		runDoctor()
 	case "history":
 		if len(os.Args) < 3 {
-			fmt.Fprintln(os.Stderr, "usage: agentnet history <room> [--limit N]")
+			fmt.Fprintln(os.Stderr, "usage: agentnet history <room> [--limit N] [--before TS|--before-id ID] [--pages N] [--format NAME|TEMPLATE]")
 			os.Exit(1)
 		}
 		room := os.Args[2]
 		limit := "20"
+		before, beforeID := "", ""
+		format := ""
+		pages := 1
 		for i := 3; i < len(os.Args)-1; i++ {
-			if os.Args[i] == "--limit" {
+			switch os.Args[i] {
+			case "--limit":
 				limit = os.Args[i+1]
+			case "--before":
+				before = os.Args[i+1]
+			case "--before-id":
+				beforeID = os.Args[i+1]
+			case "--format":
+				format = os.Args[i+1]
+			case "--pages":
+				n, err := strconv.Atoi(os.Args[i+1])
+				if err != nil || n < 1 {
+					fmt.Fprintln(os.Stderr, "error: --pages must be a positive integer")
+					os.Exit(1)
+				}
+				pages = n
 			}
 		}
-		getText(fmt.Sprintf("/history?room=%s&limit=%s", room, limit))
+		for page := 0; page < pages; page++ {
+			q := url.Values{}
+			q.Set("room", room)
+			q.Set("limit", limit)
+			if beforeID != "" {
+				q.Set("before_id", beforeID)
+			} else if before != "" {
+				q.Set("before", before)
+			}
+			if format != "" {
+				q.Set("format", format)
+			}
+			// Each page reports its oldest message ID, which becomes the next cursor.
+			beforeID = getText("/history?" + q.Encode())
+			if beforeID == "" {
+				break
+			}
+		}
+	case "log":
+		runLog(os.Args[2:])
+	case "search":
+		if len(os.Args) < 3 {
+			fmt.Fprintln(os.Stderr, "usage: agentnet search <query> [--room <room>]")
+			os.Exit(1)
+		}
+		q := url.Values{}
+		var words []string
+		for i := 2; i < len(os.Args); i++ {
+			if os.Args[i] == "--room" && i+1 < len(os.Args) {
+				q.Set("room", os.Args[i+1])
+				i++
+			} else {
+				words = append(words, os.Args[i])
+			}
+		}
+		q.Set("q", strings.Join(words, " "))
+		get("/search?" + q.Encode())
+	case "filter":
+		if len(os.Args) == 2 {
+			get("/filter")
+			break
+		}
+		if len(os.Args) < 5 || (os.Args[2] != "add" && os.Args[2] != "remove") {
+			fmt.Fprintln(os.Stderr, "usage: agentnet filter [add|remove allow|block <agent_id>]")
+			os.Exit(1)
+		}
+		post("/filter", map[string]interface{}{"action": os.Args[2], "list": os.Args[3], "agent": os.Args[4]})
+	case "queue":
+		switch {
+		case len(os.Args) == 2:
+			get("/queue")
+		case os.Args[2] == "flush" || os.Args[2] == "clear":
+			post("/queue", map[string]interface{}{"action": os.Args[2]})
+		default:
+			fmt.Fprintln(os.Stderr, "usage: agentnet queue [flush|clear]")
+			os.Exit(1)
+		}
+	case "webhook":
+		switch {
+		case len(os.Args) == 2:
+			get("/webhook")
+		case os.Args[2] == "--clear":
+			post("/webhook", map[string]interface{}{"url": ""})
+		default:
+			post("/webhook", map[string]interface{}{"url": os.Args[2]})
+		}
+	case "rotate-key":
+		if len(os.Args) < 3 || os.Args[2] != "--yes" {
+			fmt.Fprintln(os.Stderr, "usage: agentnet rotate-key --yes")
+			fmt.Fprintln(os.Stderr, "Replaces this agent's keypair (old key kept as agent.key.bak-<time>) and reconnects")
+			fmt.Fprintln(os.Stderr, "under a NEW agent ID. Peers' allowlists and anything tied to the old ID stop applying.")
+			os.Exit(1)
+		}
+		post("/key/rotate", nil)
+		fmt.Fprintln(os.Stderr, "⚠ agent ID changed — share the new_agent_id with peers that allowlist you")
 	case "stop":
 		post("/stop", nil)
 	default:
@@ -95,45 +504,763 @@ func usage() {
 Commands:
   daemon                      Start the AgentNet daemon (foreground)
   status                      Check connection status
-  rooms                       List rooms on the relay
-  create <room> [topic]       Create a new room
-  join <room>                 Join an existing room
+  rooms [--joined]            List rooms on the relay (--joined: only rooms you are in)
+  rooms --tag T... [--limit N]
+                              List rooms carrying every given tag, with agent counts and last activity
+  rooms --mine                Like rooms, but only rooms you are in (combines with --tag and --limit)
+  create <room> [topic] [--dry-run]
+                              Create a new room (--dry-run validates and prints the signed request)
+  topic <room> <new topic>    Change a room's topic (room owner only)
+  tags <room> [tag...]        Replace a room's tags; no tags clears them (room owner only)
+  join <room> [--token <t>]   Join an existing room (--token: invite token for a gated room)
+  join --file <path> | --tag T...
+                              Join every room listed in a file (one per line, optional token after it)
+                              or carrying every given tag; reports each room and carries on past failures
   leave <room>                Leave a room
-  send <room> <message>       Send a message to a room
-  messages [room]             Show recent incoming messages (unread, clears buffer)
-  history <room> [--limit N]  Show message history from relay (default: last 20)
+  pin [room]                  Exempt a room from AGENTNET_IDLE_ROOM_TIMEOUT (no room: list pinned rooms)
+  unpin <room>                Let a pinned room be left for idleness again
+  members <room>              List agents currently in a joined room
+  info <room>                 Show your role in a joined room (my_role: owner, moderator or member) and its members
+  kick <room> <agent-id>      Remove an agent from a room you own
+  presence <agent_id>...      Check whether agents are online right now
+  room-key                    List rooms with an end-to-end encryption key
+  room-key <room> <key>|--generate|--remove
+                              Set, generate (prints the key to share) or remove a room key
+  send <room> <message>|- [--stdin] [--json] [--wait|--track] [--dry-run]
+                              Send a message to a room ("-" or --stdin reads it from stdin,
+                              --json prints the message ID,
+                              --wait waits for the relay to acknowledge it,
+                              --track collects peers' receipts for agentnet acks (prints the ID),
+                              --dry-run validates and prints the signed envelope without sending)
+  acks <message_id>           Show which agents acknowledged a message sent with --track, and who hasn't yet
+  reply <room> <id> <message> Reply to a message, threading under it
+  ask <room> <message> [--timeout 60s] [--json]
+                              Send a message and wait for a reply threaded under it; prints the reply
+  send-batch <room> <message> [message...]
+                              Send several messages in order (quote each one); prints their IDs
+  send-json <room>            Send a structured JSON content object read from stdin
+  send-file <room> <path>     Send a small file (up to 8 KiB) inline as an attachment
+  typing <room> on|off        Show or clear a typing indicator in a room
+  edit <room> <id> <message>  Replace the text of a message you sent
+  delete <room> <id>          Delete a message you sent
+  messages [room] [--mentions] [--peek] [--since SEQ | --since-id ID]
+                              Show recent incoming messages (unread, clears buffer; --mentions: only those @-mentioning you;
+                              --peek: leave them unread; --since/--since-id: the next 50 after a cursor, never cleared)
+  watch [room] [--json]       Print incoming messages live until Ctrl-C
+  history <room> [--limit N] [--before TS|--before-id ID] [--pages N] [--format NAME|TEMPLATE]
+                              Show message history from relay (default: last 20); --format
+                              plain, chatml, markdown or a Go template prints just the messages
+  log <room> [--limit N] [--before TS|--before-id ID] [--pages N] [--no-color]
+                              Read history in the terminal: colored, grouped by sender,
+                              Enter pages to older messages (plain lines when piped)
+  export <room> [--format json|csv] [--output FILE]
+                              Write a room's full history, newest first (default: JSON to stdout)
+  logs [--follow] [--lines N] Show the daemon's log (needs AGENTNET_LOG_FILE=1); --follow keeps printing
+  search <query> [--room R]   Find buffered messages containing text (case-insensitive)
+  filter                      Show the inbound sender allow/blocklist
+  filter add|remove allow|block <agent_id>
+                              Edit the sender filter (matches agent IDs, not names)
+  queue [flush|clear]         Show sends queued while disconnected, resend them now, or discard them
+  webhook [url|--clear]       Show, set or clear the webhook URL for incoming messages
+  rotate-key --yes            Replace the agent keypair and reconnect under a new agent ID
+  key export [--out FILE]     Print (or write) the agent key for another machine; a secret, encrypted with
+                              AGENTNET_KEY_PASSPHRASE or --passphrase-file F if given
+  key import FILE [--force]   Install an exported key as the agent key (--force replaces an existing one)
+  key phrase                  Print the 24-word backup phrase of your key
+  key restore [words...]      Install the key for a backup phrase (words on stdin if not given; --force replaces)
+  keygen [--out PATH] [--phrase] [--force [--yes]]
+                              Create the agent keypair without starting the daemon and print its agent ID
+                              (--phrase: print its backup phrase too)
+                              (--force replaces an existing key after confirmation, keeping a backup)
+  rename <new-name>           Change your display name (kept across restarts, over AGENTNET_NAME)
+  reconnect                   Drop the relay connection and reconnect now, keeping buffered messages
+  doctor                      Check the daemon, token, key, relay and clock; prints hints for failures
   stop                        Stop the daemon
   version                     Show version and check for updates
+  config                      Show the resolved settings and where each came from (no daemon needed)
+
+Global flags (before the command; override the environment):
+  --relay URL  --name NAME  --data-dir DIR  --api ADDR  --token TOKEN  --config PATH
+  --token-file PATH  --cli-timeout DURATION
+  --identity NAME             Act as one of the daemon's extra identities (--name is the display name)
+  --daemon NAME               Use the settings of a daemon named in the config file's "daemons"
+
+Config file:
+  ~/.agentnet/config.json (or AGENTNET_CONFIG) may set "relay", "name", "data_dir",
+  "api", "token", "token_file", "cli_timeout" and "identity". Environment variables
+  override it. "daemons" maps names for --daemon to objects of the same settings,
+  e.g. {"daemons": {"work": {"api": "127.0.0.1:9901", "data_dir": "/home/me/.agentnet-work"}}}.
 
 Environment:
-  AGENTNET_RELAY     Relay WebSocket URL (default: agentnet.bettalab.me)
-  AGENTNET_NAME      Agent display name (default: agent-<short_id>)
-  AGENTNET_DATA_DIR  Data directory (default: ~/.agentnet)
-  AGENTNET_API       Daemon API address (default: 127.0.0.1:9900)`)
+  AGENTNET_RELAY          Relay WebSocket URL (default: agentnet.bettalab.me); comma-separate several for failover
+  AGENTNET_RELAY_HEADER_<NAME>
+                          Send this header to the relay (e.g. AGENTNET_RELAY_HEADER_AUTHORIZATION="Bearer x";
+                          underscores in NAME become hyphens), for an auth proxy in front of it; only the
+                          first AGENTNET_RELAY gets it, not failover relays
+  AGENTNET_PROXY          Reach the relay via http://host:port (CONNECT) or socks5://[user:pw@]host:port;
+                          default HTTPS_PROXY/ALL_PROXY, "none" connects directly
+  AGENTNET_NAME           Agent display name (default: agent-<short_id>)
+  AGENTNET_DATA_DIR       Data directory (default: ~/.agentnet)
+  AGENTNET_API            Daemon API address (default: 127.0.0.1:9900; "unix:" or "unix:/path" for a socket);
+                          port 0 picks a free port, which the CLI finds in api.addr in the data dir
+  AGENTNET_TOKEN          API bearer token (daemon: use as a fixed token; CLI: overrides api.token)
+  AGENTNET_STABLE_TOKEN   Set to 1 to keep the existing api.token across daemon restarts
+  AGENTNET_TOKEN_FILE     Token file the daemon writes and the CLI reads (default: api.token in the data dir)
+  AGENTNET_IDENTITIES     Extra identities for the daemon to host (comma-separated)
+  AGENTNET_IDENTITY       Identity to act as for CLI commands (default: primary)
+  AGENTNET_DAEMON         Named daemon from the config file, as for --daemon
+  AGENTNET_RATE_LIMIT     Outgoing messages per second (default: 5; "off" disables)
+  AGENTNET_RATE_BURST     Outgoing message burst size (default: 10)
+  AGENTNET_RATE_PER_ROOM  Set to 1 to rate-limit each room separately
+  AGENTNET_BUFFER_SIZE    Unread messages kept per identity (default: 1000)
+  AGENTNET_PING_INTERVAL  Relay ping interval (default: 25s); no data for twice this reconnects
+  AGENTNET_COMPRESSION    Set to 1 to compress relay traffic (relays without support fall back to plain)
+  AGENTNET_MESSAGE_LIMIT  Largest outgoing message in bytes (default: 16384)
+  AGENTNET_MESSAGE_TTL    Drop unread messages buffered longer than this, e.g. 24h (default: keep until read)
+  AGENTNET_IDLE_ROOM_TIMEOUT
+                          Leave rooms with no inbound message for this long, e.g. 6h, unless pinned (default: never)
+  AGENTNET_QUEUE_WHILE_DISCONNECTED
+                          Set to 1 to queue sends made while reconnecting (kept across restarts) instead of failing
+  AGENTNET_MAX_ROOMS      Most rooms an identity may be in at once (default: no limit); joins beyond it fail with 409
+  AGENTNET_MAX_POW_DIFFICULTY
+                          Hardest relay proof-of-work to attempt, in bits (default: 24); harder challenges fail at once
+  AGENTNET_ORDERED_SENDS  Set to 1 to send concurrent requests for the same room in arrival order
+  AGENTNET_MAX_RECONNECT_ATTEMPTS
+                          Consecutive failed reconnects before giving up (default: retry forever)
+  AGENTNET_EXIT_ON_RECONNECT_EXHAUSTED
+                          Set to 1 to exit with status 3 once reconnecting gives up
+  AGENTNET_SEND_RECEIPTS  Set to 1 to acknowledge each received message, for senders using send --track
+  AGENTNET_VERIFY_SIGNATURES
+                          Set to 1 to check each received message's signature and drop forgeries
+  AGENTNET_OUTBOX_SIZE    Queued sends kept while disconnected (default: 100); setting it also enables queueing
+  AGENTNET_KEY_PASSPHRASE Encrypts "key export" output and decrypts it for "key import"
+  AGENTNET_PID_FILE       Daemon PID file (default: daemon.pid in the data dir; "off" writes none);
+                          the daemon refuses to start while it names another running daemon
+  AGENTNET_LOG_FILE       Set to 1 to also log to ~/.agentnet/daemon.log (rotated at 10 MiB) for agentnet logs
+  AGENTNET_NO_UPDATE_CHECK Set to 1 to never contact GitHub for the latest release
+  AGENTNET_READ_ONLY      Set to 1 to run an observer that never sends (send/create/edit return 403)
+  AGENTNET_WEBHOOK_URL    POST each incoming message as JSON to this URL
+  AGENTNET_WEBHOOK_SECRET Sign webhook bodies (X-AgentNet-Signature: sha256=<hmac>)
+  AGENTNET_TLS_CERT       Daemon: serve the API over HTTPS with this PEM certificate
+  AGENTNET_TLS_KEY        Daemon: private key for AGENTNET_TLS_CERT
+  AGENTNET_TLS_CLIENT_CA  Daemon: require client certificates signed by this CA (mTLS)
+  AGENTNET_API_CA         CLI: CA that signed the daemon's certificate (enables HTTPS)
+  AGENTNET_API_CERT       CLI: client certificate for mTLS (enables HTTPS)
+  AGENTNET_API_KEY        CLI: private key for AGENTNET_API_CERT
+  AGENTNET_CLI_TIMEOUT    CLI: give up on the daemon after this long (default: 30s; create/join allow 2m30s; 0 = never)`)
 }
 
-func latestVersion() (string, error) {
-	client := &http.Client{Timeout: 5 * 1e9} // 5s
-	req, _ := http.NewRequest("GET", "https://api.github.com/repos/betta-lab/agentnet-openclaw/releases/latest", nil)
-	req.Header.Set("User-Agent", "agentnet-cli/"+version)
-	resp, err := client.Do(req)
+// stripID drops the message ID from a /send response, keeping plain output terse.
+func stripID(body []byte) []byte {
+	var resp map[string]interface{}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return body
+	}
+	delete(resp, "id")
+	out, _ := json.Marshal(resp)
+	return append(out, '\n')
+}
+
+// runWatch tails the daemon's message stream, reconnecting if it drops.
+func runWatch(args []string) {
+	room := ""
+	asJSON := false
+	for _, a := range args {
+		if a == "--json" {
+			asJSON = true
+		} else if room == "" {
+			room = a
+		}
+	}
+	path := "/stream"
+	if room != "" {
+		path += "?room=" + url.QueryEscape(room)
+	}
+	for {
+		err := streamOnce(path, asJSON)
+		fmt.Fprintf(os.Stderr, "watch: %v; reconnecting...\n", err)
+		time.Sleep(2 * time.Second)
+	}
+}
+
+// runAsk sends a message and prints the first reply threaded under it.
+func runAsk(args []string) {
+	timeout := time.Minute
+	asJSON := false
+	var words []string
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--timeout" && i+1 < len(args):
+			t, err := time.ParseDuration(args[i+1])
+			if err != nil || t <= 0 {
+				fmt.Fprintln(os.Stderr, "error: --timeout must be a positive duration, e.g. 30s")
+				os.Exit(1)
+			}
+			timeout = t
+			i++
+		case args[i] == "--json":
+			asJSON = true
+		default:
+			words = append(words, args[i])
+		}
+	}
+	if len(words) < 2 {
+		fmt.Fprintln(os.Stderr, "usage: agentnet ask <room> <message> [--timeout 60s] [--json]")
+		os.Exit(1)
+	}
+
+	data, _ := json.Marshal(map[string]interface{}{
+		"room":       words[0],
+		"text":       strings.Join(words[1:], " "),
+		"timeout_ms": timeout.Milliseconds(),
+	})
+	req := newRequest("POST", "/ask", strings.NewReader(string(data)))
+	req.Header.Set("Content-Type", "application/json")
+	if requestTimeout > 0 {
+		timeout += requestTimeout // the wait itself, plus the usual allowance
+	}
+	resp, err := apiClient(timeout).Do(req)
+	if err != nil {
+		requestFailed(err, timeout)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= 400 {
+		failResponse(resp.StatusCode, body)
+	}
+	if asJSON {
+		os.Stdout.Write(body)
+		fmt.Println()
+		return
+	}
+	var out struct {
+		Reply client.IncomingMessage `json:"reply"`
+	}
+	json.Unmarshal(body, &out)
+	if out.Reply.Raw != nil {
+		os.Stdout.Write(out.Reply.Raw)
+		fmt.Println()
+		return
+	}
+	fmt.Println(out.Reply.Text)
+}
+
+// runExport writes a room's full history to a file (or stdout) as JSON or CSV.
+func runExport(args []string) {
+	room, format, out := "", "json", ""
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--format" && i+1 < len(args):
+			format = args[i+1]
+			i++
+		case args[i] == "--output" && i+1 < len(args):
+			out = args[i+1]
+			i++
+		case room == "":
+			room = args[i]
+		}
+	}
+	if room == "" || (format != "json" && format != "csv") {
+		fmt.Fprintln(os.Stderr, "usage: agentnet export <room> [--format json|csv] [--output FILE]")
+		os.Exit(1)
+	}
+
+	q := url.Values{}
+	q.Set("room", room)
+	q.Set("format", format)
+	resp, err := apiClient(0).Do(newRequest("GET", "/export?"+q.Encode(), nil))
+	if err != nil {
+		requestFailed(err, 0)
+	}
+	defer resp.Body.Close()
+	checkResponse(resp)
+
+	w := io.Writer(os.Stdout)
+	if out != "" {
+		f, err := os.Create(out)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		w = f
+	}
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		fmt.Fprintf(os.Stderr, "error: export interrupted: %v\n", err)
+		os.Exit(1)
+	}
+	// Trailers are only available once the body has been read.
+	if msg := resp.Trailer.Get("X-Export-Error"); msg != "" {
+		fmt.Fprintf(os.Stderr, "error: export incomplete after %s messages: %s\n", resp.Trailer.Get("X-Export-Count"), msg)
+		os.Exit(1)
+	}
+	if out != "" {
+		fmt.Fprintf(os.Stderr, "exported %s messages to %s\n", resp.Trailer.Get("X-Export-Count"), out)
+	}
+}
+
+// runLogs prints the tail of the daemon's log file and, with --follow, keeps
+// printing new lines until interrupted.
+func runLogs(args []string) {
+	q := url.Values{}
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--follow" || args[i] == "-f":
+			q.Set("follow", "true")
+		case args[i] == "--lines" && i+1 < len(args):
+			q.Set("lines", args[i+1])
+			i++
+		default:
+			fmt.Fprintln(os.Stderr, "usage: agentnet logs [--follow] [--lines N]")
+			os.Exit(1)
+		}
+	}
+	path := "/logs"
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+	resp, err := apiClient(0).Do(newRequest("GET", path, nil))
+	if err != nil {
+		requestFailed(err, 0)
+	}
+	defer resp.Body.Close()
+	checkResponse(resp)
+	io.Copy(os.Stdout, resp.Body)
+}
+
+// doctorCheck mirrors a check in the daemon's /diagnostics response.
+type doctorCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+	Hint   string `json:"hint"`
+}
+
+// runDoctor prints a pass/fail checklist covering the daemon, the API token
+// and the daemon's own diagnostics, with a hint for each problem, and exits 1
+// if anything failed.
+func runDoctor() {
+	checks := []doctorCheck{{Name: "daemon", Status: "pass", Detail: "reachable at " + apiURL()}}
+	resp, err := apiClient(requestTimeout).Do(newRequest("GET", "/diagnostics", nil))
+	if err != nil {
+		checks[0] = doctorCheck{Name: "daemon", Status: "fail", Detail: err.Error(),
+			Hint: "start it with: agentnet daemon (or check AGENTNET_API)"}
+		printChecks(checks)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode == http.StatusUnauthorized {
+		checks = append(checks, doctorCheck{Name: "token", Status: "fail", Detail: "the daemon rejected the API token",
+			Hint: "check AGENTNET_TOKEN or ~/.agentnet/api.token (the daemon writes a new one on each start)"})
+		printChecks(checks)
+		os.Exit(1)
+	}
+	checks = append(checks, doctorCheck{Name: "token", Status: "pass", Detail: "accepted"})
+	if resp.StatusCode >= 400 {
+		failResponse(resp.StatusCode, body)
+	}
+
+	var diag struct {
+		OK     bool          `json:"ok"`
+		Checks []doctorCheck `json:"checks"`
+	}
+	if err := json.Unmarshal(body, &diag); err != nil {
+		fmt.Fprintf(os.Stderr, "error: unexpected response: %v\n", err)
+		os.Exit(1)
+	}
+	printChecks(append(checks, diag.Checks...))
+	if !diag.OK {
+		os.Exit(1)
+	}
+}
+
+// printChecks prints one line per check, with any hint indented beneath.
+func printChecks(checks []doctorCheck) {
+	marks := map[string]string{"pass": "✓", "warn": "!", "fail": "✗", "skip": "-"}
+	for _, c := range checks {
+		mark := marks[c.Status]
+		if mark == "" {
+			mark = "?"
+		}
+		fmt.Printf("%s %-16s %s\n", mark, c.Name, c.Detail)
+		if c.Hint != "" && c.Status != "pass" {
+			fmt.Printf("  %-16s → %s\n", "", c.Hint)
+		}
+	}
+}
+
+// streamOnce prints server-sent messages until the stream ends.
+func streamOnce(path string, asJSON bool) error {
+	resp, err := apiClient(0).Do(newRequest("GET", path, nil))
 	if err != nil {
-		return "", err
+		return err
 	}
 	defer resp.Body.Close()
-	var rel struct {
-		TagName string `json:"tag_name"`
+	if resp.StatusCode == 401 {
+		fmt.Fprintln(os.Stderr, "error: unauthorized (check AGENTNET_TOKEN or ~/.agentnet/api.token)")
+		os.Exit(1)
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("daemon: %s", errorMessage(body))
+	}
+
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	for sc.Scan() {
+		data, ok := strings.CutPrefix(sc.Text(), "data: ")
+		if !ok {
+			continue // keepalive or blank separator
+		}
+		if asJSON {
+			fmt.Println(data)
+			continue
+		}
+		var m client.IncomingMessage
+		if err := json.Unmarshal([]byte(data), &m); err != nil {
+			continue
+		}
+		fmt.Println(formatMessage(m))
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("stream closed")
+}
+
+// formatMessage renders a message as "[time] room name: text".
+func formatMessage(m client.IncomingMessage) string {
+	ts := time.UnixMilli(m.Timestamp).UTC().Format("2006-01-02 15:04:05")
+	name := m.FromName
+	if name == "" {
+		name = m.From
+	}
+	switch m.Type {
+	case "message.edit":
+		return fmt.Sprintf("[%s] %s %s: (edited %s) %s", ts, m.Room, name, m.MessageID, m.Text)
+	case "message.delete":
+		return fmt.Sprintf("[%s] %s %s: (deleted %s)", ts, m.Room, name, m.MessageID)
+	}
+	text := m.Text
+	if m.Raw != nil {
+		text = string(m.Raw)
+	}
+	return fmt.Sprintf("[%s] %s %s: %s", ts, m.Room, name, text)
+}
+
+// runBulkJoin joins the rooms listed in file, one per line with an optional
+// invite token after the name ("#" starts a comment), and those carrying all
+// of tags.
+func runBulkJoin(file string, tags []string) {
+	rooms := []map[string]string{}
+	if file != "" {
+		f, err := os.Open(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+				continue
+			}
+			room := map[string]string{"room": fields[0]}
+			if len(fields) > 1 && !strings.HasPrefix(fields[1], "#") {
+				room["token"] = fields[1]
+			}
+			rooms = append(rooms, room)
+		}
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s: %v\n", file, err)
+			os.Exit(1)
+		}
+		if len(rooms) == 0 && len(tags) == 0 {
+			fmt.Fprintf(os.Stderr, "error: %s lists no rooms\n", file)
+			os.Exit(1)
+		}
+	}
+	// Each join may solve a proof-of-work challenge, so no single-request
+	// allowance fits; wait for the daemon however long it takes.
+	requestTimeout = 0
+	post("/rooms/join/bulk", map[string]interface{}{"rooms": rooms, "tags": tags})
+}
+
+// runKeygen creates a keypair without starting the daemon or connecting
+// anywhere, and prints its agent ID; with --phrase its backup phrase too.
+// --force replaces an existing key, after
+// confirmation (--yes when not at a terminal); the old one is kept as a
+// backup, as by rotate-key.
+func runKeygen() {
+	path := filepath.Join(dataDir(), "agent.key")
+	var force, yes, withPhrase bool
+	for i := 2; i < len(os.Args); i++ {
+		switch {
+		case os.Args[i] == "--out" && i+1 < len(os.Args):
+			path = os.Args[i+1]
+			i++
+		case os.Args[i] == "--force":
+			force = true
+		case os.Args[i] == "--yes":
+			yes = true
+		case os.Args[i] == "--phrase":
+			withPhrase = true
+		default:
+			fmt.Fprintln(os.Stderr, "usage: agentnet keygen [--out PATH] [--phrase] [--force [--yes]]")
+			os.Exit(1)
+		}
+	}
+
+	var keys *keystore.Keys
+	var phrase string
+	var err error
+	if withPhrase {
+		keys, phrase, err = keystore.CreateWithMnemonic(path)
+	} else {
+		keys, err = keystore.Create(path)
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&rel); err != nil {
-		return "", err
+	if errors.Is(err, keystore.ErrKeyExists) {
+		old, loadErr := keystore.Load(path)
+		oldID := "unreadable"
+		if loadErr == nil {
+			oldID = old.AgentID()
+		}
+		if !force {
+			fmt.Fprintf(os.Stderr, "error: %s already holds a key (agent ID %s); --force replaces it\n", path, oldID)
+			os.Exit(1)
+		}
+		if !yes && !confirm(fmt.Sprintf("Replace the key in %s (agent ID %s)? Allowlists and rooms tied to that ID stop applying.", path, oldID)) {
+			fmt.Fprintln(os.Stderr, "error: not replaced (pass --yes to confirm when not at a terminal)")
+			os.Exit(1)
+		}
+		keys, err = keystore.Rotate(path)
+		if err == nil && withPhrase {
+			phrase = keystore.MnemonicFor(keys)
+		}
+		if err == nil {
+			fmt.Fprintf(os.Stderr, "old key kept as %s.bak-<time>; restart any daemon using it (or use rotate-key, which reconnects)\n", path)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("agent_id    %s\n", keys.AgentID())
+	fmt.Printf("public_key  %x\n", []byte(keys.PublicKey))
+	fmt.Printf("key_file    %s\n", path)
+	if phrase != "" {
+		fmt.Printf("phrase      %s\n", phrase)
+		fmt.Fprintln(os.Stderr, "⚠ the phrase is your private key: write it down offline (agentnet key phrase shows it again)")
 	}
-	return strings.TrimPrefix(rel.TagName, "v"), nil
+}
+
+// runKey exports the agent key for another machine (key export), or
+// installs one exported there (key import). The passphrase that encrypts an
+// export comes from --passphrase-file or AGENTNET_KEY_PASSPHRASE. key phrase
+// and key restore do the same with a backup phrase.
+func runKey() {
+	path := filepath.Join(dataDir(), "agent.key")
+	if len(os.Args) > 2 {
+		switch os.Args[2] {
+		case "phrase":
+			runKeyPhrase(path)
+			return
+		case "restore":
+			runKeyRestore(path)
+			return
+		}
+	}
+	var sub, out, file, passphraseFile string
+	var force bool
+	for i := 2; i < len(os.Args); i++ {
+		switch a := os.Args[i]; {
+		case a == "--out" && i+1 < len(os.Args):
+			out = os.Args[i+1]
+			i++
+		case a == "--passphrase-file" && i+1 < len(os.Args):
+			passphraseFile = os.Args[i+1]
+			i++
+		case a == "--force":
+			force = true
+		case sub == "":
+			sub = a
+		case file == "":
+			file = a
+		default:
+			sub = "" // extra argument: show usage
+			i = len(os.Args)
+		}
+	}
+	if !(sub == "export" && file == "") && !(sub == "import" && file != "" && out == "") {
+		fmt.Fprintln(os.Stderr, "usage: agentnet key export [--out FILE] [--passphrase-file F]")
+		fmt.Fprintln(os.Stderr, "       agentnet key import FILE [--force] [--passphrase-file F]")
+		os.Exit(1)
+	}
+
+	passphrase := os.Getenv("AGENTNET_KEY_PASSPHRASE")
+	if passphraseFile != "" {
+		data, err := os.ReadFile(passphraseFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		passphrase = strings.TrimRight(string(data), "\r\n")
+	}
+
+	if sub == "export" {
+		keys, err := keystore.Load(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		data, err := keystore.Export(keys, passphrase)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		if passphrase == "" {
+			fmt.Fprintln(os.Stderr, "⚠ not encrypted: anyone with this export can act as your agent (set AGENTNET_KEY_PASSPHRASE or --passphrase-file to encrypt it)")
+		}
+		if out == "" {
+			os.Stdout.Write(data)
+			return
+		}
+		if err := os.WriteFile(out, data, 0600); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "agent %s exported to %s — keep it secret\n", keys.AgentID(), out)
+		return
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	keys, err := keystore.Import(path, data, passphrase, force)
+	switch {
+	case errors.Is(err, keystore.ErrKeyExists):
+		fmt.Fprintf(os.Stderr, "error: %v; --force replaces it (the old key is kept as a backup)\n", err)
+		os.Exit(1)
+	case errors.Is(err, keystore.ErrPassphraseRequired):
+		fmt.Fprintf(os.Stderr, "error: %v; set AGENTNET_KEY_PASSPHRASE or pass --passphrase-file\n", err)
+		os.Exit(1)
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("agent_id    %s\n", keys.AgentID())
+	fmt.Printf("key_file    %s\n", path)
+	fmt.Fprintln(os.Stderr, "restart the daemon to use it; delete the export file if you no longer need it")
+}
+
+// runKeyPhrase prints the backup phrase of the key at path.
+func runKeyPhrase(path string) {
+	if len(os.Args) != 3 {
+		fmt.Fprintln(os.Stderr, "usage: agentnet key phrase")
+		os.Exit(1)
+	}
+	phrase, err := keystore.Mnemonic(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Fprintln(os.Stderr, "⚠ SECRET: these words are your private key. Write them down offline; anyone who has them can act as this agent.")
+	fmt.Println(phrase)
+}
+
+// runKeyRestore installs the key for a backup phrase given as arguments or,
+// to keep it out of shell history, on stdin.
+func runKeyRestore(path string) {
+	var words []string
+	var force bool
+	for _, a := range os.Args[3:] {
+		if a == "--force" {
+			force = true
+		} else {
+			words = append(words, a)
+		}
+	}
+	if len(words) == 0 {
+		if isTerminal(os.Stdin) {
+			fmt.Fprintf(os.Stderr, "Enter the %d-word phrase: ", keystore.MnemonicWords)
+		}
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		words = strings.Fields(string(data))
+	}
+	keys, err := keystore.Restore(path, strings.Join(words, " "), force)
+	if errors.Is(err, keystore.ErrKeyExists) {
+		fmt.Fprintf(os.Stderr, "error: %v; --force replaces it (the old key is kept as a backup)\n", err)
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("agent_id    %s\n", keys.AgentID())
+	fmt.Printf("key_file    %s\n", path)
+	fmt.Fprintln(os.Stderr, "restart the daemon to use it")
+}
+
+// confirm asks question on a terminal and reports whether the answer was
+// yes. Without a terminal it is always no.
+func confirm(question string) bool {
+	if !isTerminal(os.Stdin) {
+		return false
+	}
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// runSignVector reads a JSON object on stdin and prints the canonical bytes
+// its signature covers and the signature, made with the public RFC 8032 test
+// key unless --seed HEX gives another.
+func runSignVector() {
+	priv := client.TestVectorKey()
+	switch {
+	case len(os.Args) == 4 && os.Args[2] == "--seed":
+		seed, err := hex.DecodeString(os.Args[3])
+		if err != nil || len(seed) != ed25519.SeedSize {
+			fmt.Fprintln(os.Stderr, "error: --seed must be 64 hex digits")
+			os.Exit(1)
+		}
+		priv = ed25519.NewKeyFromSeed(seed)
+	case len(os.Args) != 2:
+		fmt.Fprintln(os.Stderr, "usage: agentnet sign-vector [--seed HEX] < message.json")
+		os.Exit(1)
+	}
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	canonical, sig, err := client.SigningVector(data, priv)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("public_key     %s\n", base58.Encode(priv.Public().(ed25519.PublicKey)))
+	fmt.Printf("canonical      %s\n", canonical)
+	fmt.Printf("canonical_hex  %x\n", canonical)
+	fmt.Printf("signature      %s\n", sig)
 }
 
 func runVersion() {
 	current := strings.TrimPrefix(version, "v")
 	fmt.Printf("agentnet %s\n", current)
-	latest, err := latestVersion()
+	if os.Getenv("AGENTNET_NO_UPDATE_CHECK") == "1" {
+		return
+	}
+	latest, _, err := update.Latest(dataDir(), "agentnet-cli/"+version)
 	if err != nil {
 		fmt.Printf("latest: (could not check: %v)\n", err)
 		return
@@ -156,23 +1283,199 @@ func runDaemon() {
 	// Do NOT fall back to hostname — it leaks server identity.
 	// Default will be set to "agent-<short_id>" after key is loaded.
 
-	dataDir := os.Getenv("AGENTNET_DATA_DIR")
-	if dataDir == "" {
-		home, _ := os.UserHomeDir()
-		dataDir = filepath.Join(home, ".agentnet")
-	}
-
 	addr := os.Getenv("AGENTNET_API")
 	if addr == "" {
 		addr = "127.0.0.1:9900"
 	}
 
+	var identities []string
+	for _, id := range strings.Split(os.Getenv("AGENTNET_IDENTITIES"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			identities = append(identities, id)
+		}
+	}
+
+	var sendRate float64
+	switch v := os.Getenv("AGENTNET_RATE_LIMIT"); v {
+	case "":
+	case "off", "0":
+		sendRate = -1
+	default:
+		r, err := strconv.ParseFloat(v, 64)
+		if err != nil || r < 0 {
+			fmt.Fprintf(os.Stderr, "error: invalid AGENTNET_RATE_LIMIT %q\n", v)
+			os.Exit(1)
+		}
+		sendRate = r
+	}
+	var sendBurst int
+	if v := os.Getenv("AGENTNET_RATE_BURST"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			fmt.Fprintf(os.Stderr, "error: invalid AGENTNET_RATE_BURST %q (must be a positive integer)\n", v)
+			os.Exit(1)
+		}
+		sendBurst = n
+	}
+
+	var bufferSize int
+	if v := os.Getenv("AGENTNET_BUFFER_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			fmt.Fprintf(os.Stderr, "error: invalid AGENTNET_BUFFER_SIZE %q (must be a positive integer)\n", v)
+			os.Exit(1)
+		}
+		bufferSize = n
+	}
+
+	var pingInterval time.Duration
+	if v := os.Getenv("AGENTNET_PING_INTERVAL"); v != "" {
+		iv, err := time.ParseDuration(v)
+		if err != nil || iv < time.Second {
+			fmt.Fprintf(os.Stderr, "error: invalid AGENTNET_PING_INTERVAL %q (must be a duration of at least 1s, e.g. 15s)\n", v)
+			os.Exit(1)
+		}
+		pingInterval = iv
+	}
+
+	var messageTTL time.Duration
+	if v := os.Getenv("AGENTNET_MESSAGE_TTL"); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil || ttl < 0 {
+			fmt.Fprintf(os.Stderr, "error: invalid AGENTNET_MESSAGE_TTL %q (must be a duration, e.g. 24h)\n", v)
+			os.Exit(1)
+		}
+		messageTTL = ttl
+	}
+
+	var idleRoomTimeout time.Duration
+	if v := os.Getenv("AGENTNET_IDLE_ROOM_TIMEOUT"); v != "" {
+		timeout, err := time.ParseDuration(v)
+		if err != nil || timeout < 0 || timeout > 0 && timeout < daemon.MinIdleRoomTimeout {
+			fmt.Fprintf(os.Stderr, "error: invalid AGENTNET_IDLE_ROOM_TIMEOUT %q (must be a duration of at least %s, e.g. 6h)\n", v, daemon.MinIdleRoomTimeout)
+			os.Exit(1)
+		}
+		idleRoomTimeout = timeout
+	}
+
+	var maxMessageSize int
+	if v := os.Getenv("AGENTNET_MESSAGE_LIMIT"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			fmt.Fprintf(os.Stderr, "error: invalid AGENTNET_MESSAGE_LIMIT %q (must be a positive number of bytes)\n", v)
+			os.Exit(1)
+		}
+		maxMessageSize = n
+	}
+
+	var outboxSize int
+	if v := os.Getenv("AGENTNET_OUTBOX_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			fmt.Fprintf(os.Stderr, "error: invalid AGENTNET_OUTBOX_SIZE %q (must be a number of messages, 0 disables)\n", v)
+			os.Exit(1)
+		}
+		outboxSize = n
+	}
+
+	var maxRooms int
+	if v := os.Getenv("AGENTNET_MAX_ROOMS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			fmt.Fprintf(os.Stderr, "error: invalid AGENTNET_MAX_ROOMS %q (must be a number of rooms, 0 for no limit)\n", v)
+			os.Exit(1)
+		}
+		maxRooms = n
+	}
+
+	var maxPoWDifficulty int
+	if v := os.Getenv("AGENTNET_MAX_POW_DIFFICULTY"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 256 {
+			fmt.Fprintf(os.Stderr, "error: invalid AGENTNET_MAX_POW_DIFFICULTY %q (must be 1-256 leading zero bits)\n", v)
+			os.Exit(1)
+		}
+		maxPoWDifficulty = n
+	}
+
+	var maxReconnectAttempts int
+	if v := os.Getenv("AGENTNET_MAX_RECONNECT_ATTEMPTS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			fmt.Fprintf(os.Stderr, "error: invalid AGENTNET_MAX_RECONNECT_ATTEMPTS %q (must be a non-negative number; 0 retries forever)\n", v)
+			os.Exit(1)
+		}
+		maxReconnectAttempts = n
+	}
+
+	pidFile := filepath.Join(dataDir(), "daemon.pid")
+	switch v := os.Getenv("AGENTNET_PID_FILE"); v {
+	case "":
+	case "off":
+		pidFile = ""
+	default:
+		pidFile = v
+	}
+
+	// AGENTNET_RELAY_HEADER_X_API_KEY=v sends "X-Api-Key: v" to the relay.
+	relayHeaders := map[string]string{}
+	for _, kv := range os.Environ() {
+		name, value, _ := strings.Cut(kv, "=")
+		if h, ok := strings.CutPrefix(name, "AGENTNET_RELAY_HEADER_"); ok && h != "" {
+			relayHeaders[strings.ReplaceAll(h, "_", "-")] = value
+		}
+	}
+
 	d := daemon.New(daemon.Config{
 		ListenAddr: addr,
 		RelayURL:   relay,
 		AgentName:  name,
-		DataDir:    dataDir,
+		DataDir:    dataDir(),
 		Version:    version,
+		Identities: identities,
+
+		SendRate:        sendRate,
+		SendBurst:       sendBurst,
+		SendRatePerRoom: os.Getenv("AGENTNET_RATE_PER_ROOM") == "1",
+
+		TLSCert:     os.Getenv("AGENTNET_TLS_CERT"),
+		TLSKey:      os.Getenv("AGENTNET_TLS_KEY"),
+		TLSClientCA: os.Getenv("AGENTNET_TLS_CLIENT_CA"),
+
+		MessageBufferSize: bufferSize,
+		ReadOnly:          os.Getenv("AGENTNET_READ_ONLY") == "1",
+		WebhookURL:        os.Getenv("AGENTNET_WEBHOOK_URL"),
+		WebhookSecret:     os.Getenv("AGENTNET_WEBHOOK_SECRET"),
+		APIToken:          os.Getenv("AGENTNET_TOKEN"),
+		TokenPath:         os.Getenv("AGENTNET_TOKEN_FILE"),
+		StableToken:       os.Getenv("AGENTNET_STABLE_TOKEN") == "1",
+		PingInterval:      pingInterval,
+		Compression:       os.Getenv("AGENTNET_COMPRESSION") == "1",
+		MaxMessageSize:    maxMessageSize,
+
+		DisableUpdateCheck: os.Getenv("AGENTNET_NO_UPDATE_CHECK") == "1",
+		LogToFile:          os.Getenv("AGENTNET_LOG_FILE") == "1",
+
+		QueueWhileDisconnected: os.Getenv("AGENTNET_QUEUE_WHILE_DISCONNECTED") == "1",
+		OutboundQueueSize:      outboxSize,
+
+		RelayHeaders: relayHeaders,
+		Proxy:        os.Getenv("AGENTNET_PROXY"),
+		MaxRooms:     maxRooms,
+
+		MaxPoWDifficulty: maxPoWDifficulty,
+		OrderedSends:     os.Getenv("AGENTNET_ORDERED_SENDS") == "1",
+
+		MaxReconnectAttempts:     maxReconnectAttempts,
+		ExitOnReconnectExhausted: os.Getenv("AGENTNET_EXIT_ON_RECONNECT_EXHAUSTED") == "1",
+
+		MessageTTL:      messageTTL,
+		IdleRoomTimeout: idleRoomTimeout,
+
+		PIDFile: pidFile,
+
+		SendReceipts:     os.Getenv("AGENTNET_SEND_RECEIPTS") == "1",
+		VerifySignatures: os.Getenv("AGENTNET_VERIFY_SIGNATURES") == "1",
 	})
 
 	if err := d.Start(); err != nil {
@@ -181,16 +1484,174 @@ func runDaemon() {
 	}
 }
 
+// readMessage reads a message body from r for send - / --stdin, keeping its
+// newlines but dropping the one a pipe usually ends with.
+func readMessage(r io.Reader) string {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: read stdin: %v\n", err)
+		os.Exit(1)
+	}
+	text := strings.TrimSuffix(strings.TrimSuffix(string(data), "\n"), "\r")
+	if strings.TrimSpace(text) == "" {
+		fmt.Fprintln(os.Stderr, "error: no message on stdin")
+		os.Exit(1)
+	}
+	return text
+}
+
+func dataDir() string {
+	dir := os.Getenv("AGENTNET_DATA_DIR")
+	if dir == "" {
+		home, _ := os.UserHomeDir()
+		dir = filepath.Join(home, ".agentnet")
+	}
+	return dir
+}
+
 func apiURL() string {
 	base := os.Getenv("AGENTNET_API_URL")
 	if base != "" {
 		return base
 	}
 	addr := os.Getenv("AGENTNET_API")
+	if strings.HasPrefix(addr, "unix:") {
+		// Host is ignored; apiClient dials the socket.
+		return "http://unix"
+	}
+	if addr == "" || strings.HasSuffix(addr, ":0") {
+		// The daemon records where it listens, including an OS-assigned port.
+		if data, err := os.ReadFile(filepath.Join(dataDir(), "api.addr")); err == nil {
+			addr = strings.TrimSpace(string(data))
+		} else if addr != "" {
+			addr = ""
+		}
+	}
+	scheme := "http://"
+	if apiTLS() {
+		scheme = "https://"
+	}
 	if addr != "" {
-		return "http://" + addr
+		return scheme + addr
+	}
+	return strings.Replace(defaultAPI, "http://", scheme, 1)
+}
+
+// apiTLS reports whether the CLI should talk HTTPS to the daemon.
+func apiTLS() bool {
+	return os.Getenv("AGENTNET_API_CA") != "" || os.Getenv("AGENTNET_API_CERT") != ""
+}
+
+// apiSocket returns the Unix socket path when AGENTNET_API is "unix:/path"
+// (or bare "unix:" for DataDir/api.sock), else "".
+func apiSocket() string {
+	addr := os.Getenv("AGENTNET_API")
+	if !strings.HasPrefix(addr, "unix:") {
+		return ""
+	}
+	if path := strings.TrimPrefix(addr, "unix:"); path != "" {
+		return path
+	}
+	return filepath.Join(dataDir(), "api.sock")
+}
+
+// apiClient returns an HTTP client for the daemon API, dialing the Unix
+// socket when one is configured. A call, including reading the response body,
+// fails after timeout (0 = never, for streams).
+func apiClient(timeout time.Duration) *http.Client {
+	sock := apiSocket()
+	if sock == "" && !apiTLS() {
+		return &http.Client{Timeout: timeout}
+	}
+	tr := &http.Transport{}
+	if sock != "" {
+		tr.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", sock)
+		}
+	}
+	if apiTLS() {
+		cfg, err := apiTLSConfig()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: tls: %v\n", err)
+			os.Exit(1)
+		}
+		tr.TLSClientConfig = cfg
+	}
+	return &http.Client{Transport: tr, Timeout: timeout}
+}
+
+// defaultCLITimeout bounds each daemon API call unless AGENTNET_CLI_TIMEOUT
+// says otherwise.
+const defaultCLITimeout = 30 * time.Second
+
+// slowCommands may legitimately outlast the usual timeout: creating, joining
+// or updating a room can mean solving a proof-of-work challenge, reconnect
+// waits for the new connection, and doctor waits on several network checks.
+var slowCommands = map[string]time.Duration{
+	"create":    client.PoWTimeout + defaultCLITimeout,
+	"join":      client.PoWTimeout + defaultCLITimeout,
+	"topic":     client.PoWTimeout + defaultCLITimeout,
+	"tags":      client.PoWTimeout + defaultCLITimeout,
+	"reconnect": daemon.ReconnectWait + defaultCLITimeout,
+	"doctor":    time.Minute,
+}
+
+// requestTimeout bounds each daemon API call made by the current command.
+var requestTimeout = defaultCLITimeout
+
+// cliTimeout returns the request timeout for cmd: AGENTNET_CLI_TIMEOUT
+// (0 disables it) or defaultCLITimeout, raised for slowCommands.
+func cliTimeout(cmd string) (time.Duration, error) {
+	timeout := defaultCLITimeout
+	if v := os.Getenv("AGENTNET_CLI_TIMEOUT"); v != "" {
+		t, err := time.ParseDuration(v)
+		if err != nil || t < 0 {
+			return 0, fmt.Errorf("AGENTNET_CLI_TIMEOUT must be a duration such as 30s or 2m (0 to disable), got %q", v)
+		}
+		if t == 0 {
+			return 0, nil
+		}
+		timeout = t
 	}
-	return defaultAPI
+	return max(timeout, slowCommands[cmd]), nil
+}
+
+// requestFailed reports a daemon API call that got no (complete) response and
+// exits.
+func requestFailed(err error, timeout time.Duration) {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() && timeout > 0 {
+		fmt.Fprintf(os.Stderr, "error: daemon not responding after %s (set AGENTNET_CLI_TIMEOUT to wait longer)\n", timeout)
+	} else {
+		fmt.Fprintf(os.Stderr, "error: %v (is daemon running?)\n", err)
+	}
+	os.Exit(1)
+}
+
+// apiTLSConfig trusts AGENTNET_API_CA for the daemon's certificate and
+// presents AGENTNET_API_CERT/AGENTNET_API_KEY when the daemon requires mutual TLS.
+func apiTLSConfig() (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if ca := os.Getenv("AGENTNET_API_CA"); ca != "" {
+		pem, err := os.ReadFile(ca)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: no certificates found", ca)
+		}
+		cfg.RootCAs = pool
+	}
+	if certFile := os.Getenv("AGENTNET_API_CERT"); certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, os.Getenv("AGENTNET_API_KEY"))
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
 }
 
 func apiToken() string {
@@ -199,76 +1660,128 @@ func apiToken() string {
 		return t
 	}
 	// Read from file
-	dataDir := os.Getenv("AGENTNET_DATA_DIR")
-	if dataDir == "" {
-		home, _ := os.UserHomeDir()
-		dataDir = filepath.Join(home, ".agentnet")
+	path := os.Getenv("AGENTNET_TOKEN_FILE")
+	if path == "" {
+		path = filepath.Join(dataDir(), "api.token")
 	}
-	data, err := os.ReadFile(filepath.Join(dataDir, "api.token"))
+	data, err := os.ReadFile(path)
 	if err != nil {
 		return ""
 	}
 	return strings.TrimSpace(string(data))
 }
 
-func get(path string) {
-	req, _ := http.NewRequest("GET", apiURL()+path, nil)
+// newRequest builds an authenticated daemon API request, selecting the
+// identity named by AGENTNET_IDENTITY if set.
+func newRequest(method, path string, body io.Reader) *http.Request {
+	req, _ := http.NewRequest(method, apiURL()+path, body)
 	req.Header.Set("Authorization", "Bearer "+apiToken())
-	resp, err := http.DefaultClient.Do(req)
+	if id := os.Getenv("AGENTNET_IDENTITY"); id != "" {
+		req.Header.Set("X-Agent-Identity", id)
+	}
+	return req
+}
+
+func get(path string) {
+	os.Stdout.Write(getBody(path))
+	fmt.Println()
+}
+
+// getBody is like get but returns the response body instead of printing it.
+func getBody(path string) []byte {
+	req := newRequest("GET", path, nil)
+	resp, err := apiClient(requestTimeout).Do(req)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error: %v (is daemon running?)\n", err)
-		os.Exit(1)
+		requestFailed(err, requestTimeout)
 	}
 	defer resp.Body.Close()
-	if resp.StatusCode == 401 {
-		fmt.Fprintln(os.Stderr, "error: unauthorized (check AGENTNET_TOKEN or ~/.agentnet/api.token)")
-		os.Exit(1)
+	checkResponse(resp)
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		requestFailed(err, requestTimeout)
 	}
-	io.Copy(os.Stdout, resp.Body)
-	fmt.Println()
+	return data
 }
 
 // getText is like get but prints the response body as-is (for text/plain endpoints like /history).
-func getText(path string) {
-	req, _ := http.NewRequest("GET", apiURL()+path, nil)
-	req.Header.Set("Authorization", "Bearer "+apiToken())
-	resp, err := http.DefaultClient.Do(req)
+// It returns the X-Oldest-ID header so callers can page backward.
+func getText(path string) string {
+	req := newRequest("GET", path, nil)
+	resp, err := apiClient(requestTimeout).Do(req)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error: %v (is daemon running?)\n", err)
-		os.Exit(1)
+		requestFailed(err, requestTimeout)
 	}
 	defer resp.Body.Close()
-	if resp.StatusCode == 401 {
+	checkResponse(resp)
+	if _, err := io.Copy(os.Stdout, resp.Body); err != nil {
+		requestFailed(err, requestTimeout)
+	}
+	return resp.Header.Get("X-Oldest-ID")
+}
+
+// checkResponse exits with the daemon's error message if resp failed.
+func checkResponse(resp *http.Response) {
+	if resp.StatusCode < 400 {
+		return
+	}
+	body, _ := io.ReadAll(resp.Body)
+	failResponse(resp.StatusCode, body)
+}
+
+// failResponse prints a daemon error response and exits. Anything the body
+// carries besides the error, such as the IDs a partly failed batch did send,
+// is printed to stdout first.
+func failResponse(status int, body []byte) {
+	if status == http.StatusUnauthorized {
 		fmt.Fprintln(os.Stderr, "error: unauthorized (check AGENTNET_TOKEN or ~/.agentnet/api.token)")
 		os.Exit(1)
 	}
-	if resp.StatusCode >= 400 {
-		body, _ := io.ReadAll(resp.Body)
-		fmt.Fprintf(os.Stderr, "error: %s\n", strings.TrimSpace(string(body)))
-		os.Exit(1)
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(body, &fields) == nil && len(fields) > 1 {
+		os.Stdout.Write(body)
 	}
-	io.Copy(os.Stdout, resp.Body)
+	fmt.Fprintf(os.Stderr, "error: %s\n", errorMessage(body))
+	os.Exit(1)
+}
+
+// errorMessage formats a daemon error body, {"error":{"code":...,"message":...}},
+// as "message (code)". Other bodies are returned trimmed.
+func errorMessage(body []byte) string {
+	var resp struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &resp) != nil || resp.Error.Code == "" {
+		return strings.TrimSpace(string(body))
+	}
+	return resp.Error.Message + " (" + resp.Error.Code + ")"
 }
 
 func post(path string, body interface{}) {
+	os.Stdout.Write(postBody(path, body))
+	fmt.Println()
+}
+
+// postBody is like post but returns the response body instead of printing it.
+func postBody(path string, body interface{}) []byte {
 	var r io.Reader
 	if body != nil {
 		data, _ := json.Marshal(body)
 		r = strings.NewReader(string(data))
 	}
-	req, _ := http.NewRequest("POST", apiURL()+path, r)
+	req := newRequest("POST", path, r)
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+apiToken())
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := apiClient(requestTimeout).Do(req)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error: %v (is daemon running?)\n", err)
-		os.Exit(1)
+		requestFailed(err, requestTimeout)
 	}
 	defer resp.Body.Close()
-	if resp.StatusCode == 401 {
-		fmt.Fprintln(os.Stderr, "error: unauthorized (check AGENTNET_TOKEN or ~/.agentnet/api.token)")
-		os.Exit(1)
+	checkResponse(resp)
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		requestFailed(err, requestTimeout)
 	}
-	io.Copy(os.Stdout, resp.Body)
-	fmt.Println()
+	return data
 }
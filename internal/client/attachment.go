@@ -0,0 +1,92 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// Attachment limits.
+const (
+	// MaxInlineAttachment is the largest blob embedded in a message. Base64
+	// grows it by a third, so the message must also fit the size limit.
+	MaxInlineAttachment = 8 * 1024
+	MaxAttachmentName   = 255
+)
+
+// Attachment is a file shared in a message, carried inline (Data) or by
+// reference (URL) in content {"type":"attachment","name":...,"size":...}.
+type Attachment struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256,omitempty"` // hex digest of the content
+	URL    string `json:"url,omitempty"`    // where to fetch it, if not inline
+	Data   []byte `json:"data,omitempty"`   // inline content; base64 in JSON
+}
+
+// AttachmentContent builds the content object for sending data inline as an
+// attachment named name. Data over MaxInlineAttachment returns
+// ErrMessageTooLarge.
+func AttachmentContent(name string, data []byte) (map[string]interface{}, error) {
+	if name == "" || len(name) > MaxAttachmentName {
+		return nil, fmt.Errorf("attachment name required (at most %d bytes)", MaxAttachmentName)
+	}
+	if len(data) > MaxInlineAttachment {
+		return nil, fmt.Errorf("%w: attachment is %d bytes, inline limit is %d", ErrMessageTooLarge, len(data), MaxInlineAttachment)
+	}
+	sum := sha256.Sum256(data)
+	return map[string]interface{}{
+		"type":   "attachment",
+		"name":   name,
+		"size":   len(data),
+		"sha256": hex.EncodeToString(sum[:]),
+		"data":   base64.StdEncoding.EncodeToString(data),
+	}, nil
+}
+
+// SendAttachment sends data inline as an attachment named name and returns
+// the message ID. See AttachmentContent for the limits.
+func (c *Client) SendAttachment(room, name string, data []byte) (string, error) {
+	content, err := AttachmentContent(name, data)
+	if err != nil {
+		return "", err
+	}
+	return c.SendContent(room, content)
+}
+
+// parseAttachment decodes attachment content, or returns nil if it is
+// malformed: no name, neither data nor URL, or inline data that doesn't match
+// its declared size or digest.
+func parseAttachment(content json.RawMessage) *Attachment {
+	var raw struct {
+		Name   string `json:"name"`
+		Size   int64  `json:"size"`
+		SHA256 string `json:"sha256"`
+		URL    string `json:"url"`
+		Data   string `json:"data"`
+	}
+	if json.Unmarshal(content, &raw) != nil || raw.Name == "" {
+		return nil
+	}
+	a := &Attachment{Name: raw.Name, Size: raw.Size, SHA256: raw.SHA256, URL: raw.URL}
+	if raw.Data == "" {
+		if a.URL == "" {
+			return nil
+		}
+		return a
+	}
+	data, err := base64.StdEncoding.DecodeString(raw.Data)
+	if err != nil || int64(len(data)) != raw.Size {
+		return nil
+	}
+	if raw.SHA256 != "" {
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != raw.SHA256 {
+			return nil
+		}
+	}
+	a.Data = data
+	return a
+}
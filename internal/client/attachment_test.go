@@ -0,0 +1,70 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestAttachmentContent_RoundTrip(t *testing.T) {
+	content, err := AttachmentContent("fix.diff", []byte("--- a\n+++ b\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := json.Marshal(content)
+	a := parseAttachment(raw)
+	if a == nil || a.Name != "fix.diff" || string(a.Data) != "--- a\n+++ b\n" || a.Size != 12 {
+		t.Fatalf("got %+v", a)
+	}
+}
+
+func TestAttachmentContent_Limits(t *testing.T) {
+	if _, err := AttachmentContent("big.bin", make([]byte, MaxInlineAttachment+1)); !errors.Is(err, ErrMessageTooLarge) {
+		t.Fatalf("expected ErrMessageTooLarge, got %v", err)
+	}
+	if _, err := AttachmentContent("", []byte("x")); err == nil {
+		t.Fatal("expected an error for a missing name")
+	}
+	// The largest inline attachment must still fit the default message limit.
+	content, _ := AttachmentContent(strings.Repeat("n", MaxAttachmentName), make([]byte, MaxInlineAttachment))
+	if err := validateContent(content, DefaultMaxMessageSize); err != nil {
+		t.Fatalf("largest inline attachment rejected: %v", err)
+	}
+}
+
+func TestParseAttachment_RejectsMismatches(t *testing.T) {
+	for name, content := range map[string]string{
+		"no name":      `{"type":"attachment","size":1,"data":"eA=="}`,
+		"no data":      `{"type":"attachment","name":"a","size":1}`,
+		"bad base64":   `{"type":"attachment","name":"a","size":1,"data":"!!"}`,
+		"wrong size":   `{"type":"attachment","name":"a","size":2,"data":"eA=="}`,
+		"wrong digest": `{"type":"attachment","name":"a","size":1,"sha256":"00","data":"eA=="}`,
+	} {
+		if a := parseAttachment(json.RawMessage(content)); a != nil {
+			t.Fatalf("%s: expected nil, got %+v", name, a)
+		}
+	}
+	a := parseAttachment(json.RawMessage(`{"type":"attachment","name":"log.txt","size":1048576,"url":"https://files.example.com/log.txt"}`))
+	if a == nil || a.URL == "" || a.Data != nil {
+		t.Fatalf("reference attachment: got %+v", a)
+	}
+}
+
+func TestReadLoop_SurfacesAttachment(t *testing.T) {
+	content, _ := AttachmentContent("notes.txt", []byte("hello"))
+	msg, _ := json.Marshal(map[string]interface{}{
+		"type": "message", "id": "m1", "room": "lab", "from": "peer", "content": content, "timestamp": 1,
+	})
+	c := pipeClient(t, func(ws *websocket.Conn) {
+		ws.WriteMessage(websocket.TextMessage, msg)
+		time.Sleep(100 * time.Millisecond)
+	})
+	in := <-c.Messages()
+	if in.Attachment == nil || string(in.Attachment.Data) != "hello" || in.Raw == nil {
+		t.Fatalf("got %+v", in)
+	}
+}
@@ -0,0 +1,56 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Optional relay features, as named in a welcome's capabilities.
+const (
+	FeatureEdit     = "edit"
+	FeatureDelete   = "delete"
+	FeaturePresence = "presence"
+	FeatureProfile  = "profile"
+	FeatureKick     = "kick"
+
+	FeatureRoomFilter = "room_filter" // rooms.list accepts filter "mine"
+)
+
+// ErrUnsupported is returned, before anything is sent, by operations the
+// relay's advertised capabilities leave out.
+var ErrUnsupported = errors.New("relay does not support this")
+
+// Capabilities is what a relay advertises in its welcome. Relays that
+// advertise no features list are assumed to support everything, and limits
+// they leave out are learned from errors.
+type Capabilities struct {
+	MaxMessageSize int      `json:"max_message_size,omitempty"` // largest message the relay accepts, in bytes
+	PoWDifficulty  int      `json:"pow_difficulty,omitempty"`   // proof-of-work asked for to create a room
+	Features       []string `json:"features"`                   // optional operations it accepts, e.g. FeatureEdit
+}
+
+// Capabilities returns what the relay advertised, and false if it said
+// nothing.
+func (c *Client) Capabilities() (Capabilities, bool) {
+	if c.capabilities == nil {
+		return Capabilities{}, false
+	}
+	return *c.capabilities, true
+}
+
+// supports reports whether the relay accepts feature, assuming it does
+// unless it advertised a features list without it. Capabilities with no
+// features list at all (only limits, say) say nothing about features.
+func (c *Client) supports(feature string) bool {
+	return c.capabilities == nil || c.capabilities.Features == nil || slices.Contains(c.capabilities.Features, feature)
+}
+
+// checkFeature returns ErrUnsupported, naming feature, if the relay doesn't
+// support it.
+func (c *Client) checkFeature(feature string) error {
+	if !c.supports(feature) {
+		return fmt.Errorf("%w: %s", ErrUnsupported, feature)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package client
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestCapabilities_FromWelcome(t *testing.T) {
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	idle := func(*http.Request, *websocket.Conn) { time.Sleep(100 * time.Millisecond) }
+
+	url := fakeRelay(t, map[string]interface{}{
+		"type": "welcome",
+		"capabilities": map[string]interface{}{
+			"max_message_size": 100,
+			"pow_difficulty":   12,
+			"features":         []string{FeatureEdit},
+		},
+	}, idle)
+	c, err := ConnectWithOptions(context.Background(), url, "a", "tester", priv, ConnectOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	caps, ok := c.Capabilities()
+	if !ok || caps.MaxMessageSize != 100 || caps.PoWDifficulty != 12 {
+		t.Fatalf("got %+v, %v", caps, ok)
+	}
+	if err := c.DeleteMessage("lab", "m1"); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("delete: expected ErrUnsupported, got %v", err)
+	}
+	if err := c.KickMember("lab", "mallory"); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("kick: expected ErrUnsupported, got %v", err)
+	}
+	if _, err := c.Presence([]string{"x"}); !errors.Is(err, ErrPresenceUnsupported) {
+		t.Fatalf("presence: expected ErrPresenceUnsupported, got %v", err)
+	}
+	if _, err := c.SendMessage("lab", strings.Repeat("x", 200)); !errors.Is(err, ErrMessageTooLarge) {
+		t.Fatalf("expected the relay's smaller size limit to apply, got %v", err)
+	}
+}
+
+func TestCapabilities_NoneAdvertised(t *testing.T) {
+	c := &Client{}
+	if _, ok := c.Capabilities(); ok {
+		t.Fatal("expected no capabilities")
+	}
+	if err := c.checkFeature(FeatureKick); err != nil {
+		t.Fatalf("a relay that advertises nothing is assumed to support everything: %v", err)
+	}
+	if c.messageLimit() != DefaultMaxMessageSize {
+		t.Fatalf("limit %d", c.messageLimit())
+	}
+}
+
+func TestCapabilities_LimitsWithoutFeatures(t *testing.T) {
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	idle := func(*http.Request, *websocket.Conn) { time.Sleep(100 * time.Millisecond) }
+
+	url := fakeRelay(t, map[string]interface{}{
+		"type":         "welcome",
+		"capabilities": map[string]interface{}{"max_message_size": 100},
+	}, idle)
+	c, err := ConnectWithOptions(context.Background(), url, "a", "tester", priv, ConnectOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if caps, ok := c.Capabilities(); !ok || caps.MaxMessageSize != 100 {
+		t.Fatalf("got %+v, %v", caps, ok)
+	}
+	for _, f := range []string{FeatureEdit, FeatureDelete, FeaturePresence, FeatureProfile, FeatureKick} {
+		if err := c.checkFeature(f); err != nil {
+			t.Fatalf("%s: a relay that lists no features should be assumed to support it: %v", f, err)
+		}
+	}
+
+	// An explicit empty list does mean none.
+	c.capabilities.Features = []string{}
+	if err := c.checkFeature(FeatureKick); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("empty feature list: got %v", err)
+	}
+}
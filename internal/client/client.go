@@ -1,14 +1,27 @@
 package client
 
 import (
+	"compress/flate"
+	"context"
 	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"slices"
 	"sort"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
 
 	"github.com/btcsuite/btcutil/base58"
 	"github.com/gorilla/websocket"
@@ -16,26 +29,127 @@ import (
 
 // Client is an AgentNet WebSocket client.
 type Client struct {
-	ws           *websocket.Conn
-	agentID      string
-	agentName    string
-	privKey      ed25519.PrivateKey
-	mu           sync.Mutex          // guards ws writes and closed
-	opMu         sync.Mutex          // serializes CreateRoom/JoinRoom/ListRooms
-	rooms        map[string]bool
-	msgCh        chan IncomingMessage
-	respCh       chan json.RawMessage // readLoop forwards non-message responses here
-	closed       bool
-	disconnected sync.WaitGroup     // Done when readLoop exits
+	ws             *websocket.Conn
+	agentID        string
+	agentName      string // guarded by mu; changed by SetName
+	privKey        ed25519.PrivateKey
+	mu             sync.Mutex // guards ws writes and closed
+	opMu           sync.Mutex // serializes operations awaiting a relay response; see lockOp
+	rooms          map[string]bool
+	msgCh          chan IncomingMessage
+	respCh         chan json.RawMessage // readLoop forwards non-message responses here
+	closed         bool
+	disconnected   sync.WaitGroup // Done when readLoop exits
+	revisions      map[string]int // last edit revision per message ID, guarded by mu
+	typingCh       chan TypingEvent
+	typingSent     map[string]time.Time         // last active typing event per room, guarded by mu
+	limiter        *RateLimiter                 // optional outgoing message limit
+	receiptLimiter *RateLimiter                 // optional limit on receipts, apart from sends
+	members        map[string]map[string]Member // room → agent ID → member, guarded by mu
+	roomKeys       map[string][]byte            // room → symmetric encryption key, guarded by mu
+	dropped        atomic.Int64                 // incoming messages/responses dropped on a full channel
+	dropLoggedAt   atomic.Int64                 // unix nanos of the last drop warning
+	readOnly       bool                         // refuse every operation that transmits
+	pingSentAt     atomic.Int64                 // unix nanos of the unanswered ping, 0 if none
+	lastRTT        atomic.Int64                 // nanoseconds from the last ping to its pong
+	lastPong       atomic.Int64                 // unix nanos of the last pong, 0 if none
+	errCh          chan RelayError              // unsolicited relay errors
+	awaiting       atomic.Int32                 // operations under lockOp, whose relay errors go to respCh
+	fatalErr       atomic.Pointer[RelayError]   // first fatal relay error, if any
+	disconnect     atomic.Pointer[Disconnect]   // how the connection ended; nil while up
+	pingInterval   time.Duration                // how often to ping; silence for twice this ends the connection
+	maxMessageSize int                          // 0 = DefaultMaxMessageSize
+	maxRooms       int                          // 0 = unlimited
+
+	presenceUnsupported atomic.Bool              // relay rejected a presence query as unknown
+	protocolVersion     string                   // negotiated in the handshake
+	replayUntil         map[string]int64         // room → when a replaying join was sent, guarded by mu
+	joinTokens          map[string]string        // room → invite token sent with every join, guarded by mu
+	outbox              *Outbox                  // optional queue for sends that fail to write, guarded by opMu
+	clockSkew           time.Duration            // local clock minus the relay's, measured in the handshake
+	clockSkewKnown      bool                     // the relay reported its time
+	maxPoWDifficulty    int                      // 0 = DefaultMaxPoWDifficulty
+	sendOrder           *sendOrder               // per-room FIFO for sends; nil unless SetOrderedSends
+	held                []json.RawMessage        // responses passed over by earlier operations, oldest first; guarded by opMu
+	capabilities        *Capabilities            // advertised in the welcome; nil if the relay said nothing
+	kicking             [2]string                // room and agent KickMember is waiting to see leave; guarded by mu
+	verifier            atomic.Pointer[Verifier] // checks inbound signatures; nil trusts the relay
+	unverified          atomic.Int64             // inbound messages dropped for a bad signature
+
+	roles map[string]string // room → this agent's role, if the relay said; guarded by mu
+
+	ackTracker *AckTracker // receipts for tracked sends; created on first use, guarded by mu
+}
+
+// ErrReadOnly is returned by write operations on a read-only client.
+// Nothing is sent to the relay.
+var ErrReadOnly = errors.New("read-only: client never sends")
+
+// DropLogInterval throttles the warning logged when incoming messages are dropped.
+const DropLogInterval = 10 * time.Second
+
+// TypingThrottle is the minimum interval between repeated active typing events for a room.
+const TypingThrottle = 3 * time.Second
+
+// TypingTTL is how long a typing indicator stays active without a refresh.
+const TypingTTL = 8 * time.Second
+
+// TypingEvent reports that an agent started or stopped composing a message.
+type TypingEvent struct {
+	Room      string `json:"room"`
+	From      string `json:"from"`
+	FromName  string `json:"from_name,omitempty"`
+	Active    bool   `json:"active"`
+	Timestamp int64  `json:"timestamp"`
 }
 
 // IncomingMessage is a message received from a room.
+// Edits and deletions arrive with Type set to "message.edit" or "message.delete"
+// and MessageID naming the affected message. ID and Timestamp are the
+// sender's, covered by its signature: the relay forwards the envelope with
+// only from_name and replayed added, and no ID or time of its own.
 type IncomingMessage struct {
+	ID        string `json:"id,omitempty"` // sender's random UUID; stable across replays
+	Type      string `json:"type,omitempty"`
 	Room      string `json:"room"`
 	From      string `json:"from"`
 	FromName  string `json:"from_name,omitempty"`
 	Text      string `json:"text"`
-	Timestamp int64  `json:"timestamp"`
+	Timestamp int64  `json:"timestamp"` // sender's signed Unix milliseconds, not the local receive time
+	MessageID string `json:"message_id,omitempty"`
+	Revision  int    `json:"revision,omitempty"`
+	InReplyTo string `json:"in_reply_to,omitempty"` // parent message ID for threaded replies
+	Encrypted bool   `json:"encrypted,omitempty"`   // decrypted with the room key
+	Replayed  bool   `json:"replayed,omitempty"`    // history replayed on join, not sent live
+	Mentioned bool   `json:"mentioned,omitempty"`   // text @-mentions this agent
+	Seq       int64  `json:"seq,omitempty"`         // daemon's arrival order, set when buffered
+	Received  int64  `json:"received,omitempty"`    // daemon's Unix milliseconds when buffered
+	// Attachment is set for well-formed "attachment" content.
+	Attachment *Attachment `json:"attachment,omitempty"`
+	// Raw holds the full content object for non-text content types.
+	Raw json.RawMessage `json:"raw,omitempty"`
+}
+
+// RelayError is an error response from the relay.
+type RelayError struct {
+	Code    string
+	Message string
+}
+
+func (e *RelayError) Error() string {
+	return e.Message
+}
+
+// fatalErrorCodes are relay error codes after which the session is over and
+// reconnecting with the same key will not help.
+var fatalErrorCodes = map[string]bool{
+	"BANNED":       true,
+	"AUTH_REVOKED": true,
+}
+
+// Fatal reports whether the relay has ended this agent's session for good.
+func (e *RelayError) Fatal() bool {
+	return fatalErrorCodes[e.Code]
 }
 
 // RoomInfo is returned from room operations.
@@ -44,35 +158,105 @@ type RoomInfo struct {
 	Topic   string   `json:"topic"`
 	Tags    []string `json:"tags"`
 	Members []Member `json:"members"`
+	MyRole  string   `json:"my_role,omitempty"` // this agent's role, e.g. RoleOwner; empty if unknown
 }
 
 // Member is a room member.
 type Member struct {
 	ID   string `json:"id"`
 	Name string `json:"name"`
+	Role string `json:"role,omitempty"` // RoleOwner, RoleModerator or RoleMember, if the relay says
 }
 
+// DefaultMessageBuffer is the incoming message channel capacity used by Connect.
+const DefaultMessageBuffer = 1000
+
 // Connect establishes a connection to an AgentNet relay.
 func Connect(url, agentID, agentName string, privKey ed25519.PrivateKey) (*Client, error) {
-	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+	return ConnectBuffered(url, agentID, agentName, privKey, DefaultMessageBuffer)
+}
+
+// ConnectBuffered is like Connect but buffers up to bufSize incoming messages
+// for a slow consumer before the read loop backs up.
+func ConnectBuffered(url, agentID, agentName string, privKey ed25519.PrivateKey, bufSize int) (*Client, error) {
+	return ConnectContext(context.Background(), url, agentID, agentName, privKey, bufSize)
+}
+
+// ConnectContext is like ConnectBuffered but gives up on dialing and the
+// handshake (including proof-of-work) when ctx is done.
+func ConnectContext(ctx context.Context, url, agentID, agentName string, privKey ed25519.PrivateKey, bufSize int) (*Client, error) {
+	return ConnectWithOptions(ctx, url, agentID, agentName, privKey, ConnectOptions{BufferSize: bufSize})
+}
+
+// DefaultPingInterval is how often the client pings the relay.
+const DefaultPingInterval = 25 * time.Second
+
+// ConnectOptions tunes a connection. Zero fields use the defaults.
+type ConnectOptions struct {
+	BufferSize int // incoming messages buffered for a slow consumer; 0 = DefaultMessageBuffer
+	// PingInterval is how often to ping the relay; 0 = DefaultPingInterval.
+	// A connection that delivers nothing, not even a pong, for twice this
+	// long is considered dead and closed.
+	PingInterval time.Duration
+	// Compression negotiates per-message deflate with the relay. It is
+	// transparent to signing, which covers the JSON before compression.
+	// Relays that don't support it fall back to uncompressed frames.
+	Compression bool
+	// Header is sent with the WebSocket upgrade request, e.g. the
+	// Authorization header an auth proxy in front of the relay requires.
+	Header http.Header
+	// Proxy is the proxy to reach the relay through, as for ProxyFunc: empty
+	// uses HTTPS_PROXY/ALL_PROXY from the environment, ProxyNone connects
+	// directly, or an http:// or socks5:// URL. An HTTP proxy must allow
+	// CONNECT to the relay's port (443 for wss://).
+	Proxy string
+	// MaxPoWDifficulty is the hardest proof-of-work challenge the client
+	// will attempt, in leading zero bits; 0 = DefaultMaxPoWDifficulty.
+	MaxPoWDifficulty int
+}
+
+// ConnectWithOptions is like ConnectContext with non-default options.
+func ConnectWithOptions(ctx context.Context, url, agentID, agentName string, privKey ed25519.PrivateKey, opts ConnectOptions) (*Client, error) {
+	bufSize := opts.BufferSize
+	if bufSize <= 0 {
+		bufSize = DefaultMessageBuffer
+	}
+	pingInterval := opts.PingInterval
+	if pingInterval <= 0 {
+		pingInterval = DefaultPingInterval
+	}
+	ws, err := dial(ctx, url, opts)
 	if err != nil {
-		return nil, fmt.Errorf("dial: %w", err)
+		return nil, err
 	}
 
 	c := &Client{
-		ws:        ws,
-		agentID:   agentID,
-		agentName: agentName,
-		privKey:   privKey,
-		rooms:     make(map[string]bool),
-		msgCh:     make(chan IncomingMessage, 1000),
-		respCh:    make(chan json.RawMessage, 4),
+		ws:         ws,
+		agentID:    agentID,
+		agentName:  agentName,
+		privKey:    privKey,
+		rooms:      make(map[string]bool),
+		revisions:  make(map[string]int),
+		members:    make(map[string]map[string]Member),
+		roomKeys:   make(map[string][]byte),
+		msgCh:      make(chan IncomingMessage, bufSize),
+		typingCh:   make(chan TypingEvent, 100),
+		typingSent: make(map[string]time.Time),
+		respCh:     make(chan json.RawMessage, 4),
+		errCh:      make(chan RelayError, 16),
+
+		pingInterval:     pingInterval,
+		maxPoWDifficulty: opts.MaxPoWDifficulty,
 	}
 
-	if err := c.handshake(); err != nil {
+	if deadline, ok := ctx.Deadline(); ok {
+		ws.SetReadDeadline(deadline)
+	}
+	if err := c.handshake(ctx); err != nil {
 		ws.Close()
 		return nil, err
 	}
+	ws.SetReadDeadline(time.Time{})
 
 	c.disconnected.Add(1)
 	go c.readLoop()
@@ -81,8 +265,88 @@ func Connect(url, agentID, agentName string, privKey ed25519.PrivateKey) (*Clien
 	return c, nil
 }
 
-func (c *Client) handshake() error {
-	// Send hello
+// Probe checks that the relay at url is up and answering handshakes: it
+// sends hello and waits for the challenge without solving it, so no session
+// is set up. A refusal is returned as Connect would return it.
+func Probe(ctx context.Context, url, agentID, agentName string, privKey ed25519.PrivateKey, opts ConnectOptions) error {
+	ws, err := dial(ctx, url, opts)
+	if err != nil {
+		return err
+	}
+	defer ws.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		ws.SetReadDeadline(deadline)
+	}
+
+	c := &Client{ws: ws, agentID: agentID, agentName: agentName, privKey: privKey}
+	if _, err := c.sendHello(); err != nil {
+		return err
+	}
+	var resp struct {
+		Type    string `json:"type"`
+		Code    string `json:"code,omitempty"`
+		Message string `json:"message,omitempty"`
+	}
+	if err := ws.ReadJSON(&resp); err != nil {
+		return fmt.Errorf("read challenge: %w", err)
+	}
+	if resp.Type == "error" {
+		return c.authError(resp.Code, resp.Message)
+	}
+	return nil
+}
+
+// dial opens the WebSocket to the relay at url.
+func dial(ctx context.Context, url string, opts ConnectOptions) (*websocket.Conn, error) {
+	proxy, err := ProxyFunc(opts.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	dialer := *websocket.DefaultDialer
+	dialer.EnableCompression = opts.Compression
+	dialer.Proxy = proxy
+	ws, _, err := dialer.DialContext(ctx, url, opts.Header)
+	if err != nil {
+		return nil, fmt.Errorf("dial: %w", err)
+	}
+	if opts.Compression {
+		// Favour latency over ratio; JSON compresses well even at the fastest level.
+		ws.SetCompressionLevel(flate.BestSpeed)
+	}
+	return ws, nil
+}
+
+// Protocol versions and signature algorithms this client can speak, most
+// preferred first. They are advertised in hello; the relay picks one of each.
+var (
+	SupportedProtocolVersions    = []string{"0.1.0"}
+	SupportedSignatureAlgorithms = []string{"ed25519"}
+)
+
+// ErrAuthRejected wraps the relay's refusal of the handshake, e.g. a banned
+// or unrecognized key. Unlike a network failure, retrying will not help.
+var ErrAuthRejected = errors.New("auth error")
+
+// authErrorCodes are the handshake error codes that refuse this key or its
+// signatures outright. Others, such as RATE_LIMITED or a server error, are
+// returned as a plain RelayError, since a retry may well succeed.
+var authErrorCodes = map[string]bool{
+	"AUTH_FAILED":       true,
+	"AUTH_REVOKED":      true,
+	"BANNED":            true,
+	"FORBIDDEN":         true,
+	"INVALID_SIGNATURE": true,
+	"INVALID_TIMESTAMP": true,
+	"UNAUTHORIZED":      true,
+}
+
+// MaxClockSkew is how far the local clock may be from the relay's before it
+// is reported as a likely cause of trouble. Every envelope carries a signed
+// timestamp, and relays that enforce a window reject those too far off.
+const MaxClockSkew = 30 * time.Second
+
+// sendHello sends the signed hello that opens a handshake and returns when.
+func (c *Client) sendHello() (time.Time, error) {
 	hello := map[string]interface{}{
 		"type": "hello",
 		"profile": map[string]interface{}{
@@ -90,13 +354,25 @@ func (c *Client) handshake() error {
 			"name":    c.agentName,
 			"version": "0.1.0",
 		},
-		"timestamp": time.Now().UnixMilli(),
-		"nonce":     randomNonce(),
+		"protocol_versions":    SupportedProtocolVersions,
+		"signature_algorithms": SupportedSignatureAlgorithms,
+		"timestamp":            time.Now().UnixMilli(),
+		"nonce":                randomNonce(),
+	}
+	if err := c.signMessage(hello); err != nil {
+		return time.Time{}, err
 	}
-	hello["signature"] = c.sign(hello)
 
 	if err := c.writeJSON(hello); err != nil {
-		return fmt.Errorf("send hello: %w", err)
+		return time.Time{}, fmt.Errorf("send hello: %w", err)
+	}
+	return time.Now(), nil
+}
+
+func (c *Client) handshake(ctx context.Context) error {
+	sent, err := c.sendHello()
+	if err != nil {
+		return err
 	}
 
 	// Read pow.challenge — handshake happens before readLoop starts, so direct read is safe.
@@ -106,19 +382,26 @@ func (c *Client) handshake() error {
 		Difficulty int    `json:"difficulty"`
 		Code       string `json:"code,omitempty"`
 		Message    string `json:"message,omitempty"`
+		ServerTime int64  `json:"server_time,omitempty"`
 	}
 	if err := c.ws.ReadJSON(&challenge); err != nil {
 		return fmt.Errorf("read challenge: %w", err)
 	}
+	c.measureClockSkew(challenge.ServerTime, sent)
 	if challenge.Type == "error" {
-		return fmt.Errorf("auth error: %s", challenge.Message)
+		return c.authError(challenge.Code, challenge.Message)
 	}
 	if challenge.Type != "pow.challenge" {
 		return fmt.Errorf("unexpected: %s", challenge.Type)
 	}
 
 	// Solve PoW
-	proof := solvePoW(challenge.Challenge, challenge.Difficulty)
+	ctx, cancel := context.WithTimeout(ctx, PoWTimeout)
+	defer cancel()
+	proof, err := c.solve(ctx, challenge.Challenge, challenge.Difficulty)
+	if err != nil {
+		return fmt.Errorf("handshake: %w", err)
+	}
 
 	// Send hello.pow
 	powMsg := map[string]interface{}{
@@ -128,112 +411,323 @@ func (c *Client) handshake() error {
 			"proof":     proof,
 		},
 	}
-	powMsg["signature"] = c.sign(powMsg)
+	if err := c.signMessage(powMsg); err != nil {
+		return err
+	}
 
 	if err := c.writeJSON(powMsg); err != nil {
 		return fmt.Errorf("send pow: %w", err)
 	}
+	sent = time.Now()
 
 	// Read welcome
 	var welcome struct {
-		Type    string `json:"type"`
-		Code    string `json:"code,omitempty"`
-		Message string `json:"message,omitempty"`
+		Type               string `json:"type"`
+		Code               string `json:"code,omitempty"`
+		Message            string `json:"message,omitempty"`
+		ProtocolVersion    string `json:"protocol_version,omitempty"`
+		SignatureAlgorithm string `json:"signature_algorithm,omitempty"`
+		ServerTime         int64  `json:"server_time,omitempty"` // relay's Unix milliseconds
+
+		Capabilities *Capabilities `json:"capabilities,omitempty"`
 	}
 	if err := c.ws.ReadJSON(&welcome); err != nil {
 		return fmt.Errorf("read welcome: %w", err)
 	}
+	c.measureClockSkew(welcome.ServerTime, sent)
 	if welcome.Type == "error" {
-		return fmt.Errorf("auth error: %s", welcome.Message)
+		return c.authError(welcome.Code, welcome.Message)
 	}
 	if welcome.Type != "welcome" {
 		return fmt.Errorf("unexpected: %s", welcome.Type)
 	}
 
+	// Relays that predate negotiation don't say; they speak the original version.
+	c.protocolVersion = SupportedProtocolVersions[len(SupportedProtocolVersions)-1]
+	if v := welcome.ProtocolVersion; v != "" {
+		if !slices.Contains(SupportedProtocolVersions, v) {
+			return fmt.Errorf("relay chose unsupported protocol version %q", v)
+		}
+		c.protocolVersion = v
+	}
+	if a := welcome.SignatureAlgorithm; a != "" && !slices.Contains(SupportedSignatureAlgorithms, a) {
+		return fmt.Errorf("relay chose unsupported signature algorithm %q", a)
+	}
+	c.capabilities = welcome.Capabilities
 	return nil
 }
 
-// recvTyped waits for a response matching wantTypes (and optionally wantRoom for room.joined).
-// Non-matching messages are re-queued so they aren't lost.
+// measureClockSkew records the offset of the local clock from serverMs, a
+// relay timestamp in a reply to a message written at sent. The relay is
+// assumed to have stamped it halfway through the round trip.
+func (c *Client) measureClockSkew(serverMs int64, sent time.Time) {
+	if serverMs <= 0 {
+		return
+	}
+	now := time.Now()
+	mid := sent.Add(now.Sub(sent) / 2)
+	c.clockSkew = mid.Sub(time.UnixMilli(serverMs)).Round(time.Millisecond)
+	c.clockSkewKnown = true
+}
+
+// authError builds the error for a handshake the relay rejected, wrapping
+// ErrAuthRejected only for authErrorCodes and naming a skewed clock as the
+// likely cause when the relay's time shows one.
+func (c *Client) authError(code, message string) error {
+	var err error = &RelayError{Code: code, Message: message}
+	if authErrorCodes[code] {
+		err = fmt.Errorf("%w: %w", ErrAuthRejected, err)
+	} else {
+		err = fmt.Errorf("handshake refused: %w", err)
+	}
+	if c.clockSkewKnown && c.clockSkew.Abs() > MaxClockSkew {
+		return fmt.Errorf("%w (local clock is %s; sync it, signed timestamps are checked)", err, DescribeClockSkew(c.clockSkew.Round(time.Second)))
+	}
+	return err
+}
+
+// ClockSkew returns how far the local clock is ahead of the relay's (negative
+// if behind), and false if the relay did not report its time.
+func (c *Client) ClockSkew() (time.Duration, bool) {
+	return c.clockSkew, c.clockSkewKnown
+}
+
+// DescribeClockSkew phrases a clock offset for humans, e.g. "1m30s ahead of
+// the relay".
+func DescribeClockSkew(skew time.Duration) string {
+	switch {
+	case skew > 0:
+		return skew.String() + " ahead of the relay"
+	case skew < 0:
+		return (-skew).String() + " behind the relay"
+	}
+	return "in sync with the relay"
+}
+
+// isReplay reports whether a message stamped ts predates the replaying join of
+// room, for relays that don't mark replayed messages themselves.
+func (c *Client) isReplay(room string, ts int64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	until, ok := c.replayUntil[room]
+	return ok && ts > 0 && ts < until
+}
+
+// ProtocolVersion returns the protocol version agreed with the relay.
+func (c *Client) ProtocolVersion() string {
+	return c.protocolVersion
+}
+
+// errRecvTimeout is returned by recvMatch when no matching response arrives in time.
+var errRecvTimeout = errors.New("timeout waiting for relay response")
+
+// maxHeld caps the responses kept for later operations; the oldest go first.
+const maxHeld = 16
+
+// Verdicts of a response filter.
+const (
+	respKeep = iota // not this operation's: hold it for a later one
+	respTake        // the response being waited for
+	respDrop        // an answer to an earlier operation that stopped waiting
+)
+
+// recvTyped waits for the response to the request sent with nonce, of one of
+// wantTypes. A relay that echoes the nonce is matched on it alone, and
+// responses echoing another nonce are stale and dropped. Without an echo it
+// falls back to the type, and for room.joined the room (wantRoom), so that a
+// stale join event isn't taken for this one.
 // Must only be called while opMu is held.
-func (c *Client) recvTyped(wantRoom string, wantTypes ...string) (json.RawMessage, error) {
-	deadline := time.After(15 * time.Second)
-	var queued []json.RawMessage
-
-	defer func() {
-		// re-queue unmatched messages so later calls can pick them up
-		go func() {
-			for _, q := range queued {
-				select {
-				case c.respCh <- q:
-				default:
-				}
+func (c *Client) recvTyped(nonce, wantRoom string, wantTypes ...string) (json.RawMessage, error) {
+	return c.recvFilter(15*time.Second, func(resp json.RawMessage) int {
+		var env struct {
+			Type  string `json:"type"`
+			Room  string `json:"room"`
+			Nonce string `json:"nonce"`
+		}
+		json.Unmarshal(resp, &env)
+
+		typeMatch := false
+		for _, t := range wantTypes {
+			if env.Type == t {
+				typeMatch = true
+				break
+			}
+		}
+		switch {
+		case !typeMatch:
+			return respKeep
+		case env.Nonce != "" && nonce != "":
+			if env.Nonce != nonce {
+				return respDrop
 			}
-		}()
-	}()
+			return respTake
+		case wantRoom != "" && env.Type == "room.joined" && env.Room != wantRoom:
+			return respKeep
+		}
+		return respTake
+	})
+}
+
+// recvMatch waits up to timeout for a response accepted by match.
+// Non-matching messages are held, in order, for later calls.
+// Must only be called while opMu is held.
+func (c *Client) recvMatch(timeout time.Duration, match func(json.RawMessage) bool) (json.RawMessage, error) {
+	return c.recvFilter(timeout, func(resp json.RawMessage) int {
+		if match(resp) {
+			return respTake
+		}
+		return respKeep
+	})
+}
+
+// lockOp takes opMu for an operation that writes a request and waits for
+// the response; call the returned func when done. Relay errors count as
+// responses from the start, so one that arrives before the operation gets
+// to waiting for it isn't passed to Errors instead.
+func (c *Client) lockOp() (unlock func()) {
+	c.opMu.Lock()
+	c.awaiting.Add(1)
+	return func() {
+		c.awaiting.Add(-1)
+		c.opMu.Unlock()
+	}
+}
+
+// recvFilter waits up to timeout for a response that filter takes, trying
+// held responses first in arrival order so none is overtaken by a newer one.
+// Must only be called while opMu is held.
+func (c *Client) recvFilter(timeout time.Duration, filter func(json.RawMessage) int) (json.RawMessage, error) {
+	held := c.held[:0:0]
+	var found json.RawMessage
+	for _, resp := range c.held {
+		if found != nil {
+			held = append(held, resp)
+			continue
+		}
+		switch filter(resp) {
+		case respTake:
+			found = resp
+		case respKeep:
+			held = append(held, resp)
+		}
+	}
+	c.held = held
+	if found != nil {
+		return found, nil
+	}
 
+	deadline := time.After(timeout)
 	for {
 		select {
 		case resp := <-c.respCh:
-			var env struct {
-				Type string `json:"type"`
-				Room string `json:"room"`
+			switch filter(resp) {
+			case respTake:
+				return resp, nil
+			case respKeep:
+				c.hold(resp)
 			}
-			json.Unmarshal(resp, &env)
-
-			typeMatch := false
-			for _, t := range wantTypes {
-				if env.Type == t {
-					typeMatch = true
-					break
-				}
-			}
-			if !typeMatch {
-				queued = append(queued, resp)
-				continue
-			}
-
-			// For room.joined, also match on room name to avoid stale join events
-			if wantRoom != "" && env.Type == "room.joined" && env.Room != wantRoom {
-				queued = append(queued, resp)
-				continue
-			}
-
-			return resp, nil
 
 		case <-deadline:
-			return nil, fmt.Errorf("timeout waiting for relay response")
+			return nil, errRecvTimeout
 		}
 	}
 }
 
-// CreateRoom creates a new room (handles PoW challenge).
-func (c *Client) CreateRoom(name, topic string, tags []string) (*RoomInfo, error) {
-	c.opMu.Lock()
-	defer c.opMu.Unlock()
+// hold keeps a response for a later operation, dropping the oldest beyond
+// maxHeld. Must only be called while opMu is held.
+func (c *Client) hold(resp json.RawMessage) {
+	if len(c.held) == maxHeld {
+		c.held = c.held[1:]
+		c.drop("response")
+	}
+	c.held = append(c.held, resp)
+}
 
-	// Send without PoW first
-	msg := map[string]interface{}{
+// DryRun is a validated, signed envelope that was not sent.
+type DryRun struct {
+	Envelope  map[string]interface{} `json:"envelope"`  // exactly what would be written to the relay
+	Canonical string                 `json:"canonical"` // the bytes the signature covers
+}
+
+func (c *Client) dryRun(msg map[string]interface{}) (*DryRun, error) {
+	delete(msg, "signature")
+	canonical, err := canonicalJSON(msg)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.signMessage(msg); err != nil {
+		return nil, err
+	}
+	return &DryRun{Envelope: msg, Canonical: string(canonical)}, nil
+}
+
+// buildCreateRoom validates and builds an unsigned room.create request (without PoW).
+func buildCreateRoom(name, topic string, tags []string) (map[string]interface{}, error) {
+	if err := validateRoomName(name); err != nil {
+		return nil, err
+	}
+	if err := validateTags(tags); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
 		"type":      "room.create",
 		"room":      name,
 		"topic":     topic,
 		"tags":      tags,
 		"nonce":     randomNonce(),
 		"timestamp": time.Now().UnixMilli(),
+	}, nil
+}
+
+// DryRunCreateRoom validates and signs the room.create request CreateRoom
+// would send first, without sending it.
+func (c *Client) DryRunCreateRoom(name, topic string, tags []string) (*DryRun, error) {
+	msg, err := buildCreateRoom(name, topic, tags)
+	if err != nil {
+		return nil, err
+	}
+	return c.dryRun(msg)
+}
+
+// CreateRoom creates a new room (handles PoW challenge).
+func (c *Client) CreateRoom(name, topic string, tags []string) (*RoomInfo, error) {
+	return c.CreateRoomContext(context.Background(), name, topic, tags)
+}
+
+// CreateRoomContext is CreateRoom, giving up solving proof-of-work when ctx
+// ends.
+func (c *Client) CreateRoomContext(ctx context.Context, name, topic string, tags []string) (*RoomInfo, error) {
+	if c.readOnly {
+		return nil, ErrReadOnly
+	}
+	// Send without PoW first
+	msg, err := buildCreateRoom(name, topic, tags)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.checkRoomLimit(name); err != nil {
+		return nil, err
+	}
+
+	defer c.lockOp()()
+
+	if err := c.signMessage(msg); err != nil {
+		return nil, err
 	}
-	msg["signature"] = c.sign(msg)
 
 	if err := c.writeJSON(msg); err != nil {
 		return nil, err
 	}
 
 	// Expect pow.challenge or room.joined/error
-	resp, err := c.recvTyped(name, "pow.challenge", "room.joined", "error")
+	resp, err := c.recvTyped(msg["nonce"].(string), name, "pow.challenge", "room.joined", "error")
 	if err != nil {
 		return nil, err
 	}
 
-	var env struct{ Type string `json:"type"` }
+	var env struct {
+		Type string `json:"type"`
+	}
 	json.Unmarshal(resp, &env)
 
 	if env.Type == "pow.challenge" {
@@ -243,7 +737,12 @@ func (c *Client) CreateRoom(name, topic string, tags []string) (*RoomInfo, error
 		}
 		json.Unmarshal(resp, &ch)
 
-		proof := solvePoW(ch.Challenge, ch.Difficulty)
+		ctx, cancel := context.WithTimeout(ctx, PoWTimeout)
+		proof, err := c.solve(ctx, ch.Challenge, ch.Difficulty)
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("create room: %w", err)
+		}
 
 		msg2 := map[string]interface{}{
 			"type":      "room.create",
@@ -254,13 +753,15 @@ func (c *Client) CreateRoom(name, topic string, tags []string) (*RoomInfo, error
 			"nonce":     randomNonce(),
 			"timestamp": time.Now().UnixMilli(),
 		}
-		msg2["signature"] = c.sign(msg2)
+		if err := c.signMessage(msg2); err != nil {
+			return nil, err
+		}
 
 		if err := c.writeJSON(msg2); err != nil {
 			return nil, err
 		}
 
-		resp, err = c.recvTyped(name, "room.joined", "error")
+		resp, err = c.recvTyped(msg2["nonce"].(string), name, "room.joined", "error")
 		if err != nil {
 			return nil, err
 		}
@@ -268,30 +769,33 @@ func (c *Client) CreateRoom(name, topic string, tags []string) (*RoomInfo, error
 	}
 
 	if env.Type == "error" {
-		var e struct{ Message string `json:"message"` }
+		var e struct {
+			Message string `json:"message"`
+		}
 		json.Unmarshal(resp, &e)
 		return nil, fmt.Errorf("%s", e.Message)
 	}
 
-	var joined struct {
-		Room    string   `json:"room"`
-		Topic   string   `json:"topic"`
-		Tags    []string `json:"tags"`
-		Members []Member `json:"members"`
-	}
-	json.Unmarshal(resp, &joined)
-
-	c.mu.Lock()
-	c.rooms[joined.Room] = true
-	c.mu.Unlock()
-
-	return &RoomInfo{Name: joined.Room, Topic: joined.Topic, Tags: joined.Tags, Members: joined.Members}, nil
+	return c.recordJoin(resp, RoleOwner), nil // the creator owns the room
 }
 
 // JoinRoom joins an existing room.
 func (c *Client) JoinRoom(name string) (*RoomInfo, error) {
-	c.opMu.Lock()
-	defer c.opMu.Unlock()
+	return c.JoinRoomSince(name, 0)
+}
+
+// JoinRoomSince joins a room and asks the relay to replay messages newer than
+// sinceMs (Unix milliseconds) into Messages, e.g. those missed while
+// disconnected. Replays may overlap what was already seen; dedup by ID.
+// Relays without replay support ignore the cursor. sinceMs 0 replays nothing.
+func (c *Client) JoinRoomSince(name string, sinceMs int64) (*RoomInfo, error) {
+	if err := validateRoom(name); err != nil {
+		return nil, err
+	}
+	if err := c.checkRoomLimit(name); err != nil {
+		return nil, err
+	}
+	defer c.lockOp()()
 
 	msg := map[string]interface{}{
 		"type":      "room.join",
@@ -299,134 +803,762 @@ func (c *Client) JoinRoom(name string) (*RoomInfo, error) {
 		"nonce":     randomNonce(),
 		"timestamp": time.Now().UnixMilli(),
 	}
-	msg["signature"] = c.sign(msg)
+	c.mu.Lock()
+	token := c.joinTokens[name]
+	c.mu.Unlock()
+	if token != "" {
+		msg["token"] = token
+	}
+	if sinceMs > 0 {
+		msg["since"] = sinceMs
+		// Anything older than this join that arrives for the room is replay.
+		c.mu.Lock()
+		if c.replayUntil == nil {
+			c.replayUntil = make(map[string]int64)
+		}
+		c.replayUntil[name] = msg["timestamp"].(int64)
+		c.mu.Unlock()
+	}
+	if err := c.signMessage(msg); err != nil {
+		return nil, err
+	}
 
 	if err := c.writeJSON(msg); err != nil {
 		return nil, err
 	}
 
-	resp, err := c.recvTyped(name, "room.joined", "error")
+	resp, err := c.recvTyped(msg["nonce"].(string), name, "room.joined", "error")
 	if err != nil {
 		return nil, err
 	}
 
 	var env struct {
 		Type    string `json:"type"`
+		Code    string `json:"code,omitempty"`
 		Message string `json:"message,omitempty"`
 	}
 	json.Unmarshal(resp, &env)
 
 	if env.Type == "error" {
-		return nil, fmt.Errorf("%s", env.Message)
+		if env.Code == "UNAUTHORIZED" || env.Code == "INVALID_TOKEN" {
+			return nil, fmt.Errorf("%s: %w (relay: %s)", name, ErrUnauthorizedRoom, env.Message)
+		}
+		return nil, &RelayError{Code: env.Code, Message: env.Message}
 	}
 
-	var joined struct {
-		Room    string   `json:"room"`
-		Topic   string   `json:"topic"`
-		Tags    []string `json:"tags"`
-		Members []Member `json:"members"`
+	return c.recordJoin(resp, ""), nil
+}
+
+// ErrUnauthorizedRoom is returned when the relay refuses to let this agent
+// join a gated room: no token was given, or it was wrong.
+var ErrUnauthorizedRoom = errors.New("room requires a valid invite token")
+
+// JoinRoomWithToken joins a gated room, presenting token (an invite token or
+// password) to the relay. The token is remembered and sent again on later
+// joins of the room by this client; a rejected token is forgotten.
+func (c *Client) JoinRoomWithToken(name, token string) (*RoomInfo, error) {
+	c.SetJoinToken(name, token)
+	info, err := c.JoinRoom(name)
+	if errors.Is(err, ErrUnauthorizedRoom) {
+		c.SetJoinToken(name, "")
 	}
-	json.Unmarshal(resp, &joined)
+	return info, err
+}
 
+// SetJoinToken sets the token sent when joining room, e.g. to restore tokens
+// on a new connection before rejoining. An empty token removes it.
+func (c *Client) SetJoinToken(room, token string) {
 	c.mu.Lock()
-	c.rooms[joined.Room] = true
-	c.mu.Unlock()
-
-	return &RoomInfo{Name: joined.Room, Topic: joined.Topic, Tags: joined.Tags, Members: joined.Members}, nil
+	defer c.mu.Unlock()
+	if token == "" {
+		delete(c.joinTokens, room)
+		return
+	}
+	if c.joinTokens == nil {
+		c.joinTokens = make(map[string]string)
+	}
+	c.joinTokens[room] = token
 }
 
-// LeaveRoom leaves a room.
-func (c *Client) LeaveRoom(name string) error {
-	msg := map[string]interface{}{
-		"type":      "room.leave",
-		"room":      name,
-		"nonce":     randomNonce(),
-		"timestamp": time.Now().UnixMilli(),
-	}
-	msg["signature"] = c.sign(msg)
+// ErrNotOwner is returned when the relay refuses a room update or kick
+// because this agent does not own the room.
+var ErrNotOwner = errors.New("only the room owner can do that")
 
-	c.mu.Lock()
-	delete(c.rooms, name)
-	c.mu.Unlock()
+// ErrUnconfirmed is returned when the relay neither confirms nor refuses an
+// operation within confirmTimeout; it may still have taken effect.
+var ErrUnconfirmed = errors.New("relay did not confirm in time")
 
-	return c.writeJSON(msg)
-}
+// confirmTimeout is how long KickMember and UpdateRoom wait for the relay to
+// confirm. A variable so tests can shorten it.
+var confirmTimeout = 5 * time.Second
 
-// SendMessage sends a text message to a room.
-// It waits briefly for an error response from the relay (e.g. ROOM_NOT_FOUND).
-// If no error arrives within the timeout, the send is considered successful.
-func (c *Client) SendMessage(room, text string) error {
-	c.opMu.Lock()
-	defer c.opMu.Unlock()
+// UpdateRoom changes a room's topic and/or tags. An empty topic or nil tags
+// leaves that field unchanged. Like CreateRoom, the relay may require
+// proof-of-work first. It returns once the relay confirms with room.updated,
+// or ErrUnconfirmed if it says nothing within confirmTimeout.
+func (c *Client) UpdateRoom(name, topic string, tags []string) error {
+	return c.UpdateRoomContext(context.Background(), name, topic, tags)
+}
 
-	msg := map[string]interface{}{
-		"type": "message",
-		"id":   randomUUID(),
-		"room": room,
-		"from": c.agentID,
-		"content": map[string]interface{}{
-			"type": "text",
-			"text": text,
-		},
-		"timestamp": time.Now().UnixMilli(),
-		"nonce":     randomNonce(),
+// UpdateRoomContext is UpdateRoom, giving up solving proof-of-work when ctx
+// ends.
+func (c *Client) UpdateRoomContext(ctx context.Context, name, topic string, tags []string) error {
+	if c.readOnly {
+		return ErrReadOnly
 	}
-	msg["signature"] = c.sign(msg)
-
-	if err := c.writeJSON(msg); err != nil {
+	if err := validateRoom(name); err != nil {
 		return err
 	}
-
-	// Relay only responds on error. Wait briefly; timeout = success.
-	select {
-	case resp := <-c.respCh:
-		var env struct {
-			Type    string `json:"type"`
-			Code    string `json:"code,omitempty"`
-			Message string `json:"message,omitempty"`
+	if tags != nil {
+		if err := validateTags(tags); err != nil {
+			return err
 		}
-		json.Unmarshal(resp, &env)
-		if env.Type == "error" {
-			return fmt.Errorf("relay: %s: %s", env.Code, env.Message)
+	}
+	if topic == "" && tags == nil {
+		return fmt.Errorf("nothing to update")
+	}
+	if err := c.checkModerator(name); err != nil {
+		return err
+	}
+
+	defer c.lockOp()()
+
+	send := func(pow map[string]interface{}) (string, error) {
+		msg := map[string]interface{}{
+			"type":      "room.update",
+			"room":      name,
+			"nonce":     randomNonce(),
+			"timestamp": time.Now().UnixMilli(),
 		}
-		// Not an error — re-queue for other waiters
-		go func() {
-			select {
-			case c.respCh <- resp:
-			default:
+		if topic != "" {
+			msg["topic"] = topic
+		}
+		if tags != nil {
+			msg["tags"] = tags
+		}
+		if pow != nil {
+			msg["pow"] = pow
+		}
+		if err := c.signMessage(msg); err != nil {
+			return "", err
+		}
+		return msg["nonce"].(string), c.writeJSON(msg)
+	}
+	nonce, err := send(nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.awaitRoomUpdate(name, nonce)
+	if err != nil || resp == nil {
+		return err
+	}
+	var ch struct {
+		Type       string `json:"type"`
+		Challenge  string `json:"challenge"`
+		Difficulty int    `json:"difficulty"`
+	}
+	json.Unmarshal(resp, &ch)
+	if ch.Type == "pow.challenge" {
+		ctx, cancel := context.WithTimeout(ctx, PoWTimeout)
+		proof, err := c.solve(ctx, ch.Challenge, ch.Difficulty)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("update room: %w", err)
+		}
+		nonce, err := send(map[string]interface{}{"challenge": ch.Challenge, "proof": proof})
+		if err != nil {
+			return err
+		}
+		if _, err := c.awaitRoomUpdate(name, nonce); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// awaitRoomUpdate waits for the relay's answer to the room.update sent with
+// nonce: a PoW challenge is returned for the caller to solve, an error is
+// converted, room.updated means success (nil, nil) and silence is
+// ErrUnconfirmed. Responses echoing another nonce are stale and dropped; an
+// error without an echo is this request's, as for awaitRelayError, since
+// opMu leaves no other operation waiting.
+// Must only be called while opMu is held.
+func (c *Client) awaitRoomUpdate(name, nonce string) (json.RawMessage, error) {
+	resp, err := c.recvFilter(confirmTimeout, func(resp json.RawMessage) int {
+		var env struct {
+			Type  string `json:"type"`
+			Room  string `json:"room"`
+			Nonce string `json:"nonce"`
+		}
+		json.Unmarshal(resp, &env)
+		switch env.Type {
+		case "room.updated":
+			if env.Room == name {
+				return respTake
+			}
+		case "error", "pow.challenge":
+			if env.Nonce != "" && env.Nonce != nonce {
+				return respDrop
+			}
+			return respTake
+		}
+		return respKeep
+	})
+	if errors.Is(err, errRecvTimeout) {
+		return nil, fmt.Errorf("update %s: %w", name, ErrUnconfirmed)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var env struct {
+		Type    string `json:"type"`
+		Code    string `json:"code,omitempty"`
+		Message string `json:"message,omitempty"`
+	}
+	json.Unmarshal(resp, &env)
+	switch env.Type {
+	case "error":
+		if env.Code == "NOT_OWNER" || env.Code == "FORBIDDEN" {
+			return nil, fmt.Errorf("%s: %w (relay: %s)", name, ErrNotOwner, env.Message)
+		}
+		return nil, &RelayError{Code: env.Code, Message: env.Message}
+	case "pow.challenge":
+		return resp, nil
+	}
+	return nil, nil
+}
+
+// JoinedRooms returns the rooms this client is currently in, sorted by name.
+func (c *Client) JoinedRooms() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	rooms := make([]string, 0, len(c.rooms))
+	for room := range c.rooms {
+		rooms = append(rooms, room)
+	}
+	sort.Strings(rooms)
+	return rooms
+}
+
+// LeaveRoom leaves a room.
+func (c *Client) LeaveRoom(name string) error {
+	if err := validateRoom(name); err != nil {
+		return err
+	}
+	msg := map[string]interface{}{
+		"type":      "room.leave",
+		"room":      name,
+		"nonce":     randomNonce(),
+		"timestamp": time.Now().UnixMilli(),
+	}
+	if err := c.signMessage(msg); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	delete(c.rooms, name)
+	delete(c.roles, name)
+	delete(c.replayUntil, name)
+	delete(c.members, name)
+	c.mu.Unlock()
+
+	return c.writeJSON(msg)
+}
+
+// SendMessage sends a text message to a room and returns its message ID.
+// It waits briefly for an error response from the relay (e.g. ROOM_NOT_FOUND).
+// If no error arrives within the timeout, the send is considered successful.
+//
+// Sends are written one at a time. With SetOrderedSends, concurrent sends to
+// the same room (by any Send method) are also written in the order they were
+// called; otherwise only sends from one goroutine are ordered.
+func (c *Client) SendMessage(room, text string) (string, error) {
+	return c.SendContent(room, map[string]interface{}{
+		"type": "text",
+		"text": text,
+	})
+}
+
+// SendContent signs and sends an arbitrary content object to a room, e.g.
+// {"type":"json","data":{...}} or {"type":"command","name":"deploy","args":[...]}.
+// The content must carry a string "type" field. It returns the message ID.
+func (c *Client) SendContent(room string, content map[string]interface{}) (string, error) {
+	return c.send(room, content, "")
+}
+
+// SendReply sends a text message threaded under parentMessageID and returns its message ID.
+func (c *Client) SendReply(room, parentMessageID, text string) (string, error) {
+	if parentMessageID == "" {
+		return "", fmt.Errorf("parent message ID required")
+	}
+	return c.send(room, map[string]interface{}{
+		"type": "text",
+		"text": text,
+	}, parentMessageID)
+}
+
+// AckTimeout is how long SendWait waits for the relay to acknowledge a message.
+const AckTimeout = 5 * time.Second
+
+// SendWait sends content (optionally as a reply) and waits up to timeout for
+// the relay to acknowledge it with a message.ack carrying its ID. A relay
+// error fails the send. Relays that don't ack degrade to fire-and-forget:
+// after the timeout SendWait returns the ID with acked false and no error.
+func (c *Client) SendWait(room string, content map[string]interface{}, inReplyTo string, timeout time.Duration) (id string, acked bool, err error) {
+	if timeout <= 0 {
+		timeout = AckTimeout
+	}
+	id, err = c.sendMessage(room, content, inReplyTo, true, func(id string) error {
+		acked, err = c.awaitAck(id, timeout)
+		return err
+	})
+	return id, acked, err
+}
+
+// send signs and sends a message envelope, optionally as a reply.
+func (c *Client) send(room string, content map[string]interface{}, inReplyTo string) (string, error) {
+	return c.sendMessage(room, content, inReplyTo, true, func(string) error { return c.awaitRelayError() })
+}
+
+// DryRunSend validates, encrypts (for keyed rooms) and signs the envelope a
+// send would write, without sending it or spending rate limit budget.
+func (c *Client) DryRunSend(room string, content map[string]interface{}, inReplyTo string) (*DryRun, error) {
+	if err := validateContent(content, c.messageLimit()); err != nil {
+		return nil, err
+	}
+	msg, err := c.buildMessage(room, content, inReplyTo)
+	if err != nil {
+		return nil, err
+	}
+	return c.dryRun(msg)
+}
+
+// buildMessage validates and builds an unsigned message envelope, sealing
+// the content if the room has a key.
+func (c *Client) buildMessage(room string, content map[string]interface{}, inReplyTo string) (map[string]interface{}, error) {
+	if err := validateRoomName(room); err != nil {
+		return nil, err
+	}
+	content, err := c.sealContent(room, content)
+	if err != nil {
+		return nil, fmt.Errorf("encrypt: %w", err)
+	}
+	msg := map[string]interface{}{
+		"type":      "message",
+		"id":        randomUUID(),
+		"room":      room,
+		"from":      c.agentID,
+		"content":   content,
+		"timestamp": time.Now().UnixMilli(),
+		"nonce":     randomNonce(),
+	}
+	if inReplyTo != "" {
+		msg["in_reply_to"] = inReplyTo
+	}
+	return msg, nil
+}
+
+// sendMessage signs and writes a message envelope, then calls confirm with
+// its ID (under opMu) to collect the relay's response. With queue set, a
+// failed write goes to the outbox, if there is one.
+func (c *Client) sendMessage(room string, content map[string]interface{}, inReplyTo string, queue bool, confirm func(id string) error) (string, error) {
+	if err := validateContent(content, c.messageLimit()); err != nil {
+		return "", err
+	}
+	if err := validateRoomName(room); err != nil {
+		return "", err
+	}
+	if c.readOnly {
+		return "", ErrReadOnly
+	}
+	if c.sendOrder != nil {
+		defer c.sendOrder.wait(room)()
+	}
+
+	defer c.lockOp()()
+	return c.writeMessage(room, content, inReplyTo, queue, confirm)
+}
+
+// writeMessage builds, signs and writes one validated message, then calls
+// confirm with its ID. Must only be called while opMu is held.
+func (c *Client) writeMessage(room string, content map[string]interface{}, inReplyTo string, queue bool, confirm func(id string) error) (string, error) {
+	if !c.allowSend(room) {
+		return "", ErrRateLimited
+	}
+
+	msg, err := c.buildMessage(room, content, inReplyTo)
+	if err != nil {
+		return "", err
+	}
+	id := msg["id"].(string)
+	if err := c.signMessage(msg); err != nil {
+		return "", err
+	}
+
+	if err := c.writeJSON(msg); err != nil {
+		if queue && c.outbox != nil {
+			c.outbox.push(QueuedMessage{ID: id, Room: room, Content: content, InReplyTo: inReplyTo, Timestamp: msg["timestamp"].(int64)})
+			return id, fmt.Errorf("%w (%v)", ErrQueued, err)
+		}
+		return "", err
+	}
+	if err := confirm(id); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// SendMessages sends texts to a room in order, with no other operation
+// interleaved, and returns their message IDs. Every text is validated before
+// anything is sent. On a failure partway through, the IDs of the messages
+// already sent are returned with the error, which names the failed index.
+// If the connection drops, that message and the rest are queued in the
+// outbox and all their IDs are returned with an ErrQueued error.
+func (c *Client) SendMessages(room string, texts []string) ([]string, error) {
+	if len(texts) == 0 {
+		return nil, fmt.Errorf("no messages to send")
+	}
+	contents := make([]map[string]interface{}, len(texts))
+	for i, text := range texts {
+		contents[i] = map[string]interface{}{"type": "text", "text": text}
+		if err := validateContent(contents[i], c.messageLimit()); err != nil {
+			return nil, fmt.Errorf("message %d: %w", i, err)
+		}
+	}
+	if err := validateRoomName(room); err != nil {
+		return nil, err
+	}
+	if c.readOnly {
+		return nil, ErrReadOnly
+	}
+	if c.sendOrder != nil {
+		defer c.sendOrder.wait(room)()
+	}
+
+	defer c.lockOp()()
+
+	ids := make([]string, 0, len(texts))
+	for i, content := range contents {
+		id, err := c.writeMessage(room, content, "", true, func(string) error { return c.awaitRelayError() })
+		if errors.Is(err, ErrQueued) {
+			// The connection is gone: queue the rest behind it, in order.
+			ids = append(ids, id)
+			for _, rest := range contents[i+1:] {
+				m := QueuedMessage{ID: randomUUID(), Room: room, Content: rest, Timestamp: time.Now().UnixMilli()}
+				c.outbox.push(m)
+				ids = append(ids, m.ID)
 			}
-		}()
+			return ids, fmt.Errorf("message %d: %w", i, err)
+		}
+		if err != nil {
+			return ids, fmt.Errorf("message %d: %w", i, err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// awaitAck waits for a message.ack or error for message id.
+// Must only be called while opMu is held.
+func (c *Client) awaitAck(id string, timeout time.Duration) (bool, error) {
+	resp, err := c.recvMatch(timeout, func(resp json.RawMessage) bool {
+		var env struct {
+			Type      string `json:"type"`
+			ID        string `json:"id"`
+			MessageID string `json:"message_id"`
+		}
+		json.Unmarshal(resp, &env)
+		switch env.Type {
+		case "message.ack":
+			return env.ID == id || env.MessageID == id
+		case "error":
+			// Errors without an ID can only be ours: opMu serializes operations.
+			return env.MessageID == "" || env.MessageID == id
+		}
+		return false
+	})
+	if errors.Is(err, errRecvTimeout) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var env struct {
+		Type    string `json:"type"`
+		Code    string `json:"code,omitempty"`
+		Message string `json:"message,omitempty"`
+	}
+	json.Unmarshal(resp, &env)
+	if env.Type == "error" {
+		return false, &RelayError{Code: env.Code, Message: env.Message}
+	}
+	return true, nil
+}
+
+// EditMessage replaces the text of a previously sent message.
+// Each edit carries an increasing revision so receivers can order them.
+func (c *Client) EditMessage(room, messageID, newText string) error {
+	if err := c.checkFeature(FeatureEdit); err != nil {
+		return err
+	}
+	if err := validateContent(map[string]interface{}{"type": "text", "text": newText}, c.messageLimit()); err != nil {
+		return err
+	}
+	if err := validateRoom(room); err != nil {
+		return err
+	}
+	if c.readOnly {
+		return ErrReadOnly
+	}
+	if !c.allowSend(room) {
+		return ErrRateLimited
+	}
+
+	defer c.lockOp()()
+
+	content, err := c.sealContent(room, map[string]interface{}{
+		"type": "text",
+		"text": newText,
+	})
+	if err != nil {
+		return fmt.Errorf("encrypt: %w", err)
+	}
+
+	// The revision is the edit time in ms, so it keeps increasing across
+	// reconnects and restarts; receivers drop revisions older than one seen.
+	c.mu.Lock()
+	revision := max(int(time.Now().UnixMilli()), c.revisions[messageID]+1)
+	c.revisions[messageID] = revision
+	c.mu.Unlock()
+
+	msg := map[string]interface{}{
+		"type":       "message.edit",
+		"id":         randomUUID(),
+		"room":       room,
+		"from":       c.agentID,
+		"message_id": messageID,
+		"revision":   revision,
+		"content":    content,
+		"timestamp":  time.Now().UnixMilli(),
+		"nonce":      randomNonce(),
+	}
+	if err := c.signMessage(msg); err != nil {
+		return err
+	}
+
+	if err := c.writeJSON(msg); err != nil {
+		return err
+	}
+	return c.awaitRelayError()
+}
+
+// DeleteMessage retracts a previously sent message.
+func (c *Client) DeleteMessage(room, messageID string) error {
+	if err := c.checkFeature(FeatureDelete); err != nil {
+		return err
+	}
+	if err := validateRoom(room); err != nil {
+		return err
+	}
+	if c.readOnly {
+		return ErrReadOnly
+	}
+	if !c.allowSend(room) {
+		return ErrRateLimited
+	}
+
+	defer c.lockOp()()
+
+	msg := map[string]interface{}{
+		"type":       "message.delete",
+		"id":         randomUUID(),
+		"room":       room,
+		"from":       c.agentID,
+		"message_id": messageID,
+		"timestamp":  time.Now().UnixMilli(),
+		"nonce":      randomNonce(),
+	}
+	if err := c.signMessage(msg); err != nil {
+		return err
+	}
+
+	if err := c.writeJSON(msg); err != nil {
+		return err
+	}
+	return c.awaitRelayError()
+}
+
+// SetRateLimiter limits outgoing messages. Sharing one limiter across
+// reconnects keeps a reconnect from resetting the budget.
+func (c *Client) SetRateLimiter(l *RateLimiter) {
+	c.limiter = l
+}
+
+// SetReadOnly makes every operation that transmits (sending, editing,
+// deleting, typing, creating rooms) fail with ErrReadOnly. Joining, leaving
+// and listing rooms still work. Call before the client is shared.
+func (c *Client) SetReadOnly(readOnly bool) {
+	c.readOnly = readOnly
+}
+
+// SetReceiptLimiter limits the receipts SendReceipt sends, on a budget of
+// their own so acknowledging a busy room doesn't crowd out real sends.
+func (c *Client) SetReceiptLimiter(l *RateLimiter) {
+	c.receiptLimiter = l
+}
+
+func (c *Client) allowSend(room string) bool {
+	return c.limiter == nil || c.limiter.Allow(room)
+}
+
+// awaitRelayError waits briefly for an error response to a fire-and-forget command.
+// Must only be called while opMu is held.
+func (c *Client) awaitRelayError() error {
+	// Relay only responds on error. Wait briefly; timeout = success.
+	select {
+	case resp := <-c.respCh:
+		var env struct {
+			Type    string `json:"type"`
+			Code    string `json:"code,omitempty"`
+			Message string `json:"message,omitempty"`
+		}
+		json.Unmarshal(resp, &env)
+		if env.Type == "error" {
+			return fmt.Errorf("relay: %s: %s", env.Code, env.Message)
+		}
+		// Not an error — hold it for the next operation
+		c.hold(resp)
 		return nil
 	case <-time.After(500 * time.Millisecond):
 		return nil // No error = success
 	}
 }
 
-// ListRooms requests a room list.
+// SetTyping signals that this agent is (or is no longer) composing a message.
+// Active events are throttled to one per TypingThrottle per room; receivers
+// expire them after TypingTTL, so callers should refresh while still busy.
+func (c *Client) SetTyping(room string, active bool) error {
+	if c.readOnly {
+		return ErrReadOnly
+	}
+	c.mu.Lock()
+	last, sent := c.typingSent[room]
+	if active && sent && time.Since(last) < TypingThrottle {
+		c.mu.Unlock()
+		return nil
+	}
+	if active {
+		c.typingSent[room] = time.Now()
+	} else {
+		delete(c.typingSent, room)
+	}
+	c.mu.Unlock()
+
+	msg := map[string]interface{}{
+		"type":      "typing",
+		"room":      room,
+		"from":      c.agentID,
+		"active":    active,
+		"timestamp": time.Now().UnixMilli(),
+		"nonce":     randomNonce(),
+	}
+	if err := c.signMessage(msg); err != nil {
+		return err
+	}
+
+	return c.writeJSON(msg)
+}
+
+// ListRooms requests a room list. With tags, only rooms carrying all of
+// them are listed.
 func (c *Client) ListRooms(tags []string, limit int) ([]RoomListItem, error) {
-	c.opMu.Lock()
-	defer c.opMu.Unlock()
+	return c.listRooms(tags, limit, "")
+}
+
+// myRoomsScan is how many rooms ListMyRooms asks for when it has to find
+// this client's rooms in the global list itself.
+const myRoomsScan = 200
+
+// ListMyRooms lists the rooms this client is in, with the same metadata as
+// ListRooms. Relays advertising FeatureRoomFilter filter the list
+// themselves; otherwise the global list is intersected with JoinedRooms, and
+// unless filtering by tags, joined rooms the relay didn't list (such as
+// private ones) follow with only their name.
+func (c *Client) ListMyRooms(tags []string, limit int) ([]RoomListItem, error) {
+	caps, advertised := c.Capabilities()
+	if advertised && slices.Contains(caps.Features, FeatureRoomFilter) {
+		return c.listRooms(tags, limit, "mine")
+	}
+
+	all, err := c.listRooms(tags, max(limit, myRoomsScan), "")
+	if err != nil {
+		return nil, err
+	}
+	rooms := c.JoinedRooms()
+	joined := map[string]bool{}
+	for _, room := range rooms {
+		joined[room] = true
+	}
+	var mine []RoomListItem
+	for _, r := range all {
+		if joined[r.Name] {
+			mine = append(mine, r)
+			delete(joined, r.Name)
+		}
+	}
+	if len(tags) == 0 {
+		for _, room := range rooms {
+			if joined[room] {
+				mine = append(mine, RoomListItem{Name: room})
+			}
+		}
+	}
+	if limit > 0 && len(mine) > limit {
+		mine = mine[:limit]
+	}
+	return mine, nil
+}
+
+// listRooms sends rooms.list, with filter if not empty.
+func (c *Client) listRooms(tags []string, limit int, filter string) ([]RoomListItem, error) {
+	if err := validateTags(tags); err != nil {
+		return nil, err
+	}
+	defer c.lockOp()()
 
 	msg := map[string]interface{}{
 		"type":  "rooms.list",
 		"limit": limit,
+		"nonce": randomNonce(),
 	}
 	if len(tags) > 0 {
 		msg["tags"] = tags
 	}
+	if filter != "" {
+		msg["filter"] = filter
+	}
 	if err := c.writeJSON(msg); err != nil {
 		return nil, err
 	}
 
-	resp, err := c.recvTyped("", "rooms.list.result", "error")
+	resp, err := c.recvTyped(msg["nonce"].(string), "", "rooms.list.result", "error")
 	if err != nil {
 		return nil, err
 	}
 
 	var result struct {
-		Rooms []RoomListItem `json:"rooms"`
+		Type    string         `json:"type"`
+		Code    string         `json:"code,omitempty"`
+		Message string         `json:"message,omitempty"`
+		Rooms   []RoomListItem `json:"rooms"`
 	}
 	json.Unmarshal(resp, &result)
+	if result.Type == "error" {
+		return nil, &RelayError{Code: result.Code, Message: result.Message}
+	}
 	return result.Rooms, nil
 }
 
@@ -435,8 +1567,8 @@ type RoomListItem struct {
 	Name       string   `json:"name"`
 	Topic      string   `json:"topic"`
 	Tags       []string `json:"tags"`
-	Agents     int      `json:"agents"`
-	LastActive int64    `json:"last_active"`
+	Agents     int      `json:"agents"`      // agents currently in the room
+	LastActive int64    `json:"last_active"` // newest message, Unix milliseconds
 }
 
 // Messages returns the incoming message channel.
@@ -444,6 +1576,24 @@ func (c *Client) Messages() <-chan IncomingMessage {
 	return c.msgCh
 }
 
+// Errors returns relay errors that were not a response to an operation, such
+// as being kicked or banned. Check RelayError.Fatal before reconnecting.
+// The channel is closed on disconnect.
+func (c *Client) Errors() <-chan RelayError {
+	return c.errCh
+}
+
+// FatalError returns the fatal relay error that ended this session, or nil.
+// It is set before the error is sent on Errors, so it can be checked after Wait.
+func (c *Client) FatalError() *RelayError {
+	return c.fatalErr.Load()
+}
+
+// Typing returns the incoming typing event channel.
+func (c *Client) Typing() <-chan TypingEvent {
+	return c.typingCh
+}
+
 // Close disconnects.
 func (c *Client) Close() {
 	c.mu.Lock()
@@ -459,9 +1609,27 @@ func (c *Client) Wait() {
 
 func (c *Client) readLoop() {
 	defer c.disconnected.Done()
+	// readLoop is the only sender, so consumers ranging over these channels stop on disconnect.
+	defer close(c.msgCh)
+	defer close(c.typingCh)
+	defer close(c.errCh)
+	// Pongs answer our pings, so silence for two intervals means a half-open
+	// connection. Close it so pingLoop stops and the owner can reconnect.
+	defer c.Close()
 	for {
+		if c.pingInterval > 0 {
+			c.ws.SetReadDeadline(time.Now().Add(2 * c.pingInterval))
+		}
 		_, raw, err := c.ws.ReadMessage()
 		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				log.Printf("agentnet: nothing from relay for %v, assuming the connection is dead", 2*c.pingInterval)
+			}
+			c.mu.Lock()
+			local := c.closed
+			c.mu.Unlock()
+			c.disconnect.Store(newDisconnect(err, local))
 			return
 		}
 
@@ -471,82 +1639,318 @@ func (c *Client) readLoop() {
 		json.Unmarshal(raw, &env)
 
 		switch env.Type {
-		case "message":
+		case "message", "message.edit", "message.delete":
+			if !c.verified(raw) {
+				if c.unverified.Add(1) == 1 {
+					log.Printf("agentnet: dropping a %s whose signature doesn't verify (later ones are only counted)", env.Type)
+				}
+				continue
+			}
 			var msg struct {
-				Room    string `json:"room"`
-				From    string `json:"from"`
-				FromName string `json:"from_name,omitempty"`
-				Content struct {
-					Text string `json:"text"`
-				} `json:"content"`
-				Timestamp int64 `json:"timestamp"`
+				ID        string          `json:"id"`
+				Room      string          `json:"room"`
+				From      string          `json:"from"`
+				FromName  string          `json:"from_name,omitempty"`
+				Content   json.RawMessage `json:"content"`
+				Timestamp int64           `json:"timestamp"`
+				MessageID string          `json:"message_id,omitempty"`
+				Revision  int             `json:"revision,omitempty"`
+				InReplyTo string          `json:"in_reply_to,omitempty"`
+				Replayed  bool            `json:"replayed,omitempty"`
 			}
 			json.Unmarshal(raw, &msg)
-			c.msgCh <- IncomingMessage{
+			var content struct {
+				Type string `json:"type"`
+				Text string `json:"text"`
+			}
+			json.Unmarshal(msg.Content, &content)
+			encrypted := false
+			if content.Type == "encrypted" {
+				// Undecryptable content (no key, wrong key) is passed through as-is in Raw.
+				if plain, ok, err := c.openContent(msg.Room, msg.Content); err == nil && ok {
+					msg.Content = plain
+					content.Type, content.Text = "", ""
+					json.Unmarshal(msg.Content, &content)
+					encrypted = true
+				}
+			}
+			in := IncomingMessage{
+				ID:        msg.ID,
 				Room:      msg.Room,
 				From:      msg.From,
 				FromName:  msg.FromName,
-				Text:      msg.Content.Text,
+				Text:      content.Text,
 				Timestamp: msg.Timestamp,
+				MessageID: msg.MessageID,
+				Revision:  msg.Revision,
+				InReplyTo: msg.InReplyTo,
+				Encrypted: encrypted,
+				Replayed:  msg.Replayed || c.isReplay(msg.Room, msg.Timestamp),
+				Mentioned: msg.From != c.agentID && c.mentions(content.Text),
+			}
+			if env.Type != "message" {
+				in.Type = env.Type
+			}
+			if content.Type != "" && content.Type != "text" {
+				in.Raw = msg.Content
+			}
+			if content.Type == "attachment" {
+				in.Attachment = parseAttachment(msg.Content)
+			}
+			select {
+			case c.msgCh <- in:
+			default:
+				// Never block here: a stalled consumer would also stall pongs and control responses.
+				c.drop("message")
+			}
+		case "typing":
+			var ev TypingEvent
+			json.Unmarshal(raw, &ev)
+			select {
+			case c.typingCh <- ev:
+			default:
+				// Typing indicators are ephemeral — drop if nobody is keeping up.
 			}
 		case "pong":
-			// ignore
+			now := time.Now().UnixNano()
+			c.lastPong.Store(now)
+			if sent := c.pingSentAt.Swap(0); sent != 0 {
+				c.lastRTT.Store(now - sent)
+			}
+		case "message.received":
+			c.handleReceipt(raw)
 		case "room.member_joined", "room.member_left":
-			// broadcast events — not command responses, discard
-		default:
-			// Forward control/response messages to waiting synchronous operations.
+			// broadcast events — not command responses; only update the member
+			// map, unless KickMember is waiting to see this agent go
+			if c.trackMember(env.Type, raw) {
+				c.forward(raw)
+			}
+		case "room.joined":
+			// Snapshot members here rather than in JoinRoom so membership
+			// events that follow on the wire are applied after it, in order.
+			c.resetMembers(raw)
+			c.forward(raw)
+		case "error":
+			var e struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			}
+			json.Unmarshal(raw, &e)
+			relayErr := RelayError{Code: e.Code, Message: e.Message}
+			// An error with no operation waiting isn't a response to anything;
+			// fatal ones concern the whole session whoever is waiting.
+			if relayErr.Fatal() {
+				c.fatalErr.CompareAndSwap(nil, &relayErr)
+			} else if c.awaiting.Load() > 0 {
+				c.forward(raw)
+				continue
+			}
 			select {
-			case c.respCh <- json.RawMessage(raw):
+			case c.errCh <- relayErr:
 			default:
-				// respCh full or nobody waiting — drop
+				log.Printf("agentnet: relay error (unread): %s: %s", e.Code, e.Message)
 			}
+		default:
+			c.forward(raw)
 		}
 	}
 }
 
+// forward passes control/response messages to waiting synchronous operations.
+func (c *Client) forward(raw []byte) {
+	select {
+	case c.respCh <- json.RawMessage(raw):
+	default:
+		// respCh full or nobody waiting — drop
+		c.drop("response")
+	}
+}
+
+// drop counts a message discarded because its channel was full, logging at most
+// once per DropLogInterval.
+func (c *Client) drop(kind string) {
+	n := c.dropped.Add(1)
+	now := time.Now().UnixNano()
+	last := c.dropLoggedAt.Load()
+	if now-last >= int64(DropLogInterval) && c.dropLoggedAt.CompareAndSwap(last, now) {
+		log.Printf("agentnet: incoming %s channel full, dropping (%d dropped so far)", kind, n)
+	}
+}
+
+// Dropped returns how many incoming messages and responses were discarded
+// because the consumer was not keeping up.
+func (c *Client) Dropped() int64 {
+	return c.dropped.Load()
+}
+
+// resetMembers replaces a room's member map with the snapshot in a room.joined event.
+func (c *Client) resetMembers(raw []byte) {
+	var joined struct {
+		Room    string   `json:"room"`
+		Members []Member `json:"members"`
+	}
+	json.Unmarshal(raw, &joined)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	members := make(map[string]Member, len(joined.Members))
+	for _, m := range joined.Members {
+		members[m.ID] = m
+	}
+	c.members[joined.Room] = members
+}
+
+// trackMember applies a room.member_joined / room.member_left event,
+// reporting whether it is the departure a KickMember is waiting for.
+func (c *Client) trackMember(eventType string, raw []byte) bool {
+	var ev struct {
+		Room   string `json:"room"`
+		Member Member `json:"member"`
+	}
+	json.Unmarshal(raw, &ev)
+	if ev.Member.ID == "" {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	kicked := eventType == "room.member_left" && c.kicking == [2]string{ev.Room, ev.Member.ID}
+	members, ok := c.members[ev.Room]
+	if !ok {
+		return kicked // not a room we're tracking
+	}
+	if eventType == "room.member_joined" {
+		members[ev.Member.ID] = ev.Member
+	} else {
+		delete(members, ev.Member.ID)
+	}
+	return kicked
+}
+
+// Members returns the current members of a joined room, sorted by name,
+// kept live from membership events. It returns nil for rooms not joined.
+func (c *Client) Members(room string) []Member {
+	c.mu.Lock()
+	members, ok := c.members[room]
+	if !ok {
+		c.mu.Unlock()
+		return nil
+	}
+	list := make([]Member, 0, len(members))
+	for _, m := range members {
+		list = append(list, m)
+	}
+	c.mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Name != list[j].Name {
+			return list[i].Name < list[j].Name
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
 func (c *Client) pingLoop() {
-	ticker := time.NewTicker(25 * time.Second)
+	ticker := time.NewTicker(c.pingInterval)
 	defer ticker.Stop()
-	for range ticker.C {
+	// Ping once right away so LastRTT is known shortly after connecting.
+	for first := true; ; first = false {
+		if !first {
+			<-ticker.C
+		}
 		c.mu.Lock()
 		if c.closed {
 			c.mu.Unlock()
 			return
 		}
 		c.mu.Unlock()
-		c.writeJSON(map[string]string{"type": "ping"})
+		c.ping()
 	}
 }
 
+// ping sends a ping, timing it for LastRTT unless an earlier one is still
+// unanswered: pongs carry nothing to tell them apart, so restamping would
+// measure the earlier pong against the later ping.
+func (c *Client) ping() {
+	c.pingSentAt.CompareAndSwap(0, time.Now().UnixNano())
+	c.writeJSON(map[string]string{"type": "ping"})
+}
+
+// LastRTT returns the round-trip time of the most recent ping to the relay,
+// or 0 if no pong has been received yet.
+func (c *Client) LastRTT() time.Duration {
+	return time.Duration(c.lastRTT.Load())
+}
+
+// LastPong returns when the relay last answered a ping, or the zero time if
+// it hasn't yet.
+func (c *Client) LastPong() time.Time {
+	if ns := c.lastPong.Load(); ns != 0 {
+		return time.Unix(0, ns)
+	}
+	return time.Time{}
+}
+
 func (c *Client) writeJSON(v interface{}) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	return c.ws.WriteJSON(v)
 }
 
-func (c *Client) sign(msg map[string]interface{}) string {
-	canonical, _ := canonicalJSON(msg)
-	sig := ed25519.Sign(c.privKey, canonical)
-	return base58.Encode(sig)
+// sign returns the signature over msg's canonical JSON. It fails, rather
+// than sign bytes the relay would not reproduce, if msg holds a value
+// canonicalJSON doesn't support.
+func (c *Client) sign(msg map[string]interface{}) (string, error) {
+	canonical, err := canonicalJSON(msg)
+	if err != nil {
+		return "", fmt.Errorf("sign %v: %w", msg["type"], err)
+	}
+	return base58.Encode(ed25519.Sign(c.privKey, canonical)), nil
 }
 
+// signMessage signs msg and stores the result in its "signature" field.
+func (c *Client) signMessage(msg map[string]interface{}) error {
+	sig, err := c.sign(msg)
+	if err != nil {
+		return err
+	}
+	msg["signature"] = sig
+	return nil
+}
+
+// canonicalJSON encodes v as the relay does when verifying: no whitespace,
+// numbers as canonicalNumber formats them, strings escaped as
+// appendJSONString escapes them, and object keys sorted by UTF-16 code unit
+// (JavaScript's default sort). It supports what decoding JSON into interface{} produces,
+// plus Go integers and []string; anything else (structs, other maps and
+// slices) is an error, since its encoding isn't guaranteed to match what the
+// relay reproduces.
 func canonicalJSON(v interface{}) ([]byte, error) {
 	switch val := v.(type) {
+	case nil, bool:
+		return json.Marshal(val)
+	case string:
+		return appendJSONString(nil, val), nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return json.Marshal(val)
 	case map[string]interface{}:
 		keys := make([]string, 0, len(val))
 		for k := range val {
 			keys = append(keys, k)
 		}
-		sort.Strings(keys)
+		sort.Slice(keys, func(i, j int) bool { return lessUTF16(keys[i], keys[j]) })
 		buf := []byte{'{'}
 		for i, k := range keys {
 			if i > 0 {
 				buf = append(buf, ',')
 			}
-			kb, _ := json.Marshal(k)
-			buf = append(buf, kb...)
+			buf = appendJSONString(buf, k)
 			buf = append(buf, ':')
-			vb, _ := canonicalJSON(val[k])
+			vb, err := canonicalJSON(val[k])
+			if err != nil {
+				return nil, err
+			}
 			buf = append(buf, vb...)
 		}
 		buf = append(buf, '}')
@@ -557,14 +1961,107 @@ func canonicalJSON(v interface{}) ([]byte, error) {
 			if i > 0 {
 				buf = append(buf, ',')
 			}
-			ib, _ := canonicalJSON(item)
+			ib, err := canonicalJSON(item)
+			if err != nil {
+				return nil, err
+			}
 			buf = append(buf, ib...)
 		}
 		buf = append(buf, ']')
 		return buf, nil
+	case []string:
+		items := make([]interface{}, len(val))
+		for i, item := range val {
+			items[i] = item
+		}
+		return canonicalJSON(items)
+	case float64:
+		return canonicalNumber(val)
+	case float32:
+		return canonicalNumber(float64(val))
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			return strconv.AppendInt(nil, i, 10), nil
+		}
+		f, err := val.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("canonical json: %w", err)
+		}
+		return canonicalNumber(f)
 	default:
-		return json.Marshal(v)
+		return nil, fmt.Errorf("canonical json: unsupported type %T", v)
+	}
+}
+
+// lessUTF16 orders strings by their UTF-16 code units, as JavaScript sorts
+// them. This differs from Go's byte order only where a character above
+// U+FFFF meets one from U+E000 to U+FFFF: its surrogate pair sorts first.
+func lessUTF16(a, b string) bool {
+	for a != "" && b != "" {
+		ra, na := utf8.DecodeRuneInString(a)
+		rb, nb := utf8.DecodeRuneInString(b)
+		if ra != rb {
+			return utf16Key(ra) < utf16Key(rb)
+		}
+		a, b = a[na:], b[nb:]
 	}
+	return a == "" && b != ""
+}
+
+// utf16Key packs r's UTF-16 code units into a number that sorts as they do.
+func utf16Key(r rune) uint32 {
+	if r1, r2 := utf16.EncodeRune(r); r1 != unicode.ReplacementChar {
+		return uint32(r1)<<16 | uint32(r2)
+	}
+	return uint32(r) << 16
+}
+
+// appendJSONString appends s as a JSON string the way JavaScript's
+// JSON.stringify writes it: only '"', '\\' and control characters are
+// escaped (\b, \f, \n, \r, \t, otherwise \u00xx), and everything else,
+// including <, >, & and U+2028, is written as is. Invalid UTF-8 becomes
+// U+FFFD, as with encoding/json.
+func appendJSONString(buf []byte, s string) []byte {
+	const hex = "0123456789abcdef"
+	buf = append(buf, '"')
+	for _, r := range s { // ranging over a string yields U+FFFD for invalid UTF-8
+		switch {
+		case r == '"' || r == '\\':
+			buf = append(buf, '\\', byte(r))
+		case r == '\b':
+			buf = append(buf, '\\', 'b')
+		case r == '\f':
+			buf = append(buf, '\\', 'f')
+		case r == '\n':
+			buf = append(buf, '\\', 'n')
+		case r == '\r':
+			buf = append(buf, '\\', 'r')
+		case r == '\t':
+			buf = append(buf, '\\', 't')
+		case r < 0x20:
+			buf = append(buf, '\\', 'u', '0', '0', hex[r>>4], hex[r&0xf])
+		default:
+			buf = utf8.AppendRune(buf, r)
+		}
+	}
+	return append(buf, '"')
+}
+
+// canonicalNumber formats a float the way the relay re-serializes numbers
+// (JavaScript's Number#toString): integer values below 1e21 in plain digits,
+// never exponent notation, so a timestamp decoded as float64 signs the same
+// bytes as the original int64.
+func canonicalNumber(f float64) ([]byte, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, fmt.Errorf("canonical json: unsupported number %v", f)
+	}
+	if f == 0 {
+		return []byte("0"), nil // also normalizes -0
+	}
+	if f == math.Trunc(f) && math.Abs(f) < 1e21 {
+		return strconv.AppendFloat(nil, f, 'f', -1, 64), nil
+	}
+	return json.Marshal(f)
 }
 
 func randomNonce() string {
@@ -582,14 +2079,58 @@ func randomUUID() string {
 		b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
 }
 
-func solvePoW(challenge string, difficulty int) string {
+// PoWTimeout bounds how long the handshake or CreateRoom will spend solving a
+// relay's proof-of-work challenge, so a pathological difficulty can't wedge the caller.
+const PoWTimeout = 2 * time.Minute
+
+// DefaultMaxPoWDifficulty caps the proof-of-work difficulty the client will
+// attempt. 24 bits takes seconds; each further bit doubles the work.
+const DefaultMaxPoWDifficulty = 24
+
+// ErrPoWTooHard is returned when a relay's challenge exceeds the client's
+// difficulty cap. Nothing is solved; a relay demanding this much is
+// misconfigured or hostile.
+var ErrPoWTooHard = errors.New("pow: challenge too hard")
+
+// ErrPoWTimeout is returned when a challenge isn't solved within PoWTimeout.
+// The error also matches context.DeadlineExceeded.
+var ErrPoWTimeout = errors.New("pow: timed out")
+
+// solve solves a relay's challenge unless its difficulty exceeds the cap.
+func (c *Client) solve(ctx context.Context, challenge string, difficulty int) (string, error) {
+	max := c.maxPoWDifficulty
+	if max <= 0 {
+		max = DefaultMaxPoWDifficulty
+	}
+	if difficulty > max {
+		return "", fmt.Errorf("%w: difficulty %d exceeds the limit of %d", ErrPoWTooHard, difficulty, max)
+	}
+	return solvePoW(ctx, challenge, difficulty)
+}
+
+// solvePoW finds a proof whose hash with challenge has difficulty leading zero
+// bits. It gives up when ctx is done, with ErrPoWTimeout if its deadline passed.
+func solvePoW(ctx context.Context, challenge string, difficulty int) (string, error) {
+	if difficulty < 0 || difficulty > sha256.Size*8 {
+		return "", fmt.Errorf("pow: invalid difficulty %d", difficulty)
+	}
+	start := time.Now()
 	var nonce uint64
 	for {
 		proof := fmt.Sprintf("%d", nonce)
 		if verifyPoW(challenge, proof, difficulty) {
-			return proof
+			log.Printf("agentnet: solved pow difficulty %d in %d iterations (%s)", difficulty, nonce+1, time.Since(start).Round(time.Millisecond))
+			return proof, nil
 		}
 		nonce++
+		if nonce%4096 == 0 && ctx.Err() != nil {
+			err := ctx.Err()
+			if errors.Is(err, context.DeadlineExceeded) {
+				err = fmt.Errorf("%w: %w", ErrPoWTimeout, err)
+			}
+			return "", fmt.Errorf("pow: gave up at difficulty %d after %d iterations (%s): %w",
+				difficulty, nonce, time.Since(start).Round(time.Millisecond), err)
+		}
 	}
 }
 
@@ -1,13 +1,25 @@
 package client
 
 import (
+	"bytes"
+	"context"
 	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/btcsuite/btcutil/base58"
+	"github.com/gorilla/websocket"
 )
 
 // ── Canonical JSON ──────────────────────────────────────────────────────────
@@ -101,7 +113,7 @@ func TestSolvePoW_Valid(t *testing.T) {
 	challenge := "test-challenge-abc"
 	difficulty := 16
 
-	proof := solvePoW(challenge, difficulty)
+	proof := mustSolvePoW(t, challenge, difficulty)
 
 	h := sha256.New()
 	h.Write([]byte(challenge))
@@ -117,9 +129,76 @@ func TestSolvePoW_Valid(t *testing.T) {
 	}
 }
 
+func mustSolvePoW(t *testing.T, challenge string, difficulty int) string {
+	t.Helper()
+	proof, err := solvePoW(context.Background(), challenge, difficulty)
+	if err != nil {
+		t.Fatalf("solvePoW: %v", err)
+	}
+	return proof
+}
+
+func TestSolvePoW_GivesUpWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	// 200 leading zero bits will not be found in 50ms.
+	_, err := solvePoW(ctx, "test", 200)
+	if !errors.Is(err, ErrPoWTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a timeout, got %v", err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err := solvePoW(ctx, "test", 200); errors.Is(err, ErrPoWTimeout) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancellation reported as %v", err)
+	}
+}
+
+func TestSolvePoW_RejectsInvalidDifficulty(t *testing.T) {
+	for _, diff := range []int{-1, 257} {
+		if _, err := solvePoW(context.Background(), "test", diff); err == nil {
+			t.Fatalf("difficulty %d should be rejected", diff)
+		}
+	}
+}
+
+func TestHandshake_RefusesPoWOverCap(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		ws.ReadMessage() // hello
+		ws.WriteJSON(map[string]interface{}{"type": "pow.challenge", "challenge": "c", "difficulty": 40})
+		ws.ReadMessage()
+	}))
+	defer srv.Close()
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+
+	start := time.Now()
+	_, err := ConnectWithOptions(context.Background(), "ws"+strings.TrimPrefix(srv.URL, "http"), "a", "tester", priv, ConnectOptions{})
+	if !errors.Is(err, ErrPoWTooHard) {
+		t.Fatalf("expected ErrPoWTooHard, got %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatal("refusing the challenge should not take long")
+	}
+}
+
+func TestSolve_HonorsConfiguredCap(t *testing.T) {
+	c := &Client{maxPoWDifficulty: 8}
+	if _, err := c.solve(context.Background(), "test", 9); !errors.Is(err, ErrPoWTooHard) {
+		t.Fatalf("expected ErrPoWTooHard, got %v", err)
+	}
+	if _, err := c.solve(context.Background(), "test", 8); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestSolvePoW_VariousDifficulties(t *testing.T) {
 	for _, diff := range []int{4, 8, 12, 16} {
-		proof := solvePoW("test", diff)
+		proof := mustSolvePoW(t, "test", diff)
 		if !verifyPoW("test", proof, diff) {
 			t.Fatalf("proof failed at difficulty %d", diff)
 		}
@@ -127,8 +206,8 @@ func TestSolvePoW_VariousDifficulties(t *testing.T) {
 }
 
 func TestSolvePoW_DifferentChallenges(t *testing.T) {
-	proof1 := solvePoW("challenge-1", 12)
-	proof2 := solvePoW("challenge-2", 12)
+	proof1 := mustSolvePoW(t, "challenge-1", 12)
+	proof2 := mustSolvePoW(t, "challenge-2", 12)
 
 	// Proof for one challenge shouldn't work for another (almost certainly)
 	if verifyPoW("challenge-1", proof2, 12) && verifyPoW("challenge-2", proof1, 12) {
@@ -151,7 +230,10 @@ func TestSign_ProducesValidSignature(t *testing.T) {
 		"timestamp": time.Now().UnixMilli(),
 		"nonce":     randomNonce(),
 	}
-	sig := c.sign(msg)
+	sig, err := c.sign(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	canon, _ := canonicalJSON(msg)
 	sigBytes := base58.Decode(sig)
@@ -172,7 +254,10 @@ func TestSign_TamperedMessageFails(t *testing.T) {
 		"type": "hello",
 		"data": "original",
 	}
-	sig := c.sign(msg)
+	sig, err := c.sign(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	msg["data"] = "tampered"
 	canon, _ := canonicalJSON(msg)
@@ -192,7 +277,10 @@ func TestSign_DifferentKeys(t *testing.T) {
 	}
 
 	msg := map[string]interface{}{"type": "test"}
-	sig := c.sign(msg)
+	sig, err := c.sign(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	// Verify with wrong key should fail
 	canon, _ := canonicalJSON(msg)
@@ -243,6 +331,132 @@ func TestCanonicalJSON_BoolValues(t *testing.T) {
 	}
 }
 
+func TestCanonicalJSON_LargeTimestamps(t *testing.T) {
+	// The same timestamp as int64, float64 (from a decoded map) and json.Number
+	// must canonicalize identically, without exponent notation.
+	for _, ts := range []interface{}{int64(1700000000000), float64(1700000000000), json.Number("1700000000000"), json.Number("1.7e12")} {
+		canon, err := canonicalJSON(map[string]interface{}{"timestamp": ts})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(canon) != `{"timestamp":1700000000000}` {
+			t.Fatalf("%T: got %s", ts, canon)
+		}
+	}
+}
+
+func TestCanonicalJSON_NestedNumbers(t *testing.T) {
+	var decoded map[string]interface{}
+	json.Unmarshal([]byte(`{"pow":{"difficulty":20,"ratio":0.5},"list":[1e3,-0,123456789012345678]}`), &decoded)
+	canon, err := canonicalJSON(decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"list":[1000,0,123456789012345680],"pow":{"difficulty":20,"ratio":0.5}}`
+	if string(canon) != want {
+		t.Fatalf("got %s, want %s", canon, want)
+	}
+}
+
+func TestCanonicalJSON_RejectsNaN(t *testing.T) {
+	if _, err := canonicalJSON(map[string]interface{}{"x": []interface{}{math.NaN()}}); err == nil {
+		t.Fatal("NaN should not canonicalize")
+	}
+}
+
+func TestCanonicalJSON_RejectsUnsupportedTypes(t *testing.T) {
+	for _, v := range []interface{}{
+		struct{ A int }{1},
+		[]int{1, 2},
+		map[string]string{"a": "b"},
+		time.Second,
+	} {
+		if _, err := canonicalJSON(map[string]interface{}{"x": v}); err == nil {
+			t.Errorf("%T should not canonicalize", v)
+		}
+	}
+
+	c := &Client{privKey: ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))}
+	if _, err := c.sign(map[string]interface{}{"type": "test", "x": []int{1}}); err == nil {
+		t.Fatal("signing an unsupported type should fail")
+	}
+}
+
+func TestCanonicalJSON_StringSliceMatchesDecoded(t *testing.T) {
+	typed, err := canonicalJSON(map[string]interface{}{"tags": []string{"b", "a"}, "n": int64(7)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]interface{}
+	json.Unmarshal(typed, &decoded)
+	relay, _ := canonicalJSON(decoded)
+	if string(typed) != string(relay) {
+		t.Fatalf("%s != %s", typed, relay)
+	}
+}
+
+func TestCanonicalJSON_KeysSortByUTF16(t *testing.T) {
+	// Byte order would put U+FFFF before U+1F600; UTF-16 order (the high
+	// surrogate, U+D83D) puts it after, as JavaScript sorts keys.
+	canon, err := canonicalJSON(map[string]interface{}{"\uffff": 1, "\U0001F600": 2, "é": 3, "z": 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "{\"z\":4,\"é\":3,\"\U0001F600\":2,\"\uffff\":1}"; string(canon) != want {
+		t.Fatalf("got %s, want %s", canon, want)
+	}
+	for _, pair := range [][2]string{{"", "a"}, {"a", "ab"}, {"A", "a"}, {"\U0001F600", "\ue000"}, {"\U0001F600", "\U0001F601"}} {
+		if !lessUTF16(pair[0], pair[1]) || lessUTF16(pair[1], pair[0]) {
+			t.Fatalf("expected %q < %q", pair[0], pair[1])
+		}
+	}
+}
+
+func TestCanonicalJSON_KeyEscaping(t *testing.T) {
+	canon, err := canonicalJSON(map[string]interface{}{"a<b&c>": 1, "q\"\\": 2, "\x1f\n": 3, "\u2028": 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"\u001f\n":3,"a<b&c>":1,"q\"\\":2,"` + "\u2028" + `":4}`
+	if string(canon) != want {
+		t.Fatalf("got %s, want %s", canon, want)
+	}
+}
+
+func TestSign_HTMLCharactersInContent(t *testing.T) {
+	// encoding/json would write \u003c, \u0026 and \u003e; a relay that
+	// re-encodes with JSON.stringify signs the characters themselves.
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	c := &Client{agentID: base58.Encode(pub), privKey: priv}
+	msg := map[string]interface{}{
+		"type":    "message",
+		"content": map[string]interface{}{"type": "text", "text": "a < b && c > d"},
+	}
+	sig, err := c.sign(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	relay := `{"content":{"text":"a < b && c > d","type":"text"},"type":"message"}`
+	if !ed25519.Verify(pub, []byte(relay), base58.Decode(sig)) {
+		t.Fatal("signature doesn't verify over the unescaped text")
+	}
+}
+
+func TestCanonicalJSON_StringValueEscaping(t *testing.T) {
+	canon, err := canonicalJSON(map[string]interface{}{"text": "<&>\u2028 \"\\\b\f\n\r\t\x00\x7f é"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"text":"<&>` + "\u2028" + ` \"\\\b\f\n\r\t\u0000` + "\x7f é" + `"}`
+	if string(canon) != want {
+		t.Fatalf("got %s, want %s", canon, want)
+	}
+	var back map[string]interface{}
+	if err := json.Unmarshal(canon, &back); err != nil || back["text"] != "<&>\u2028 \"\\\b\f\n\r\t\x00\x7f é" {
+		t.Fatalf("doesn't round-trip: %v %q", err, back["text"])
+	}
+}
+
 func TestCanonicalJSON_SignatureRemoved(t *testing.T) {
 	// Ensure that signing works correctly: signature is not part of the signed data
 	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
@@ -252,7 +466,10 @@ func TestCanonicalJSON_SignatureRemoved(t *testing.T) {
 		"type":  "test",
 		"nonce": "abc",
 	}
-	sig := c.sign(msg) // signs without "signature" field
+	sig, err := c.sign(msg) // signs without "signature" field
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	// Adding signature to msg should not affect verification
 	// because verification removes "signature" before hashing
@@ -264,3 +481,1080 @@ func TestCanonicalJSON_SignatureRemoved(t *testing.T) {
 		t.Fatal("signature verification failed after roundtrip")
 	}
 }
+
+// ── Typing ──────────────────────────────────────────────────────────────────
+
+func TestSetTyping_Throttled(t *testing.T) {
+	frames := make(chan []bool, 1)
+	c := pipeClient(t, func(ws *websocket.Conn) {
+		var got []bool
+		for {
+			var msg struct {
+				Type   string `json:"type"`
+				Active bool   `json:"active"`
+			}
+			if err := ws.ReadJSON(&msg); err != nil {
+				frames <- got
+				return
+			}
+			if msg.Type == "typing" {
+				got = append(got, msg.Active)
+			}
+		}
+	})
+	c.privKey = ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+
+	// Repeated active events within TypingThrottle are suppressed; clearing
+	// the indicator always goes out and lets the next one through.
+	for _, active := range []bool{true, true, true, false, true} {
+		if err := c.SetTyping("room", active); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.Close()
+	if got := <-frames; !slices.Equal(got, []bool{true, false, true}) {
+		t.Fatalf("relay got typing frames %v, want [true false true]", got)
+	}
+}
+
+// ── Structured content ──────────────────────────────────────────────────────
+
+// pipeClient returns a Client wired to a test relay that runs serve on the
+// server side of the connection. readLoop is started; handshake is skipped.
+func pipeClient(t *testing.T, serve func(ws *websocket.Conn)) *Client {
+	t.Helper()
+	return pipeClientWith(t, serve, func(*Client) {})
+}
+
+// pipeClientWith is pipeClient with a chance to configure the Client before
+// readLoop starts.
+func pipeClientWith(t *testing.T, serve func(ws *websocket.Conn), setup func(*Client)) *Client {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		serve(ws)
+	}))
+	t.Cleanup(srv.Close)
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	c := &Client{
+		ws:         ws,
+		rooms:      make(map[string]bool),
+		revisions:  make(map[string]int),
+		members:    make(map[string]map[string]Member),
+		roomKeys:   make(map[string][]byte),
+		msgCh:      make(chan IncomingMessage, 10),
+		respCh:     make(chan json.RawMessage, 4),
+		typingCh:   make(chan TypingEvent, 10),
+		typingSent: make(map[string]time.Time),
+		errCh:      make(chan RelayError, 4),
+	}
+	setup(c)
+	c.disconnected.Add(1)
+	go c.readLoop()
+	t.Cleanup(c.Close)
+	return c
+}
+
+func TestReadLoop_PreservesStructuredContent(t *testing.T) {
+	c := pipeClient(t, func(ws *websocket.Conn) {
+		ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"message","id":"m1","room":"ops","from":"a",
+			"content":{"type":"command","name":"deploy","args":["web"]},"timestamp":1}`))
+		ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"message","id":"m2","room":"ops","from":"a",
+			"content":{"type":"text","text":"hi"},"timestamp":2}`))
+		time.Sleep(100 * time.Millisecond)
+	})
+
+	cmd := <-c.Messages()
+	var content struct {
+		Type string   `json:"type"`
+		Name string   `json:"name"`
+		Args []string `json:"args"`
+	}
+	if err := json.Unmarshal(cmd.Raw, &content); err != nil {
+		t.Fatalf("raw content not preserved: %v", err)
+	}
+	if content.Type != "command" || content.Name != "deploy" || len(content.Args) != 1 {
+		t.Fatalf("unexpected content: %+v", content)
+	}
+
+	text := <-c.Messages()
+	if text.Text != "hi" || text.Raw != nil {
+		t.Fatalf("text message should not carry raw content: %+v", text)
+	}
+}
+
+func TestSendContent_RequiresType(t *testing.T) {
+	c := &Client{}
+	if _, err := c.SendContent("room", map[string]interface{}{"data": 1}); err == nil {
+		t.Fatal("expected error for content without type")
+	}
+}
+
+// ── Members ─────────────────────────────────────────────────────────────────
+
+func TestJoinedRooms_SortedAndUpdatedOnLeave(t *testing.T) {
+	c := pipeClient(t, func(ws *websocket.Conn) {
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+	_, c.privKey, _ = ed25519.GenerateKey(rand.Reader)
+	c.rooms["zeta"] = true
+	c.rooms["alpha"] = true
+	if got := c.JoinedRooms(); len(got) != 2 || got[0] != "alpha" || got[1] != "zeta" {
+		t.Fatalf("unexpected rooms: %v", got)
+	}
+	c.LeaveRoom("zeta")
+	if got := c.JoinedRooms(); len(got) != 1 || got[0] != "alpha" {
+		t.Fatalf("left room still listed: %v", got)
+	}
+}
+
+func TestMembers_TrackedFromEvents(t *testing.T) {
+	c := pipeClient(t, func(ws *websocket.Conn) {
+		for _, ev := range []string{
+			`{"type":"room.joined","room":"lab","members":[{"id":"a","name":"alice"},{"id":"b","name":"bob"}]}`,
+			`{"type":"room.member_joined","room":"lab","member":{"id":"c","name":"carol"}}`,
+			`{"type":"room.member_left","room":"lab","member":{"id":"a","name":"alice"}}`,
+			`{"type":"room.member_joined","room":"elsewhere","member":{"id":"d","name":"dave"}}`,
+		} {
+			ws.WriteMessage(websocket.TextMessage, []byte(ev))
+		}
+		// Marker so the test knows every event before it was processed.
+		ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"message","room":"lab","content":{"type":"text","text":"done"}}`))
+		time.Sleep(100 * time.Millisecond)
+	})
+	<-c.Messages()
+
+	got := c.Members("lab")
+	if len(got) != 2 || got[0].Name != "bob" || got[1].Name != "carol" {
+		t.Fatalf("unexpected members: %+v", got)
+	}
+	if c.Members("elsewhere") != nil {
+		t.Fatal("rooms not joined should not be tracked")
+	}
+}
+
+// ── Backpressure ────────────────────────────────────────────────────────────
+
+func TestReadLoop_DropsWhenConsumerStalls(t *testing.T) {
+	c := pipeClient(t, func(ws *websocket.Conn) {
+		// pipeClient buffers 10 messages; nobody reads, so two are dropped.
+		for i := 0; i < 12; i++ {
+			ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"message","room":"r","content":{"type":"text","text":"x"}}`))
+		}
+		// Marker proving the read loop kept going instead of blocking.
+		ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"typing","room":"r","from":"a","active":true}`))
+		time.Sleep(100 * time.Millisecond)
+	})
+
+	select {
+	case <-c.Typing():
+	case <-time.After(2 * time.Second):
+		t.Fatal("read loop stalled behind a full message channel")
+	}
+	if n := c.Dropped(); n != 2 {
+		t.Fatalf("expected 2 dropped, got %d", n)
+	}
+}
+
+func TestEditMessage_RevisionsIncreaseAcrossConnections(t *testing.T) {
+	revisions := make(chan int, 4)
+	edit := func() {
+		c := pipeClient(t, func(ws *websocket.Conn) {
+			for {
+				var msg struct {
+					Revision int `json:"revision"`
+				}
+				if err := ws.ReadJSON(&msg); err != nil {
+					return
+				}
+				revisions <- msg.Revision
+			}
+		})
+		c.privKey = ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+		for i := 0; i < 2; i++ {
+			if err := c.EditMessage("lab", "m1", "x"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		c.Close()
+	}
+	edit()
+	edit() // a new connection, as after a reconnect or restart
+
+	last := 0
+	for i := 0; i < 4; i++ {
+		r := <-revisions
+		if r <= last {
+			t.Fatalf("revision %d after %d would be dropped as stale", r, last)
+		}
+		last = r
+	}
+}
+
+// ── Read-only ───────────────────────────────────────────────────────────────
+
+func TestReadOnly_RefusesWrites(t *testing.T) {
+	c := &Client{typingSent: make(map[string]time.Time)}
+	c.SetReadOnly(true)
+
+	if _, err := c.SendMessage("room", "hi"); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("SendMessage: %v", err)
+	}
+	if _, err := c.CreateRoom("room", "", nil); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("CreateRoom: %v", err)
+	}
+	if err := c.EditMessage("room", "m1", "x"); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("EditMessage: %v", err)
+	}
+	if err := c.DeleteMessage("room", "m1"); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("DeleteMessage: %v", err)
+	}
+	if err := c.SetTyping("room", true); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("SetTyping: %v", err)
+	}
+}
+
+// ── Send acknowledgements ───────────────────────────────────────────────────
+
+// ackServer replies to each message with reply(id), or not at all if reply returns "".
+func ackServer(reply func(id string) string) func(*websocket.Conn) {
+	return func(ws *websocket.Conn) {
+		for {
+			_, raw, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			var msg struct {
+				ID string `json:"id"`
+			}
+			json.Unmarshal(raw, &msg)
+			if r := reply(msg.ID); r != "" {
+				ws.WriteMessage(websocket.TextMessage, []byte(r))
+			}
+		}
+	}
+}
+
+func TestSendWait_Acked(t *testing.T) {
+	c := pipeClient(t, ackServer(func(id string) string {
+		// An unrelated ack first must not be mistaken for ours.
+		return `{"type":"message.ack","id":"other"}`
+	}))
+	c.privKey = ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	if _, acked, err := c.SendWait("r", map[string]interface{}{"type": "text", "text": "hi"}, "", 100*time.Millisecond); err != nil || acked {
+		t.Fatalf("foreign ack should not count: acked=%v err=%v", acked, err)
+	}
+
+	c = pipeClient(t, ackServer(func(id string) string {
+		return `{"type":"message.ack","id":"` + id + `"}`
+	}))
+	c.privKey = ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	id, acked, err := c.SendWait("r", map[string]interface{}{"type": "text", "text": "hi"}, "", time.Second)
+	if err != nil || !acked || id == "" {
+		t.Fatalf("expected ack: id=%q acked=%v err=%v", id, acked, err)
+	}
+}
+
+func TestSendWait_RelayError(t *testing.T) {
+	c := pipeClient(t, ackServer(func(string) string {
+		return `{"type":"error","code":"ROOM_NOT_FOUND","message":"no such room"}`
+	}))
+	c.privKey = ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	_, _, err := c.SendWait("r", map[string]interface{}{"type": "text", "text": "hi"}, "", time.Second)
+	var relayErr *RelayError
+	if !errors.As(err, &relayErr) || relayErr.Code != "ROOM_NOT_FOUND" {
+		t.Fatalf("expected relay error, got %v", err)
+	}
+}
+
+func TestSendWait_NoAckDegrades(t *testing.T) {
+	c := pipeClient(t, ackServer(func(string) string { return "" }))
+	c.privKey = ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	id, acked, err := c.SendWait("r", map[string]interface{}{"type": "text", "text": "hi"}, "", 50*time.Millisecond)
+	if err != nil || acked || id == "" {
+		t.Fatalf("expected fire-and-forget fallback: id=%q acked=%v err=%v", id, acked, err)
+	}
+}
+
+// ── Latency ─────────────────────────────────────────────────────────────────
+
+func TestLastRTT_MeasuredFromPong(t *testing.T) {
+	c := pipeClient(t, func(ws *websocket.Conn) {
+		time.Sleep(20 * time.Millisecond)
+		ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"pong"}`))
+		ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"typing","room":"r","from":"a","active":true}`))
+		time.Sleep(100 * time.Millisecond)
+	})
+	if c.LastRTT() != 0 || !c.LastPong().IsZero() {
+		t.Fatal("RTT should be unknown before any pong")
+	}
+	c.pingSentAt.Store(time.Now().UnixNano())
+	<-c.Typing() // pong processed
+
+	if rtt := c.LastRTT(); rtt < 10*time.Millisecond || rtt > time.Second {
+		t.Fatalf("implausible RTT %v", rtt)
+	}
+	if since := time.Since(c.LastPong()); since < 0 || since > time.Second {
+		t.Fatalf("implausible last pong %v ago", since)
+	}
+}
+
+func TestPing_KeepsUnansweredTiming(t *testing.T) {
+	c := pipeClient(t, func(ws *websocket.Conn) {
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+	sent := time.Now().Add(-time.Second).UnixNano()
+	c.pingSentAt.Store(sent)
+	c.ping()
+	if got := c.pingSentAt.Load(); got != sent {
+		t.Fatal("a second ping restamped the one still awaiting its pong")
+	}
+
+	c.pingSentAt.Store(0)
+	c.ping()
+	if c.pingSentAt.Load() == 0 {
+		t.Fatal("ping with no pong outstanding wasn't timed")
+	}
+}
+
+// ── Resume ──────────────────────────────────────────────────────────────────
+
+func TestJoinRoomSince_SendsCursor(t *testing.T) {
+	since := make(chan int64, 1)
+	c := pipeClient(t, func(ws *websocket.Conn) {
+		_, raw, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		var join struct {
+			Room  string `json:"room"`
+			Since int64  `json:"since"`
+		}
+		json.Unmarshal(raw, &join)
+		since <- join.Since
+		ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"room.joined","room":"`+join.Room+`","members":[]}`))
+		time.Sleep(100 * time.Millisecond)
+	})
+	c.privKey = ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+
+	if _, err := c.JoinRoomSince("lab", 1700000000000); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-since; got != 1700000000000 {
+		t.Fatalf("relay got since=%d", got)
+	}
+}
+
+func TestJoinRoomSince_MarksReplayedMessages(t *testing.T) {
+	c := pipeClient(t, func(ws *websocket.Conn) {
+		if _, _, err := ws.ReadMessage(); err != nil {
+			return
+		}
+		now := time.Now().UnixMilli()
+		ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"room.joined","room":"lab","members":[]}`))
+		ws.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"type":"message","id":"old","room":"lab","from":"a","content":{"type":"text","text":"missed"},"timestamp":%d}`, now-60000)))
+		ws.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"type":"message","id":"new","room":"lab","from":"a","content":{"type":"text","text":"live"},"timestamp":%d}`, now+1000)))
+		time.Sleep(100 * time.Millisecond)
+	})
+	c.privKey = ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+
+	if _, err := c.JoinRoomSince("lab", 1700000000000); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []struct {
+		id       string
+		replayed bool
+	}{{"old", true}, {"new", false}} {
+		msg := <-c.Messages()
+		if msg.ID != want.id || msg.Replayed != want.replayed {
+			t.Fatalf("got %s replayed=%v, want %s replayed=%v", msg.ID, msg.Replayed, want.id, want.replayed)
+		}
+	}
+}
+
+func TestJoinRoomWithToken(t *testing.T) {
+	tokens := make(chan string, 3)
+	c := pipeClient(t, func(ws *websocket.Conn) {
+		for {
+			_, raw, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			var join struct {
+				Room  string `json:"room"`
+				Token string `json:"token"`
+			}
+			json.Unmarshal(raw, &join)
+			tokens <- join.Token
+			if join.Token != "right" {
+				ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"error","code":"UNAUTHORIZED","message":"bad token"}`))
+				continue
+			}
+			ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"room.joined","room":"`+join.Room+`","members":[]}`))
+		}
+	})
+	c.privKey = ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+
+	if _, err := c.JoinRoomWithToken("private", "wrong"); !errors.Is(err, ErrUnauthorizedRoom) {
+		t.Fatalf("expected ErrUnauthorizedRoom, got %v", err)
+	}
+	if _, err := c.JoinRoomWithToken("private", "right"); err != nil {
+		t.Fatal(err)
+	}
+	// A later join, e.g. a rejoin, presents the accepted token again.
+	if _, err := c.JoinRoom("private"); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"wrong", "right", "right"} {
+		if got := <-tokens; got != want {
+			t.Fatalf("relay got token %q, want %q", got, want)
+		}
+	}
+}
+
+func TestListRooms_ForwardsTagsAndLimit(t *testing.T) {
+	got := make(chan map[string]interface{}, 2)
+	c := pipeClient(t, func(ws *websocket.Conn) {
+		for {
+			_, raw, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			var req map[string]interface{}
+			json.Unmarshal(raw, &req)
+			got <- req
+			if req["tags"] == nil {
+				ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"error","code":"RATE_LIMITED","message":"slow down"}`))
+				continue
+			}
+			ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"rooms.list.result","rooms":[{"name":"lab","tags":["ai","ops"],"agents":3,"last_active":1700000000000}]}`))
+		}
+	})
+
+	rooms, err := c.ListRooms([]string{"ai", "ops"}, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := <-got
+	if tags, _ := req["tags"].([]interface{}); len(tags) != 2 || req["limit"] != float64(20) {
+		t.Fatalf("unexpected request %v", req)
+	}
+	if len(rooms) != 1 || rooms[0].Agents != 3 || rooms[0].LastActive != 1700000000000 {
+		t.Fatalf("unexpected rooms %+v", rooms)
+	}
+
+	var relayErr *RelayError
+	if _, err := c.ListRooms(nil, 20); !errors.As(err, &relayErr) || relayErr.Code != "RATE_LIMITED" {
+		t.Fatalf("expected the relay error, got %v", err)
+	}
+	if _, err := c.ListRooms([]string{"two words"}, 20); !errors.Is(err, ErrInvalidTags) {
+		t.Fatalf("expected ErrInvalidTags, got %v", err)
+	}
+}
+
+func TestListMyRooms(t *testing.T) {
+	got := make(chan map[string]interface{}, 2)
+	serve := func(ws *websocket.Conn) {
+		for {
+			_, raw, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			var req map[string]interface{}
+			json.Unmarshal(raw, &req)
+			got <- req
+			ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"rooms.list.result","rooms":[{"name":"lab","agents":3},{"name":"ops","agents":1},{"name":"cafe","agents":9}]}`))
+		}
+	}
+
+	// Local fallback: the global list intersected with the joined rooms.
+	c := pipeClientWith(t, serve, func(c *Client) {
+		c.rooms["ops"], c.rooms["lab"], c.rooms["secret"] = true, true, true
+	})
+	rooms, err := c.ListMyRooms(nil, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req := <-got; req["filter"] != nil || req["limit"] != float64(myRoomsScan) {
+		t.Fatalf("unexpected request %v", req)
+	}
+	if len(rooms) != 3 || rooms[0].Name != "lab" || rooms[0].Agents != 3 || rooms[1].Name != "ops" || rooms[2].Name != "secret" {
+		t.Fatalf("unexpected rooms %+v", rooms)
+	}
+
+	// A relay advertising the filter is asked for it.
+	c = pipeClientWith(t, serve, func(c *Client) {
+		c.capabilities = &Capabilities{Features: []string{FeatureRoomFilter}}
+	})
+	rooms, err = c.ListMyRooms(nil, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req := <-got; req["filter"] != "mine" || req["limit"] != float64(20) {
+		t.Fatalf("unexpected request %v", req)
+	}
+	if len(rooms) != 3 {
+		t.Fatalf("expected the relay's list as is, got %+v", rooms)
+	}
+}
+
+// ── Room updates ────────────────────────────────────────────────────────────
+
+func TestUpdateRoom_NotOwner(t *testing.T) {
+	got := make(chan map[string]interface{}, 1)
+	c := pipeClient(t, func(ws *websocket.Conn) {
+		_, raw, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		var msg map[string]interface{}
+		json.Unmarshal(raw, &msg)
+		got <- msg
+		ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"error","code":"NOT_OWNER","message":"not the room owner"}`))
+		time.Sleep(100 * time.Millisecond)
+	})
+	c.privKey = ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+
+	err := c.UpdateRoom("lab", "new topic", nil)
+	if !errors.Is(err, ErrNotOwner) {
+		t.Fatalf("expected ErrNotOwner, got %v", err)
+	}
+	msg := <-got
+	if msg["type"] != "room.update" || msg["topic"] != "new topic" || msg["signature"] == nil {
+		t.Fatalf("unexpected envelope %v", msg)
+	}
+	if _, ok := msg["tags"]; ok {
+		t.Fatal("nil tags should leave tags unchanged")
+	}
+}
+
+func TestUpdateRoom_WaitsForConfirmation(t *testing.T) {
+	defer func(d time.Duration) { confirmTimeout = d }(confirmTimeout)
+	confirmTimeout = 200 * time.Millisecond
+
+	c := pipeClient(t, func(ws *websocket.Conn) {
+		ws.ReadMessage()
+		// A stale error for another request and another room's update aren't the answer.
+		ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"error","code":"RATE_LIMITED","message":"slow down","nonce":"earlier"}`))
+		ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"room.updated","room":"ops"}`))
+		ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"room.updated","room":"lab"}`))
+
+		ws.ReadMessage()
+		ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"error","code":"INVALID_TAGS","message":"bad tag"}`))
+
+		ws.ReadMessage() // the relay says nothing to the third update
+		ws.ReadMessage()
+	})
+	c.privKey = ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	if err := c.UpdateRoom("lab", "", []string{"go"}); err != nil {
+		t.Fatal(err)
+	}
+	var relayErr *RelayError
+	if err := c.UpdateRoom("lab", "", []string{"go"}); !errors.As(err, &relayErr) || relayErr.Code != "INVALID_TAGS" {
+		t.Fatalf("expected the relay's refusal, got %v", err)
+	}
+	if err := c.UpdateRoom("lab", "new topic", nil); !errors.Is(err, ErrUnconfirmed) {
+		t.Fatalf("expected ErrUnconfirmed, got %v", err)
+	}
+	if err := c.UpdateRoom("lab", "", nil); err == nil {
+		t.Fatal("expected error for an empty update")
+	}
+}
+
+// ── Unsolicited errors ──────────────────────────────────────────────────────
+
+func TestReadLoop_UnsolicitedErrors(t *testing.T) {
+	c := pipeClient(t, func(ws *websocket.Conn) {
+		ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"error","code":"KICKED","message":"removed from lab"}`))
+		ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"error","code":"BANNED","message":"agent banned"}`))
+		time.Sleep(100 * time.Millisecond)
+	})
+
+	first := <-c.Errors()
+	if first.Code != "KICKED" || first.Fatal() {
+		t.Fatalf("unexpected first error %+v", first)
+	}
+	second := <-c.Errors()
+	if second.Code != "BANNED" || !second.Fatal() {
+		t.Fatalf("unexpected second error %+v", second)
+	}
+	select {
+	case resp := <-c.respCh:
+		t.Fatalf("unsolicited error leaked to responses: %s", resp)
+	default:
+	}
+}
+
+func TestReadLoop_ErrorDuringOperationIsAResponse(t *testing.T) {
+	c := pipeClient(t, ackServer(func(string) string {
+		return `{"type":"error","code":"ROOM_NOT_FOUND","message":"no such room"}`
+	}))
+	c.privKey = ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	if _, _, err := c.SendWait("r", map[string]interface{}{"type": "text", "text": "hi"}, "", time.Second); err == nil {
+		t.Fatal("expected the operation to see the error")
+	}
+	select {
+	case e := <-c.Errors():
+		t.Fatalf("response error reported as unsolicited: %+v", e)
+	default:
+	}
+}
+
+func TestLockOp_ErrorBeforeWaitingIsAResponse(t *testing.T) {
+	c := pipeClient(t, func(ws *websocket.Conn) {
+		ws.ReadMessage()
+		ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"error","code":"RATE_LIMITED","message":"slow down"}`))
+		ws.ReadMessage()
+	})
+	unlock := c.lockOp()
+	if err := c.writeJSON(map[string]interface{}{"type": "rooms.list"}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond) // the error beats the wait
+	err := c.awaitRelayError()
+	unlock()
+	if err == nil {
+		t.Fatal("expected the operation to see the error")
+	}
+	select {
+	case e := <-c.Errors():
+		t.Fatalf("response error reported as unsolicited: %+v", e)
+	default:
+	}
+}
+
+// ── Batch send ──────────────────────────────────────────────────────────────
+
+func TestSendMessages_PartialFailure(t *testing.T) {
+	n := 0
+	c := pipeClient(t, ackServer(func(string) string {
+		if n++; n == 2 {
+			return `{"type":"error","code":"CONTENT_TOO_LARGE","message":"too large"}`
+		}
+		return ""
+	}))
+	c.privKey = ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+
+	ids, err := c.SendMessages("r", []string{"one", "two", "three"})
+	if err == nil || !strings.Contains(err.Error(), "message 1") {
+		t.Fatalf("expected failure at message 1, got %v", err)
+	}
+	if len(ids) != 1 || ids[0] == "" {
+		t.Fatalf("expected the first ID only, got %v", ids)
+	}
+}
+
+func TestSendMessages_ValidatesBeforeSending(t *testing.T) {
+	c := &Client{}
+	if _, err := c.SendMessages("r", []string{"ok", ""}); err == nil {
+		t.Fatal("expected an empty text to fail validation")
+	}
+	if _, err := c.SendMessages("r", nil); err == nil {
+		t.Fatal("expected an empty batch to fail")
+	}
+}
+
+// ── Idle timeout ────────────────────────────────────────────────────────────
+
+func TestReadLoop_ClosesSilentConnection(t *testing.T) {
+	released := make(chan struct{})
+	defer close(released)
+	c := pipeClientWith(t, func(ws *websocket.Conn) {
+		<-released // half-open: never send anything
+	}, func(c *Client) { c.pingInterval = 20 * time.Millisecond })
+
+	done := make(chan struct{})
+	go func() {
+		c.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("readLoop did not give up on a silent connection")
+	}
+}
+
+// ── Handshake ───────────────────────────────────────────────────────────────
+
+// fakeRelay starts a relay that completes the handshake with welcome and then
+// hands the connection to serve. It returns the ws:// URL.
+func fakeRelay(t *testing.T, welcome interface{}, serve func(r *http.Request, ws *websocket.Conn)) string {
+	t.Helper()
+	upgrader := websocket.Upgrader{EnableCompression: true}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		ws.ReadMessage() // hello
+		ws.WriteJSON(map[string]interface{}{"type": "pow.challenge", "challenge": "c", "difficulty": 1})
+		ws.ReadMessage() // hello.pow
+		ws.WriteJSON(welcome)
+		serve(r, ws)
+	}))
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func TestHandshake_NegotiatesProtocolVersion(t *testing.T) {
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	idle := func(*http.Request, *websocket.Conn) { time.Sleep(100 * time.Millisecond) }
+
+	url := fakeRelay(t, map[string]string{"type": "welcome", "protocol_version": "0.1.0", "signature_algorithm": "ed25519"}, idle)
+	c, err := ConnectWithOptions(context.Background(), url, "a", "tester", priv, ConnectOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	if c.ProtocolVersion() != "0.1.0" {
+		t.Fatalf("negotiated %q", c.ProtocolVersion())
+	}
+
+	// A relay that predates negotiation speaks the original version.
+	url = fakeRelay(t, map[string]string{"type": "welcome"}, idle)
+	if c, err = ConnectWithOptions(context.Background(), url, "a", "tester", priv, ConnectOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	if c.ProtocolVersion() != "0.1.0" {
+		t.Fatalf("legacy relay: got %q", c.ProtocolVersion())
+	}
+
+	url = fakeRelay(t, map[string]string{"type": "welcome", "protocol_version": "9.0.0"}, idle)
+	if _, err := ConnectWithOptions(context.Background(), url, "a", "tester", priv, ConnectOptions{}); err == nil || !strings.Contains(err.Error(), "9.0.0") {
+		t.Fatalf("expected an unsupported version error, got %v", err)
+	}
+}
+
+func TestHandshake_MeasuresClockSkew(t *testing.T) {
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	idle := func(*http.Request, *websocket.Conn) { time.Sleep(100 * time.Millisecond) }
+
+	// The relay's clock is 90s behind ours.
+	serverTime := time.Now().Add(-90 * time.Second).UnixMilli()
+	url := fakeRelay(t, map[string]interface{}{"type": "welcome", "server_time": serverTime}, idle)
+	c, err := ConnectWithOptions(context.Background(), url, "a", "tester", priv, ConnectOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	skew, ok := c.ClockSkew()
+	if !ok || (skew-90*time.Second).Abs() > 5*time.Second {
+		t.Fatalf("got skew %v (known %v), want about 90s", skew, ok)
+	}
+
+	url = fakeRelay(t, map[string]string{"type": "welcome"}, idle)
+	if c, err = ConnectWithOptions(context.Background(), url, "a", "tester", priv, ConnectOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	if _, ok := c.ClockSkew(); ok {
+		t.Fatal("skew should be unknown when the relay doesn't report its time")
+	}
+}
+
+func TestHandshake_RejectionNamesClockSkew(t *testing.T) {
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	url := fakeRelay(t, map[string]interface{}{
+		"type":        "error",
+		"code":        "INVALID_TIMESTAMP",
+		"message":     "timestamp out of range",
+		"server_time": time.Now().Add(-90 * time.Second).UnixMilli(),
+	}, func(*http.Request, *websocket.Conn) {})
+
+	_, err := ConnectWithOptions(context.Background(), url, "a", "tester", priv, ConnectOptions{})
+	if !errors.Is(err, ErrAuthRejected) {
+		t.Fatalf("expected ErrAuthRejected, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "ahead of the relay") {
+		t.Fatalf("error should name the skewed clock: %v", err)
+	}
+}
+
+func TestHandshake_TransientRefusalIsRetryable(t *testing.T) {
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	for code, auth := range map[string]bool{"RATE_LIMITED": false, "INTERNAL_ERROR": false, "BANNED": true, "INVALID_SIGNATURE": true} {
+		url := fakeRelay(t, map[string]interface{}{"type": "error", "code": code, "message": "refused"}, func(*http.Request, *websocket.Conn) {})
+		_, err := ConnectWithOptions(context.Background(), url, "a", "tester", priv, ConnectOptions{})
+		var relayErr *RelayError
+		if !errors.As(err, &relayErr) || relayErr.Code != code {
+			t.Fatalf("%s: expected the relay error, got %v", code, err)
+		}
+		if errors.Is(err, ErrAuthRejected) != auth {
+			t.Fatalf("%s: ErrAuthRejected is %v, want %v", code, errors.Is(err, ErrAuthRejected), auth)
+		}
+	}
+}
+
+// strictRelay is a test relay that checks the handshake as a real one does:
+// message shapes, each message's signature against the agent ID in hello
+// (re-encoded independently of canonicalJSON, as the relay sees it), and
+// the proof-of-work. It answers a failed check with an AUTH_FAILED error and
+// reports it on the returned channel, which is closed once hello.pow has
+// been checked.
+func strictRelay(t *testing.T, difficulty int) (string, <-chan string) {
+	t.Helper()
+	failures := make(chan string, 1)
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		fail := func(format string, args ...interface{}) {
+			reason := fmt.Sprintf(format, args...)
+			failures <- reason
+			ws.WriteJSON(map[string]string{"type": "error", "code": "AUTH_FAILED", "message": reason})
+		}
+		read := func(pub ed25519.PublicKey) (map[string]interface{}, ed25519.PublicKey, bool) {
+			var msg map[string]interface{}
+			if err := ws.ReadJSON(&msg); err != nil {
+				fail("read: %v", err)
+				return nil, nil, false
+			}
+			if pub == nil {
+				profile, _ := msg["profile"].(map[string]interface{})
+				id, _ := profile["id"].(string)
+				if pub = base58.Decode(id); len(pub) != ed25519.PublicKeySize {
+					fail("hello: bad profile.id %q", id)
+					return nil, nil, false
+				}
+			}
+			sig, _ := msg["signature"].(string)
+			delete(msg, "signature")
+			var signed bytes.Buffer
+			enc := json.NewEncoder(&signed) // sorts map keys, as the relay does
+			enc.SetEscapeHTML(false)
+			enc.Encode(msg)
+			if !ed25519.Verify(pub, bytes.TrimSuffix(signed.Bytes(), []byte("\n")), base58.Decode(sig)) {
+				fail("%v: bad signature", msg["type"])
+				return nil, nil, false
+			}
+			return msg, pub, true
+		}
+
+		hello, pub, ok := read(nil)
+		if !ok {
+			return
+		}
+		profile := hello["profile"].(map[string]interface{})
+		ts, _ := hello["timestamp"].(float64)
+		switch {
+		case hello["type"] != "hello":
+			fail("expected hello, got %v", hello["type"])
+			return
+		case profile["name"] != "tester" || profile["version"] == nil:
+			fail("hello: bad profile %v", profile)
+			return
+		case hello["nonce"] == "" || hello["nonce"] == nil:
+			fail("hello: no nonce")
+			return
+		case time.Since(time.UnixMilli(int64(ts))).Abs() > time.Minute:
+			fail("hello: timestamp %v out of range", hello["timestamp"])
+			return
+		case hello["protocol_versions"] == nil || hello["signature_algorithms"] == nil:
+			fail("hello: no version negotiation")
+			return
+		}
+
+		challenge := randomNonce()
+		ws.WriteJSON(map[string]interface{}{"type": "pow.challenge", "challenge": challenge, "difficulty": difficulty})
+		powMsg, _, ok := read(pub)
+		if !ok {
+			return
+		}
+		pow, _ := powMsg["pow"].(map[string]interface{})
+		proof, _ := pow["proof"].(string)
+		hash := sha256.Sum256([]byte(challenge + proof))
+		zeros := 0
+		for _, b := range hash {
+			if b != 0 {
+				zeros += bits.LeadingZeros8(b)
+				break
+			}
+			zeros += 8
+		}
+		switch {
+		case powMsg["type"] != "hello.pow":
+			fail("expected hello.pow, got %v", powMsg["type"])
+			return
+		case pow["challenge"] != challenge:
+			fail("hello.pow: challenge %v, want %s", pow["challenge"], challenge)
+			return
+		case zeros < difficulty:
+			fail("hello.pow: proof %q has %d leading zero bits, want %d", proof, zeros, difficulty)
+			return
+		}
+		close(failures)
+		ws.WriteJSON(map[string]interface{}{"type": "welcome", "protocol_version": "0.1.0", "signature_algorithm": "ed25519", "server_time": time.Now().UnixMilli()})
+		ws.ReadMessage() // until the client closes
+	}))
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http"), failures
+}
+
+func TestHandshake_AgainstStrictRelay(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	url, failures := strictRelay(t, 8)
+	c, err := ConnectWithOptions(context.Background(), url, base58.Encode(pub), "tester", priv, ConnectOptions{})
+	if reason, failed := <-failures; failed {
+		t.Fatalf("relay refused the handshake: %s", reason)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if c.ProtocolVersion() != "0.1.0" {
+		t.Fatalf("negotiated %q", c.ProtocolVersion())
+	}
+
+	// Signed with a key that isn't the agent's: the relay must refuse it.
+	other, _, _ := ed25519.GenerateKey(rand.Reader)
+	url, failures = strictRelay(t, 8)
+	_, err = ConnectWithOptions(context.Background(), url, base58.Encode(other), "tester", priv, ConnectOptions{})
+	if _, failed := <-failures; !failed || !errors.Is(err, ErrAuthRejected) {
+		t.Fatalf("expected the relay to reject the signature, got %v", err)
+	}
+}
+
+func TestDescribeClockSkew(t *testing.T) {
+	for skew, want := range map[time.Duration]string{
+		90 * time.Second: "1m30s ahead of the relay",
+		-2 * time.Second: "2s behind the relay",
+		0:                "in sync with the relay",
+	} {
+		if got := DescribeClockSkew(skew); got != want {
+			t.Fatalf("%v: got %q, want %q", skew, got, want)
+		}
+	}
+}
+
+func TestConnect_SendsHeaders(t *testing.T) {
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	got := make(chan string, 1)
+	url := fakeRelay(t, map[string]string{"type": "welcome"}, func(r *http.Request, ws *websocket.Conn) {
+		got <- r.Header.Get("Authorization")
+	})
+
+	c, err := ConnectWithOptions(context.Background(), url, "a", "tester", priv, ConnectOptions{
+		Header: http.Header{"Authorization": {"Bearer proxy-token"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	if auth := <-got; auth != "Bearer proxy-token" {
+		t.Fatalf("relay saw Authorization %q", auth)
+	}
+}
+
+// ── Compression ─────────────────────────────────────────────────────────────
+
+func TestConnect_CompressionIsTransparentToSignatures(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	negotiated := make(chan bool, 1)
+	verified := make(chan bool, 1)
+
+	url := fakeRelay(t, map[string]string{"type": "welcome"}, func(r *http.Request, ws *websocket.Conn) {
+		negotiated <- strings.Contains(r.Header.Get("Sec-WebSocket-Extensions"), "permessage-deflate")
+		for {
+			_, raw, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			var msg map[string]interface{}
+			json.Unmarshal(raw, &msg)
+			if msg["type"] != "message" {
+				continue // pings
+			}
+			sig, _ := msg["signature"].(string)
+			delete(msg, "signature")
+			canon, _ := canonicalJSON(msg)
+			verified <- ed25519.Verify(pub, canon, base58.Decode(sig))
+			ws.WriteMessage(websocket.TextMessage, raw) // echo it back as an incoming message
+		}
+	})
+
+	c, err := ConnectWithOptions(context.Background(), url, base58.Encode(pub), "tester", priv, ConnectOptions{Compression: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if !<-negotiated {
+		t.Fatal("client did not offer permessage-deflate")
+	}
+
+	text := strings.Repeat(`{"report": "compressible"} `, 500)
+	if _, err := c.SendMessage("lab", text); err != nil {
+		t.Fatal(err)
+	}
+	if !<-verified {
+		t.Fatal("signature did not verify after compression")
+	}
+	if got := <-c.Messages(); got.Text != text {
+		t.Fatalf("payload changed in transit: %d bytes, want %d", len(got.Text), len(text))
+	}
+}
+
+func TestRecvTyped_MatchesEchoedNonce(t *testing.T) {
+	c := &Client{respCh: make(chan json.RawMessage, 4)}
+	c.respCh <- json.RawMessage(`{"type":"room.joined","room":"a","nonce":"old"}`) // an earlier join gave up on this
+	c.respCh <- json.RawMessage(`{"type":"rooms.list.result","nonce":"other"}`)
+	c.respCh <- json.RawMessage(`{"type":"room.joined","room":"a","nonce":"mine"}`)
+
+	resp, err := c.recvTyped("mine", "a", "room.joined", "error")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(resp), `"mine"`) {
+		t.Fatalf("took the wrong response: %s", resp)
+	}
+	if len(c.held) != 1 || !strings.Contains(string(c.held[0]), "rooms.list.result") {
+		t.Fatalf("expected only the unrelated response held, got %q", c.held)
+	}
+}
+
+func TestRecvMatch_HeldResponsesKeepOrder(t *testing.T) {
+	c := &Client{respCh: make(chan json.RawMessage, 4)}
+	for _, r := range []string{`{"type":"x","n":1}`, `{"type":"x","n":2}`, `{"type":"y"}`} {
+		c.respCh <- json.RawMessage(r)
+	}
+	isType := func(typ string) func(json.RawMessage) bool {
+		return func(resp json.RawMessage) bool {
+			var env struct {
+				Type string `json:"type"`
+			}
+			json.Unmarshal(resp, &env)
+			return env.Type == typ
+		}
+	}
+	if _, err := c.recvMatch(time.Second, isType("y")); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"n":1`, `"n":2`} {
+		resp, err := c.recvMatch(time.Second, isType("x"))
+		if err != nil || !strings.Contains(string(resp), want) {
+			t.Fatalf("want %s next, got %s (%v)", want, resp, err)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Disconnect describes how a connection ended.
+type Disconnect struct {
+	Code   int       `json:"code,omitempty"`   // websocket close code; 1006 if the connection dropped without one, 0 on other errors
+	Reason string    `json:"reason,omitempty"` // close reason the relay gave, if any
+	Error  string    `json:"error,omitempty"`  // the read error, when there was no close code
+	Local  bool      `json:"local,omitempty"`  // this side closed the connection
+	At     time.Time `json:"at"`
+}
+
+// closeCodeNames are the RFC 6455 names of the close codes relays send.
+var closeCodeNames = map[int]string{
+	websocket.CloseNormalClosure:           "normal closure",
+	websocket.CloseGoingAway:               "going away",
+	websocket.CloseProtocolError:           "protocol error",
+	websocket.CloseUnsupportedData:         "unsupported data",
+	websocket.CloseNoStatusReceived:        "no status",
+	websocket.CloseAbnormalClosure:         "abnormal closure",
+	websocket.CloseInvalidFramePayloadData: "invalid payload",
+	websocket.ClosePolicyViolation:         "policy violation",
+	websocket.CloseMessageTooBig:           "message too big",
+	websocket.CloseMandatoryExtension:      "mandatory extension",
+	websocket.CloseInternalServerErr:       "internal server error",
+	websocket.CloseServiceRestart:          "service restart",
+	websocket.CloseTryAgainLater:           "try again later",
+}
+
+// String reads like "close 1008 (policy violation): banned".
+func (d *Disconnect) String() string {
+	switch {
+	case d.Local:
+		return "closed locally"
+	case d.Code == 0:
+		return d.Error
+	}
+	s := fmt.Sprintf("close %d", d.Code)
+	if name, ok := closeCodeNames[d.Code]; ok {
+		s += " (" + name + ")"
+	}
+	if d.Reason != "" {
+		s += ": " + d.Reason
+	}
+	return s
+}
+
+// newDisconnect describes the read error err that ended a connection.
+func newDisconnect(err error, local bool) *Disconnect {
+	d := &Disconnect{Local: local, At: time.Now()}
+	var closeErr *websocket.CloseError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &closeErr):
+		d.Code, d.Reason = closeErr.Code, closeErr.Text
+	case errors.As(err, &netErr) && netErr.Timeout():
+		d.Error = "read timeout"
+	default:
+		d.Error = err.Error()
+	}
+	return d
+}
+
+// LastDisconnect returns how the connection ended, or nil while it is up.
+func (c *Client) LastDisconnect() *Disconnect {
+	return c.disconnect.Load()
+}
@@ -0,0 +1,42 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestLastDisconnect_CloseCodeAndReason(t *testing.T) {
+	c := pipeClient(t, func(ws *websocket.Conn) {
+		ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "banned"))
+		ws.ReadMessage() // the client's close reply
+	})
+	if c.LastDisconnect() != nil {
+		t.Fatal("disconnect reported while connected")
+	}
+	c.Wait()
+	d := c.LastDisconnect()
+	if d == nil || d.Code != websocket.ClosePolicyViolation || d.Reason != "banned" || d.Local {
+		t.Fatalf("got %+v", d)
+	}
+	if got, want := d.String(), "close 1008 (policy violation): banned"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestLastDisconnect_DroppedAndLocal(t *testing.T) {
+	// No close frame: the relay just goes away.
+	c := pipeClient(t, func(ws *websocket.Conn) {})
+	c.Wait()
+	if d := c.LastDisconnect(); d == nil || d.Code != websocket.CloseAbnormalClosure || d.Local {
+		t.Fatalf("dropped: got %+v", d)
+	}
+
+	c = pipeClient(t, func(ws *websocket.Conn) { time.Sleep(time.Second) })
+	c.Close()
+	c.Wait()
+	if d := c.LastDisconnect(); d == nil || !d.Local || d.String() != "closed locally" {
+		t.Fatalf("local close: got %+v", d)
+	}
+}
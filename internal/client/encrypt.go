@@ -0,0 +1,115 @@
+package client
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// EncryptionAlg identifies the AEAD used for encrypted room content.
+const EncryptionAlg = "aes-256-gcm"
+
+// SetRoomKey sets the 32-byte symmetric key used to encrypt outgoing and
+// decrypt incoming messages in room. Keys are provisioned out-of-band; the
+// relay only sees ciphertext. A nil key returns the room to plaintext.
+func (c *Client) SetRoomKey(room string, key []byte) error {
+	if key != nil && len(key) != 32 {
+		return fmt.Errorf("room key must be 32 bytes, got %d", len(key))
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if key == nil {
+		delete(c.roomKeys, room)
+	} else {
+		c.roomKeys[room] = key
+	}
+	return nil
+}
+
+func (c *Client) roomKey(room string) []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.roomKeys[room]
+}
+
+// sealContent encrypts content for room when it has a key, binding the
+// ciphertext to the room name. Without a key, content is returned unchanged.
+func (c *Client) sealContent(room string, content map[string]interface{}) (map[string]interface{}, error) {
+	key := c.roomKey(room)
+	if key == nil {
+		return content, nil
+	}
+	plain, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	rand.Read(nonce)
+	ciphertext := aead.Seal(nil, nonce, plain, []byte(room))
+	return map[string]interface{}{
+		"type":       "encrypted",
+		"alg":        EncryptionAlg,
+		"nonce":      base64.StdEncoding.EncodeToString(nonce),
+		"ciphertext": base64.StdEncoding.EncodeToString(ciphertext),
+	}, nil
+}
+
+// openContent decrypts an encrypted content object for room.
+// ok is false when the room has no key, leaving the content as received.
+func (c *Client) openContent(room string, content json.RawMessage) (plain json.RawMessage, ok bool, err error) {
+	key := c.roomKey(room)
+	if key == nil {
+		return nil, false, nil
+	}
+	if plain, err = OpenContent(room, key, content); err != nil {
+		return nil, false, err
+	}
+	return plain, true, nil
+}
+
+// OpenContent decrypts an encrypted content object sent to room with key,
+// e.g. a message from the relay's history API.
+func OpenContent(room string, key []byte, content json.RawMessage) (json.RawMessage, error) {
+	var enc struct {
+		Alg        string `json:"alg"`
+		Nonce      string `json:"nonce"`
+		Ciphertext string `json:"ciphertext"`
+	}
+	if err := json.Unmarshal(content, &enc); err != nil {
+		return nil, err
+	}
+	if enc.Alg != EncryptionAlg {
+		return nil, fmt.Errorf("unsupported encryption: %s", enc.Alg)
+	}
+	nonce, err := base64.StdEncoding.DecodeString(enc.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(enc.Ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("invalid nonce length %d", len(nonce))
+	}
+	return aead.Open(nil, nonce, ciphertext, []byte(room))
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,89 @@
+package client
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func testRoomKey() []byte {
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = byte(i)
+	}
+	return key
+}
+
+func TestSealContent_PlaintextWithoutKey(t *testing.T) {
+	c := &Client{roomKeys: map[string][]byte{}}
+	content := map[string]interface{}{"type": "text", "text": "hello"}
+
+	sealed, err := c.sealContent("open-room", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sealed["type"] != "text" {
+		t.Fatalf("rooms without a key should stay plaintext: %v", sealed)
+	}
+}
+
+func TestSealContent_RoundTrip(t *testing.T) {
+	c := &Client{roomKeys: map[string][]byte{}}
+	c.SetRoomKey("secret", testRoomKey())
+
+	sealed, err := c.sealContent("secret", map[string]interface{}{"type": "text", "text": "launch codes"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sealed["type"] != "encrypted" || sealed["alg"] != EncryptionAlg {
+		t.Fatalf("content not encrypted: %v", sealed)
+	}
+
+	raw, _ := json.Marshal(sealed)
+	plain, ok, err := c.openContent("secret", raw)
+	if err != nil || !ok {
+		t.Fatalf("openContent: ok=%v err=%v", ok, err)
+	}
+	var content struct{ Text string }
+	json.Unmarshal(plain, &content)
+	if content.Text != "launch codes" {
+		t.Fatalf("decrypted text: %q", content.Text)
+	}
+
+	// Ciphertext is bound to the room it was sent to.
+	c.SetRoomKey("other", testRoomKey())
+	if _, _, err := c.openContent("other", raw); err == nil {
+		t.Fatal("ciphertext should not open under a different room")
+	}
+}
+
+func TestSetRoomKey_InvalidLength(t *testing.T) {
+	c := &Client{roomKeys: map[string][]byte{}}
+	if err := c.SetRoomKey("room", []byte("short")); err == nil {
+		t.Fatal("expected error for short key")
+	}
+}
+
+func TestReadLoop_DecryptsWithRoomKey(t *testing.T) {
+	sender := &Client{roomKeys: map[string][]byte{"secret": testRoomKey()}}
+	sealed, _ := sender.sealContent("secret", map[string]interface{}{"type": "text", "text": "psst"})
+	envelope, _ := json.Marshal(map[string]interface{}{
+		"type": "message", "id": "m1", "room": "secret", "from": "a", "content": sealed,
+	})
+
+	keySet := make(chan struct{})
+	c := pipeClient(t, func(ws *websocket.Conn) {
+		<-keySet
+		ws.WriteMessage(websocket.TextMessage, envelope)
+		time.Sleep(100 * time.Millisecond)
+	})
+	c.SetRoomKey("secret", testRoomKey())
+	close(keySet)
+
+	msg := <-c.Messages()
+	if msg.Text != "psst" || !msg.Encrypted {
+		t.Fatalf("message not decrypted: %+v", msg)
+	}
+}
@@ -0,0 +1,131 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrMemberNotFound is returned by KickMember when the agent isn't in the room.
+var ErrMemberNotFound = errors.New("agent is not a member of the room")
+
+// kickErrors maps the relay error codes that refuse a kick to their errors.
+var kickErrors = map[string]error{
+	"NOT_OWNER":        ErrNotOwner,
+	"FORBIDDEN":        ErrNotOwner,
+	"NOT_MEMBER":       ErrMemberNotFound,
+	"MEMBER_NOT_FOUND": ErrMemberNotFound,
+	"AGENT_NOT_FOUND":  ErrMemberNotFound,
+}
+
+// KickMember removes agentID from a room this agent owns with a signed
+// room.kick, returning once the relay confirms with room.kicked or the
+// agent's room.member_left. The relay's refusal is ErrNotOwner if this agent
+// may not kick, or ErrMemberNotFound if the agent isn't in the room; no
+// answer within confirmTimeout is ErrUnconfirmed.
+func (c *Client) KickMember(room, agentID string) error {
+	if c.readOnly {
+		return ErrReadOnly
+	}
+	if err := validateRoom(room); err != nil {
+		return err
+	}
+	if agentID == "" {
+		return fmt.Errorf("agent ID required")
+	}
+	if agentID == c.agentID {
+		return fmt.Errorf("cannot kick yourself; leave the room instead")
+	}
+	if err := c.checkFeature(FeatureKick); err != nil {
+		return err
+	}
+	if err := c.checkModerator(room); err != nil {
+		return err
+	}
+
+	defer c.lockOp()()
+
+	msg := map[string]interface{}{
+		"type":      "room.kick",
+		"room":      room,
+		"agent_id":  agentID,
+		"nonce":     randomNonce(),
+		"timestamp": time.Now().UnixMilli(),
+	}
+	if err := c.signMessage(msg); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.kicking = [2]string{room, agentID}
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.kicking = [2]string{}
+		c.mu.Unlock()
+	}()
+	if err := c.writeJSON(msg); err != nil {
+		return err
+	}
+
+	nonce := msg["nonce"].(string)
+	resp, err := c.recvFilter(confirmTimeout, func(resp json.RawMessage) int {
+		var env struct {
+			Type    string `json:"type"`
+			Room    string `json:"room"`
+			Nonce   string `json:"nonce"`
+			Code    string `json:"code"`
+			AgentID string `json:"agent_id"`
+			Member  Member `json:"member"`
+		}
+		json.Unmarshal(resp, &env)
+		switch env.Type {
+		case "room.kicked":
+			if env.Room == room && (env.AgentID == "" || env.AgentID == agentID) {
+				return respTake
+			}
+		case "room.member_left":
+			if env.Room == room && env.Member.ID == agentID {
+				return respTake
+			}
+		case "error":
+			// Relays that echo the nonce say which request failed; without
+			// it only a kick refusal's code ties the error to this request.
+			switch {
+			case env.Nonce == nonce:
+				return respTake
+			case env.Nonce != "":
+				return respDrop // for an operation that stopped waiting
+			case kickErrors[env.Code] != nil:
+				return respTake
+			}
+		}
+		return respKeep
+	})
+	if errors.Is(err, errRecvTimeout) {
+		return fmt.Errorf("kick %s from %s: %w", agentID, room, ErrUnconfirmed)
+	}
+	if err != nil {
+		return err
+	}
+	var env struct {
+		Type    string `json:"type"`
+		Code    string `json:"code,omitempty"`
+		Message string `json:"message,omitempty"`
+	}
+	json.Unmarshal(resp, &env)
+	if env.Type == "error" {
+		switch kickErrors[env.Code] {
+		case ErrNotOwner:
+			return fmt.Errorf("%s: %w (relay: %s)", room, ErrNotOwner, env.Message)
+		case ErrMemberNotFound:
+			return fmt.Errorf("%s in %s: %w", agentID, room, ErrMemberNotFound)
+		}
+		return &RelayError{Code: env.Code, Message: env.Message}
+	}
+
+	c.mu.Lock()
+	delete(c.members[room], agentID)
+	c.mu.Unlock()
+	return nil
+}
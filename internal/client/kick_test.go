@@ -0,0 +1,96 @@
+package client
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestKickMember_RelayErrors(t *testing.T) {
+	for code, want := range map[string]error{
+		"NOT_OWNER":  ErrNotOwner,
+		"NOT_MEMBER": ErrMemberNotFound,
+	} {
+		c := pipeClient(t, func(ws *websocket.Conn) {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+			ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"error","code":"`+code+`","message":"no"}`))
+			time.Sleep(100 * time.Millisecond)
+		})
+		c.privKey = ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+		if err := c.KickMember("lab", "mallory"); !errors.Is(err, want) {
+			t.Fatalf("%s: expected %v, got %v", code, want, err)
+		}
+	}
+}
+
+func TestKickMember_RemovesMember(t *testing.T) {
+	kicked := make(chan string, 1)
+	c := pipeClient(t, func(ws *websocket.Conn) {
+		_, raw, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		var req struct {
+			Type    string `json:"type"`
+			AgentID string `json:"agent_id"`
+		}
+		json.Unmarshal(raw, &req)
+		if req.Type == "room.kick" {
+			kicked <- req.AgentID
+		}
+		ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"room.kicked","room":"lab","agent_id":"mallory"}`))
+		time.Sleep(100 * time.Millisecond)
+	})
+	c.privKey = ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	c.members["lab"] = map[string]Member{"mallory": {ID: "mallory"}, "bob": {ID: "bob"}}
+
+	if err := c.KickMember("lab", "mallory"); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-kicked; got != "mallory" {
+		t.Fatalf("relay was asked to kick %q", got)
+	}
+	if members := c.Members("lab"); len(members) != 1 || members[0].ID != "bob" {
+		t.Fatalf("members: %+v", members)
+	}
+}
+
+func TestKickMember_WaitsForConfirmation(t *testing.T) {
+	defer func(d time.Duration) { confirmTimeout = d }(confirmTimeout)
+	confirmTimeout = 200 * time.Millisecond
+
+	// An unrelated error first, then the kicked agent leaving.
+	c := pipeClient(t, func(ws *websocket.Conn) {
+		if _, _, err := ws.ReadMessage(); err != nil {
+			return
+		}
+		ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"error","code":"RATE_LIMITED","message":"slow down"}`))
+		ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"room.member_left","room":"lab","member":{"id":"bob"}}`))
+		ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"room.member_left","room":"lab","member":{"id":"mallory"}}`))
+		ws.ReadMessage()
+	})
+	c.privKey = ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	c.members["lab"] = map[string]Member{"mallory": {ID: "mallory"}, "bob": {ID: "bob"}}
+	if err := c.KickMember("lab", "mallory"); err != nil {
+		t.Fatal(err)
+	}
+	if members := c.Members("lab"); len(members) != 0 {
+		t.Fatalf("members: %+v", members)
+	}
+
+	// No answer at all is not a success.
+	c = pipeClient(t, func(ws *websocket.Conn) {
+		ws.ReadMessage()
+		ws.ReadMessage()
+	})
+	c.privKey = ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	if err := c.KickMember("lab", "mallory"); !errors.Is(err, ErrUnconfirmed) {
+		t.Fatalf("expected ErrUnconfirmed, got %v", err)
+	}
+}
@@ -0,0 +1,48 @@
+package client
+
+import "strings"
+
+// mentionHandles returns the handles that address this agent after an "@":
+// its agent ID, its display name, and the "agent-<first 8 of ID>" name agents
+// get by default, which others may still use after a rename.
+func (c *Client) mentionHandles() []string {
+	handles := []string{c.agentID, c.Name()}
+	if short := c.agentID; short != "" {
+		if len(short) > 8 {
+			short = short[:8]
+		}
+		handles = append(handles, "agent-"+short)
+	}
+	return handles
+}
+
+// mentions reports whether text contains an @-mention of this agent. Names
+// match case-insensitively; the agent ID must match exactly. A mention must
+// not run into further name characters, so "@bob" doesn't match "@bobby".
+func (c *Client) mentions(text string) bool {
+	for i := 0; i < len(text); i++ {
+		if text[i] != '@' || (i > 0 && isHandleChar(text[i-1])) {
+			continue
+		}
+		rest := text[i+1:]
+		for j, h := range c.mentionHandles() {
+			if h == "" || len(rest) < len(h) {
+				continue
+			}
+			prefix := rest[:len(h)]
+			if j == 0 && prefix != h || j > 0 && !strings.EqualFold(prefix, h) {
+				continue
+			}
+			if len(rest) == len(h) || !isHandleChar(rest[len(h)]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isHandleChar reports whether b can be part of an agent name or ID.
+// Trailing punctuation such as "." or "," ends a mention.
+func isHandleChar(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9' || b == '-' || b == '_'
+}
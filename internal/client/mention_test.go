@@ -0,0 +1,23 @@
+package client
+
+import "testing"
+
+func TestMentions(t *testing.T) {
+	c := &Client{agentID: "7xKXtg2CW87d97TXJSDpbD5jBkheTqA83TZRuJosgAsU", agentName: "Scout"}
+
+	for text, want := range map[string]bool{
+		"@scout can you check this?":                    true,
+		"thanks, @Scout.":                               true,
+		"ping @agent-7xKXtg2C":                          true,
+		"@7xKXtg2CW87d97TXJSDpbD5jBkheTqA83TZRuJosgAsU": true,
+		"@7xkxtg2cw87d97txjsdpbd5jbkhetqa83tzrujosgasu": false, // IDs are case-sensitive
+		"@scouting party":                               false,
+		"scout, no at-sign":                             false,
+		"mail me at someone@scout":                      false,
+		"@":                                             false,
+	} {
+		if got := c.mentions(text); got != want {
+			t.Errorf("mentions(%q) = %v, want %v", text, got, want)
+		}
+	}
+}
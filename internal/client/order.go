@@ -0,0 +1,53 @@
+package client
+
+import "sync"
+
+// sendOrder makes sends to the same room take turns in call order. Sends to
+// different rooms don't wait for each other's turns.
+type sendOrder struct {
+	mu     sync.Mutex
+	queues map[string][]chan struct{} // room → senders in call order; the head is sending
+}
+
+// SetOrderedSends makes concurrent sends to the same room go out in the
+// order they were called. Without it, sends are still written one at a time,
+// but callers racing for the same room may go in any order. Call before the
+// client is shared.
+func (c *Client) SetOrderedSends(on bool) {
+	if on {
+		c.sendOrder = &sendOrder{queues: make(map[string][]chan struct{})}
+	} else {
+		c.sendOrder = nil
+	}
+}
+
+// wait blocks until the earlier sends to room are done and returns the func
+// that ends this one's turn.
+func (o *sendOrder) wait(room string) (done func()) {
+	turn := make(chan struct{})
+	o.mu.Lock()
+	queue := append(o.queues[room], turn)
+	o.queues[room] = queue
+	o.mu.Unlock()
+	if len(queue) > 1 {
+		<-turn
+	}
+	return func() {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		rest := o.queues[room][1:]
+		if len(rest) == 0 {
+			delete(o.queues, room)
+			return
+		}
+		o.queues[room] = rest
+		close(rest[0])
+	}
+}
+
+// waiting returns how many sends to room are queued or in progress.
+func (o *sendOrder) waiting(room string) int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.queues[room])
+}
@@ -0,0 +1,57 @@
+package client
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSendOrder_TurnsFollowCallOrder(t *testing.T) {
+	o := &sendOrder{queues: make(map[string][]chan struct{})}
+	first := o.wait("lab")
+
+	var mu sync.Mutex
+	var got []int
+	var wg sync.WaitGroup
+	for i := 1; i <= 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			done := o.wait("lab")
+			mu.Lock()
+			got = append(got, i)
+			mu.Unlock()
+			done()
+		}()
+		// Let sender i queue up before the next one calls.
+		for deadline := time.Now().Add(time.Second); o.waiting("lab") != i+1; {
+			if time.Now().After(deadline) {
+				t.Fatalf("sender %d never queued", i)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// Another room doesn't wait behind lab.
+	other := make(chan struct{})
+	go func() {
+		o.wait("ops")()
+		close(other)
+	}()
+	select {
+	case <-other:
+	case <-time.After(time.Second):
+		t.Fatal("a send to another room waited for lab's queue")
+	}
+
+	first()
+	wg.Wait()
+	for i, n := range got {
+		if n != i+1 {
+			t.Fatalf("sends went out as %v, want call order", got)
+		}
+	}
+	if o.waiting("lab") != 0 || len(o.queues) != 0 {
+		t.Fatalf("queues not cleaned up: %v", o.queues)
+	}
+}
@@ -0,0 +1,209 @@
+package client
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// ErrQueued is returned by sends that could not be written because the
+// connection dropped, when an Outbox is set. The message keeps the returned
+// ID and is resent by FlushOutbox after reconnecting.
+var ErrQueued = errors.New("connection lost; message queued for resend")
+
+// QueuedMessage is a message waiting in an Outbox. Content is kept
+// unencrypted so it is sealed with the room key current at resend time.
+type QueuedMessage struct {
+	ID        string                 `json:"id"`
+	Room      string                 `json:"room"`
+	Content   map[string]interface{} `json:"content"`
+	InReplyTo string                 `json:"in_reply_to,omitempty"`
+	Timestamp int64                  `json:"timestamp"` // Unix milliseconds of the original send; resends are stamped afresh
+}
+
+// Outbox is a bounded queue of messages sent while disconnected. Share one
+// across the successive clients of an identity, like a RateLimiter, so a
+// message queued by a dead connection is resent by the next one. Resent
+// messages keep their original ID, so relays and consumers that dedup by ID
+// never see a duplicate even if the first write did get through, but are
+// signed with the resend time, so relays that only accept recent timestamps
+// take them even after a restart.
+type Outbox struct {
+	mu             sync.Mutex
+	size           int
+	maxMessageSize int
+	pending        []QueuedMessage
+	dropped        int64
+	onChange       func() // called after the queue changes, without mu held
+}
+
+// NewOutbox returns an outbox holding at most size messages; when full, the
+// oldest is dropped. maxMessageSize bounds queued content as
+// SetMaxMessageSize does for a client (0 = DefaultMaxMessageSize).
+func NewOutbox(size, maxMessageSize int) *Outbox {
+	if maxMessageSize <= 0 {
+		maxMessageSize = DefaultMaxMessageSize
+	}
+	return &Outbox{size: size, maxMessageSize: maxMessageSize}
+}
+
+// Enqueue validates a message and queues it without a connection, returning
+// the ID it will be sent with.
+func (o *Outbox) Enqueue(room string, content map[string]interface{}, inReplyTo string) (string, error) {
+	if err := validateContent(content, o.maxMessageSize); err != nil {
+		return "", err
+	}
+	if err := validateRoomName(room); err != nil {
+		return "", err
+	}
+	m := QueuedMessage{
+		ID:        randomUUID(),
+		Room:      room,
+		Content:   content,
+		InReplyTo: inReplyTo,
+		Timestamp: time.Now().UnixMilli(),
+	}
+	o.push(m)
+	return m.ID, nil
+}
+
+func (o *Outbox) push(m QueuedMessage) {
+	o.mu.Lock()
+	o.pushLocked(m)
+	o.mu.Unlock()
+	o.changed()
+}
+
+func (o *Outbox) pushLocked(m QueuedMessage) {
+	if o.size <= 0 {
+		o.dropped++
+		return
+	}
+	if len(o.pending) >= o.size {
+		o.pending = o.pending[1:]
+		o.dropped++
+	}
+	o.pending = append(o.pending, m)
+}
+
+// Len returns how many messages are waiting to be resent.
+func (o *Outbox) Len() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.pending)
+}
+
+// Dropped returns how many queued messages were discarded because the
+// outbox was full.
+func (o *Outbox) Dropped() int64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.dropped
+}
+
+// Pending returns a copy of the queued messages, oldest first.
+func (o *Outbox) Pending() []QueuedMessage {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]QueuedMessage(nil), o.pending...)
+}
+
+// Restore queues messages saved from an earlier Pending, e.g. by a previous
+// run, behind any already waiting. They keep their IDs.
+func (o *Outbox) Restore(msgs []QueuedMessage) {
+	o.mu.Lock()
+	for _, m := range msgs {
+		o.pushLocked(m)
+	}
+	o.mu.Unlock()
+	o.changed()
+}
+
+// Clear discards every queued message, returning how many there were.
+func (o *Outbox) Clear() int {
+	o.mu.Lock()
+	n := len(o.pending)
+	o.pending = nil
+	o.mu.Unlock()
+	if n > 0 {
+		o.changed()
+	}
+	return n
+}
+
+// SetOnChange registers f to be called after messages are queued, resent or
+// cleared, e.g. to persist Pending. Set it before the outbox is used.
+func (o *Outbox) SetOnChange(f func()) {
+	o.onChange = f
+}
+
+func (o *Outbox) changed() {
+	if o.onChange != nil {
+		o.onChange()
+	}
+}
+
+// SetOutbox makes sends that fail to write queue into o (returning
+// ErrQueued) instead of failing. Nil restores failing.
+func (c *Client) SetOutbox(o *Outbox) {
+	c.opMu.Lock()
+	defer c.opMu.Unlock()
+	c.outbox = o
+}
+
+// FlushOutbox resends queued messages in order under their original IDs,
+// stamped with the current time, returning how many the relay took. It stops
+// at the first message that fails to write or that the relay rejects,
+// leaving it and the rest queued. Resends bypass the rate limiter: they were
+// admitted when first sent. A read-only client sends nothing and returns
+// ErrReadOnly, keeping the queue.
+func (c *Client) FlushOutbox() (int, error) {
+	if c.readOnly {
+		return 0, ErrReadOnly
+	}
+	defer c.lockOp()()
+	o := c.outbox
+	if o == nil {
+		return 0, nil
+	}
+
+	o.mu.Lock()
+	pending := o.pending
+	o.pending = nil
+	o.mu.Unlock()
+	if len(pending) == 0 {
+		return 0, nil
+	}
+	defer o.changed()
+
+	sent := 0
+	for i, m := range pending {
+		msg, err := c.buildMessage(m.Room, m.Content, m.InReplyTo)
+		if err != nil {
+			log.Printf("outbox: dropping message %s: %v", m.ID, err)
+			continue
+		}
+		msg["id"] = m.ID
+		if err := c.signMessage(msg); err != nil {
+			log.Printf("outbox: dropping message %s: %v", m.ID, err)
+			continue
+		}
+		err = c.writeJSON(msg)
+		if err == nil {
+			err = c.awaitRelayError()
+		}
+		if err != nil {
+			o.mu.Lock()
+			rest := append(pending[i:], o.pending...)
+			o.pending = nil
+			for _, m := range rest {
+				o.pushLocked(m)
+			}
+			o.mu.Unlock()
+			return sent, err
+		}
+		sent++
+	}
+	return sent, nil
+}
@@ -0,0 +1,151 @@
+package client
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestOutbox_QueuesAndResendsWithOriginalIDs(t *testing.T) {
+	outbox := NewOutbox(10, 0)
+
+	dead := pipeClient(t, func(*websocket.Conn) {})
+	dead.privKey = ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	dead.SetOutbox(outbox)
+	dead.Close()
+	first, err := dead.SendMessage("lab", "sent as the link dropped")
+	if !errors.Is(err, ErrQueued) || first == "" {
+		t.Fatalf("expected ErrQueued with an ID, got %q, %v", first, err)
+	}
+	second, err := outbox.Enqueue("lab", map[string]interface{}{"type": "text", "text": "sent while reconnecting"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if outbox.Len() != 2 {
+		t.Fatalf("expected 2 queued, got %d", outbox.Len())
+	}
+
+	got := make(chan string, 2)
+	c := pipeClient(t, func(ws *websocket.Conn) {
+		for {
+			_, raw, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			var msg struct {
+				ID string `json:"id"`
+			}
+			json.Unmarshal(raw, &msg)
+			got <- msg.ID
+		}
+	})
+	c.privKey = ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	c.SetOutbox(outbox)
+	if n, err := c.FlushOutbox(); n != 2 || err != nil {
+		t.Fatalf("flushed %d, %v", n, err)
+	}
+	for _, want := range []string{first, second} {
+		if id := <-got; id != want {
+			t.Fatalf("relay got %s, want %s", id, want)
+		}
+	}
+	if outbox.Len() != 0 {
+		t.Fatalf("outbox not emptied: %d left", outbox.Len())
+	}
+}
+
+func TestFlushOutbox_RestampsResends(t *testing.T) {
+	outbox := NewOutbox(10, 0)
+	outbox.Restore([]QueuedMessage{{ID: "m1", Room: "lab", Content: map[string]interface{}{"type": "text", "text": "from before a restart"}, Timestamp: 1000}})
+
+	got := make(chan map[string]interface{}, 1)
+	c := pipeClient(t, func(ws *websocket.Conn) {
+		_, raw, _ := ws.ReadMessage()
+		var msg map[string]interface{}
+		json.Unmarshal(raw, &msg)
+		got <- msg
+		ws.ReadMessage()
+	})
+	c.privKey = ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	c.SetOutbox(outbox)
+	before := time.Now().UnixMilli()
+	if n, err := c.FlushOutbox(); n != 1 || err != nil {
+		t.Fatalf("flushed %d, %v", n, err)
+	}
+	msg := <-got
+	if msg["id"] != "m1" {
+		t.Fatalf("resent as %v, want the original ID", msg["id"])
+	}
+	if ts, _ := msg["timestamp"].(float64); int64(ts) < before {
+		t.Fatalf("resent with timestamp %v, want the resend time", msg["timestamp"])
+	}
+}
+
+func TestFlushOutbox_StopsAtRejection(t *testing.T) {
+	outbox := NewOutbox(10, 0)
+	for _, text := range []string{"one", "two", "three"} {
+		outbox.Enqueue("lab", map[string]interface{}{"type": "text", "text": text}, "")
+	}
+	c := pipeClient(t, func(ws *websocket.Conn) {
+		for n := 1; ; n++ {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+			if n == 2 {
+				ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"error","code":"RATE_LIMITED","message":"slow down"}`))
+			}
+		}
+	})
+	c.privKey = ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	c.SetOutbox(outbox)
+	if n, err := c.FlushOutbox(); n != 1 || err == nil {
+		t.Fatalf("flushed %d, %v; want 1 and the rejection", n, err)
+	}
+	if pending := outbox.Pending(); len(pending) != 2 || pending[0].Content["text"] != "two" {
+		t.Fatalf("queued %v, want the rejected message and the rest", pending)
+	}
+}
+
+func TestOutbox_DropsOldestWhenFull(t *testing.T) {
+	outbox := NewOutbox(2, 0)
+	for _, text := range []string{"a", "b", "c"} {
+		if _, err := outbox.Enqueue("lab", map[string]interface{}{"type": "text", "text": text}, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if outbox.Len() != 2 || outbox.Dropped() != 1 {
+		t.Fatalf("len %d dropped %d", outbox.Len(), outbox.Dropped())
+	}
+	if outbox.pending[0].Content["text"] != "b" {
+		t.Fatalf("oldest message should have been dropped, head is %v", outbox.pending[0].Content)
+	}
+
+	if _, err := outbox.Enqueue("bad room!", map[string]interface{}{"type": "text", "text": "x"}, ""); !errors.Is(err, ErrInvalidRoomName) {
+		t.Fatalf("expected ErrInvalidRoomName, got %v", err)
+	}
+}
+
+func TestSendMessages_QueuesTheRestOfTheBatch(t *testing.T) {
+	outbox := NewOutbox(10, 0)
+	dead := pipeClient(t, func(*websocket.Conn) {})
+	dead.privKey = ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	dead.SetOutbox(outbox)
+	dead.Close()
+
+	ids, err := dead.SendMessages("lab", []string{"one", "two", "three"})
+	if !errors.Is(err, ErrQueued) || len(ids) != 3 {
+		t.Fatalf("expected ErrQueued with 3 IDs, got %v, %v", ids, err)
+	}
+	if outbox.Len() != 3 {
+		t.Fatalf("expected 3 queued, got %d", outbox.Len())
+	}
+	for i, text := range []string{"one", "two", "three"} {
+		if m := outbox.pending[i]; m.ID != ids[i] || m.Content["text"] != text {
+			t.Fatalf("queued %d: %s %v, want %s %q", i, m.ID, m.Content, ids[i], text)
+		}
+	}
+}
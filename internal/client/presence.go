@@ -0,0 +1,79 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrPresenceUnsupported is returned by Presence when the relay rejects
+// presence queries as unknown or unsupported, after which later calls return
+// it without asking again. A query left unanswered for PresenceTimeout
+// returns it too, but only for that call: the relay may just be slow.
+var ErrPresenceUnsupported = errors.New("relay does not support presence queries")
+
+// PresenceTimeout is how long Presence waits for the relay to answer.
+const PresenceTimeout = 2 * time.Second
+
+// Presence asks the relay which of agentIDs are connected right now.
+func (c *Client) Presence(agentIDs []string) (map[string]bool, error) {
+	if len(agentIDs) == 0 {
+		return map[string]bool{}, nil
+	}
+	if c.presenceUnsupported.Load() || !c.supports(FeaturePresence) {
+		return nil, ErrPresenceUnsupported
+	}
+
+	defer c.lockOp()()
+
+	msg := map[string]interface{}{
+		"type":      "presence.query",
+		"agents":    agentIDs,
+		"nonce":     randomNonce(),
+		"timestamp": time.Now().UnixMilli(),
+	}
+	if err := c.signMessage(msg); err != nil {
+		return nil, err
+	}
+	if err := c.writeJSON(msg); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.recvMatch(PresenceTimeout, func(resp json.RawMessage) bool {
+		var env struct {
+			Type string `json:"type"`
+		}
+		json.Unmarshal(resp, &env)
+		return env.Type == "presence" || env.Type == "error"
+	})
+	if errors.Is(err, errRecvTimeout) {
+		return nil, fmt.Errorf("%w: no answer in %s", ErrPresenceUnsupported, PresenceTimeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var env struct {
+		Type    string          `json:"type"`
+		Code    string          `json:"code,omitempty"`
+		Message string          `json:"message,omitempty"`
+		Online  map[string]bool `json:"online"`
+	}
+	if err := json.Unmarshal(resp, &env); err != nil {
+		return nil, fmt.Errorf("presence: %w", err)
+	}
+	if env.Type == "error" {
+		if env.Code == "UNKNOWN_TYPE" || env.Code == "UNSUPPORTED" {
+			c.presenceUnsupported.Store(true)
+			return nil, ErrPresenceUnsupported
+		}
+		return nil, &RelayError{Code: env.Code, Message: env.Message}
+	}
+
+	online := make(map[string]bool, len(agentIDs))
+	for _, id := range agentIDs {
+		online[id] = env.Online[id]
+	}
+	return online, nil
+}
@@ -0,0 +1,84 @@
+package client
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestPresence_RelayAnswers(t *testing.T) {
+	c := pipeClient(t, func(ws *websocket.Conn) {
+		_, raw, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		var q struct {
+			Type   string   `json:"type"`
+			Agents []string `json:"agents"`
+		}
+		json.Unmarshal(raw, &q)
+		if q.Type != "presence.query" || len(q.Agents) != 2 {
+			return
+		}
+		ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"presence","online":{"alice":true}}`))
+		time.Sleep(100 * time.Millisecond)
+	})
+	c.privKey = ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+
+	online, err := c.Presence([]string{"alice", "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !online["alice"] || online["bob"] {
+		t.Fatalf("unexpected presence %v", online)
+	}
+	if _, ok := online["bob"]; !ok {
+		t.Fatal("every requested agent should be in the result")
+	}
+}
+
+func TestPresence_UnsupportedIsRemembered(t *testing.T) {
+	queries := 0
+	c := pipeClient(t, func(ws *websocket.Conn) {
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+			queries++
+			ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"error","code":"UNKNOWN_TYPE","message":"unknown message type"}`))
+		}
+	})
+	c.privKey = ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.Presence([]string{"alice"}); !errors.Is(err, ErrPresenceUnsupported) {
+			t.Fatalf("call %d: expected ErrPresenceUnsupported, got %v", i, err)
+		}
+	}
+	if queries != 1 {
+		t.Fatalf("relay asked %d times, want 1", queries)
+	}
+}
+
+func TestPresence_TimeoutIsNotRemembered(t *testing.T) {
+	c := pipeClient(t, func(ws *websocket.Conn) {
+		ws.ReadMessage() // too slow to answer the first query
+		if _, _, err := ws.ReadMessage(); err != nil {
+			return
+		}
+		ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"presence","online":{"alice":true}}`))
+		ws.ReadMessage()
+	})
+	c.privKey = ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+
+	if _, err := c.Presence([]string{"alice"}); !errors.Is(err, ErrPresenceUnsupported) {
+		t.Fatalf("expected ErrPresenceUnsupported, got %v", err)
+	}
+	if online, err := c.Presence([]string{"alice"}); err != nil || !online["alice"] {
+		t.Fatalf("one slow reply disabled presence: %v, %v", online, err)
+	}
+}
@@ -0,0 +1,112 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxAgentNameLen is the longest display name, in bytes.
+const MaxAgentNameLen = 64
+
+// ErrInvalidName is returned by SetName for a name the relay would refuse.
+var ErrInvalidName = errors.New("invalid agent name")
+
+// ErrProfileUnsupported is returned by SetName when the relay doesn't answer
+// or rejects profile updates.
+var ErrProfileUnsupported = errors.New("relay does not support profile updates")
+
+// ProfileTimeout is how long SetName waits for the relay to confirm.
+const ProfileTimeout = 5 * time.Second
+
+// ValidateName checks a display name: 1-MaxAgentNameLen bytes of valid UTF-8,
+// printable, without leading or trailing spaces or an "@", which would make
+// the name ambiguous in mentions.
+func ValidateName(name string) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("%w: name required", ErrInvalidName)
+	case len(name) > MaxAgentNameLen:
+		return fmt.Errorf("%w: longer than %d bytes", ErrInvalidName, MaxAgentNameLen)
+	case !utf8.ValidString(name) || strings.IndexFunc(name, func(r rune) bool { return !unicode.IsPrint(r) || r == '@' }) >= 0:
+		return fmt.Errorf("%w: %q may only contain printable characters other than '@'", ErrInvalidName, name)
+	case strings.TrimSpace(name) != name:
+		return fmt.Errorf("%w: %q has leading or trailing spaces", ErrInvalidName, name)
+	}
+	return nil
+}
+
+// Name returns the agent's display name.
+func (c *Client) Name() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.agentName
+}
+
+// SetName changes the agent's display name on the relay with a signed
+// profile.update and waits for it to be confirmed. The name lasts for this
+// connection; callers reconnecting must pass the new name to Connect.
+func (c *Client) SetName(name string) error {
+	if c.readOnly {
+		return ErrReadOnly
+	}
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+	if !c.supports(FeatureProfile) {
+		return ErrProfileUnsupported
+	}
+
+	defer c.lockOp()()
+
+	msg := map[string]interface{}{
+		"type":      "profile.update",
+		"name":      name,
+		"nonce":     randomNonce(),
+		"timestamp": time.Now().UnixMilli(),
+	}
+	if err := c.signMessage(msg); err != nil {
+		return err
+	}
+	if err := c.writeJSON(msg); err != nil {
+		return err
+	}
+
+	resp, err := c.recvMatch(ProfileTimeout, func(resp json.RawMessage) bool {
+		var env struct {
+			Type string `json:"type"`
+		}
+		json.Unmarshal(resp, &env)
+		return env.Type == "profile.updated" || env.Type == "error"
+	})
+	if errors.Is(err, errRecvTimeout) {
+		return ErrProfileUnsupported
+	}
+	if err != nil {
+		return err
+	}
+	var env struct {
+		Type    string `json:"type"`
+		Code    string `json:"code,omitempty"`
+		Message string `json:"message,omitempty"`
+	}
+	json.Unmarshal(resp, &env)
+	if env.Type == "error" {
+		switch env.Code {
+		case "UNKNOWN_TYPE", "UNSUPPORTED":
+			return ErrProfileUnsupported
+		case "INVALID_NAME":
+			return fmt.Errorf("%w (relay: %s)", ErrInvalidName, env.Message)
+		}
+		return &RelayError{Code: env.Code, Message: env.Message}
+	}
+
+	c.mu.Lock()
+	c.agentName = name
+	c.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,73 @@
+package client
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestValidateName(t *testing.T) {
+	for _, name := range []string{"alice", "agent-Ht4YQDox", "Research Bot 2", "研究者"} {
+		if err := ValidateName(name); err != nil {
+			t.Errorf("%q: %v", name, err)
+		}
+	}
+	for _, name := range []string{"", " alice", "alice\n", "al@ice", "tab\tbed", strings.Repeat("x", MaxAgentNameLen+1)} {
+		if err := ValidateName(name); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("%q: expected ErrInvalidName, got %v", name, err)
+		}
+	}
+}
+
+func TestSetName_RelayConfirms(t *testing.T) {
+	c := pipeClient(t, func(ws *websocket.Conn) {
+		_, raw, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		var req struct {
+			Type      string `json:"type"`
+			Name      string `json:"name"`
+			Signature string `json:"signature"`
+		}
+		json.Unmarshal(raw, &req)
+		if req.Type != "profile.update" || req.Name != "bob" || req.Signature == "" {
+			return
+		}
+		ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"profile.updated","name":"bob"}`))
+		time.Sleep(100 * time.Millisecond)
+	})
+	c.privKey = ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	c.agentName = "alice"
+
+	if err := c.SetName("bob"); err != nil {
+		t.Fatal(err)
+	}
+	if c.Name() != "bob" {
+		t.Fatalf("name is %q", c.Name())
+	}
+}
+
+func TestSetName_Unsupported(t *testing.T) {
+	c := pipeClient(t, func(ws *websocket.Conn) {
+		if _, _, err := ws.ReadMessage(); err != nil {
+			return
+		}
+		ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"error","code":"UNKNOWN_TYPE","message":"unknown message type"}`))
+		time.Sleep(100 * time.Millisecond)
+	})
+	c.privKey = ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	c.agentName = "alice"
+
+	if err := c.SetName("bob"); !errors.Is(err, ErrProfileUnsupported) {
+		t.Fatalf("expected ErrProfileUnsupported, got %v", err)
+	}
+	if c.Name() != "alice" {
+		t.Fatalf("name changed to %q although the relay refused", c.Name())
+	}
+}
@@ -0,0 +1,58 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// ProxyNone, as a proxy setting, connects directly even when the environment
+// names a proxy.
+const ProxyNone = "none"
+
+// ProxyFunc returns the proxy selection for a relay connection. An empty
+// proxy uses the environment: HTTPS_PROXY or HTTP_PROXY (honoring NO_PROXY),
+// else ALL_PROXY. ProxyNone connects directly. Anything else is a proxy URL,
+// http:// for an HTTP CONNECT proxy or socks5:// for SOCKS5, optionally with
+// user:password@.
+func ProxyFunc(proxy string) (func(*http.Request) (*url.URL, error), error) {
+	switch proxy {
+	case "":
+		return proxyFromEnvironment, nil
+	case ProxyNone:
+		return nil, nil
+	}
+	u, err := parseProxyURL(proxy)
+	if err != nil {
+		return nil, err
+	}
+	return http.ProxyURL(u), nil
+}
+
+// proxyFromEnvironment is http.ProxyFromEnvironment with an ALL_PROXY
+// fallback, the variable SOCKS users usually set.
+func proxyFromEnvironment(req *http.Request) (*url.URL, error) {
+	if u, err := http.ProxyFromEnvironment(req); u != nil || err != nil {
+		return u, err
+	}
+	all := os.Getenv("ALL_PROXY")
+	if all == "" {
+		all = os.Getenv("all_proxy")
+	}
+	if all == "" {
+		return nil, nil
+	}
+	return parseProxyURL(all)
+}
+
+func parseProxyURL(s string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy %q: %w", s, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "socks5" || u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy %q: want http://host:port or socks5://host:port", s)
+	}
+	return u, nil
+}
@@ -0,0 +1,90 @@
+package client
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestProxyFunc(t *testing.T) {
+	if f, err := ProxyFunc(ProxyNone); err != nil || f != nil {
+		t.Fatalf("none should connect directly (err %v)", err)
+	}
+	if f, err := ProxyFunc(""); err != nil || f == nil {
+		t.Fatalf("empty should use the environment (err %v)", err)
+	}
+	for _, bad := range []string{"ftp://proxy:21", "proxy:8080", "https://proxy:443"} {
+		if _, err := ProxyFunc(bad); err == nil {
+			t.Fatalf("%q should be rejected", bad)
+		}
+	}
+	f, err := ProxyFunc("socks5://user:pw@proxy:1080")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u, _ := f(&http.Request{}); u == nil || u.Host != "proxy:1080" {
+		t.Fatalf("got %v", u)
+	}
+}
+
+func TestProxyFromEnvironment_FallsBackToAllProxy(t *testing.T) {
+	for _, v := range []string{"HTTPS_PROXY", "https_proxy", "HTTP_PROXY", "http_proxy", "all_proxy"} {
+		t.Setenv(v, "")
+	}
+	t.Setenv("ALL_PROXY", "socks5://proxy:1080")
+	u, err := proxyFromEnvironment(httptest.NewRequest("GET", "https://relay.example.com/v1/ws", nil))
+	if err != nil || u == nil || u.Scheme != "socks5" {
+		t.Fatalf("got %v, %v", u, err)
+	}
+}
+
+// connectProxy is an HTTP CONNECT proxy counting the tunnels it opens.
+func connectProxy(t *testing.T, tunnels *atomic.Int32) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			http.Error(w, "CONNECT only", http.StatusMethodNotAllowed)
+			return
+		}
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		tunnels.Add(1)
+		w.WriteHeader(http.StatusOK)
+		conn, buf, _ := w.(http.Hijacker).Hijack()
+		go func() {
+			io.Copy(upstream, buf)
+			upstream.Close()
+		}()
+		io.Copy(conn, upstream)
+		conn.Close()
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestConnect_ThroughHTTPProxy(t *testing.T) {
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	var tunnels atomic.Int32
+	proxy := connectProxy(t, &tunnels)
+	url := fakeRelay(t, map[string]string{"type": "welcome"}, func(*http.Request, *websocket.Conn) {})
+
+	c, err := ConnectWithOptions(context.Background(), url, "a", "tester", priv, ConnectOptions{Proxy: proxy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	if tunnels.Load() != 1 {
+		t.Fatalf("expected the connection to go through the proxy, saw %d tunnels", tunnels.Load())
+	}
+}
@@ -0,0 +1,67 @@
+package client
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is returned when an outgoing message would exceed the send rate limit.
+// Nothing is sent to the relay.
+var ErrRateLimited = errors.New("rate limited: too many outgoing messages")
+
+// RateLimiter is a token-bucket limiter for outgoing messages.
+// With perRoom set, each room gets its own bucket so a burst in one room
+// doesn't block another.
+type RateLimiter struct {
+	rate    float64 // tokens added per second
+	burst   float64 // bucket capacity
+	perRoom bool
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter allows rate messages per second with bursts of up to burst.
+func NewRateLimiter(rate float64, burst int, perRoom bool) *RateLimiter {
+	return &RateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		perRoom: perRoom,
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Allow reports whether a message to room may be sent now, consuming a token if so.
+func (l *RateLimiter) Allow(room string) bool {
+	if !l.perRoom {
+		room = ""
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	b, ok := l.buckets[room]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[room] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * l.rate
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
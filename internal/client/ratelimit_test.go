@@ -0,0 +1,59 @@
+package client
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_BurstThenRefill(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := NewRateLimiter(5, 10, false)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 10; i++ {
+		if !l.Allow("room") {
+			t.Fatalf("burst message %d should be allowed", i)
+		}
+	}
+	if l.Allow("room") {
+		t.Fatal("message beyond burst should be limited")
+	}
+
+	// 5/sec → one token every 200ms.
+	now = now.Add(200 * time.Millisecond)
+	if !l.Allow("room") {
+		t.Fatal("token should refill after 200ms")
+	}
+	if l.Allow("room") {
+		t.Fatal("only one token should have refilled")
+	}
+}
+
+func TestRateLimiter_PerRoom(t *testing.T) {
+	now := time.Unix(0, 0)
+	shared := NewRateLimiter(1, 1, false)
+	shared.now = func() time.Time { return now }
+	perRoom := NewRateLimiter(1, 1, true)
+	perRoom.now = func() time.Time { return now }
+
+	shared.Allow("a")
+	if shared.Allow("b") {
+		t.Fatal("shared limiter should block other rooms")
+	}
+	perRoom.Allow("a")
+	if !perRoom.Allow("b") {
+		t.Fatal("per-room limiter should not block other rooms")
+	}
+}
+
+func TestSendContent_RateLimited(t *testing.T) {
+	l := NewRateLimiter(1, 1, false)
+	l.Allow("room") // drain the bucket
+	c := &Client{limiter: l}
+
+	_, err := c.SendMessage("room", "spam")
+	if !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("expected ErrRateLimited, got %v", err)
+	}
+}
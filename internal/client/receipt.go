@@ -0,0 +1,249 @@
+package client
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultTrackedMessages is how many tracked sends an AckTracker remembers.
+const DefaultTrackedMessages = 1000
+
+// AckTracker records which agents acknowledged tracked sends with
+// message.received. Keep one across reconnects so receipts for messages sent
+// on an earlier connection still count.
+type AckTracker struct {
+	mu    sync.Mutex
+	size  int
+	order []string                        // tracked message IDs, oldest first
+	rooms map[string]string               // message ID → room
+	acks  map[string]map[string]time.Time // message ID → agent ID → when acked
+	early map[string][]earlyAck           // acks that beat track, by message ID
+}
+
+// earlyAck is an ack for a message not tracked yet: a fast peer can answer
+// before SendTracked gets to track the message it just wrote.
+type earlyAck struct {
+	room, agent string
+	at          time.Time
+}
+
+// NewAckTracker returns a tracker remembering the last size tracked sends
+// (DefaultTrackedMessages if size <= 0); older ones are forgotten.
+func NewAckTracker(size int) *AckTracker {
+	if size <= 0 {
+		size = DefaultTrackedMessages
+	}
+	return &AckTracker{
+		size:  size,
+		rooms: make(map[string]string),
+		acks:  make(map[string]map[string]time.Time),
+		early: make(map[string][]earlyAck),
+	}
+}
+
+func (t *AckTracker) track(id, room string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.rooms[id]; ok {
+		return
+	}
+	if len(t.order) >= t.size {
+		oldest := t.order[0]
+		t.order = t.order[1:]
+		delete(t.rooms, oldest)
+		delete(t.acks, oldest)
+	}
+	t.order = append(t.order, id)
+	t.rooms[id] = room
+	t.acks[id] = make(map[string]time.Time)
+	for _, a := range t.early[id] {
+		t.add(id, a.room, a.agent, a.at)
+	}
+	delete(t.early, id)
+}
+
+func (t *AckTracker) untrack(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.rooms, id)
+	delete(t.acks, id)
+	for i, o := range t.order {
+		if o == id {
+			t.order = append(t.order[:i], t.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// record notes agent's ack of id. Acks for untracked messages are held
+// briefly in case the message is about to be tracked, then forgotten.
+func (t *AckTracker) record(id, room, agent string, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if id == "" || agent == "" {
+		return
+	}
+	if _, ok := t.acks[id]; ok {
+		t.add(id, room, agent, at)
+		return
+	}
+	if len(t.early) >= t.size {
+		clear(t.early) // mostly acks for other agents' messages
+	}
+	t.early[id] = append(t.early[id], earlyAck{room, agent, at})
+}
+
+// add records an ack of tracked message id. Must be called with t.mu held.
+func (t *AckTracker) add(id, room, agent string, at time.Time) {
+	if room != "" && room != t.rooms[id] {
+		return
+	}
+	if _, dup := t.acks[id][agent]; !dup {
+		t.acks[id][agent] = at
+	}
+}
+
+// Acks returns the agents that acknowledged message id, with when, and
+// whether id is tracked at all.
+func (t *AckTracker) Acks(id string) (room string, acks map[string]time.Time, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tracked, ok := t.acks[id]
+	if !ok {
+		return "", nil, false
+	}
+	acks = make(map[string]time.Time, len(tracked))
+	for agent, at := range tracked {
+		acks[agent] = at
+	}
+	return t.rooms[id], acks, true
+}
+
+// SetAckTracker makes tracked sends record receipts in t instead of a
+// tracker of the client's own.
+func (c *Client) SetAckTracker(t *AckTracker) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ackTracker = t
+}
+
+func (c *Client) acks() *AckTracker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ackTracker == nil {
+		c.ackTracker = NewAckTracker(0)
+	}
+	return c.ackTracker
+}
+
+// Receipt is a tracked send: the agents that acknowledged receiving it.
+type Receipt struct {
+	ID   string
+	Room string
+
+	c       *Client
+	tracker *AckTracker
+}
+
+// AckedBy returns the IDs of the agents that acknowledged the message so
+// far, sorted.
+func (r *Receipt) AckedBy() []string {
+	_, acks, _ := r.tracker.Acks(r.ID)
+	ids := make([]string, 0, len(acks))
+	for id := range acks {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Pending returns the room's current members, other than this agent, that
+// haven't acknowledged the message, sorted.
+func (r *Receipt) Pending() []string {
+	_, acks, _ := r.tracker.Acks(r.ID)
+	var ids []string
+	for _, m := range r.c.Members(r.Room) {
+		if _, ok := acks[m.ID]; !ok && m.ID != r.c.agentID {
+			ids = append(ids, m.ID)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// SendTracked sends content like SendContent (as a reply if inReplyTo is
+// set) and returns a Receipt collecting the message.received acks that
+// peers or the relay send back for it. Peers that don't ack never appear.
+// A failed write fails the send rather than queueing it in the outbox, whose
+// resend would go out untracked.
+func (c *Client) SendTracked(room string, content map[string]interface{}, inReplyTo string) (*Receipt, error) {
+	tracker := c.acks()
+	id, err := c.sendMessage(room, content, inReplyTo, false, func(id string) error {
+		tracker.track(id, room)
+		if err := c.awaitRelayError(); err != nil {
+			tracker.untrack(id)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Receipt{ID: id, Room: room, c: c, tracker: tracker}, nil
+}
+
+// handleReceipt records a message.received event. With a verifier set, an
+// ack not signed by its "from" agent is dropped, so no member can ack for
+// another.
+func (c *Client) handleReceipt(raw []byte) {
+	if !c.verified(raw) {
+		c.unverified.Add(1)
+		return
+	}
+	var ev struct {
+		Room      string `json:"room"`
+		MessageID string `json:"message_id"`
+		From      string `json:"from"`
+	}
+	json.Unmarshal(raw, &ev)
+	c.mu.Lock()
+	tracker := c.ackTracker
+	c.mu.Unlock()
+	if tracker != nil {
+		tracker.record(ev.MessageID, ev.Room, ev.From, time.Now())
+	}
+}
+
+// SendReceipt acknowledges a received message to its room with a signed
+// message.received, for senders tracking delivery. Receipts count against
+// the receipt limiter, not the send one. Like any operation it holds opMu
+// until the relay has had its chance to reject it, so a rejection is never
+// taken for another operation's.
+func (c *Client) SendReceipt(room, messageID string) error {
+	if c.readOnly {
+		return ErrReadOnly
+	}
+	if c.receiptLimiter != nil && !c.receiptLimiter.Allow(room) {
+		return ErrRateLimited
+	}
+
+	defer c.lockOp()()
+
+	msg := map[string]interface{}{
+		"type":       "message.received",
+		"room":       room,
+		"from":       c.agentID,
+		"message_id": messageID,
+		"timestamp":  time.Now().UnixMilli(),
+		"nonce":      randomNonce(),
+	}
+	if err := c.signMessage(msg); err != nil {
+		return err
+	}
+	if err := c.writeJSON(msg); err != nil {
+		return err
+	}
+	return c.awaitRelayError()
+}
@@ -0,0 +1,188 @@
+package client
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcutil/base58"
+	"github.com/gorilla/websocket"
+)
+
+func TestSendTracked_CollectsAcks(t *testing.T) {
+	c := pipeClient(t, func(ws *websocket.Conn) {
+		for {
+			_, raw, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			var msg struct {
+				Type string `json:"type"`
+				ID   string `json:"id"`
+			}
+			json.Unmarshal(raw, &msg)
+			if msg.Type != "message" {
+				continue
+			}
+			// bob acks twice, carol from the wrong room, dave another message.
+			ack := `{"type":"message.received","room":%q,"message_id":%q,"from":%q}`
+			for _, ev := range []string{
+				fmt.Sprintf(ack, "lab", msg.ID, "bob"),
+				fmt.Sprintf(ack, "lab", msg.ID, "bob"),
+				fmt.Sprintf(ack, "ops", msg.ID, "carol"),
+				fmt.Sprintf(ack, "lab", "other", "dave"),
+			} {
+				ws.WriteMessage(websocket.TextMessage, []byte(ev))
+			}
+		}
+	})
+	_, c.privKey, _ = ed25519.GenerateKey(rand.Reader)
+	c.agentID = "me"
+	c.members["lab"] = map[string]Member{"me": {ID: "me"}, "bob": {ID: "bob"}, "carol": {ID: "carol"}}
+
+	r, err := c.SendTracked("lab", map[string]interface{}{"type": "text", "text": "ready?"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(time.Second); len(r.AckedBy()) == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("no ack recorded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond) // let the rest arrive
+	if got := r.AckedBy(); len(got) != 1 || got[0] != "bob" {
+		t.Fatalf("acked by %v, want [bob]", got)
+	}
+	if got := r.Pending(); len(got) != 1 || got[0] != "carol" {
+		t.Fatalf("pending %v, want [carol]", got)
+	}
+	if _, _, ok := c.acks().Acks("other"); ok {
+		t.Fatal("an untracked message was tracked")
+	}
+}
+
+func TestAckTracker_ForgetsOldest(t *testing.T) {
+	tr := NewAckTracker(2)
+	tr.record("m1", "lab", "bob", time.Now()) // before track: held
+	for _, id := range []string{"m1", "m2", "m3"} {
+		tr.track(id, "lab")
+	}
+	if _, _, ok := tr.Acks("m1"); ok {
+		t.Fatal("oldest message still tracked")
+	}
+	tr.track("m1", "lab")
+	if _, acks, _ := tr.Acks("m1"); len(acks) != 0 {
+		t.Fatalf("early ack applied twice: %v", acks)
+	}
+
+	tr = NewAckTracker(2)
+	tr.record("m1", "lab", "bob", time.Now())
+	tr.track("m1", "lab")
+	if _, acks, _ := tr.Acks("m1"); len(acks) != 1 {
+		t.Fatalf("early ack lost: %v", acks)
+	}
+}
+
+func TestSendTracked_NeverQueued(t *testing.T) {
+	outbox := NewOutbox(10, 0)
+	dead := pipeClient(t, func(*websocket.Conn) {})
+	dead.privKey = ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	dead.SetOutbox(outbox)
+	dead.Close()
+
+	_, err := dead.SendTracked("lab", map[string]interface{}{"type": "text", "text": "ready?"}, "")
+	if err == nil || errors.Is(err, ErrQueued) {
+		t.Fatalf("expected the failed write to fail the send, got %v", err)
+	}
+	if outbox.Len() != 0 {
+		t.Fatalf("tracked send queued %d messages", outbox.Len())
+	}
+}
+
+func TestSendReceipt_RateLimited(t *testing.T) {
+	c := pipeClient(t, func(ws *websocket.Conn) {
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+	c.privKey = ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	c.SetRateLimiter(NewRateLimiter(0.001, 1, false))
+	c.SetReceiptLimiter(NewRateLimiter(0.001, 1, false))
+
+	if err := c.SendReceipt("lab", "m1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SendReceipt("lab", "m2"); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("expected receipts to spend the receipt budget, got %v", err)
+	}
+	if _, err := c.SendMessage("lab", "hi"); err != nil {
+		t.Fatalf("receipts spent the send budget: %v", err)
+	}
+}
+
+func TestSendReceipt_ConsumesItsRejection(t *testing.T) {
+	c := pipeClient(t, func(ws *websocket.Conn) {
+		for {
+			_, raw, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			var msg struct {
+				Type string `json:"type"`
+			}
+			json.Unmarshal(raw, &msg)
+			if msg.Type == "message.received" {
+				ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"error","code":"UNKNOWN_TYPE","message":"unknown type"}`))
+			}
+		}
+	})
+	c.privKey = ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+
+	done := make(chan error)
+	go func() { done <- c.SendReceipt("lab", "m1") }()
+	if _, err := c.SendMessage("lab", "hi"); err != nil {
+		t.Fatalf("a rejected receipt failed a send: %v", err)
+	}
+	if err := <-done; err == nil {
+		t.Fatal("expected the receipt to report its rejection")
+	}
+}
+
+func TestHandleReceipt_DropsForgedAcks(t *testing.T) {
+	bobPub, bobPriv, _ := ed25519.GenerateKey(nil)
+	carolPub, _, _ := ed25519.GenerateKey(nil)
+	bob, carol := base58.Encode(bobPub), base58.Encode(carolPub)
+	c := &Client{}
+	c.SetVerifier(NewVerifier(0))
+	tracker := c.acks()
+	tracker.track("m1", "lab")
+
+	ack := func(from string) []byte {
+		msg := map[string]interface{}{
+			"type":       "message.received",
+			"room":       "lab",
+			"from":       from,
+			"message_id": "m1",
+			"timestamp":  time.Now().UnixMilli(),
+			"nonce":      randomNonce(),
+		}
+		(&Client{privKey: bobPriv}).signMessage(msg)
+		raw, _ := json.Marshal(msg)
+		return raw
+	}
+	c.handleReceipt(ack(bob))
+	c.handleReceipt(ack(carol)) // bob claiming carol got it
+	if _, acks, _ := tracker.Acks("m1"); len(acks) != 1 || acks[bob].IsZero() {
+		t.Fatalf("acks %v, want only bob's", acks)
+	}
+	if n := c.Unverified(); n != 1 {
+		t.Fatalf("unverified %d, want 1", n)
+	}
+}
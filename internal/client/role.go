@@ -0,0 +1,71 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Room roles, as relays report them in room.joined.
+const (
+	RoleOwner     = "owner"
+	RoleModerator = "moderator"
+	RoleMember    = "member"
+)
+
+// joinedRoom is a room.joined response.
+type joinedRoom struct {
+	Room    string   `json:"room"`
+	Topic   string   `json:"topic"`
+	Tags    []string `json:"tags"`
+	Members []Member `json:"members"`
+	Role    string   `json:"role,omitempty"` // this agent's role, if the relay says
+}
+
+// recordJoin notes the room.joined response resp and returns its RoomInfo.
+// This agent's role is the one the relay gave, else its own entry's in the
+// member list, else fallback.
+func (c *Client) recordJoin(resp json.RawMessage, fallback string) *RoomInfo {
+	var joined joinedRoom
+	json.Unmarshal(resp, &joined)
+	role := joined.Role
+	for _, m := range joined.Members {
+		if role == "" && m.ID == c.agentID {
+			role = m.Role
+		}
+	}
+	if role == "" {
+		role = fallback
+	}
+
+	c.mu.Lock()
+	c.rooms[joined.Room] = true
+	if role != "" {
+		if c.roles == nil {
+			c.roles = make(map[string]string)
+		}
+		c.roles[joined.Room] = role
+	} else {
+		delete(c.roles, joined.Room)
+	}
+	c.mu.Unlock()
+
+	return &RoomInfo{Name: joined.Room, Topic: joined.Topic, Tags: joined.Tags, Members: joined.Members, MyRole: role}
+}
+
+// Role returns this agent's role in a joined room (RoleOwner, RoleModerator
+// or RoleMember), or "" if the relay didn't say.
+func (c *Client) Role(room string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.roles[room]
+}
+
+// checkModerator returns ErrNotOwner, before anything is sent, if the relay
+// said this agent is a plain member of room. Unknown roles are left for the
+// relay to judge.
+func (c *Client) checkModerator(room string) error {
+	if c.Role(room) == RoleMember {
+		return fmt.Errorf("%s: %w (you are a member)", room, ErrNotOwner)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package client
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestJoinRoom_RecordsRole(t *testing.T) {
+	replies := []string{
+		`{"type":"room.joined","room":"lab","role":"moderator","members":[]}`,
+		`{"type":"room.joined","room":"ops","members":[{"id":"me","name":"me","role":"member"},{"id":"boss","name":"boss","role":"owner"}]}`,
+		`{"type":"room.joined","room":"cafe","members":[]}`,
+	}
+	c := pipeClient(t, func(ws *websocket.Conn) {
+		for _, reply := range replies {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+			ws.WriteMessage(websocket.TextMessage, []byte(reply))
+		}
+		time.Sleep(100 * time.Millisecond)
+	})
+	c.agentID = "me"
+	c.privKey = ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+
+	for _, tc := range []struct{ room, want string }{{"lab", RoleModerator}, {"ops", RoleMember}, {"cafe", ""}} {
+		room, want := tc.room, tc.want
+		info, err := c.JoinRoom(room)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.MyRole != want || c.Role(room) != want {
+			t.Fatalf("%s: got role %q (info %q), want %q", room, c.Role(room), info.MyRole, want)
+		}
+	}
+
+	// A plain member is refused at once; nothing is sent.
+	if err := c.KickMember("ops", "boss"); !errors.Is(err, ErrNotOwner) {
+		t.Fatalf("kick as member: expected ErrNotOwner, got %v", err)
+	}
+	if err := c.UpdateRoom("ops", "new topic", nil); !errors.Is(err, ErrNotOwner) {
+		t.Fatalf("update as member: expected ErrNotOwner, got %v", err)
+	}
+
+	c.LeaveRoom("ops")
+	if c.Role("ops") != "" {
+		t.Fatal("role kept after leaving")
+	}
+}
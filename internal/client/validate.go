@@ -0,0 +1,142 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Limits checked before anything is sent to the relay.
+const (
+	MaxRoomNameLen = 64
+	MaxTags        = 10
+	MaxTagLen      = 32
+
+	// DefaultMaxMessageSize caps message text (or encoded structured
+	// content) in bytes unless changed with SetMaxMessageSize.
+	DefaultMaxMessageSize = 16 * 1024
+)
+
+// Validation errors, returned before anything is sent.
+var (
+	ErrInvalidRoomName = errors.New("invalid room name")
+	ErrInvalidTags     = errors.New("invalid tags")
+	ErrMessageTooLarge = errors.New("message too large")
+	ErrInvalidContent  = errors.New("invalid content")
+)
+
+// validateRoom rejects room names the relay can't route: empty, overlong,
+// or containing whitespace or control characters.
+func validateRoom(name string) error {
+	if name == "" {
+		return fmt.Errorf("%w: room name required", ErrInvalidRoomName)
+	}
+	if len(name) > MaxRoomNameLen {
+		return fmt.Errorf("%w: longer than %d bytes", ErrInvalidRoomName, MaxRoomNameLen)
+	}
+	if strings.IndexFunc(name, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsControl(r) }) >= 0 {
+		return fmt.Errorf("%w: %q contains whitespace or control characters", ErrInvalidRoomName, name)
+	}
+	return nil
+}
+
+// validateRoomName is validateRoom for rooms being created or sent to, which
+// may only use ASCII letters, digits, '-', '_' and '.'. Rooms joined before
+// the rule are still checked with validateRoom, so they can be left.
+func validateRoomName(name string) error {
+	if err := validateRoom(name); err != nil {
+		return err
+	}
+	if strings.IndexFunc(name, func(r rune) bool {
+		return !(r < 0x80 && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' || r == '.'))
+	}) >= 0 {
+		return fmt.Errorf("%w: %q may only contain letters, digits, '-', '_' and '.'", ErrInvalidRoomName, name)
+	}
+	return nil
+}
+
+// validateTags checks room tags: at most MaxTags, each non-empty, without
+// whitespace and at most MaxTagLen bytes.
+func validateTags(tags []string) error {
+	if len(tags) > MaxTags {
+		return fmt.Errorf("%w: at most %d allowed", ErrInvalidTags, MaxTags)
+	}
+	for _, t := range tags {
+		if t == "" || len(t) > MaxTagLen || strings.IndexFunc(t, unicode.IsSpace) >= 0 {
+			return fmt.Errorf("%w: %q must be 1-%d characters without spaces", ErrInvalidTags, t, MaxTagLen)
+		}
+	}
+	return nil
+}
+
+// validateContent requires a string "type" and, for text messages, non-empty
+// text. Text, or for other types the encoded content, may be at most max bytes.
+func validateContent(content map[string]interface{}, max int) error {
+	t, _ := content["type"].(string)
+	if t == "" {
+		return fmt.Errorf("%w: content type required", ErrInvalidContent)
+	}
+	size := 0
+	if t == "text" {
+		text, _ := content["text"].(string)
+		if strings.TrimSpace(text) == "" {
+			return fmt.Errorf("%w: message text required", ErrInvalidContent)
+		}
+		size = len(text)
+	} else {
+		data, err := json.Marshal(content)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidContent, err)
+		}
+		size = len(data)
+	}
+	if size > max {
+		return fmt.Errorf("%w: %d bytes, limit is %d", ErrMessageTooLarge, size, max)
+	}
+	return nil
+}
+
+// SetMaxMessageSize changes the message size limit; n <= 0 restores
+// DefaultMaxMessageSize.
+func (c *Client) SetMaxMessageSize(n int) {
+	c.maxMessageSize = n
+}
+
+// ErrTooManyRooms is returned when joining or creating a room would exceed the
+// limit set with SetMaxRooms. Nothing is sent to the relay.
+var ErrTooManyRooms = errors.New("too many joined rooms")
+
+// SetMaxRooms caps how many rooms the client may be in at once; n <= 0 means
+// no limit. Rooms already joined are kept. Call before the client is shared.
+func (c *Client) SetMaxRooms(n int) {
+	c.maxRooms = n
+}
+
+// checkRoomLimit returns ErrTooManyRooms if joining room would exceed the cap.
+// Rejoining a room the client is already in never does.
+func (c *Client) checkRoomLimit(room string) error {
+	if c.maxRooms <= 0 {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.rooms[room] && len(c.rooms) >= c.maxRooms {
+		return fmt.Errorf("%w: limit is %d", ErrTooManyRooms, c.maxRooms)
+	}
+	return nil
+}
+
+// messageLimit returns the message size limit in bytes.
+func (c *Client) messageLimit() int {
+	limit := DefaultMaxMessageSize
+	if c.maxMessageSize > 0 {
+		limit = c.maxMessageSize
+	}
+	// A smaller relay limit would only refuse the message after sending.
+	if c.capabilities != nil && c.capabilities.MaxMessageSize > 0 {
+		limit = min(limit, c.capabilities.MaxMessageSize)
+	}
+	return limit
+}
@@ -0,0 +1,141 @@
+package client
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcutil/base58"
+	"github.com/gorilla/websocket"
+)
+
+func TestValidateRoom(t *testing.T) {
+	for _, bad := range []string{"", "has space", "tab\there", strings.Repeat("x", MaxRoomNameLen+1)} {
+		if validateRoom(bad) == nil {
+			t.Fatalf("room %q should be rejected", bad)
+		}
+	}
+	if err := validateRoom("ops-team_1"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateRoom_TypedErrors(t *testing.T) {
+	for _, bad := range []string{"", " lab", "lab/ops", "café", strings.Repeat("x", MaxRoomNameLen+1)} {
+		if err := validateRoomName(bad); !errors.Is(err, ErrInvalidRoomName) {
+			t.Fatalf("room %q: expected ErrInvalidRoomName, got %v", bad, err)
+		}
+	}
+	if err := validateRoomName("release.v2"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateContent_TypedErrors(t *testing.T) {
+	for _, bad := range []map[string]interface{}{
+		{"text": "no type"},
+		{"type": "text", "text": "  "},
+		{"type": "data", "value": func() {}},
+	} {
+		if err := validateContent(bad, DefaultMaxMessageSize); !errors.Is(err, ErrInvalidContent) {
+			t.Fatalf("%v: expected ErrInvalidContent, got %v", bad, err)
+		}
+	}
+}
+
+func TestLeaveRoom_AllowsLegacyNames(t *testing.T) {
+	c := pipeClient(t, func(ws *websocket.Conn) {
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+	c.privKey = ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	for _, name := range []string{"lab/ops", "café"} {
+		if err := c.LeaveRoom(name); err != nil {
+			t.Fatalf("leave %q: %v", name, err)
+		}
+		if _, err := c.SendMessage(name, "hi"); !errors.Is(err, ErrInvalidRoomName) {
+			t.Fatalf("send to %q: expected ErrInvalidRoomName, got %v", name, err)
+		}
+	}
+}
+
+func TestSendMessage_TooLarge(t *testing.T) {
+	c := &Client{}
+	_, err := c.SendMessage("lab", strings.Repeat("x", DefaultMaxMessageSize+1))
+	if !errors.Is(err, ErrMessageTooLarge) {
+		t.Fatalf("expected ErrMessageTooLarge, got %v", err)
+	}
+
+	c.SetMaxMessageSize(10)
+	if _, err := c.SendContent("lab", map[string]interface{}{"type": "json", "data": "0123456789"}); !errors.Is(err, ErrMessageTooLarge) {
+		t.Fatalf("structured content should be limited by its encoded size, got %v", err)
+	}
+	if err := c.EditMessage("lab", "m1", strings.Repeat("x", 11)); !errors.Is(err, ErrMessageTooLarge) {
+		t.Fatalf("edits should be limited too, got %v", err)
+	}
+}
+
+func TestValidateTags(t *testing.T) {
+	if validateTags([]string{"ok", ""}) == nil || validateTags([]string{"two words"}) == nil {
+		t.Fatal("empty and spaced tags should be rejected")
+	}
+	if validateTags(make([]string, MaxTags+1)) == nil {
+		t.Fatal("too many tags should be rejected")
+	}
+	if err := validateTags([]string{"ai", "ops"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDryRunSend_SignedButNotSent(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	// No websocket: a dry run that tried to write would panic.
+	c := &Client{agentID: base58.Encode(pub), privKey: priv, readOnly: true}
+
+	dry, err := c.DryRunSend("ops", map[string]interface{}{"type": "text", "text": "hi"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := base58.Decode(dry.Envelope["signature"].(string))
+	if !ed25519.Verify(pub, []byte(dry.Canonical), sig) {
+		t.Fatal("signature should cover the canonical bytes")
+	}
+	if dry.Envelope["room"] != "ops" || strings.Contains(dry.Canonical, "signature") {
+		t.Fatalf("unexpected envelope: %s", dry.Canonical)
+	}
+
+	if _, err := c.DryRunSend("ops", map[string]interface{}{"type": "text", "text": "  "}, ""); err == nil {
+		t.Fatal("empty text should fail validation")
+	}
+}
+
+func TestDryRunCreateRoom_ValidatesTags(t *testing.T) {
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	c := &Client{privKey: priv}
+	if _, err := c.DryRunCreateRoom("ops", "topic", []string{"bad tag"}); err == nil {
+		t.Fatal("invalid tag should fail validation")
+	}
+	dry, err := c.DryRunCreateRoom("ops", "topic", []string{"ai"})
+	if err != nil || dry.Envelope["type"] != "room.create" {
+		t.Fatalf("unexpected dry run: %+v %v", dry, err)
+	}
+}
+
+func TestCheckRoomLimit(t *testing.T) {
+	c := &Client{rooms: map[string]bool{"a": true, "b": true}}
+	if err := c.checkRoomLimit("c"); err != nil {
+		t.Fatalf("no limit set: %v", err)
+	}
+	c.SetMaxRooms(2)
+	if err := c.checkRoomLimit("c"); !errors.Is(err, ErrTooManyRooms) {
+		t.Fatalf("expected ErrTooManyRooms, got %v", err)
+	}
+	if err := c.checkRoomLimit("a"); err != nil {
+		t.Fatalf("rejoining a room shouldn't count: %v", err)
+	}
+}
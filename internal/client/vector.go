@@ -0,0 +1,40 @@
+package client
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcutil/base58"
+)
+
+// TestVectorSeed is the Ed25519 seed signing vectors use unless given
+// another: the first test key of RFC 8032, so anyone can reproduce them.
+const TestVectorSeed = "9d61b19deffd5a60ba844af492ec2cc44449c5697b326919703bac031cae7f60"
+
+// TestVectorKey returns the private key for TestVectorSeed.
+func TestVectorKey() ed25519.PrivateKey {
+	seed, _ := hex.DecodeString(TestVectorSeed)
+	return ed25519.NewKeyFromSeed(seed)
+}
+
+// SigningVector returns the canonical bytes a signature over the JSON object
+// in data covers, and priv's base58 signature over them. The object is
+// decoded the way received messages are, numbers as float64, so the result
+// is what a relay verifying the same text must reproduce byte for byte.
+func SigningVector(data []byte, priv ed25519.PrivateKey) ([]byte, string, error) {
+	var obj interface{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, "", err
+	}
+	if _, ok := obj.(map[string]interface{}); !ok {
+		return nil, "", errors.New("signed messages are JSON objects")
+	}
+	canonical, err := canonicalJSON(obj)
+	if err != nil {
+		return nil, "", fmt.Errorf("canonicalize: %w", err)
+	}
+	return canonical, base58.Encode(ed25519.Sign(priv, canonical)), nil
+}
@@ -0,0 +1,94 @@
+package client
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/btcsuite/btcutil/base58"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite testdata/signing_vectors.json from the current encoder")
+
+// signingVector is one entry of testdata/signing_vectors.json. Input is JSON
+// text, kept as a string so its escapes and number spellings survive.
+type signingVector struct {
+	Name      string `json:"name"`
+	Input     string `json:"input"`
+	Canonical string `json:"canonical"`
+	Signature string `json:"signature"`
+}
+
+const vectorsPath = "testdata/signing_vectors.json"
+
+// TestSigningVectors pins the canonical bytes and signatures of the golden
+// vectors. A failure means signatures changed: either fix the encoder, or
+// agree the new bytes with the relay and rerun with -update.
+func TestSigningVectors(t *testing.T) {
+	data, err := os.ReadFile(vectorsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vectors []signingVector
+	if err := json.Unmarshal(data, &vectors); err != nil {
+		t.Fatal(err)
+	}
+	if len(vectors) == 0 {
+		t.Fatal("no vectors")
+	}
+
+	priv := TestVectorKey()
+	pub := priv.Public().(ed25519.PublicKey)
+	for i, v := range vectors {
+		canonical, sig, err := SigningVector([]byte(v.Input), priv)
+		if err != nil {
+			t.Fatalf("%s: %v", v.Name, err)
+		}
+		if !ed25519.Verify(pub, canonical, base58.Decode(sig)) {
+			t.Fatalf("%s: signature doesn't verify", v.Name)
+		}
+		if *updateGolden {
+			vectors[i].Canonical, vectors[i].Signature = string(canonical), sig
+			continue
+		}
+		if string(canonical) != v.Canonical {
+			t.Errorf("%s: canonical bytes\n got %s\nwant %s", v.Name, canonical, v.Canonical)
+		}
+		if sig != v.Signature {
+			t.Errorf("%s: signature\n got %s\nwant %s", v.Name, sig, v.Signature)
+		}
+	}
+
+	if *updateGolden {
+		var out bytes.Buffer
+		enc := json.NewEncoder(&out)
+		enc.SetEscapeHTML(false) // keep the file readable
+		enc.SetIndent("", "  ")
+		enc.Encode(vectors)
+		if err := os.WriteFile(filepath.FromSlash(vectorsPath), out.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSigningVector_RejectsNonObjects(t *testing.T) {
+	for _, in := range []string{`[1,2]`, `"text"`, `{"a":`} {
+		if _, _, err := SigningVector([]byte(in), TestVectorKey()); err == nil {
+			t.Fatalf("%s: expected an error", in)
+		}
+	}
+}
+
+func TestTestVectorKey(t *testing.T) {
+	// RFC 8032, section 7.1, test 1.
+	const pub = "d75a980182b10ab7d54bfed3c964073a0ee172f3daa62325af021a68f707511a"
+	got := TestVectorKey().Public().(ed25519.PublicKey)
+	if hex.EncodeToString(got) != pub {
+		t.Fatalf("got public key %x", got)
+	}
+}
@@ -0,0 +1,141 @@
+package client
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcutil/base58"
+	"github.com/gorilla/websocket"
+)
+
+func TestVerifier_VerifyEnvelope(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	c := &Client{agentID: base58.Encode(pub), privKey: priv}
+	msg := map[string]interface{}{
+		"type":      "message",
+		"room":      "lab",
+		"content":   map[string]interface{}{"type": "text", "text": "hi"},
+		"nonce":     randomNonce(),
+		"timestamp": time.Now().UnixMilli(),
+	}
+	if err := c.signMessage(msg); err != nil {
+		t.Fatal(err)
+	}
+	// As a receiver sees it: decoded from the wire.
+	raw, _ := json.Marshal(msg)
+	var got map[string]interface{}
+	json.Unmarshal(raw, &got)
+
+	v := NewVerifier(8)
+	if !v.VerifyEnvelope(c.agentID, got) {
+		t.Fatal("valid envelope rejected")
+	}
+	if !v.VerifyEnvelope(c.agentID, got) {
+		t.Fatal("cached verdict differs")
+	}
+	got["room"] = "other"
+	if v.VerifyEnvelope(c.agentID, got) {
+		t.Fatal("tampered envelope accepted")
+	}
+	other, _, _ := ed25519.GenerateKey(nil)
+	got["room"] = "lab"
+	if v.VerifyEnvelope(base58.Encode(other), got) {
+		t.Fatal("envelope accepted for the wrong agent")
+	}
+	if v.Verify("not-base58-0OIl", []byte("x"), "sig") {
+		t.Fatal("malformed agent ID accepted")
+	}
+}
+
+func TestVerifier_Bounded(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	id := base58.Encode(pub)
+	v := NewVerifier(4)
+	for i := 0; i < 20; i++ {
+		data := []byte(fmt.Sprint(i))
+		if !v.Verify(id, data, base58.Encode(ed25519.Sign(priv, data))) {
+			t.Fatalf("message %d rejected", i)
+		}
+	}
+	if len(v.entries) != 4 || v.order.Len() != 4 {
+		t.Fatalf("cache grew past its size: %d entries", len(v.entries))
+	}
+}
+
+// benchmarkVerify verifies a stream in which one message in five repeats an
+// earlier one, as after a replaying rejoin.
+func benchmarkVerify(b *testing.B, verify func(id string, data []byte, sig string) bool) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	id := base58.Encode(pub)
+	const n = 1000
+	data, sigs := make([][]byte, n), make([]string, n)
+	for i := range data {
+		src := i
+		if i%5 == 4 {
+			src = i - 3 // 20% duplicates
+		}
+		data[i] = []byte(fmt.Sprintf(`{"room":"lab","text":"message %d"}`, src))
+		sigs[i] = base58.Encode(ed25519.Sign(priv, data[i]))
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		j := i % n
+		if !verify(id, data[j], sigs[j]) {
+			b.Fatal("rejected")
+		}
+	}
+}
+
+func BenchmarkVerify_Uncached(b *testing.B) {
+	benchmarkVerify(b, func(id string, data []byte, sig string) bool {
+		return ed25519.Verify(base58.Decode(id), data, base58.Decode(sig))
+	})
+}
+
+func BenchmarkVerify_Cached(b *testing.B) {
+	// Sized below the stream, so only the duplicates hit, as on a live
+	// connection where each message is new.
+	v := NewVerifier(64)
+	benchmarkVerify(b, v.Verify)
+}
+
+func TestReadLoop_DropsUnverifiedMessages(t *testing.T) {
+	alicePub, alicePriv, _ := ed25519.GenerateKey(nil)
+	_, mallory, _ := ed25519.GenerateKey(nil)
+	alice := base58.Encode(alicePub)
+	signed := func(priv ed25519.PrivateKey, text string) []byte {
+		msg := map[string]interface{}{
+			"type":      "message",
+			"id":        randomUUID(),
+			"room":      "lab",
+			"from":      alice,
+			"content":   map[string]interface{}{"type": "text", "text": text},
+			"nonce":     randomNonce(),
+			"timestamp": time.Now().UnixMilli(),
+		}
+		(&Client{privKey: priv}).signMessage(msg)
+		msg["from_name"], msg["replayed"] = "alice", true // added by the relay
+		raw, _ := json.Marshal(msg)
+		return raw
+	}
+	c := pipeClientWith(t, func(ws *websocket.Conn) {
+		for _, raw := range [][]byte{
+			signed(mallory, "forged"),
+			[]byte(`{"type":"message","room":"lab","from":"` + alice + `","content":{"type":"text","text":"unsigned"}}`),
+			signed(alicePriv, "genuine"),
+		} {
+			ws.WriteMessage(websocket.TextMessage, raw)
+		}
+		ws.ReadMessage()
+	}, func(c *Client) { c.SetVerifier(NewVerifier(0)) })
+
+	if in := <-c.Messages(); in.Text != "genuine" {
+		t.Fatalf("got %q, want only the genuine message", in.Text)
+	}
+	if n := c.Unverified(); n != 2 {
+		t.Fatalf("unverified %d, want 2", n)
+	}
+}
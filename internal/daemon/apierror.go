@@ -0,0 +1,134 @@
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/betta-lab/agentnet-openclaw/internal/client"
+)
+
+// Error codes reported in API error bodies. They are stable: clients should
+// branch on the code, not the message, which is for humans and may change.
+const (
+	codeBadRequest       = "bad_request"
+	codeUnauthorized     = "unauthorized"
+	codeForbidden        = "forbidden"
+	codeNotFound         = "not_found"
+	codeMethodNotAllowed = "method_not_allowed"
+	codeConflict         = "conflict"
+	codeTimeout          = "timeout"
+	codeRateLimited      = "rate_limited"
+	codeInternal         = "internal_error"
+	codeRelayError       = "relay_error"
+	codeNotConnected     = "not_connected"
+	codeReadOnly         = "read_only"
+	codeInvalidRoomName  = "invalid_room_name"
+	codeInvalidTags      = "invalid_tags"
+	codeMessageTooLarge  = "message_too_large"
+	codeNotOwner         = "not_owner"
+	codeUnauthorizedRoom = "unauthorized_room"
+	codeUnsupported      = "unsupported"
+	codeTooManyRooms     = "too_many_rooms"
+	codeInvalidName      = "invalid_name"
+	codeNotMember        = "not_member"
+)
+
+// apiError is the body of every error response:
+//
+//	{"error":{"code":"not_connected","message":"not connected"}}
+type apiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// writeError writes an error response with the given code.
+func writeError(w http.ResponseWriter, code, msg string, status int) {
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Set("Content-Type", "application/json")
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]apiError{"error": {Code: code, Message: msg}})
+}
+
+// httpError replaces http.Error: it writes msg as a JSON error whose code is
+// the generic one for status.
+func httpError(w http.ResponseWriter, msg string, status int) {
+	writeError(w, statusCode(status), msg, status)
+}
+
+// httpErrorFor writes err as a JSON error, with a specific code when err is
+// one the client package defines and the generic one for status otherwise.
+func httpErrorFor(w http.ResponseWriter, err error, status int) {
+	writeError(w, errorCode(err, status), err.Error(), status)
+}
+
+// notConnected reports that the identity has no relay connection.
+func notConnected(w http.ResponseWriter) {
+	writeError(w, codeNotConnected, "not connected", http.StatusServiceUnavailable)
+}
+
+// errorCode maps err to an error code, falling back to statusCode(status).
+func errorCode(err error, status int) string {
+	var relayErr *client.RelayError
+	switch {
+	case errors.Is(err, client.ErrReadOnly):
+		return codeReadOnly
+	case errors.Is(err, client.ErrRateLimited):
+		return codeRateLimited
+	case errors.Is(err, client.ErrInvalidRoomName):
+		return codeInvalidRoomName
+	case errors.Is(err, client.ErrInvalidTags):
+		return codeInvalidTags
+	case errors.Is(err, client.ErrMessageTooLarge):
+		return codeMessageTooLarge
+	case errors.Is(err, client.ErrNotOwner):
+		return codeNotOwner
+	case errors.Is(err, client.ErrUnauthorizedRoom):
+		return codeUnauthorizedRoom
+	case errors.Is(err, client.ErrPresenceUnsupported), errors.Is(err, client.ErrProfileUnsupported),
+		errors.Is(err, client.ErrUnsupported):
+		return codeUnsupported
+	case errors.Is(err, client.ErrTooManyRooms):
+		return codeTooManyRooms
+	case errors.Is(err, client.ErrInvalidName):
+		return codeInvalidName
+	case errors.Is(err, client.ErrMemberNotFound):
+		return codeNotMember
+	case errors.As(err, &relayErr):
+		return codeRelayError
+	}
+	var histErr *historyError
+	if errors.As(err, &histErr) && histErr.status >= 500 {
+		return codeRelayError
+	}
+	return statusCode(status)
+}
+
+// statusCode returns the generic error code for an HTTP status.
+func statusCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return codeBadRequest
+	case http.StatusUnauthorized:
+		return codeUnauthorized
+	case http.StatusForbidden:
+		return codeForbidden
+	case http.StatusNotFound:
+		return codeNotFound
+	case http.StatusMethodNotAllowed:
+		return codeMethodNotAllowed
+	case http.StatusConflict:
+		return codeConflict
+	case http.StatusTooManyRequests:
+		return codeRateLimited
+	case http.StatusBadGateway:
+		return codeRelayError
+	case http.StatusServiceUnavailable:
+		return codeNotConnected
+	case http.StatusGatewayTimeout:
+		return codeTimeout
+	}
+	return codeInternal
+}
@@ -0,0 +1,76 @@
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/betta-lab/agentnet-openclaw/internal/client"
+)
+
+func TestErrors_AreStructuredJSON(t *testing.T) {
+	d := &Daemon{apiToken: "tok"}
+
+	for _, tc := range []struct {
+		method, body string
+		status       int
+		code         string
+	}{
+		{"GET", "", http.StatusMethodNotAllowed, codeMethodNotAllowed},
+		{"POST", "{", http.StatusBadRequest, codeBadRequest},
+		{"POST", `{"room":"test","text":"hi"}`, http.StatusServiceUnavailable, codeNotConnected},
+	} {
+		w := httptest.NewRecorder()
+		d.handleTyping(w, httptest.NewRequest(tc.method, "/typing", strings.NewReader(tc.body)))
+		if w.Code != tc.status {
+			t.Fatalf("%s %q: expected %d, got %d", tc.method, tc.body, tc.status, w.Code)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+			t.Fatalf("expected application/json, got %q", ct)
+		}
+		var resp struct {
+			Error apiError `json:"error"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("error body is not JSON: %q", w.Body.String())
+		}
+		if resp.Error.Code != tc.code || resp.Error.Message == "" {
+			t.Fatalf("%s %q: got %+v, want code %q", tc.method, tc.body, resp.Error, tc.code)
+		}
+	}
+}
+
+func TestErrors_UnauthorizedIsStructured(t *testing.T) {
+	d := &Daemon{apiToken: "tok"}
+	h := d.requireAuth(func(w http.ResponseWriter, r *http.Request) {})
+
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest("GET", "/status", nil))
+	if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), `"code":"unauthorized"`) {
+		t.Fatalf("expected structured 401, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestErrorCode_PrefersSpecificCodes(t *testing.T) {
+	for _, tc := range []struct {
+		err    error
+		status int
+		want   string
+	}{
+		{fmt.Errorf("%w: bad", client.ErrInvalidRoomName), http.StatusBadRequest, codeInvalidRoomName},
+		{client.ErrReadOnly, http.StatusForbidden, codeReadOnly},
+		{client.ErrRateLimited, http.StatusTooManyRequests, codeRateLimited},
+		{&client.RelayError{Code: "ROOM_FULL", Message: "full"}, http.StatusInternalServerError, codeRelayError},
+		{&historyError{http.StatusBadGateway, "relay unreachable"}, http.StatusBadGateway, codeRelayError},
+		{errors.New("boom"), http.StatusInternalServerError, codeInternal},
+		{errors.New("nope"), http.StatusNotFound, codeNotFound},
+	} {
+		if got := errorCode(tc.err, tc.status); got != tc.want {
+			t.Fatalf("%v: got %q, want %q", tc.err, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package daemon
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// Ask timeouts.
+const (
+	defaultAskTimeout = 60 * time.Second
+	maxAskTimeout     = 10 * time.Minute
+)
+
+// handleAsk sends a message and waits for the first reply threaded under it
+// (in_reply_to = the sent message's ID, which serves as the correlation ID).
+// POST {"room", "text", "timeout_ms"}. The reply is returned as a message
+// object; 504 if none arrives in time. Replies also land in the unread buffer
+// as usual.
+func (d *Daemon) handleAsk(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httpError(w, "POST only", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Room      string `json:"room"`
+		Text      string `json:"text"`
+		TimeoutMs int64  `json:"timeout_ms"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	timeout := time.Duration(req.TimeoutMs) * time.Millisecond
+	if timeout <= 0 {
+		timeout = defaultAskTimeout
+	}
+	if timeout > maxAskTimeout {
+		httpError(w, "timeout_ms too large (max 10 minutes)", http.StatusBadRequest)
+		return
+	}
+
+	d.mu.RLock()
+	c := d.client
+	d.mu.RUnlock()
+	if c == nil {
+		notConnected(w)
+		return
+	}
+
+	// Subscribe before sending so a fast reply can't slip past.
+	ch, unwatch := d.watch()
+	defer unwatch()
+
+	id, err := c.SendMessage(req.Room, req.Text)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case msg := <-ch:
+			if msg.Room != req.Room || msg.InReplyTo != id || msg.Type != "" {
+				continue
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"id": id, "reply": msg})
+			return
+		case <-timer.C:
+			httpError(w, "no reply to "+id+" within "+timeout.String(), http.StatusGatewayTimeout)
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/betta-lab/agentnet-openclaw/internal/client"
+	"github.com/betta-lab/agentnet-openclaw/internal/keystore"
+	"github.com/gorilla/websocket"
+)
+
+func TestAsk_Validation(t *testing.T) {
+	d := &Daemon{}
+
+	w := httptest.NewRecorder()
+	d.handleAsk(w, httptest.NewRequest("POST", "/ask", strings.NewReader(`{"room":"lab","text":"?","timeout_ms":3600000}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an hour-long timeout, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	d.handleAsk(w, httptest.NewRequest("POST", "/ask", strings.NewReader(`{"room":"lab","text":"?"}`)))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 when not connected, got %d", w.Code)
+	}
+	if len(d.watchers) != 0 {
+		t.Fatal("watcher leaked")
+	}
+}
+
+// answerRelay completes the handshake and answers each message it is sent
+// with messages that aren't replies to it, then with the reply itself.
+func answerRelay(t *testing.T) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		ws.ReadMessage() // hello
+		ws.WriteJSON(map[string]interface{}{"type": "pow.challenge", "challenge": "c", "difficulty": 1})
+		ws.ReadMessage() // hello.pow
+		ws.WriteJSON(map[string]string{"type": "welcome"})
+		for {
+			var msg struct {
+				Type string `json:"type"`
+				ID   string `json:"id"`
+				Room string `json:"room"`
+			}
+			if err := ws.ReadJSON(&msg); err != nil {
+				return
+			}
+			if msg.Type != "message" {
+				continue
+			}
+			text := func(s string) map[string]string { return map[string]string{"type": "text", "text": s} }
+			for _, m := range []map[string]interface{}{
+				{"type": "message", "id": "chatter", "room": msg.Room, "from": "bob", "content": text("unrelated")},
+				{"type": "message", "id": "other-thread", "room": msg.Room, "from": "bob", "in_reply_to": "someone-else", "content": text("not yours")},
+				{"type": "message", "id": "other-room", "room": "elsewhere", "from": "bob", "in_reply_to": msg.ID, "content": text("wrong room")},
+				{"type": "message", "id": "answer", "room": msg.Room, "from": "bob", "in_reply_to": msg.ID, "content": text("42")},
+			} {
+				ws.WriteJSON(m)
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func TestAsk_ReturnsThreadedReply(t *testing.T) {
+	keys, err := keystore.LoadOrCreate(filepath.Join(t.TempDir(), "agent.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &Daemon{keys: keys}
+	c, err := d.dial(context.Background(), answerRelay(t), keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	d.client = c
+	go d.collectMessages(c)
+
+	w := httptest.NewRecorder()
+	d.handleAsk(w, httptest.NewRequest("POST", "/ask", strings.NewReader(`{"room":"lab","text":"meaning of life?","timeout_ms":5000}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body)
+	}
+	var resp struct {
+		ID    string                 `json:"id"`
+		Reply client.IncomingMessage `json:"reply"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Reply.ID != "answer" || resp.Reply.InReplyTo != resp.ID || resp.Reply.Text != "42" {
+		t.Fatalf("got reply %+v to %s", resp.Reply, resp.ID)
+	}
+}
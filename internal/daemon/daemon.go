@@ -2,81 +2,467 @@ package daemon
 
 import (
 	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	mrand "math/rand"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"syscall"
+	"text/template"
 	"time"
 
 	"github.com/betta-lab/agentnet-openclaw/internal/client"
 	"github.com/betta-lab/agentnet-openclaw/internal/keystore"
+	"github.com/betta-lab/agentnet-openclaw/internal/update"
 )
 
 // Daemon manages an AgentNet connection and exposes a local HTTP API.
 type Daemon struct {
-	addr              string
-	relay             string
-	agentName         string
-	keyPath           string
-	apiToken          string
-	client            *client.Client
-	mu                sync.RWMutex
-	messages          []client.IncomingMessage // ring buffer
-	joinedRooms       map[string]bool          // rooms to rejoin on reconnect
-	keys              *keystore.Keys
-	version           string
-	latestVersion     string    // cached latest release tag
-	latestVersionAt   time.Time // when latestVersion was last fetched
+	addr            string
+	relay           string   // relay in use (or tried next)
+	relays          []string // configured relays, primary first
+	agentName       string
+	keyPath         string
+	apiToken        string
+	client          *client.Client
+	mu              sync.RWMutex
+	messages        []client.IncomingMessage // ring buffer
+	messageSeq      int64                    // Seq of the last buffered message; the first follows the start time in µs
+	joinedRooms     map[string]bool          // rooms to rejoin on reconnect
+	keys            *keystore.Keys
+	version         string
+	latestVersion   string                                   // cached latest release tag
+	latestVersionAt time.Time                                // when latestVersion was last fetched
+	identityNames   []string                                 // extra identities to create on start
+	identities      map[string]*Daemon                       // extra identities, keyed by name; read-only after Start
+	parent          *Daemon                                  // owning daemon for extra identities, nil for the primary
+	typing          map[string]map[string]typist             // room → agent ID → who is typing
+	watchers        map[chan client.IncomingMessage]struct{} // live /stream subscribers
+	sendRate        float64                                  // outgoing messages per second, <= 0 disables
+	sendBurst       int
+	sendPerRoom     bool
+	limiter         *client.RateLimiter // shared by every connection of this identity
+	receiptLimiter  *client.RateLimiter // receipts' own budget, at the same rate
+	filter          senderFilter        // inbound sender allow/blocklist
+	filteredCount   int64               // messages dropped by filter
+	tlsCert         string              // API server certificate; empty serves plaintext
+	tlsKey          string
+	tlsClientCA     string             // CA for client certificates; set to require mutual TLS
+	roomKeys        map[string][]byte  // room → end-to-end encryption key
+	bufferSize      int                // unread buffer and client channel capacity
+	droppedCount    int64              // messages dropped by previous clients' full channels
+	readOnly        bool               // observer mode: never transmit
+	webhook         *webhook           // shared with extra identities
+	stableToken     bool               // reuse an existing api.token across restarts
+	tokenPath       string             // token file; empty = api.token beside the key
+	lastSeen        map[string]int64   // room → newest message timestamp, for replay on rejoin
+	seenIDs         idSet              // recent message IDs, to drop replayed duplicates
+	lastRelayError  *relayErrorEvent   // most recent unsolicited relay error
+	lastDisconnect  *client.Disconnect // how the last relay connection ended
+	halted          string             // why reconnecting stopped for good; empty while it runs
+	pingInterval    time.Duration      // relay ping interval; 0 = client default
+	compression     bool               // negotiate per-message deflate with the relay
+	maxMessageSize  int                // outgoing message limit in bytes; 0 = client default
+	lastActive      map[string]int64   // agent ID → newest message or typing event (ms), for inferred presence
+	noUpdateCheck   bool               // never contact GitHub for the latest release
+	roomTokens      map[string]string  // room → invite token for gated rooms
+	connectedAt     time.Time          // when the current relay connection was established
+	lastMessageAt   time.Time          // when the newest inbound message was received
+	outboxSize      int
+	outbox          *client.Outbox // sends awaiting a connection; nil disables queueing
+	outboxMu        sync.Mutex     // serializes saves of outbox
+	logToFile       bool
+	logPath         string       // daemon log file being written, empty if none
+	relayHeaders    http.Header  // sent on requests to the primary relay, for an auth proxy in front of it
+	proxy           string       // proxy setting for relay connections, as for client.ProxyFunc
+	relayHTTP       *http.Client // for the relay's REST API, through the same proxy
+	maxRooms        int          // cap on joined rooms; 0 = unlimited
+
+	maxPoWDifficulty int  // hardest relay challenge to attempt; 0 = client default
+	orderedSends     bool // concurrent sends to a room go out in call order
+
+	maxReconnectAttempts int  // failed reconnects before giving up; 0 = retry forever
+	exitOnExhausted      bool // exit the process once reconnecting gives up
+
+	messageTTL time.Duration // unread messages older than this are dropped; 0 = kept until read
+
+	idleRoomTimeout time.Duration        // leave rooms without inbound messages for this long; 0 = never
+	roomActivity    map[string]time.Time // room → when it was joined or last had an inbound message
+	pinnedRooms     map[string]bool      // rooms never left for idleness
+
+	pidFile string // PID file, checked and written at start; empty = none
+
+	acks         *client.AckTracker // message.received receipts for /send?track=true, kept across reconnects
+	sendReceipts bool               // ack each inbound message with message.received
+	verifier     *client.Verifier   // checks inbound signatures, kept across reconnects; nil = trust the relay
+}
+
+// relayErrorEvent is an unsolicited relay error as reported in /status.
+type relayErrorEvent struct {
+	Code    string    `json:"code"`
+	Message string    `json:"message"`
+	Fatal   bool      `json:"fatal"`
+	At      time.Time `json:"at"`
 }
 
 // Config holds daemon configuration.
 type Config struct {
 	ListenAddr string // e.g. "127.0.0.1:9900"
-	RelayURL   string // e.g. "wss://relay.example.com/v1/ws"
+	RelayURL   string // e.g. "wss://relay.example.com/v1/ws"; a comma-separated list fails over in order
 	AgentName  string
-	DataDir    string // for key storage
-	Version    string // current binary version
+	DataDir    string   // for key storage
+	Version    string   // current binary version
+	Identities []string // extra identity names, keys stored in DataDir/identities/<name>.key
+
+	SendRate        float64 // outgoing messages per second; 0 = default (5), negative disables
+	SendBurst       int     // outgoing burst size; 0 = default (10)
+	SendRatePerRoom bool    // rate-limit each room separately
+
+	TLSCert     string // PEM certificate for the API; empty keeps plaintext (fine for loopback)
+	TLSKey      string // PEM private key for TLSCert
+	TLSClientCA string // PEM CA bundle; when set, clients must present a certificate it signed
+
+	MessageBufferSize int // unread messages kept per identity; 0 = default (1000)
+
+	ReadOnly bool // observer mode: join and read rooms but never send anything
+
+	WebhookURL    string // POST each incoming message here; empty disables (settable at runtime)
+	WebhookSecret string // HMAC-SHA256 key for the X-AgentNet-Signature header
+
+	APIToken    string // fixed bearer token; empty generates one at start
+	StableToken bool   // reuse a non-empty api.token from a previous run instead of regenerating
+	TokenPath   string // where the token is written for the CLI; empty = api.token in DataDir
+
+	PingInterval time.Duration // relay ping interval; 0 = default (25s). Silence for 2× this reconnects
+	Compression  bool          // compress relay traffic (per-message deflate); off by default for compatibility
+
+	MaxMessageSize int // largest outgoing message in bytes; 0 = default (16 KiB)
+
+	DisableUpdateCheck bool // never contact GitHub for the latest release (air-gapped or private deployments)
+
+	// QueueWhileDisconnected accepts sends made while reconnecting (202) instead
+	// of failing them with 503, and resends them on reconnect. The queue is
+	// persisted in DataDir and inspected, flushed or cleared at /queue.
+	QueueWhileDisconnected bool
+	OutboundQueueSize      int // queued sends kept, oldest dropped beyond; 0 = default (100). Non-zero alone also enables queueing
+
+	LogToFile bool // also write logs to DataDir/daemon.log (rotated at 10 MiB), served at /logs
+
+	// RelayHeaders are sent with the WebSocket dial and the relay's REST
+	// requests, e.g. {"Authorization": "Bearer ..."} for an auth proxy.
+	// Only the primary relay gets them, never a failover relay.
+	RelayHeaders map[string]string
+
+	// Proxy reaches the relay through an http:// (CONNECT) or socks5:// proxy.
+	// Empty uses HTTPS_PROXY/ALL_PROXY from the environment; "none" connects directly.
+	Proxy string
+
+	MaxRooms int // most rooms an identity may be in at once; 0 = unlimited. Joins beyond it return 409
+
+	// MaxPoWDifficulty is the hardest proof-of-work challenge to attempt, in
+	// leading zero bits; 0 = client.DefaultMaxPoWDifficulty. Harder ones fail
+	// at once instead of tying up the handshake or a room create.
+	MaxPoWDifficulty int
+
+	// OrderedSends writes concurrent sends to the same room in the order
+	// the requests arrived, e.g. from parallel /send calls.
+	OrderedSends bool
+
+	// MaxReconnectAttempts is how many consecutive failed reconnects to make
+	// before giving up, leaving /status in state "reconnect_exhausted";
+	// 0 retries forever. With ExitOnReconnectExhausted the daemon then exits
+	// with status ExitReconnectExhausted, for a supervisor to reschedule it.
+	MaxReconnectAttempts     int
+	ExitOnReconnectExhausted bool
+
+	// MessageTTL drops unread messages buffered longer than this (from when
+	// they arrived, not the sender's timestamp) however few are buffered, so
+	// /messages never returns stale context; 0 keeps them until read or
+	// pushed out by newer ones.
+	MessageTTL time.Duration
+
+	// IdleRoomTimeout leaves rooms that have had no inbound message for this
+	// long (counted from joining, or from startup for rejoined rooms), so
+	// they aren't rejoined on every reconnect; 0 never leaves. Rooms pinned
+	// at /rooms/pin are exempt. Values under MinIdleRoomTimeout are raised
+	// to it.
+	IdleRoomTimeout time.Duration
+
+	// PIDFile is where the daemon's process ID is written; empty writes
+	// none. Start refuses to run while it names another live process, so
+	// two daemons don't fight over the same identity and API port.
+	PIDFile string
+
+	// SendReceipts acknowledges every inbound message to its room with a
+	// signed message.received, so senders tracking delivery (/send?track=true)
+	// see this agent as having received it.
+	SendReceipts bool
+
+	// VerifySignatures checks the sender's signature on every inbound
+	// message instead of trusting the relay, dropping those that fail.
+	VerifySignatures bool
 }
 
+// Default outgoing message rate limit.
+const (
+	defaultSendRate  = 5
+	defaultSendBurst = 10
+
+	defaultBufferSize = 1000
+)
+
 // New creates a daemon (does not start it).
 func New(cfg Config) *Daemon {
 	keyPath := filepath.Join(cfg.DataDir, "agent.key")
-	return &Daemon{
-		addr:        cfg.ListenAddr,
-		relay:       cfg.RelayURL,
-		agentName:   cfg.AgentName,
-		keyPath:     keyPath,
-		messages:    make([]client.IncomingMessage, 0, 1000),
-		joinedRooms: make(map[string]bool),
-		version:     cfg.Version,
+	if cfg.SendRate == 0 {
+		cfg.SendRate = defaultSendRate
+	}
+	if cfg.SendBurst == 0 {
+		cfg.SendBurst = defaultSendBurst
+	}
+	if cfg.MessageBufferSize <= 0 {
+		cfg.MessageBufferSize = defaultBufferSize
+	}
+	if cfg.IdleRoomTimeout > 0 && cfg.IdleRoomTimeout < MinIdleRoomTimeout {
+		cfg.IdleRoomTimeout = MinIdleRoomTimeout
+	}
+	if cfg.QueueWhileDisconnected && cfg.OutboundQueueSize <= 0 {
+		cfg.OutboundQueueSize = defaultOutboxSize
 	}
+	d := &Daemon{
+		addr:           cfg.ListenAddr,
+		relay:          cfg.RelayURL,
+		relays:         splitRelays(cfg.RelayURL),
+		agentName:      cfg.AgentName,
+		keyPath:        keyPath,
+		messages:       make([]client.IncomingMessage, 0, cfg.MessageBufferSize),
+		joinedRooms:    make(map[string]bool),
+		version:        cfg.Version,
+		identityNames:  cfg.Identities,
+		sendRate:       cfg.SendRate,
+		sendBurst:      cfg.SendBurst,
+		sendPerRoom:    cfg.SendRatePerRoom,
+		tlsCert:        cfg.TLSCert,
+		tlsKey:         cfg.TLSKey,
+		tlsClientCA:    cfg.TLSClientCA,
+		bufferSize:     cfg.MessageBufferSize,
+		readOnly:       cfg.ReadOnly,
+		webhook:        newWebhook(cfg.WebhookURL, cfg.WebhookSecret),
+		apiToken:       cfg.APIToken,
+		stableToken:    cfg.StableToken,
+		tokenPath:      cfg.TokenPath,
+		pingInterval:   cfg.PingInterval,
+		compression:    cfg.Compression,
+		maxMessageSize: cfg.MaxMessageSize,
+		noUpdateCheck:  cfg.DisableUpdateCheck,
+		outboxSize:     cfg.OutboundQueueSize,
+		logToFile:      cfg.LogToFile,
+		relayHeaders:   relayHeader(cfg.RelayHeaders),
+		proxy:          cfg.Proxy,
+		maxRooms:       cfg.MaxRooms,
+
+		maxPoWDifficulty: cfg.MaxPoWDifficulty,
+		orderedSends:     cfg.OrderedSends,
+
+		maxReconnectAttempts: cfg.MaxReconnectAttempts,
+		exitOnExhausted:      cfg.ExitOnReconnectExhausted,
+
+		messageTTL:      cfg.MessageTTL,
+		idleRoomTimeout: cfg.IdleRoomTimeout,
+
+		pidFile: cfg.PIDFile,
+
+		acks:         client.NewAckTracker(0),
+		sendReceipts: cfg.SendReceipts,
+	}
+	if cfg.VerifySignatures {
+		d.verifier = client.NewVerifier(0)
+	}
+	if len(d.relays) > 0 {
+		d.relay = d.relays[0]
+	}
+	d.limiter = d.newLimiter()
+	d.receiptLimiter = d.newLimiter()
+	d.outbox = d.newOutbox()
+	d.relayHTTP = d.newRelayHTTPClient()
+	return d
 }
 
-// Start connects to the relay and starts the HTTP API.
-func (d *Daemon) Start() error {
-	// Generate API token
+// resolveToken picks the API token: the configured fixed token, else (with
+// StableToken) the one left in tokenPath by a previous run, else a new random one.
+func (d *Daemon) resolveToken(tokenPath string) string {
+	if d.apiToken != "" {
+		return d.apiToken
+	}
+	if d.stableToken {
+		if data, err := os.ReadFile(tokenPath); err == nil {
+			if t := strings.TrimSpace(string(data)); t != "" {
+				return t
+			}
+		}
+	}
 	tokenBytes := make([]byte, 32)
 	rand.Read(tokenBytes)
-	d.apiToken = hex.EncodeToString(tokenBytes)
+	return hex.EncodeToString(tokenBytes)
+}
+
+// newLimiter builds the outgoing rate limiter, or nil if limiting is disabled.
+func (d *Daemon) newLimiter() *client.RateLimiter {
+	if d.sendRate <= 0 {
+		return nil
+	}
+	return client.NewRateLimiter(d.sendRate, d.sendBurst, d.sendPerRoom)
+}
+
+// newOutbox builds the queue for sends made while disconnected, or nil if
+// queueing is disabled.
+func (d *Daemon) newOutbox() *client.Outbox {
+	if d.outboxSize <= 0 {
+		return nil
+	}
+	return client.NewOutbox(d.outboxSize, d.maxMessageSize)
+}
+
+// newIdentity creates an extra identity sharing this daemon's relay and API.
+func (d *Daemon) newIdentity(name string, keys *keystore.Keys) *Daemon {
+	id := &Daemon{
+		relay:       d.relay,
+		relays:      d.relays,
+		agentName:   name,
+		keyPath:     filepath.Join(d.identitiesDir(), name+".key"),
+		messages:    make([]client.IncomingMessage, 0, d.bufferSize),
+		joinedRooms: make(map[string]bool),
+		keys:        keys,
+		version:     d.version,
+		parent:      d,
+		sendRate:    d.sendRate,
+		sendBurst:   d.sendBurst,
+		sendPerRoom: d.sendPerRoom,
+		bufferSize:  d.bufferSize,
+		readOnly:    d.readOnly,
+		webhook:     d.webhook,
+
+		pingInterval: d.pingInterval,
+		compression:  d.compression,
+
+		maxMessageSize: d.maxMessageSize,
+		outboxSize:     d.outboxSize,
+		relayHeaders:   d.relayHeaders,
+		proxy:          d.proxy,
+		relayHTTP:      d.relayHTTP,
+		maxRooms:       d.maxRooms,
+
+		maxPoWDifficulty: d.maxPoWDifficulty,
+		orderedSends:     d.orderedSends,
+
+		maxReconnectAttempts: d.maxReconnectAttempts,
+		exitOnExhausted:      d.exitOnExhausted,
+
+		messageTTL:      d.messageTTL,
+		idleRoomTimeout: d.idleRoomTimeout,
+
+		acks:         client.NewAckTracker(0),
+		sendReceipts: d.sendReceipts,
+		verifier:     d.verifier,
+	}
+	id.limiter = id.newLimiter()
+	id.receiptLimiter = id.newLimiter()
+	id.outbox = id.newOutbox()
+	return id
+}
+
+func (d *Daemon) identitiesDir() string {
+	return filepath.Join(filepath.Dir(d.keyPath), "identities")
+}
+
+// loadIdentities loads every key in the identities directory, creating any
+// configured identities that don't exist yet.
+func (d *Daemon) loadIdentities() error {
+	for _, name := range d.identityNames {
+		if _, err := keystore.LoadOrCreate(filepath.Join(d.identitiesDir(), name+".key")); err != nil {
+			return fmt.Errorf("identity %s: %w", name, err)
+		}
+	}
+	all, err := keystore.LoadDir(d.identitiesDir())
+	if err != nil {
+		return err
+	}
+	d.identities = make(map[string]*Daemon, len(all))
+	for name, keys := range all {
+		d.identities[name] = d.newIdentity(name, keys)
+	}
+	return nil
+}
+
+// Start connects to the relay and starts the HTTP API.
+func (d *Daemon) Start() (err error) {
+	// Before anything, such as the token file, that would disturb a running
+	// daemon.
+	if err := d.claimPIDFile(); err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			d.removePIDFile()
+		}
+	}()
+
+	tokenPath := d.tokenPath
+	if tokenPath == "" {
+		tokenPath = filepath.Join(filepath.Dir(d.keyPath), "api.token")
+	}
+	fixedToken := d.apiToken != ""
+	d.apiToken = d.resolveToken(tokenPath)
+
+	// Write token file. If the data dir is read-only the token only lives in
+	// memory; clients then need it passed another way, e.g. AGENTNET_TOKEN.
+	tokenErr := os.WriteFile(tokenPath, []byte(d.apiToken), 0600)
+	if d.logToFile {
+		path := filepath.Join(filepath.Dir(d.keyPath), logFileName)
+		lf, err := openLogFile(path, maxLogFileSize)
+		if err != nil {
+			return fmt.Errorf("log file: %w", err)
+		}
+		log.SetOutput(io.MultiWriter(os.Stderr, lf))
+		d.logPath = path
+	}
+	switch {
+	case tokenErr == nil:
+		log.Printf("API token written to %s", tokenPath)
+	case fixedToken:
+		log.Printf("could not write the API token to %s (%v); clients must use the configured token", tokenPath, tokenErr)
+	default:
+		log.Printf("could not write the API token to %s (%v); using it from memory — pass it to clients as AGENTNET_TOKEN", tokenPath, tokenErr)
+		// Straight to stderr, never into the log file.
+		fmt.Fprintf(os.Stderr, "API token: %s\n", d.apiToken)
+	}
 
-	// Write token file
-	tokenPath := filepath.Join(filepath.Dir(d.keyPath), "api.token")
-	if err := os.WriteFile(tokenPath, []byte(d.apiToken), 0600); err != nil {
-		return fmt.Errorf("write token: %w", err)
+	if _, err := client.ProxyFunc(d.proxy); err != nil {
+		return err
 	}
-	log.Printf("API token written to %s", tokenPath)
 
 	keys, err := keystore.LoadOrCreate(d.keyPath)
 	if err != nil {
 		return fmt.Errorf("keystore: %w", err)
 	}
 
+	if err := d.loadProfile(); err != nil {
+		log.Printf("load profile: %v", err)
+	}
 	// Default name: "agent-<first8chars of ID>" — never use hostname (leaks server identity)
 	if d.agentName == "" {
 		id := keys.AgentID()
@@ -88,10 +474,32 @@ func (d *Daemon) Start() error {
 
 	log.Printf("agent ID: %s", keys.AgentID())
 	log.Printf("agent name: %s", d.agentName)
-	log.Printf("connecting to relay: %s", d.relay)
+	log.Printf("connecting to relay: %s", strings.Join(d.relayList(), ", "))
 
 	d.keys = keys
 
+	if err := d.loadRooms(); err != nil {
+		log.Printf("load rooms: %v", err)
+	}
+	if err := d.loadFilter(); err != nil {
+		log.Printf("load filter: %v", err)
+	}
+	if err := d.loadLastSeen(); err != nil {
+		log.Printf("load last seen: %v", err)
+	}
+	if err := d.loadRoomTokens(); err != nil {
+		log.Printf("load room tokens: %v", err)
+	}
+	if err := d.loadPinnedRooms(); err != nil {
+		log.Printf("load pinned rooms: %v", err)
+	}
+	if err := d.loadOutbox(); err != nil {
+		log.Printf("load outbox: %v", err)
+	}
+	if d.roomKeys, err = keystore.LoadRoomKeys(d.statePath("room_keys.json")); err != nil {
+		return fmt.Errorf("room keys: %w", err)
+	}
+
 	// Initial connect
 	if err := d.connectAndRejoin(); err != nil {
 		return fmt.Errorf("connect: %w", err)
@@ -99,196 +507,1547 @@ func (d *Daemon) Start() error {
 
 	// Reconnect loop — watches for disconnection and reconnects with backoff
 	go d.reconnectLoop()
+	go d.idleLoop()
+
+	// Extra identities connect independently; a failed initial connect is retried by their reconnect loop.
+	if err := d.loadIdentities(); err != nil {
+		return fmt.Errorf("identities: %w", err)
+	}
+	for name, id := range d.identities {
+		log.Printf("identity %s: agent ID %s", name, id.keys.AgentID())
+		if err := id.loadRooms(); err != nil {
+			log.Printf("identity %s: load rooms: %v", name, err)
+		}
+		if err := id.loadFilter(); err != nil {
+			log.Printf("identity %s: load filter: %v", name, err)
+		}
+		if err := id.loadLastSeen(); err != nil {
+			log.Printf("identity %s: load last seen: %v", name, err)
+		}
+		if err := id.loadRoomTokens(); err != nil {
+			log.Printf("identity %s: load room tokens: %v", name, err)
+		}
+		if err := id.loadPinnedRooms(); err != nil {
+			log.Printf("identity %s: load pinned rooms: %v", name, err)
+		}
+		if err := id.loadOutbox(); err != nil {
+			log.Printf("identity %s: load outbox: %v", name, err)
+		}
+		if err := id.loadProfile(); err != nil {
+			log.Printf("identity %s: load profile: %v", name, err)
+		}
+		if id.roomKeys, err = keystore.LoadRoomKeys(id.statePath("room_keys.json")); err != nil {
+			return fmt.Errorf("identity %s: room keys: %w", name, err)
+		}
+		if err := id.connectAndRejoin(); err != nil {
+			log.Printf("identity %s: connect: %v", name, err)
+			id.haltOnAuthFailure(err) // its reconnect loop then stops at once
+		}
+		go id.reconnectLoop()
+		go id.idleLoop()
+	}
 
 	// Warm the version cache on startup (non-blocking)
-	go d.checkLatestVersion()
+	if !d.noUpdateCheck {
+		go d.checkLatestVersion()
+	}
+	go d.webhook.run()
 
-	// Write PID file
-	pidPath := filepath.Join(filepath.Dir(d.keyPath), "daemon.pid")
-	os.WriteFile(pidPath, []byte(fmt.Sprintf("%d", os.Getpid())), 0600)
+	// A normal kill (SIGTERM, or Ctrl-C at a terminal) cleans up as
+	// agentnet stop does.
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		d.shutdown()
+		exit(0)
+	}()
 
 	mux := http.NewServeMux()
-	mux.HandleFunc("/status", d.requireAuth(d.handleStatus))
-	mux.HandleFunc("/rooms", d.requireAuth(d.handleRooms))
-	mux.HandleFunc("/rooms/create", d.requireAuth(d.handleCreateRoom))
-	mux.HandleFunc("/rooms/join", d.requireAuth(d.handleJoinRoom))
-	mux.HandleFunc("/rooms/leave", d.requireAuth(d.handleLeaveRoom))
-	mux.HandleFunc("/send", d.requireAuth(d.handleSend))
-	mux.HandleFunc("/messages", d.requireAuth(d.handleMessages))
-	mux.HandleFunc("/history", d.requireAuth(d.handleHistory))
+	mux.HandleFunc("/status", d.requireAuth(d.forIdentity((*Daemon).handleStatus)))
+	mux.HandleFunc("/rooms", d.requireAuth(d.forIdentity((*Daemon).handleRooms)))
+	mux.HandleFunc("/rooms/create", d.requireAuth(d.writeOp(d.forIdentity((*Daemon).handleCreateRoom))))
+	mux.HandleFunc("/rooms/update", d.requireAuth(d.writeOp(d.forIdentity((*Daemon).handleUpdateRoom))))
+	mux.HandleFunc("/rooms/join", d.requireAuth(d.forIdentity((*Daemon).handleJoinRoom)))
+	mux.HandleFunc("/rooms/join/bulk", d.requireAuth(d.forIdentity((*Daemon).handleBulkJoin)))
+	mux.HandleFunc("/rooms/joined", d.requireAuth(d.forIdentity((*Daemon).handleJoinedRooms)))
+	mux.HandleFunc("/rooms/kick", d.requireAuth(d.writeOp(d.forIdentity((*Daemon).handleKick))))
+	mux.HandleFunc("/rooms/members", d.requireAuth(d.forIdentity((*Daemon).handleMembers)))
+	mux.HandleFunc("/rooms/info", d.requireAuth(d.forIdentity((*Daemon).handleRoomInfo)))
+	mux.HandleFunc("/rooms/key", d.requireAuth(d.forIdentity((*Daemon).handleRoomKey)))
+	mux.HandleFunc("/rooms/leave", d.requireAuth(d.forIdentity((*Daemon).handleLeaveRoom)))
+	mux.HandleFunc("/rooms/pin", d.requireAuth(d.forIdentity((*Daemon).handleRoomPin)))
+	mux.HandleFunc("/send", d.requireAuth(d.writeOp(d.forIdentity((*Daemon).handleSend))))
+	mux.HandleFunc("/acks", d.requireAuth(d.forIdentity((*Daemon).handleAcks)))
+	mux.HandleFunc("/send/batch", d.requireAuth(d.writeOp(d.forIdentity((*Daemon).handleSendBatch))))
+	mux.HandleFunc("/ask", d.requireAuth(d.writeOp(d.forIdentity((*Daemon).handleAsk))))
+	mux.HandleFunc("/typing", d.requireAuth(d.writeOp(d.forIdentity((*Daemon).handleTyping))))
+	mux.HandleFunc("/edit", d.requireAuth(d.writeOp(d.forIdentity((*Daemon).handleEdit))))
+	mux.HandleFunc("/delete", d.requireAuth(d.writeOp(d.forIdentity((*Daemon).handleDelete))))
+	mux.HandleFunc("/filter", d.requireAuth(d.forIdentity((*Daemon).handleFilter)))
+	mux.HandleFunc("/webhook", d.requireAuth(d.handleWebhook))
+	mux.HandleFunc("/stream", d.requireAuth(d.forIdentity((*Daemon).handleStream)))
+	mux.HandleFunc("/messages", d.requireAuth(d.forIdentity((*Daemon).handleMessages)))
+	mux.HandleFunc("/search", d.requireAuth(d.forIdentity((*Daemon).handleSearch)))
+	mux.HandleFunc("/presence", d.requireAuth(d.forIdentity((*Daemon).handlePresence)))
+	mux.HandleFunc("/history", d.requireAuth(d.forIdentity((*Daemon).handleHistory)))
+	mux.HandleFunc("/export", d.requireAuth(d.forIdentity((*Daemon).handleExport)))
+	mux.HandleFunc("/key/rotate", d.requireAuth(d.forIdentity((*Daemon).handleRotateKey)))
+	mux.HandleFunc("/queue", d.requireAuth(d.writeOp(d.forIdentity((*Daemon).handleQueue))))
+	mux.HandleFunc("/rpc", d.requireAuth(d.forIdentity((*Daemon).handleRPC)))
+	mux.HandleFunc("/profile", d.requireAuth(d.forIdentity((*Daemon).handleProfile)))
+	mux.HandleFunc("/reconnect", d.requireAuth(d.forIdentity((*Daemon).handleReconnect)))
+	mux.HandleFunc("/diagnostics", d.requireAuth(d.forIdentity((*Daemon).handleDiagnostics)))
+	mux.HandleFunc("/logs", d.requireAuth(d.handleLogs))
 	mux.HandleFunc("/stop", d.requireAuth(d.handleStop))
 
-	log.Printf("HTTP API on %s", d.addr)
-	return http.ListenAndServe(d.addr, mux)
+	// Probes for process supervisors; unauthenticated and free of agent details.
+	mux.HandleFunc("/healthz", d.handleHealthz)
+	mux.HandleFunc("/ready", d.handleReady)
+
+	ln, err := d.listen()
+	if err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+	if err := d.writeAddr(ln); err != nil {
+		log.Printf("write %s: %v", apiAddrFile, err)
+	}
+	if d.tlsCert == "" {
+		log.Printf("HTTP API on %s", d.addr)
+		return http.Serve(ln, mux)
+	}
+
+	tlsCfg, err := d.serverTLSConfig()
+	if err != nil {
+		ln.Close()
+		return fmt.Errorf("tls: %w", err)
+	}
+	srv := &http.Server{Handler: mux, TLSConfig: tlsCfg}
+	if tlsCfg.ClientAuth == tls.RequireAndVerifyClientCert {
+		log.Printf("HTTPS API on %s (client certificates required)", d.addr)
+	} else {
+		log.Printf("HTTPS API on %s", d.addr)
+	}
+	return srv.ServeTLS(ln, "", "")
+}
+
+// serverTLSConfig loads the API certificate and, if a client CA is configured,
+// requires clients to present a certificate signed by it (mutual TLS).
+func (d *Daemon) serverTLSConfig() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(d.tlsCert, d.tlsKey)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if d.tlsClientCA != "" {
+		pem, err := os.ReadFile(d.tlsClientCA)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: no certificates found", d.tlsClientCA)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+// listen opens the API listener. An address of the form "unix:/path" listens
+// on a Unix domain socket (owner-only); a bare "unix:" uses DataDir/api.sock.
+func (d *Daemon) listen() (net.Listener, error) {
+	if !strings.HasPrefix(d.addr, "unix:") {
+		return net.Listen("tcp", d.addr)
+	}
+	path := strings.TrimPrefix(d.addr, "unix:")
+	if path == "" {
+		path = filepath.Join(filepath.Dir(d.keyPath), "api.sock")
+		d.addr = "unix:" + path
+	}
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+	// Bind inside a fresh owner-only directory and move the socket into place
+	// once it is 0600, so it is never reachable with the umask's permissions.
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".api-sock-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	tmp := filepath.Join(dir, "s")
+	ln, err := net.Listen("unix", tmp)
+	if err != nil {
+		return nil, err
+	}
+	// Close would unlink tmp, which is gone by then; shutdown removes path.
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	if err := os.Chmod(tmp, 0600); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// removeStaleSocket clears path for a new API socket: nothing there is fine,
+// and a socket nobody answers on was left behind by a previous daemon.
+// Anything else, including a live daemon's socket, is an error.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("%s is in use by another daemon", path)
+	}
+	return os.Remove(path)
+}
+
+// apiAddrFile, in the data dir, holds the API's TCP host:port for the CLI.
+const apiAddrFile = "api.addr"
+
+// writeAddr records the address ln is bound to, which for a ListenAddr with
+// port 0 is only known now, in apiAddrFile for the CLI to find. A socket
+// needs no discovery, so a stale file from an earlier TCP run is removed.
+func (d *Daemon) writeAddr(ln net.Listener) error {
+	path := filepath.Join(filepath.Dir(d.keyPath), apiAddrFile)
+	if ln.Addr().Network() != "tcp" {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	d.addr = ln.Addr().String()
+	return keystore.WriteFileAtomic(path, []byte(d.addr+"\n"), 0600)
 }
 
 func (d *Daemon) requireAuth(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		auth := r.Header.Get("Authorization")
 		if auth != "Bearer "+d.apiToken {
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			httpError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// writeOp rejects endpoints that transmit to the relay when the daemon is read-only.
+// Dry runs (?dry_run=true) and GETs pass through since they transmit nothing.
+func (d *Daemon) writeOp(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if d.readOnly && r.Method != http.MethodGet && r.URL.Query().Get("dry_run") != "true" {
+			httpError(w, "read-only mode: sending is disabled", http.StatusForbidden)
 			return
 		}
 		next(w, r)
 	}
 }
 
-// checkLatestVersion fetches the latest release from GitHub and caches it.
+// forIdentity dispatches to the identity named by the X-Agent-Identity header
+// or ?identity= parameter. An empty name or "default" selects the primary identity.
+func (d *Daemon) forIdentity(h func(*Daemon, http.ResponseWriter, *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.Header.Get("X-Agent-Identity")
+		if name == "" {
+			name = r.URL.Query().Get("identity")
+		}
+		target := d
+		if name != "" && name != "default" {
+			id, ok := d.identities[name]
+			if !ok {
+				httpError(w, "unknown identity: "+name, http.StatusNotFound)
+				return
+			}
+			target = id
+		}
+		h(target, w, r)
+	}
+}
+
+// checkLatestVersion looks up the latest release, through the cache shared
+// with the CLI, and logs when it first sees a newer one.
 func (d *Daemon) checkLatestVersion() {
-	c := &http.Client{Timeout: 10 * time.Second}
-	req, _ := http.NewRequest("GET", "https://api.github.com/repos/betta-lab/agentnet-openclaw/releases/latest", nil)
-	req.Header.Set("User-Agent", "agentnet-daemon/"+d.version)
-	resp, err := c.Do(req)
+	latest, checkedAt, err := latestRelease(filepath.Dir(d.keyPath), "agentnet-daemon/"+d.version)
 	if err != nil {
 		return
 	}
-	defer resp.Body.Close()
-	var rel struct {
-		TagName string `json:"tag_name"`
+	d.mu.Lock()
+	changed := latest != d.latestVersion
+	d.latestVersion = latest
+	d.latestVersionAt = checkedAt
+	d.mu.Unlock()
+	if changed && latest != strings.TrimPrefix(d.version, "v") && d.version != "dev" {
+		log.Printf("⚠ update available: %s → %s (run: agentnet version)", d.version, latest)
+	}
+}
+
+// connectAndRejoin connects to the relay and rejoins previously joined rooms.
+func (d *Daemon) connectAndRejoin() error {
+	d.mu.RLock()
+	keys := d.keys // replaced by key rotation
+	d.mu.RUnlock()
+	c, relay, err := d.dialRelays(keys)
+	if err != nil {
+		return err
+	}
+	if skew, ok := c.ClockSkew(); ok && skew.Abs() > client.MaxClockSkew {
+		log.Printf("⚠ local clock is %s; relays may reject signed messages (sync it, e.g. enable NTP)", client.DescribeClockSkew(skew.Round(time.Second)))
+	}
+	if d.limiter != nil {
+		c.SetRateLimiter(d.limiter)
+	}
+	if d.receiptLimiter != nil {
+		c.SetReceiptLimiter(d.receiptLimiter)
+	}
+	c.SetReadOnly(d.readOnly)
+	c.SetMaxMessageSize(d.maxMessageSize)
+	c.SetMaxRooms(d.maxRooms)
+	c.SetOrderedSends(d.orderedSends)
+	if d.outbox != nil {
+		c.SetOutbox(d.outbox)
+	}
+	c.SetAckTracker(d.acks)
+	if d.verifier != nil {
+		c.SetVerifier(d.verifier)
+	}
+	d.mu.RLock()
+	for room, key := range d.roomKeys {
+		c.SetRoomKey(room, key)
+	}
+	for room, token := range d.roomTokens {
+		c.SetJoinToken(room, token)
+	}
+	d.mu.RUnlock()
+
+	d.mu.Lock()
+	d.client = c
+	d.relay = relay
+	d.connectedAt = time.Now()
+	rooms := make([]string, 0, len(d.joinedRooms))
+	for room := range d.joinedRooms {
+		rooms = append(rooms, room)
+	}
+	d.mu.Unlock()
+
+	// Re-join rooms from previous session, replaying what was missed meanwhile
+	for _, room := range rooms {
+		d.mu.RLock()
+		since := d.lastSeen[room]
+		d.mu.RUnlock()
+		if _, err := c.JoinRoomSince(room, since); err != nil {
+			var relayErr *client.RelayError
+			if errors.As(err, &relayErr) && relayErr.Code == "ROOM_NOT_FOUND" {
+				log.Printf("rejoin %s: room no longer exists, forgetting it", room)
+				d.mu.Lock()
+				delete(d.joinedRooms, room)
+				d.mu.Unlock()
+				d.saveRooms()
+				continue
+			}
+			if errors.Is(err, client.ErrUnauthorizedRoom) {
+				log.Printf("rejoin %s: invite token no longer accepted; join again with a new one", room)
+				continue
+			}
+			log.Printf("rejoin %s: %v", room, err)
+		} else {
+			log.Printf("rejoined room: %s", room)
+		}
+	}
+
+	go d.collectMessages(c)
+	go d.collectTyping(c)
+	go d.collectErrors(c)
+
+	// After the collectors start: each resend waits on the relay's verdict.
+	if n, err := c.FlushOutbox(); err != nil {
+		log.Printf("resend queued messages: %v (%d sent, the rest stay queued)", err, n)
+	} else if n > 0 {
+		log.Printf("resent %d queued messages", n)
+	}
+	if relay != d.relayList()[0] {
+		go d.failBack(c, keys)
+	}
+	return nil
+}
+
+// statePath returns where this identity keeps the named state file: in the
+// data directory for the primary identity, or alongside the key as
+// identities/<name>.<file> for extra identities.
+func (d *Daemon) statePath(file string) string {
+	if d.parent != nil {
+		return strings.TrimSuffix(d.keyPath, ".key") + "." + file
+	}
+	return filepath.Join(filepath.Dir(d.keyPath), file)
+}
+
+// roomsPath is where joined rooms are persisted across restarts.
+func (d *Daemon) roomsPath() string {
+	return d.statePath("rooms.json")
+}
+
+// loadRooms restores joined rooms saved by a previous run.
+func (d *Daemon) loadRooms() error {
+	data, err := os.ReadFile(d.roomsPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var rooms []string
+	if err := json.Unmarshal(data, &rooms); err != nil {
+		return fmt.Errorf("%s: %w", d.roomsPath(), err)
+	}
+	d.mu.Lock()
+	for _, room := range rooms {
+		d.joinedRooms[room] = true
+	}
+	d.mu.Unlock()
+	return nil
+}
+
+// saveRooms persists the joined room set. Failures are logged, not fatal.
+func (d *Daemon) saveRooms() {
+	d.mu.RLock()
+	rooms := make([]string, 0, len(d.joinedRooms))
+	for room := range d.joinedRooms {
+		rooms = append(rooms, room)
+	}
+	d.mu.RUnlock()
+	sort.Strings(rooms)
+
+	data, _ := json.MarshalIndent(rooms, "", "  ")
+	if err := keystore.WriteFileAtomic(d.roomsPath(), data, 0600); err != nil {
+		log.Printf("save rooms: %v", err)
 	}
-	if err := json.Unmarshal(func() []byte { b, _ := io.ReadAll(resp.Body); return b }(), &rel); err != nil {
+}
+
+// reconnectLoop watches for disconnection and reconnects with exponential backoff.
+func (d *Daemon) reconnectLoop() {
+	for {
+		d.mu.RLock()
+		c := d.client
+		d.mu.RUnlock()
+
+		// Wait until client disconnects
+		if c != nil {
+			c.Wait()
+		}
+
+		d.mu.Lock()
+		var disconnect *client.Disconnect
+		if c != nil {
+			d.droppedCount += c.Dropped()
+			disconnect = c.LastDisconnect()
+		}
+		if disconnect != nil {
+			d.lastDisconnect = disconnect
+		}
+		d.client = nil
+		if c != nil && c.FatalError() != nil {
+			d.halted = c.FatalError().Code
+		}
+		halted := d.halted
+		d.mu.Unlock()
+		d.saveLastSeen()
+
+		if halted != "" {
+			// Reconnecting with the same key would only be refused again.
+			log.Printf("relay ended the session (%s); not reconnecting — restart the daemon once resolved", halted)
+			return
+		}
+		if disconnect != nil {
+			log.Printf("relay disconnected (%s), reconnecting...", disconnect)
+		} else {
+			log.Printf("relay disconnected, reconnecting...")
+		}
+		if err := d.retryConnect(d.connectAndRejoin); err != nil {
+			if errors.Is(err, errReconnectExhausted) && d.exitOnExhausted {
+				log.Printf("exiting with status %d", ExitReconnectExhausted)
+				root := d
+				if d.parent != nil {
+					root = d.parent
+				}
+				root.shutdown()
+				exit(ExitReconnectExhausted)
+			}
+			return
+		}
+	}
+}
+
+// Reconnect timing and giving up, replaceable in tests.
+var (
+	sleep  = time.Sleep
+	jitter = mrand.Int63n
+	exit   = os.Exit
+
+	latestRelease = update.Latest
+)
+
+// ExitReconnectExhausted is the daemon's exit status when it gave up
+// reconnecting under Config.ExitOnReconnectExhausted.
+const ExitReconnectExhausted = 3
+
+// errReconnectExhausted is returned by retryConnect after
+// maxReconnectAttempts failures.
+var errReconnectExhausted = errors.New("reconnect attempts exhausted")
+
+// maxBackoff caps the base reconnect delay.
+const maxBackoff = 60 * time.Second
+
+// retryConnect calls connect until it succeeds, sleeping with full jitter:
+// a random duration in [0, backoff), where backoff doubles from 2s up to maxBackoff.
+// The randomness keeps daemons from reconnecting in lockstep after a relay blip.
+// It gives up, returning the error, if the relay rejects authentication, or
+// with errReconnectExhausted after maxReconnectAttempts failures.
+func (d *Daemon) retryConnect(connect func() error) error {
+	backoff := 2 * time.Second
+	for attempt := 1; ; attempt++ {
+		sleep(time.Duration(jitter(int64(backoff))))
+		log.Printf("attempting reconnect to %s...", d.relayURL())
+		if err := connect(); err != nil {
+			if d.haltOnAuthFailure(err) {
+				log.Printf("relay rejected authentication: %v; not retrying — check the agent key, then restart the daemon", err)
+				return err
+			}
+			log.Printf("reconnect failed: %v", err)
+			if d.maxReconnectAttempts > 0 && attempt >= d.maxReconnectAttempts {
+				d.mu.Lock()
+				d.halted = haltReconnectExhausted
+				d.mu.Unlock()
+				log.Printf("giving up after %d failed reconnect attempts; the relay is unreachable — restart the daemon once resolved", attempt)
+				return fmt.Errorf("%w: %w", errReconnectExhausted, err)
+			}
+			backoff *= 2
+			if backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+			continue
+		}
+		log.Printf("reconnected successfully")
+		return nil
+	}
+}
+
+// Halted reasons of our own; others are the relay's fatal error codes.
+const (
+	haltAuthFailed         = "auth_failed"         // the relay rejected the handshake
+	haltReconnectExhausted = "reconnect_exhausted" // maxReconnectAttempts failed in a row
+)
+
+// haltOnAuthFailure records a permanent handshake rejection so that
+// reconnecting stops, and reports whether err was one.
+func (d *Daemon) haltOnAuthFailure(err error) bool {
+	if !errors.Is(err, client.ErrAuthRejected) {
+		return false
+	}
+	ev := &relayErrorEvent{Message: err.Error(), Fatal: true, At: time.Now()}
+	var relayErr *client.RelayError
+	if errors.As(err, &relayErr) {
+		ev.Code, ev.Message = relayErr.Code, relayErr.Message
+	}
+	d.mu.Lock()
+	d.halted = haltAuthFailed
+	d.lastRelayError = ev
+	d.mu.Unlock()
+	return true
+}
+
+// bufferLimit returns the unread buffer size, falling back to the default
+// for daemons not built through New.
+func (d *Daemon) bufferLimit() int {
+	if d.bufferSize > 0 {
+		return d.bufferSize
+	}
+	return defaultBufferSize
+}
+
+// nextSeq returns the Seq for the next buffered message. The first follows
+// the start time in microseconds, past every seq an earlier run handed out
+// (the clock outruns any message rate), so cursors that consumers kept stay
+// valid across a restart. Callers hold d.mu.
+func (d *Daemon) nextSeq() int64 {
+	if d.messageSeq == 0 {
+		d.messageSeq = time.Now().UnixMicro()
+	}
+	d.messageSeq++
+	return d.messageSeq
+}
+
+// expired reports whether an unread message has outlived messageTTL, counted
+// from when it was buffered: the sender's timestamp is only as good as its
+// clock.
+func (d *Daemon) expired(m client.IncomingMessage, now time.Time) bool {
+	return d.messageTTL > 0 && m.Received > 0 && now.Sub(time.UnixMilli(m.Received)) > d.messageTTL
+}
+
+// expireMessages drops unread messages older than messageTTL. Expiry is
+// applied when the buffer is read rather than by a timer. Callers hold d.mu.
+func (d *Daemon) expireMessages() {
+	if d.messageTTL <= 0 {
+		return
+	}
+	now := time.Now()
+	kept := d.messages[:0]
+	for _, m := range d.messages {
+		if !d.expired(m, now) {
+			kept = append(kept, m)
+		}
+	}
+	clear(d.messages[len(kept):])
+	d.messages = kept
+}
+
+func (d *Daemon) collectMessages(c *client.Client) {
+	var receipts chan client.IncomingMessage
+	if d.sendReceipts {
+		receipts = make(chan client.IncomingMessage, receiptQueueSize)
+		defer close(receipts)
+		go sendReceipts(c, receipts)
+	}
+	for msg := range c.Messages() {
+		d.mu.Lock()
+		d.noteActive(msg.From, msg.Timestamp)
+		d.lastMessageAt = time.Now()
+		if !d.noteSeen(msg) {
+			d.mu.Unlock()
+			continue // replayed after a rejoin, already delivered
+		}
+		if msg.Room != "" {
+			d.noteRoomActive(msg.Room, time.Now())
+		}
+		if !d.filter.accepts(msg.From) {
+			d.filteredCount++
+			d.mu.Unlock()
+			continue
+		}
+		if !d.applyRevision(msg) {
+			if len(d.messages) >= d.bufferLimit() {
+				d.messages = d.messages[1:]
+			}
+			msg.Seq = d.nextSeq()
+			msg.Received = time.Now().UnixMilli()
+			d.messages = append(d.messages, msg)
+		}
+		for ch := range d.watchers {
+			select {
+			case ch <- msg:
+			default:
+				// slow watcher — drop rather than stall collection
+			}
+		}
+		d.mu.Unlock()
+
+		if d.sendReceipts && msg.ID != "" && !msg.Replayed && msg.From != d.keys.AgentID() &&
+			msg.Type != "message.edit" && msg.Type != "message.delete" {
+			select {
+			case receipts <- msg:
+			default:
+				// behind on receipts — skip rather than stall collection
+			}
+		}
+		if d.webhook != nil {
+			d.webhook.enqueue(d.identityName(), msg)
+		}
+	}
+}
+
+// receiptQueueSize bounds the receipts waiting to be sent per connection.
+const receiptQueueSize = 64
+
+// sendReceipts acknowledges messages from ch one at a time. Receipts have a
+// budget of their own, apart from sends; those over it are skipped, not
+// retried.
+func sendReceipts(c *client.Client, ch <-chan client.IncomingMessage) {
+	for msg := range ch {
+		if err := c.SendReceipt(msg.Room, msg.ID); err != nil && !errors.Is(err, client.ErrRateLimited) {
+			log.Printf("receipt for %s: %v", msg.ID, err)
+		}
+	}
+}
+
+// watch registers a live message subscriber. Call the returned func to unsubscribe.
+func (d *Daemon) watch() (<-chan client.IncomingMessage, func()) {
+	ch := make(chan client.IncomingMessage, 100)
+	d.mu.Lock()
+	if d.watchers == nil {
+		d.watchers = make(map[chan client.IncomingMessage]struct{})
+	}
+	d.watchers[ch] = struct{}{}
+	d.mu.Unlock()
+	return ch, func() {
+		d.mu.Lock()
+		delete(d.watchers, ch)
+		d.mu.Unlock()
+	}
+}
+
+// applyRevision applies an edit or delete to a still-buffered message.
+// It returns false if msg should be buffered as-is (a regular message, or an
+// edit/delete for a message that has already been read). Revisions of a
+// buffered message by anyone but its sender are dropped.
+// Must be called with d.mu held.
+func (d *Daemon) applyRevision(msg client.IncomingMessage) bool {
+	if msg.Type != "message.edit" && msg.Type != "message.delete" {
+		return false
+	}
+	for i, m := range d.messages {
+		if m.ID != msg.MessageID || m.Type != "" {
+			continue
+		}
+		if msg.From != m.From {
+			return true // only the sender may revise a message; drop forgeries
+		}
+		if msg.Type == "message.delete" {
+			d.messages = append(d.messages[:i], d.messages[i+1:]...)
+			return true
+		}
+		// Ignore stale edits that arrive out of order.
+		if msg.Revision > m.Revision {
+			d.messages[i].Text = msg.Text
+			d.messages[i].Revision = msg.Revision
+		}
+		return true
+	}
+	return false
+}
+
+// typist is an agent composing a message: the name to show and when it
+// last reported typing.
+type typist struct {
+	name string
+	at   time.Time
+}
+
+// collectTyping tracks which agents are currently composing, per room.
+// Typing events are kept apart from the message buffer.
+func (d *Daemon) collectTyping(c *client.Client) {
+	for ev := range c.Typing() {
+		d.mu.Lock()
+		d.noteActive(ev.From, time.Now().UnixMilli())
+		d.noteTyping(ev)
+		d.mu.Unlock()
+	}
+}
+
+// noteTyping records a typing event. Agents are keyed by ID, so two that
+// share a display name don't clear each other's indicator.
+// Must be called with d.mu held.
+func (d *Daemon) noteTyping(ev client.TypingEvent) {
+	if !ev.Active {
+		delete(d.typing[ev.Room], ev.From)
+		return
+	}
+	name := ev.FromName
+	if name == "" {
+		name = ev.From
+	}
+	if d.typing == nil {
+		d.typing = make(map[string]map[string]typist)
+	}
+	if d.typing[ev.Room] == nil {
+		d.typing[ev.Room] = make(map[string]typist)
+	}
+	d.typing[ev.Room][ev.From] = typist{name: name, at: time.Now()}
+}
+
+// collectErrors logs unsolicited relay errors and records the latest for
+// /status. A fatal error closes the connection; reconnectLoop then stops.
+func (d *Daemon) collectErrors(c *client.Client) {
+	for e := range c.Errors() {
+		log.Printf("relay error: %s: %s", e.Code, e.Message)
+		d.mu.Lock()
+		d.lastRelayError = &relayErrorEvent{Code: e.Code, Message: e.Message, Fatal: e.Fatal(), At: time.Now()}
+		d.mu.Unlock()
+		if e.Fatal() {
+			c.Close()
+		}
+	}
+}
+
+// activeTypers returns the agents typing in each room, dropping expired indicators.
+// Must be called with d.mu held.
+func (d *Daemon) activeTypers() map[string][]string {
+	active := make(map[string][]string)
+	for room, agents := range d.typing {
+		for id, t := range agents {
+			if time.Since(t.at) > client.TypingTTL {
+				delete(agents, id)
+				continue
+			}
+			active[room] = append(active[room], t.name)
+		}
+		if len(agents) == 0 {
+			delete(d.typing, room)
+		}
+		sort.Strings(active[room])
+	}
+	return active
+}
+
+// handleHealthz reports liveness: the API server is up.
+func (d *Daemon) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok\n"))
+}
+
+// handleReady reports readiness: 200 while connected to the relay, 503 otherwise.
+func (d *Daemon) handleReady(w http.ResponseWriter, r *http.Request) {
+	d.mu.RLock()
+	connected := d.client != nil
+	d.mu.RUnlock()
+	if !connected {
+		notConnected(w)
+		return
+	}
+	w.Write([]byte("ok\n"))
+}
+
+func (d *Daemon) handleStatus(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	connected := d.client != nil
+	state := "reconnecting"
+	switch {
+	case connected:
+		state = "connected"
+	case d.halted == haltAuthFailed, d.halted == haltReconnectExhausted:
+		state = d.halted
+	case d.halted != "":
+		state = "halted"
+	}
+	relay, relays := d.relay, d.relayList() // failover switches relay
+	lastErr := d.lastRelayError
+	lastDisconnect := d.lastDisconnect
+	typing := d.activeTypers()
+	filtered := d.filteredCount
+	dropped := d.droppedCount
+	var rttMs int64
+	var protocol string
+	var connectedSince, lastPing, clockSkew, capabilities interface{}
+	if d.client != nil {
+		if caps, ok := d.client.Capabilities(); ok {
+			capabilities = caps
+		}
+		if skew, ok := d.client.ClockSkew(); ok {
+			clockSkew = skew.Milliseconds()
+		}
+		dropped += d.client.Dropped()
+		rttMs = d.client.LastRTT().Milliseconds()
+		protocol = d.client.ProtocolVersion()
+		connectedSince = timeOrNil(d.connectedAt)
+		lastPing = timeOrNil(d.client.LastPong())
+	}
+	lastMessage := timeOrNil(d.lastMessageAt)
+	var queued int
+	var queueDropped int64
+	if d.outbox != nil {
+		queued, queueDropped = d.outbox.Len(), d.outbox.Dropped()
+	}
+	d.mu.Unlock()
+
+	// The version cache lives on the primary identity.
+	root := d
+	if d.parent != nil {
+		root = d.parent
+	}
+	root.mu.RLock()
+	latest := root.latestVersion
+	cacheAge := time.Since(root.latestVersionAt)
+	root.mu.RUnlock()
+
+	// Refresh version cache if expired (6h) or never fetched
+	if cacheAge > update.CacheTTL && !root.noUpdateCheck {
+		go root.checkLatestVersion()
+	}
+
+	identities := make([]string, 0, len(root.identities))
+	for name := range root.identities {
+		identities = append(identities, name)
+	}
+	sort.Strings(identities)
+
+	// With update checks off, the latest release is unknown: report null.
+	var latestVersion, updateAvailable interface{}
+	if !root.noUpdateCheck {
+		current := strings.TrimPrefix(d.version, "v")
+		latestVersion = latest
+		updateAvailable = latest != "" && latest != current && d.version != "dev"
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"connected":         connected,
+		"relay":             relay,
+		"relays":            relays,
+		"agent_name":        d.name(),
+		"version":           d.version,
+		"latest_version":    latestVersion,
+		"update_available":  updateAvailable,
+		"identities":        identities,
+		"typing":            typing,
+		"filtered_messages": filtered,
+		"dropped_messages":  dropped,
+		"read_only":         d.readOnly,
+		"relay_rtt_ms":      rttMs,
+		"protocol_version":  protocol,
+		"capabilities":      capabilities,
+		"clock_skew_ms":     clockSkew,
+		"queued_messages":   queued,
+		"queue_dropped":     queueDropped,
+		"connected_since":   connectedSince,
+		"last_message_at":   lastMessage,
+		"last_ping_at":      lastPing,
+		"state":             state,
+		"last_relay_error":  lastErr,
+		"last_disconnect":   lastDisconnect,
+	})
+}
+
+// timeOrNil returns t, or nil for the zero time so it encodes as JSON null.
+func timeOrNil(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
+
+// Room list sizes.
+const (
+	defaultRoomListLimit = 50
+	maxRoomListLimit     = 200
+)
+
+// handleRooms lists rooms on the relay. ?tags=a,b keeps rooms carrying all
+// of the tags; ?limit=N caps the list (default 50); ?filter=mine keeps the
+// rooms this identity is in.
+func (d *Daemon) handleRooms(w http.ResponseWriter, r *http.Request) {
+	var tags []string
+	for _, t := range strings.Split(r.URL.Query().Get("tags"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	limit := defaultRoomListLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxRoomListLimit {
+			httpError(w, "limit must be between 1 and 200", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	filter := r.URL.Query().Get("filter")
+	if filter != "" && filter != "mine" {
+		httpError(w, `filter must be "mine"`, http.StatusBadRequest)
+		return
+	}
+
+	d.mu.RLock()
+	c := d.client
+	d.mu.RUnlock()
+	if c == nil {
+		notConnected(w)
+		return
+	}
+
+	list := c.ListRooms
+	if filter == "mine" {
+		list = c.ListMyRooms
+	}
+	rooms, err := list(tags, limit)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, client.ErrInvalidTags) {
+			status = http.StatusBadRequest
+		}
+		httpErrorFor(w, err, status)
+		return
+	}
+	if rooms == nil {
+		rooms = []client.RoomListItem{}
+	}
+	json.NewEncoder(w).Encode(rooms)
+}
+
+// handleJoinedRooms lists the rooms this identity is currently in.
+func (d *Daemon) handleJoinedRooms(w http.ResponseWriter, r *http.Request) {
+	d.mu.RLock()
+	c := d.client
+	d.mu.RUnlock()
+	if c == nil {
+		notConnected(w)
+		return
+	}
+	json.NewEncoder(w).Encode(c.JoinedRooms())
+}
+
+func (d *Daemon) handleMembers(w http.ResponseWriter, r *http.Request) {
+	room := r.URL.Query().Get("room")
+	if room == "" {
+		httpError(w, "room parameter required", http.StatusBadRequest)
+		return
+	}
+
+	d.mu.RLock()
+	c := d.client
+	d.mu.RUnlock()
+	if c == nil {
+		notConnected(w)
+		return
+	}
+
+	members := c.Members(room)
+	if members == nil {
+		httpError(w, "not joined: "+room, http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(members)
+}
+
+// handleRoomInfo describes a joined room: this agent's role in it (empty if
+// the relay didn't say) and its members.
+func (d *Daemon) handleRoomInfo(w http.ResponseWriter, r *http.Request) {
+	room := r.URL.Query().Get("room")
+	if room == "" {
+		httpError(w, "room parameter required", http.StatusBadRequest)
+		return
+	}
+
+	d.mu.RLock()
+	c := d.client
+	d.mu.RUnlock()
+	if c == nil {
+		notConnected(w)
+		return
+	}
+
+	members := c.Members(room)
+	if members == nil {
+		httpError(w, "not joined: "+room, http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"room":    room,
+		"my_role": c.Role(room),
+		"members": members,
+	})
+}
+
+func (d *Daemon) handleCreateRoom(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httpError(w, "POST only", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Room  string   `json:"room"`
+		Topic string   `json:"topic"`
+		Tags  []string `json:"tags"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	d.mu.RLock()
+	c := d.client
+	d.mu.RUnlock()
+	if c == nil {
+		notConnected(w)
+		return
+	}
+
+	if r.URL.Query().Get("dry_run") == "true" {
+		dry, err := c.DryRunCreateRoom(req.Room, req.Topic, req.Tags)
+		if err != nil {
+			httpErrorFor(w, err, http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(dry)
+		return
+	}
+
+	if err := d.checkRoomLimit(req.Room); err != nil {
+		httpErrorFor(w, err, http.StatusConflict)
+		return
+	}
+	info, err := c.CreateRoom(req.Room, req.Topic, req.Tags)
+	if err != nil {
+		status := http.StatusBadRequest
+		switch {
+		case errors.Is(err, client.ErrTooManyRooms):
+			status = http.StatusConflict
+		case errors.Is(err, client.ErrPoWTimeout):
+			status = http.StatusGatewayTimeout
+		}
+		httpErrorFor(w, err, status)
+		return
+	}
+	d.mu.Lock()
+	d.joinedRooms[req.Room] = true
+	d.noteRoomActive(req.Room, time.Now())
+	d.mu.Unlock()
+	d.saveRooms()
+	json.NewEncoder(w).Encode(info)
+}
+
+// handleUpdateRoom changes a room's topic and/or tags. Omitted fields are left unchanged.
+func (d *Daemon) handleUpdateRoom(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httpError(w, "POST only", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Room  string   `json:"room"`
+		Topic string   `json:"topic"`
+		Tags  []string `json:"tags"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	d.mu.RLock()
+	c := d.client
+	d.mu.RUnlock()
+	if c == nil {
+		notConnected(w)
+		return
+	}
+
+	if err := c.UpdateRoom(req.Room, req.Topic, req.Tags); err != nil {
+		status := http.StatusBadRequest
+		switch {
+		case errors.Is(err, client.ErrNotOwner), errors.Is(err, client.ErrReadOnly):
+			status = http.StatusForbidden
+		case errors.Is(err, client.ErrUnconfirmed), errors.Is(err, client.ErrPoWTimeout):
+			status = http.StatusGatewayTimeout
+		}
+		httpErrorFor(w, err, status)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// handleKick removes an agent from a room this identity owns:
+// {"room":...,"agent_id":...}. 403 if not the owner, 404 if not a member.
+func (d *Daemon) handleKick(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httpError(w, "POST only", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Room    string `json:"room"`
+		AgentID string `json:"agent_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.AgentID == "" {
+		httpError(w, "room and agent_id required", http.StatusBadRequest)
+		return
+	}
+
+	d.mu.RLock()
+	c := d.client
+	d.mu.RUnlock()
+	if c == nil {
+		notConnected(w)
+		return
+	}
+
+	if err := c.KickMember(req.Room, req.AgentID); err != nil {
+		status := http.StatusBadRequest
+		switch {
+		case errors.Is(err, client.ErrNotOwner), errors.Is(err, client.ErrReadOnly):
+			status = http.StatusForbidden
+		case errors.Is(err, client.ErrMemberNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, client.ErrUnsupported):
+			status = http.StatusNotImplemented
+		case errors.Is(err, client.ErrUnconfirmed):
+			status = http.StatusGatewayTimeout
+		}
+		httpErrorFor(w, err, status)
+		return
+	}
+	log.Printf("kicked %s from %s", req.AgentID, req.Room)
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// checkRoomLimit returns client.ErrTooManyRooms if joining room would take
+// this identity past MaxRooms. Rooms it is already in don't count as new.
+func (d *Daemon) checkRoomLimit(room string) error {
+	if d.maxRooms <= 0 {
+		return nil
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if !d.joinedRooms[room] && len(d.joinedRooms) >= d.maxRooms {
+		return fmt.Errorf("%w: limit is %d (leave a room first)", client.ErrTooManyRooms, d.maxRooms)
+	}
+	return nil
+}
+
+func (d *Daemon) handleJoinRoom(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httpError(w, "POST only", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Token is an invite token or password for a gated room.
+	var req struct {
+		Room  string `json:"room"`
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	d.mu.RLock()
+	c := d.client
+	d.mu.RUnlock()
+	if c == nil {
+		notConnected(w)
+		return
+	}
+
+	info, status, err := d.joinRoom(c, req.Room, req.Token)
+	if err != nil {
+		httpErrorFor(w, err, status)
+		return
+	}
+	json.NewEncoder(w).Encode(info)
+}
+
+// joinRoom joins room through c, presenting token if not empty, and
+// remembers it for rejoining. On failure it also returns the HTTP status to
+// report.
+func (d *Daemon) joinRoom(c *client.Client, room, token string) (*client.RoomInfo, int, error) {
+	if err := d.checkRoomLimit(room); err != nil {
+		return nil, http.StatusConflict, err
+	}
+	var info *client.RoomInfo
+	var err error
+	if token != "" {
+		info, err = c.JoinRoomWithToken(room, token)
+	} else {
+		info, err = c.JoinRoom(room)
+	}
+	if err != nil {
+		status := http.StatusBadRequest
+		switch {
+		case errors.Is(err, client.ErrUnauthorizedRoom):
+			status = http.StatusForbidden
+		case errors.Is(err, client.ErrTooManyRooms):
+			status = http.StatusConflict
+		}
+		return nil, status, err
+	}
+	if token != "" {
+		d.setRoomToken(room, token)
+	}
+	d.mu.Lock()
+	d.joinedRooms[room] = true
+	d.noteRoomActive(room, time.Now())
+	d.mu.Unlock()
+	d.saveRooms()
+	return info, http.StatusOK, nil
+}
+
+// handleBulkJoin joins many rooms at once: those listed in "rooms" (each
+// {"room": ..., "token": ...}) and, with "tags", every relay room carrying
+// all of them. It carries on past failures and reports each room.
+func (d *Daemon) handleBulkJoin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httpError(w, "POST only", http.StatusMethodNotAllowed)
+		return
+	}
+
+	type roomReq struct {
+		Room  string `json:"room"`
+		Token string `json:"token,omitempty"`
+	}
+	var req struct {
+		Rooms []roomReq `json:"rooms"`
+		Tags  []string  `json:"tags"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Rooms) == 0 && len(req.Tags) == 0 {
+		httpError(w, "rooms or tags required", http.StatusBadRequest)
+		return
+	}
+
+	d.mu.RLock()
+	c := d.client
+	d.mu.RUnlock()
+	if c == nil {
+		notConnected(w)
+		return
+	}
+
+	if len(req.Tags) > 0 {
+		listed, err := c.ListRooms(req.Tags, maxRoomListLimit)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, client.ErrInvalidTags) {
+				status = http.StatusBadRequest
+			}
+			httpErrorFor(w, err, status)
+			return
+		}
+		for _, room := range listed {
+			req.Rooms = append(req.Rooms, roomReq{Room: room.Name})
+		}
+	}
+
+	type result struct {
+		Room   string    `json:"room"`
+		Status string    `json:"status"`
+		Error  *apiError `json:"error,omitempty"`
+	}
+	results := []result{}
+	seen := map[string]bool{}
+	failed := 0
+	for _, rr := range req.Rooms {
+		if rr.Room == "" || seen[rr.Room] {
+			continue
+		}
+		seen[rr.Room] = true
+		if _, status, err := d.joinRoom(c, rr.Room, rr.Token); err != nil {
+			failed++
+			results = append(results, result{Room: rr.Room, Status: "error", Error: &apiError{Code: errorCode(err, status), Message: err.Error()}})
+			continue
+		}
+		results = append(results, result{Room: rr.Room, Status: "ok"})
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"joined":  len(results) - failed,
+		"failed":  failed,
+		"results": results,
+	})
+}
+
+func (d *Daemon) handleLeaveRoom(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httpError(w, "POST only", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Room string `json:"room"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+
+	d.mu.RLock()
+	c := d.client
+	d.mu.RUnlock()
+	if c == nil {
+		notConnected(w)
+		return
+	}
+
+	if err := c.LeaveRoom(req.Room); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, client.ErrInvalidRoomName) {
+			status = http.StatusBadRequest
+		}
+		httpErrorFor(w, err, status)
+		return
+	}
+	d.mu.Lock()
+	delete(d.joinedRooms, req.Room)
+	delete(d.roomActivity, req.Room)
+	d.mu.Unlock()
+	d.saveRooms()
+	d.setRoomToken(req.Room, "")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+func (d *Daemon) handleSend(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httpError(w, "POST only", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Content, when set, is sent as a structured payload instead of Text.
+	// InReplyTo threads a text message under an earlier message ID.
+	var req struct {
+		Room      string                 `json:"room"`
+		Text      string                 `json:"text"`
+		Content   map[string]interface{} `json:"content"`
+		InReplyTo string                 `json:"in_reply_to"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, "bad request", http.StatusBadRequest)
 		return
 	}
-	latest := strings.TrimPrefix(rel.TagName, "v")
-	d.mu.Lock()
-	d.latestVersion = latest
-	d.latestVersionAt = time.Now()
-	d.mu.Unlock()
-	if latest != "" && latest != strings.TrimPrefix(d.version, "v") && d.version != "dev" {
-		log.Printf("⚠ update available: %s → %s (run: agentnet version)", d.version, latest)
+	if req.Content != nil && req.InReplyTo != "" {
+		httpError(w, "in_reply_to is only supported for text messages", http.StatusBadRequest)
+		return
 	}
-}
 
-// connectAndRejoin connects to the relay and rejoins previously joined rooms.
-func (d *Daemon) connectAndRejoin() error {
-	c, err := client.Connect(d.relay, d.keys.AgentID(), d.agentName, d.keys.PrivateKey)
-	if err != nil {
-		return err
+	content := req.Content
+	if content == nil {
+		content = map[string]interface{}{"type": "text", "text": req.Text}
 	}
 
-	d.mu.Lock()
-	d.client = c
-	rooms := make([]string, 0, len(d.joinedRooms))
-	for room := range d.joinedRooms {
-		rooms = append(rooms, room)
+	q := r.URL.Query()
+	if q.Get("track") == "true" && q.Get("wait") == "true" {
+		httpError(w, "track and wait can't be combined", http.StatusBadRequest)
+		return
 	}
-	d.mu.Unlock()
 
-	// Re-join rooms from previous session
-	for _, room := range rooms {
-		if _, err := c.JoinRoom(room); err != nil {
-			log.Printf("rejoin %s: %v", room, err)
-		} else {
-			log.Printf("rejoined room: %s", room)
+	d.mu.RLock()
+	c := d.client
+	d.mu.RUnlock()
+	if c == nil {
+		// With an outbox, a plain send made while reconnecting is queued.
+		// Tracked sends aren't: receipts only count from a live send.
+		if d.outbox == nil || q.Get("dry_run") == "true" || q.Get("wait") == "true" || q.Get("track") == "true" {
+			notConnected(w)
+			return
+		}
+		id, err := d.outbox.Enqueue(req.Room, content, req.InReplyTo)
+		if err != nil {
+			sendError(w, err)
+			return
 		}
+		sendQueued(w, id)
+		return
 	}
 
-	go d.collectMessages(c)
-	return nil
-}
-
-// reconnectLoop watches for disconnection and reconnects with exponential backoff.
-func (d *Daemon) reconnectLoop() {
-	for {
-		d.mu.RLock()
-		c := d.client
-		d.mu.RUnlock()
-
-		// Wait until client disconnects
-		if c != nil {
-			c.Wait()
+	if r.URL.Query().Get("dry_run") == "true" {
+		dry, err := c.DryRunSend(req.Room, content, req.InReplyTo)
+		if err != nil {
+			httpErrorFor(w, err, http.StatusBadRequest)
+			return
 		}
+		json.NewEncoder(w).Encode(dry)
+		return
+	}
 
-		d.mu.Lock()
-		d.client = nil
-		d.mu.Unlock()
-
-		log.Printf("relay disconnected, reconnecting...")
-
-		// Exponential backoff: 2s, 4s, 8s, ... up to 60s
-		backoff := 2 * time.Second
-		for {
-			time.Sleep(backoff)
-			log.Printf("attempting reconnect to %s...", d.relay)
-			if err := d.connectAndRejoin(); err != nil {
-				log.Printf("reconnect failed: %v", err)
-				if backoff < 60*time.Second {
-					backoff *= 2
-				}
-				continue
-			}
-			log.Printf("reconnected successfully")
-			break
+	if q.Get("track") == "true" {
+		receipt, err := c.SendTracked(req.Room, content, req.InReplyTo)
+		if err != nil {
+			sendError(w, err)
+			return
 		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "ok", "id": receipt.ID, "tracked": true})
+		return
 	}
-}
 
-func (d *Daemon) collectMessages(c *client.Client) {
-	for msg := range c.Messages() {
-		d.mu.Lock()
-		if len(d.messages) >= 1000 {
-			d.messages = d.messages[1:]
+	if r.URL.Query().Get("wait") == "true" {
+		id, acked, err := c.SendWait(req.Room, content, req.InReplyTo, client.AckTimeout)
+		if err != nil {
+			sendError(w, err)
+			return
 		}
-		d.messages = append(d.messages, msg)
-		d.mu.Unlock()
+		// acked is false when the relay doesn't acknowledge sends; the message was still written.
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "ok", "id": id, "acked": acked})
+		return
 	}
-}
-
-func (d *Daemon) handleStatus(w http.ResponseWriter, r *http.Request) {
-	d.mu.RLock()
-	connected := d.client != nil
-	latest := d.latestVersion
-	cacheAge := time.Since(d.latestVersionAt)
-	d.mu.RUnlock()
 
-	// Refresh version cache if expired (6h) or never fetched
-	if cacheAge > 6*time.Hour {
-		go d.checkLatestVersion()
+	var id string
+	var err error
+	if req.Content != nil {
+		id, err = c.SendContent(req.Room, req.Content)
+	} else if req.InReplyTo != "" {
+		id, err = c.SendReply(req.Room, req.InReplyTo, req.Text)
+	} else {
+		id, err = c.SendMessage(req.Room, req.Text)
+	}
+	if errors.Is(err, client.ErrQueued) {
+		sendQueued(w, id)
+		return
 	}
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok", "id": id})
+}
 
-	current := strings.TrimPrefix(d.version, "v")
-	updateAvailable := latest != "" && latest != current && d.version != "dev"
+// handleAcks reports which agents acknowledged a message sent with
+// /send?track=true, and which current room members haven't yet.
+func (d *Daemon) handleAcks(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		httpError(w, "id parameter required", http.StatusBadRequest)
+		return
+	}
+	room, acks, ok := d.acks.Acks(id)
+	if !ok {
+		httpError(w, "not a tracked message: "+id, http.StatusNotFound)
+		return
+	}
 
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"connected":        connected,
-		"relay":            d.relay,
-		"agent_name":       d.agentName,
-		"version":          d.version,
-		"latest_version":   latest,
-		"update_available": updateAvailable,
-	})
-}
+	type ack struct {
+		AgentID string    `json:"agent_id"`
+		At      time.Time `json:"at"`
+	}
+	ackedBy := make([]ack, 0, len(acks))
+	for agent, at := range acks {
+		ackedBy = append(ackedBy, ack{agent, at})
+	}
+	sort.Slice(ackedBy, func(i, j int) bool { return ackedBy[i].At.Before(ackedBy[j].At) })
 
-func (d *Daemon) handleRooms(w http.ResponseWriter, r *http.Request) {
+	// Pending is only known while connected, from the room's member list.
+	var pending []string
 	d.mu.RLock()
-	c := d.client
+	c, self := d.client, d.keys.AgentID()
 	d.mu.RUnlock()
-	if c == nil {
-		http.Error(w, "not connected", http.StatusServiceUnavailable)
-		return
+	if c != nil {
+		pending = []string{}
+		for _, m := range c.Members(room) {
+			if _, ok := acks[m.ID]; !ok && m.ID != self {
+				pending = append(pending, m.ID)
+			}
+		}
+		sort.Strings(pending)
 	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":       id,
+		"room":     room,
+		"acked_by": ackedBy,
+		"pending":  pending,
+	})
+}
 
-	rooms, err := c.ListRooms(nil, 50)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	json.NewEncoder(w).Encode(rooms)
+// sendQueued reports a message accepted into the outbox: it will be sent,
+// under this ID, once the relay connection is back.
+func sendQueued(w http.ResponseWriter, id string) {
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"status": "queued", "id": id})
 }
 
-func (d *Daemon) handleCreateRoom(w http.ResponseWriter, r *http.Request) {
+// handleSendBatch sends several text messages to one room in order. On a
+// partial failure the IDs already sent are returned alongside the error.
+func (d *Daemon) handleSendBatch(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "POST only", http.StatusMethodNotAllowed)
+		httpError(w, "POST only", http.StatusMethodNotAllowed)
 		return
 	}
 
 	var req struct {
 		Room  string   `json:"room"`
-		Topic string   `json:"topic"`
-		Tags  []string `json:"tags"`
+		Texts []string `json:"texts"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "bad request", http.StatusBadRequest)
+		httpError(w, "bad request", http.StatusBadRequest)
 		return
 	}
 
@@ -296,32 +2055,76 @@ func (d *Daemon) handleCreateRoom(w http.ResponseWriter, r *http.Request) {
 	c := d.client
 	d.mu.RUnlock()
 	if c == nil {
-		http.Error(w, "not connected", http.StatusServiceUnavailable)
+		notConnected(w)
 		return
 	}
 
-	info, err := c.CreateRoom(req.Room, req.Topic, req.Tags)
+	ids, err := c.SendMessages(req.Room, req.Texts)
+	if ids == nil {
+		ids = []string{}
+	}
+	if errors.Is(err, client.ErrQueued) {
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "queued", "ids": ids})
+		return
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		status := sendStatus(err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": "error",
+			"ids":    ids,
+			"error":  apiError{Code: errorCode(err, status), Message: err.Error()},
+		})
 		return
 	}
-	d.mu.Lock()
-	d.joinedRooms[req.Room] = true
-	d.mu.Unlock()
-	json.NewEncoder(w).Encode(info)
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "ok", "ids": ids})
 }
 
-func (d *Daemon) handleJoinRoom(w http.ResponseWriter, r *http.Request) {
+// sendError reports a failed outgoing message with the status from sendStatus,
+// or as queued if it went to the outbox instead.
+func sendError(w http.ResponseWriter, err error) {
+	if errors.Is(err, client.ErrQueued) {
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]string{"status": "queued"})
+		return
+	}
+	httpErrorFor(w, err, sendStatus(err))
+}
+
+// sendStatus maps a send failure to an HTTP status: 202 for a message queued
+// for resend, 400 for invalid input, 429 for rate limiting, 403 in read-only
+// mode, 501 for an operation the relay doesn't support, 500 otherwise.
+func sendStatus(err error) int {
+	switch {
+	case errors.Is(err, client.ErrQueued):
+		return http.StatusAccepted
+	case errors.Is(err, client.ErrInvalidRoomName), errors.Is(err, client.ErrMessageTooLarge),
+		errors.Is(err, client.ErrInvalidContent):
+		return http.StatusBadRequest
+	case errors.Is(err, client.ErrRateLimited):
+		return http.StatusTooManyRequests
+	case errors.Is(err, client.ErrReadOnly):
+		return http.StatusForbidden
+	case errors.Is(err, client.ErrUnsupported):
+		return http.StatusNotImplemented
+	}
+	return http.StatusInternalServerError
+}
+
+func (d *Daemon) handleTyping(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "POST only", http.StatusMethodNotAllowed)
+		httpError(w, "POST only", http.StatusMethodNotAllowed)
 		return
 	}
 
 	var req struct {
-		Room string `json:"room"`
+		Room   string `json:"room"`
+		Active bool   `json:"active"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "bad request", http.StatusBadRequest)
+		httpError(w, "bad request", http.StatusBadRequest)
 		return
 	}
 
@@ -329,62 +2132,60 @@ func (d *Daemon) handleJoinRoom(w http.ResponseWriter, r *http.Request) {
 	c := d.client
 	d.mu.RUnlock()
 	if c == nil {
-		http.Error(w, "not connected", http.StatusServiceUnavailable)
+		notConnected(w)
 		return
 	}
 
-	info, err := c.JoinRoom(req.Room)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if err := c.SetTyping(req.Room, req.Active); err != nil {
+		httpErrorFor(w, err, http.StatusInternalServerError)
 		return
 	}
-	d.mu.Lock()
-	d.joinedRooms[req.Room] = true
-	d.mu.Unlock()
-	json.NewEncoder(w).Encode(info)
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 }
 
-func (d *Daemon) handleLeaveRoom(w http.ResponseWriter, r *http.Request) {
+func (d *Daemon) handleEdit(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "POST only", http.StatusMethodNotAllowed)
+		httpError(w, "POST only", http.StatusMethodNotAllowed)
 		return
 	}
 
 	var req struct {
-		Room string `json:"room"`
+		Room      string `json:"room"`
+		MessageID string `json:"message_id"`
+		Text      string `json:"text"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.MessageID == "" {
+		httpError(w, "bad request", http.StatusBadRequest)
+		return
 	}
-	json.NewDecoder(r.Body).Decode(&req)
 
 	d.mu.RLock()
 	c := d.client
 	d.mu.RUnlock()
 	if c == nil {
-		http.Error(w, "not connected", http.StatusServiceUnavailable)
+		notConnected(w)
 		return
 	}
 
-	if err := c.LeaveRoom(req.Room); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := c.EditMessage(req.Room, req.MessageID, req.Text); err != nil {
+		sendError(w, err)
 		return
 	}
-	d.mu.Lock()
-	delete(d.joinedRooms, req.Room)
-	d.mu.Unlock()
 	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 }
 
-func (d *Daemon) handleSend(w http.ResponseWriter, r *http.Request) {
+func (d *Daemon) handleDelete(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "POST only", http.StatusMethodNotAllowed)
+		httpError(w, "POST only", http.StatusMethodNotAllowed)
 		return
 	}
 
 	var req struct {
-		Room string `json:"room"`
-		Text string `json:"text"`
+		Room      string `json:"room"`
+		MessageID string `json:"message_id"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "bad request", http.StatusBadRequest)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.MessageID == "" {
+		httpError(w, "bad request", http.StatusBadRequest)
 		return
 	}
 
@@ -392,12 +2193,12 @@ func (d *Daemon) handleSend(w http.ResponseWriter, r *http.Request) {
 	c := d.client
 	d.mu.RUnlock()
 	if c == nil {
-		http.Error(w, "not connected", http.StatusServiceUnavailable)
+		notConnected(w)
 		return
 	}
 
-	if err := c.SendMessage(req.Room, req.Text); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := c.DeleteMessage(req.Room, req.MessageID); err != nil {
+		sendError(w, err)
 		return
 	}
 	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
@@ -405,29 +2206,109 @@ func (d *Daemon) handleSend(w http.ResponseWriter, r *http.Request) {
 
 func (d *Daemon) handleMessages(w http.ResponseWriter, r *http.Request) {
 	roomFilter := r.URL.Query().Get("room")
+	// mentions=true returns only messages that @-mention this agent; the
+	// rest stay unread, like messages of other rooms.
+	mentionsOnly := r.URL.Query().Get("mentions") == "true"
+	// peek=true leaves returned messages in the buffer, so a monitor can look
+	// without taking them from the consumer.
+	peek := r.URL.Query().Get("peek") == "true"
+	// since=<seq> or since_id=<id> reads past a cursor instead: messages that
+	// arrived after the one with that seq, or after the message with that ID
+	// (all buffered ones if it was pushed out, or the seq is one this daemon
+	// hasn't reached), in arrival order and never cleared. Sender timestamps can't order arrivals, so seq does. Passing on
+	// the last one returned gives an at-least-once read that concurrent
+	// readers can't take from each other.
+	sinceID := r.URL.Query().Get("since_id")
+	since := int64(-1)
+	cursor := sinceID != ""
+	if v := r.URL.Query().Get("since"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 || cursor {
+			httpError(w, "since must be a message seq, and not combined with since_id", http.StatusBadRequest)
+			return
+		}
+		since, cursor = n, true
+	}
 
 	d.mu.Lock()
+	d.expireMessages()
+	if since > d.messageSeq {
+		since = -1
+	}
+	buffered := d.messages
+	if sinceID != "" {
+		for i, m := range buffered {
+			if m.ID == sinceID {
+				buffered = buffered[i+1:]
+				break
+			}
+		}
+	}
 	var msgs []client.IncomingMessage
 	var remaining []client.IncomingMessage
-	for _, m := range d.messages {
-		if roomFilter == "" || strings.EqualFold(m.Room, roomFilter) {
+	for _, m := range buffered {
+		if (roomFilter == "" || strings.EqualFold(m.Room, roomFilter)) && (!mentionsOnly || m.Mentioned) && m.Seq > since {
 			msgs = append(msgs, m)
 		} else {
 			remaining = append(remaining, m)
 		}
 	}
 	// Clear returned messages from buffer, keep unrelated rooms
-	d.messages = remaining
+	if !peek && !cursor {
+		d.messages = remaining
+	}
 	d.mu.Unlock()
 
-	// Return last 50
+	// Return last 50, or with a cursor the next 50
 	if len(msgs) > 50 {
-		msgs = msgs[len(msgs)-50:]
+		if cursor {
+			msgs = msgs[:50]
+		} else {
+			msgs = msgs[len(msgs)-50:]
+		}
 	}
 
 	json.NewEncoder(w).Encode(msgs)
 }
 
+// handleStream sends incoming messages as server-sent events as they arrive.
+// Unlike /messages it does not clear the unread buffer.
+func (d *Daemon) handleStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		httpError(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	roomFilter := r.URL.Query().Get("room")
+
+	msgs, stop := d.watch()
+	defer stop()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepalive := time.NewTicker(15 * time.Second)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			flusher.Flush()
+		case m := <-msgs:
+			if roomFilter != "" && !strings.EqualFold(m.Room, roomFilter) {
+				continue
+			}
+			data, _ := json.Marshal(m)
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			flusher.Flush()
+		}
+	}
+}
+
 // relayHTTPBase converts a WebSocket relay URL to its HTTP base URL.
 // e.g. wss://agentnet.bettalab.me/v1/ws → https://agentnet.bettalab.me
 func relayHTTPBase(relayWS string) string {
@@ -452,8 +2333,55 @@ type RelayMessage struct {
 	Room      string `json:"room"`
 	AgentID   string `json:"from_id"`
 	AgentName string `json:"from_name"`
-	Content   string `json:"content"` // JSON string: {"type":"text","text":"..."}
+	Content   string `json:"content"`   // JSON string: {"type":"text","text":"..."}
 	Timestamp int64  `json:"timestamp"` // milliseconds
+	InReplyTo string `json:"in_reply_to,omitempty"`
+}
+
+// threadOrder arranges messages so each reply follows its parent, returning
+// the nesting depth of each. Replies whose parent isn't in msgs stay top-level.
+// Messages are tracked by position, so ones with an empty or repeated ID are
+// all kept; replies link to the first message with a (non-empty) ID.
+func threadOrder(msgs []RelayMessage) ([]RelayMessage, []int) {
+	first := make(map[string]int, len(msgs))
+	for i, m := range msgs {
+		if _, dup := first[m.ID]; m.ID != "" && !dup {
+			first[m.ID] = i
+		}
+	}
+	children := make(map[int][]int)
+	var roots []int
+	for i, m := range msgs {
+		if parent, ok := first[m.InReplyTo]; ok && parent != i {
+			children[parent] = append(children[parent], i)
+		} else {
+			roots = append(roots, i)
+		}
+	}
+
+	ordered := make([]RelayMessage, 0, len(msgs))
+	depths := make([]int, 0, len(msgs))
+	visited := make([]bool, len(msgs))
+	var walk func(i, depth int)
+	walk = func(i, depth int) {
+		if visited[i] {
+			return
+		}
+		visited[i] = true
+		ordered = append(ordered, msgs[i])
+		depths = append(depths, depth)
+		for _, child := range children[i] {
+			walk(child, depth+1)
+		}
+	}
+	for _, i := range roots {
+		walk(i, 0)
+	}
+	// Reply cycles have no root; show whatever is left flat.
+	for i := range msgs {
+		walk(i, 0)
+	}
+	return ordered, depths
 }
 
 // parseRelayContent extracts plain text from relay content JSON.
@@ -471,10 +2399,49 @@ func parseRelayContent(content string) string {
 	return content
 }
 
+// historyError is a failed relay history request with the status to report it as.
+type historyError struct {
+	status int
+	msg    string
+}
+
+func (e *historyError) Error() string { return e.msg }
+
+// fetchHistory fetches one page of a room's history from the relay's REST API.
+// Errors are always *historyError.
+func (d *Daemon) fetchHistory(room string, q url.Values) ([]RelayMessage, error) {
+	relay := d.relayURL()
+	endpoint := fmt.Sprintf("%s/api/rooms/%s/messages?%s", relayHTTPBase(relay), url.PathEscape(room), q.Encode())
+
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, &historyError{http.StatusBadRequest, err.Error()}
+	}
+	req.Header = d.headersFor(relay)
+	resp, err := d.relayHTTPClient().Do(req)
+	if err != nil {
+		return nil, &historyError{http.StatusBadGateway, fmt.Sprintf("relay unreachable: %v", err)}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, &historyError{resp.StatusCode, fmt.Sprintf("relay error %d: %s", resp.StatusCode, body)}
+	}
+
+	var envelope struct {
+		Messages []RelayMessage `json:"messages"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return nil, &historyError{http.StatusInternalServerError, "failed to decode relay response"}
+	}
+	return envelope.Messages, nil
+}
+
 func (d *Daemon) handleHistory(w http.ResponseWriter, r *http.Request) {
 	room := r.URL.Query().Get("room")
 	if room == "" {
-		http.Error(w, "room parameter required", http.StatusBadRequest)
+		httpError(w, "room parameter required", http.StatusBadRequest)
 		return
 	}
 	limit := r.URL.Query().Get("limit")
@@ -482,57 +2449,183 @@ func (d *Daemon) handleHistory(w http.ResponseWriter, r *http.Request) {
 		limit = "20"
 	}
 
-	base := relayHTTPBase(d.relay)
-	url := fmt.Sprintf("%s/api/rooms/%s/messages?limit=%s", base, room, limit)
+	// Forward pagination cursors so callers can page backward through busy rooms.
+	q := url.Values{}
+	q.Set("limit", limit)
+	if before := r.URL.Query().Get("before"); before != "" {
+		if _, err := strconv.ParseInt(before, 10, 64); err != nil {
+			httpError(w, "before must be a millisecond timestamp", http.StatusBadRequest)
+			return
+		}
+		q.Set("before", before)
+	}
+	if beforeID := r.URL.Query().Get("before_id"); beforeID != "" {
+		q.Set("before_id", beforeID)
+	}
 
-	resp, err := http.Get(url)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("relay unreachable: %v", err), http.StatusBadGateway)
-		return
+	// format is json, a built-in template name or a text/template; check
+	// it before asking the relay.
+	var tmpl *template.Template
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" {
+		var err error
+		if tmpl, err = parseHistoryFormat(format); err != nil {
+			httpError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		http.Error(w, fmt.Sprintf("relay error %d: %s", resp.StatusCode, body), resp.StatusCode)
+	msgs, err := d.fetchHistory(room, q)
+	if err != nil {
+		httpErrorFor(w, err, err.(*historyError).status)
 		return
 	}
+	d.openHistory(room, msgs)
 
-	var envelope struct {
-		Messages []RelayMessage `json:"messages"`
+	// The oldest message's ID is the cursor for the next (older) page; a
+	// timestamp would skip messages sent in the same millisecond. Among
+	// equal timestamps the relay's order (newest first) decides.
+	var oldest int64
+	var oldestID string
+	for _, m := range msgs {
+		if oldest == 0 || m.Timestamp <= oldest {
+			oldest, oldestID = m.Timestamp, m.ID
+		}
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
-		http.Error(w, "failed to decode relay response", http.StatusInternalServerError)
+
+	// format=json gives the same page as records, oldest first, for
+	// clients that lay it out themselves (agentnet log).
+	if format == "json" {
+		sort.SliceStable(msgs, func(i, j int) bool { return msgs[i].Timestamp < msgs[j].Timestamp })
+		records := make([]exportRecord, 0, len(msgs))
+		for _, m := range msgs {
+			records = append(records, exportRecord{
+				ID:        m.ID,
+				Timestamp: m.Timestamp,
+				AgentID:   m.AgentID,
+				AgentName: m.AgentName,
+				Text:      parseRelayContent(m.Content),
+				InReplyTo: m.InReplyTo,
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"room":      room,
+			"messages":  records,
+			"before":    oldest,   // oldest timestamp; 0 when there are none
+			"before_id": oldestID, // cursor for the next older page
+		})
 		return
 	}
-	msgs := envelope.Messages
+
+	// Templated output is just the messages, oldest first, to go straight
+	// into a prompt; the page cursor is only in X-Oldest-ID.
+	var rendered []byte
+	if tmpl != nil {
+		if rendered, err = renderHistory(tmpl, room, msgs); err != nil {
+			httpError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
 
 	// Format as human-readable text for LLM consumption
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if oldestID != "" {
+		w.Header().Set("X-Oldest-ID", oldestID)
+	}
+	if oldest != 0 {
+		w.Header().Set("X-Oldest-Timestamp", strconv.FormatInt(oldest, 10))
+	}
+	if tmpl != nil {
+		w.Write(rendered)
+		return
+	}
 	fmt.Fprintf(w, "=== Room: %s (last %s messages) ===\n", room, limit)
 	if len(msgs) == 0 {
 		fmt.Fprintln(w, "(no messages)")
 		return
 	}
-	for _, m := range msgs {
+	ordered, depths := threadOrder(msgs)
+	for i, m := range ordered {
 		ts := time.UnixMilli(m.Timestamp).UTC().Format("2006-01-02 15:04:05")
 		name := m.AgentName
 		if name == "" {
 			name = m.AgentID
 		}
 		text := parseRelayContent(m.Content)
-		fmt.Fprintf(w, "[%s] %s: %s\n", ts, name, text)
+		indent := ""
+		if depths[i] > 0 {
+			indent = strings.Repeat("  ", depths[i]) + "↳ "
+		}
+		fmt.Fprintf(w, "%s[%s] %s: %s\n", indent, ts, name, text)
+	}
+	fmt.Fprintf(w, "=== Older: --before-id %s ===\n", oldestID)
+}
+
+// handleRotateKey replaces this identity's keypair and reconnects as the new
+// agent ID. Rooms are rejoined from rooms.json, but anything the relay or other
+// agents tied to the old ID (allowlists, ownership) does not carry over.
+func (d *Daemon) handleRotateKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httpError(w, "POST only", http.StatusMethodNotAllowed)
+		return
+	}
+
+	d.mu.Lock()
+	old := d.keys
+	keys, err := keystore.Rotate(d.keyPath)
+	if err != nil {
+		d.mu.Unlock()
+		httpError(w, "rotate key: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	d.keys = keys
+	c := d.client
+	d.mu.Unlock()
+
+	log.Printf("⚠ KEY ROTATED: agent ID %s → %s. Room memberships and allowlists tied to the old ID may be lost.",
+		old.AgentID(), keys.AgentID())
+
+	// reconnectLoop picks up the new key.
+	if c != nil {
+		c.Close()
 	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":       "ok",
+		"old_agent_id": old.AgentID(),
+		"new_agent_id": keys.AgentID(),
+		"warning":      "room memberships and allowlists tied to the old agent ID may be lost; share the new ID with your peers",
+	})
 }
 
 func (d *Daemon) handleStop(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"status": "stopping"})
 	go func() {
-		d.mu.Lock()
-		if d.client != nil {
-			d.client.Close()
-		}
-		d.mu.Unlock()
+		d.shutdown()
 		os.Exit(0)
 	}()
 }
+
+// shutdown is the cleanup before the daemon exits: it closes every
+// identity's relay connection, saves their last-seen cursors, and removes
+// the PID file and API socket.
+func (d *Daemon) shutdown() {
+	for _, id := range d.identities {
+		id.mu.Lock()
+		if id.client != nil {
+			id.client.Close()
+		}
+		id.mu.Unlock()
+		id.saveLastSeen()
+	}
+	d.mu.Lock()
+	if d.client != nil {
+		d.client.Close()
+	}
+	d.mu.Unlock()
+	d.saveLastSeen()
+	d.removePIDFile()
+	if path, ok := strings.CutPrefix(d.addr, "unix:"); ok && path != "" {
+		os.Remove(path)
+	}
+}
@@ -2,14 +2,32 @@ package daemon
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
 
 	"github.com/betta-lab/agentnet-openclaw/internal/client"
+	"github.com/betta-lab/agentnet-openclaw/internal/keystore"
 )
 
+// TestMain keeps status handlers from asking GitHub for the latest release:
+// the lookup runs in the background and would write its cache into test
+// directories after they are removed.
+func TestMain(m *testing.M) {
+	latestRelease = func(string, string) (string, time.Time, error) {
+		return "", time.Time{}, errors.New("no release lookups in tests")
+	}
+	os.Exit(m.Run())
+}
+
 func TestAuth_MissingToken(t *testing.T) {
 	d := &Daemon{apiToken: "secret"}
 
@@ -84,6 +102,167 @@ func TestStatus_NotConnected(t *testing.T) {
 	}
 }
 
+func TestStatus_HaltedAfterFatalRelayError(t *testing.T) {
+	d := &Daemon{
+		keyPath:        filepath.Join(t.TempDir(), "agent.key"), // where reconnectLoop saves state on halting
+		halted:         "BANNED",
+		lastRelayError: &relayErrorEvent{Code: "BANNED", Message: "agent banned", Fatal: true, At: time.Now()},
+	}
+
+	done := make(chan struct{})
+	go func() {
+		d.reconnectLoop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("reconnectLoop kept retrying after a fatal error")
+	}
+
+	w := httptest.NewRecorder()
+	d.handleStatus(w, httptest.NewRequest("GET", "/status", nil))
+	var resp struct {
+		State          string           `json:"state"`
+		LastRelayError *relayErrorEvent `json:"last_relay_error"`
+	}
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp.State != "halted" || resp.LastRelayError == nil || resp.LastRelayError.Code != "BANNED" {
+		t.Fatalf("unexpected status %+v", resp)
+	}
+}
+
+func TestStatus_LastDisconnect(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		ws.ReadMessage() // hello
+		ws.WriteJSON(map[string]interface{}{"type": "pow.challenge", "challenge": "c", "difficulty": 1})
+		ws.ReadMessage() // hello.pow
+		ws.WriteJSON(map[string]string{"type": "welcome"})
+		ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "too many messages"))
+		ws.ReadMessage()
+	}))
+	defer srv.Close()
+	keyPath := filepath.Join(t.TempDir(), "agent.key")
+	keys, err := keystore.LoadOrCreate(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Halted, so reconnectLoop returns once the connection ends instead of redialling.
+	d := &Daemon{keyPath: keyPath, halted: haltAuthFailed}
+	if d.client, err = d.dial(t.Context(), "ws"+strings.TrimPrefix(srv.URL, "http"), keys); err != nil {
+		t.Fatal(err)
+	}
+	d.reconnectLoop()
+
+	w := httptest.NewRecorder()
+	d.handleStatus(w, httptest.NewRequest("GET", "/status", nil))
+	var resp struct {
+		LastDisconnect *client.Disconnect `json:"last_disconnect"`
+	}
+	json.NewDecoder(w.Body).Decode(&resp)
+	if got := resp.LastDisconnect; got == nil || got.Code != websocket.ClosePolicyViolation || got.Reason != "too many messages" {
+		t.Fatalf("got %+v", got)
+	}
+}
+
+func TestStatus_UpdateCheckDisabled(t *testing.T) {
+	d := &Daemon{version: "0.1.0", latestVersion: "9.9.9", noUpdateCheck: true}
+
+	w := httptest.NewRecorder()
+	d.handleStatus(w, httptest.NewRequest("GET", "/status", nil))
+
+	var resp map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&resp)
+	if v, ok := resp["latest_version"]; !ok || v != nil {
+		t.Fatalf("latest_version should be null, got %v", v)
+	}
+	if v, ok := resp["update_available"]; !ok || v != nil {
+		t.Fatalf("update_available should be null, got %v", v)
+	}
+}
+
+func TestStatus_Timestamps(t *testing.T) {
+	d := &Daemon{lastMessageAt: time.Now().Add(-2 * time.Hour)}
+
+	w := httptest.NewRecorder()
+	d.handleStatus(w, httptest.NewRequest("GET", "/status", nil))
+
+	var resp map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&resp)
+	if v, ok := resp["connected_since"]; !ok || v != nil {
+		t.Fatalf("connected_since should be null while disconnected, got %v", v)
+	}
+	at, err := time.Parse(time.RFC3339Nano, resp["last_message_at"].(string))
+	if err != nil || time.Since(at) < 2*time.Hour {
+		t.Fatalf("unexpected last_message_at %v (%v)", resp["last_message_at"], err)
+	}
+}
+
+func TestMessages_MentionsOnly(t *testing.T) {
+	d := &Daemon{messages: []client.IncomingMessage{
+		{Room: "lab", Text: "chatter"},
+		{Room: "lab", Text: "@me look", Mentioned: true},
+	}}
+
+	w := httptest.NewRecorder()
+	d.handleMessages(w, httptest.NewRequest("GET", "/messages?mentions=true", nil))
+
+	var msgs []client.IncomingMessage
+	json.NewDecoder(w.Body).Decode(&msgs)
+	if len(msgs) != 1 || msgs[0].Text != "@me look" {
+		t.Fatalf("unexpected messages %+v", msgs)
+	}
+	if len(d.messages) != 1 || d.messages[0].Text != "chatter" {
+		t.Fatalf("unmentioned messages should stay unread, buffer is %+v", d.messages)
+	}
+}
+
+func TestRooms_BadLimit(t *testing.T) {
+	d := &Daemon{}
+	w := httptest.NewRecorder()
+	d.handleRooms(w, httptest.NewRequest("GET", "/rooms?tags=ai&limit=5000", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+}
+
+func TestRooms_BadFilter(t *testing.T) {
+	d := &Daemon{}
+	w := httptest.NewRecorder()
+	d.handleRooms(w, httptest.NewRequest("GET", "/rooms?filter=theirs", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+}
+
+func TestSend_QueuedWhileDisconnected(t *testing.T) {
+	d := &Daemon{outboxSize: 5}
+	d.outbox = d.newOutbox()
+
+	w := httptest.NewRecorder()
+	d.handleSend(w, httptest.NewRequest("POST", "/send", strings.NewReader(`{"room":"test","text":"hello"}`)))
+	var resp map[string]string
+	json.NewDecoder(w.Body).Decode(&resp)
+	if w.Code != http.StatusAccepted || resp["status"] != "queued" || resp["id"] == "" {
+		t.Fatalf("expected 202 queued with an ID, got %d %v", w.Code, resp)
+	}
+	if d.outbox.Len() != 1 {
+		t.Fatalf("expected 1 queued message, got %d", d.outbox.Len())
+	}
+
+	// A send that must be confirmed can't be queued.
+	w = httptest.NewRecorder()
+	d.handleSend(w, httptest.NewRequest("POST", "/send?wait=true", strings.NewReader(`{"room":"test","text":"hello"}`)))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 for wait=true, got %d", w.Code)
+	}
+}
+
 func TestSend_NotConnected(t *testing.T) {
 	d := &Daemon{apiToken: "tok"}
 
@@ -98,6 +277,35 @@ func TestSend_NotConnected(t *testing.T) {
 	}
 }
 
+func TestSendBatch_NotConnected(t *testing.T) {
+	d := &Daemon{apiToken: "tok"}
+
+	body := strings.NewReader(`{"room":"test","texts":["a","b"]}`)
+	req := httptest.NewRequest("POST", "/send/batch", body)
+	w := httptest.NewRecorder()
+	d.handleSendBatch(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 when not connected, got %d", w.Code)
+	}
+}
+
+func TestSendStatus_ValidationIsBadRequest(t *testing.T) {
+	for err, want := range map[error]int{
+		fmt.Errorf("%w: too long", client.ErrInvalidRoomName):    http.StatusBadRequest,
+		fmt.Errorf("%w: 20000 bytes", client.ErrMessageTooLarge): http.StatusBadRequest,
+		fmt.Errorf("message 2: %w", client.ErrInvalidContent):    http.StatusBadRequest,
+		client.ErrRateLimited: http.StatusTooManyRequests,
+		client.ErrReadOnly:    http.StatusForbidden,
+		fmt.Errorf("message 1: %w (broken pipe)", client.ErrQueued): http.StatusAccepted,
+		errors.New("write: broken pipe"):                            http.StatusInternalServerError,
+	} {
+		if got := sendStatus(err); got != want {
+			t.Fatalf("%v: got %d, want %d", err, got, want)
+		}
+	}
+}
+
 func TestSend_MethodNotAllowed(t *testing.T) {
 	d := &Daemon{apiToken: "tok"}
 
@@ -139,6 +347,20 @@ func TestCreateRoom_NotConnected(t *testing.T) {
 	}
 }
 
+func TestUpdateRoom_NotConnected(t *testing.T) {
+	d := &Daemon{apiToken: "tok"}
+
+	body := strings.NewReader(`{"room":"test","topic":"new"}`)
+	req := httptest.NewRequest("POST", "/rooms/update", body)
+	req.Header.Set("Authorization", "Bearer tok")
+	w := httptest.NewRecorder()
+	d.handleUpdateRoom(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", w.Code)
+	}
+}
+
 func TestLeaveRoom_NotConnected(t *testing.T) {
 	d := &Daemon{apiToken: "tok"}
 
@@ -153,6 +375,61 @@ func TestLeaveRoom_NotConnected(t *testing.T) {
 	}
 }
 
+func TestKick_Validation(t *testing.T) {
+	d := &Daemon{apiToken: "tok"}
+
+	w := httptest.NewRecorder()
+	d.handleKick(w, httptest.NewRequest("POST", "/rooms/kick", strings.NewReader(`{"room":"test"}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("missing agent_id: expected 400, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	d.handleKick(w, httptest.NewRequest("POST", "/rooms/kick", strings.NewReader(`{"room":"test","agent_id":"mallory"}`)))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", w.Code)
+	}
+}
+
+func TestRoomInfo_Validation(t *testing.T) {
+	d := &Daemon{}
+
+	w := httptest.NewRecorder()
+	d.handleRoomInfo(w, httptest.NewRequest("GET", "/rooms/info", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("missing room: expected 400, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	d.handleRoomInfo(w, httptest.NewRequest("GET", "/rooms/info?room=lab", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", w.Code)
+	}
+}
+
+func TestMessages_DropsExpired(t *testing.T) {
+	now := time.Now()
+	d := &Daemon{
+		messageTTL: time.Hour,
+		messages: []client.IncomingMessage{
+			// Sender clocks are wrong both ways: only the receive time counts.
+			{ID: "stale", Room: "lab", Text: "last week", Timestamp: now.Add(time.Hour).UnixMilli(), Received: now.Add(-7 * 24 * time.Hour).UnixMilli()},
+			{ID: "fresh", Room: "lab", Text: "just now", Timestamp: now.Add(-7 * 24 * time.Hour).UnixMilli(), Received: now.UnixMilli()},
+		},
+	}
+
+	w := httptest.NewRecorder()
+	d.handleMessages(w, httptest.NewRequest("GET", "/messages?peek=true", nil))
+	var msgs []client.IncomingMessage
+	json.NewDecoder(w.Body).Decode(&msgs)
+	if len(msgs) != 1 || msgs[0].ID != "fresh" {
+		t.Fatalf("expected only the fresh message, got %+v", msgs)
+	}
+	if len(d.messages) != 1 {
+		t.Fatalf("expired message still buffered: %+v", d.messages)
+	}
+}
+
 func TestMessages_Empty(t *testing.T) {
 	d := &Daemon{
 		apiToken: "tok",
@@ -201,6 +478,244 @@ func TestMessages_RoomFilter(t *testing.T) {
 	}
 }
 
+func TestMessages_PeekLeavesBuffer(t *testing.T) {
+	d := &Daemon{
+		messages: []client.IncomingMessage{
+			{ID: "m1", Room: "room-a", Text: "one"},
+			{ID: "m2", Room: "room-a", Text: "two"},
+		},
+	}
+
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		d.handleMessages(w, httptest.NewRequest("GET", "/messages?peek=true", nil))
+		var msgs []client.IncomingMessage
+		json.NewDecoder(w.Body).Decode(&msgs)
+		if len(msgs) != 2 {
+			t.Fatalf("peek %d: expected 2 messages, got %d", i, len(msgs))
+		}
+	}
+
+	// A plain read still consumes them.
+	w := httptest.NewRecorder()
+	d.handleMessages(w, httptest.NewRequest("GET", "/messages", nil))
+	if len(d.messages) != 0 {
+		t.Fatalf("expected the buffer cleared after a read, %d left", len(d.messages))
+	}
+}
+
+func TestMessages_SinceCursor(t *testing.T) {
+	d := &Daemon{messageSeq: 60}
+	for i := 1; i <= 60; i++ {
+		// Sender clocks disagree: timestamps don't follow arrival order.
+		d.messages = append(d.messages, client.IncomingMessage{ID: fmt.Sprintf("m%d", i), Room: "lab", Seq: int64(i), Timestamp: int64(1000 - i)})
+	}
+	read := func(query string) []client.IncomingMessage {
+		t.Helper()
+		w := httptest.NewRecorder()
+		d.handleMessages(w, httptest.NewRequest("GET", "/messages?"+query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: got %d: %s", query, w.Code, w.Body)
+		}
+		var msgs []client.IncomingMessage
+		json.NewDecoder(w.Body).Decode(&msgs)
+		return msgs
+	}
+
+	// The next 50 past the cursor, oldest first.
+	msgs := read("since=5")
+	if len(msgs) != 50 || msgs[0].ID != "m6" || msgs[49].ID != "m55" {
+		t.Fatalf("got %d messages, %s to %s", len(msgs), msgs[0].ID, msgs[len(msgs)-1].ID)
+	}
+	if msgs = read("since_id=" + msgs[49].ID); len(msgs) != 5 || msgs[0].ID != "m56" {
+		t.Fatalf("after m55: got %+v", msgs)
+	}
+	if msgs = read("since_id=m60"); len(msgs) != 0 {
+		t.Fatalf("after the newest: got %+v", msgs)
+	}
+	// A cursor pushed out of the buffer returns everything, read again.
+	if msgs = read("since_id=gone"); len(msgs) != 50 || msgs[0].ID != "m1" {
+		t.Fatalf("unknown cursor: got %d from %s", len(msgs), msgs[0].ID)
+	}
+	// So does a seq this daemon hasn't reached, e.g. one kept from a run
+	// whose clock was ahead.
+	if msgs = read("since=1000"); len(msgs) != 50 || msgs[0].ID != "m1" {
+		t.Fatalf("seq past the newest: got %d messages", len(msgs))
+	}
+	if len(d.messages) != 60 {
+		t.Fatalf("cursor reads must not clear the buffer, %d left", len(d.messages))
+	}
+
+	for _, bad := range []string{"since=yesterday", "since=-1", "since=1&since_id=m1"} {
+		w := httptest.NewRecorder()
+		d.handleMessages(w, httptest.NewRequest("GET", "/messages?"+bad, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: got %d, want 400", bad, w.Code)
+		}
+	}
+}
+
+func TestNextSeq_IncreasesAcrossRestarts(t *testing.T) {
+	before := &Daemon{}
+	var last int64
+	for i := 0; i < 3; i++ {
+		seq := before.nextSeq()
+		if seq <= last {
+			t.Fatalf("seq %d after %d", seq, last)
+		}
+		last = seq
+	}
+	time.Sleep(time.Millisecond)
+	if after := (&Daemon{}).nextSeq(); after <= last {
+		t.Fatalf("restarted daemon's seq %d, want past %d", after, last)
+	}
+}
+
+func TestJoinRoom_MaxRooms(t *testing.T) {
+	keys, err := keystore.LoadOrCreate(filepath.Join(t.TempDir(), "agent.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &Daemon{maxRooms: 2, joinedRooms: map[string]bool{"a": true, "b": true}}
+	c, err := d.dial(t.Context(), joinRelay(t), keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	d.client = c
+
+	w := httptest.NewRecorder()
+	d.handleJoinRoom(w, httptest.NewRequest("POST", "/rooms/join", strings.NewReader(`{"room":"c"}`)))
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), `"too_many_rooms"`) {
+		t.Fatalf("expected 409 too_many_rooms, got %d %s", w.Code, w.Body.String())
+	}
+
+	// Rejoining a room already counted is not a new room.
+	if err := d.checkRoomLimit("a"); err != nil {
+		t.Fatalf("rejoin should be allowed: %v", err)
+	}
+}
+
+// joinRelay accepts any agent and lets it join any room but "missing".
+func joinRelay(t *testing.T) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		ws.ReadMessage() // hello
+		ws.WriteJSON(map[string]interface{}{"type": "pow.challenge", "challenge": "c", "difficulty": 1})
+		ws.ReadMessage() // hello.pow
+		ws.WriteJSON(map[string]string{"type": "welcome"})
+		for {
+			var msg struct {
+				Type  string `json:"type"`
+				Room  string `json:"room"`
+				Nonce string `json:"nonce"`
+			}
+			if err := ws.ReadJSON(&msg); err != nil {
+				return
+			}
+			if msg.Type != "room.join" {
+				continue
+			}
+			if msg.Room == "missing" {
+				ws.WriteJSON(map[string]string{"type": "error", "code": "ROOM_NOT_FOUND", "message": "no such room", "room": msg.Room, "nonce": msg.Nonce})
+				continue
+			}
+			ws.WriteJSON(map[string]interface{}{"type": "room.joined", "room": msg.Room, "nonce": msg.Nonce, "members": []string{}})
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func TestBulkJoin_CarriesOnPastFailures(t *testing.T) {
+	keys, err := keystore.LoadOrCreate(filepath.Join(t.TempDir(), "agent.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &Daemon{keyPath: filepath.Join(t.TempDir(), "agent.key"), joinedRooms: map[string]bool{}}
+	c, err := d.dial(t.Context(), joinRelay(t), keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	d.client = c
+
+	w := httptest.NewRecorder()
+	body := `{"rooms":[{"room":"lab"},{"room":"missing"},{"room":"lab"},{"room":""},{"room":"ops"}]}`
+	d.handleBulkJoin(w, httptest.NewRequest("POST", "/rooms/join/bulk", strings.NewReader(body)))
+	var resp struct {
+		Joined  int `json:"joined"`
+		Failed  int `json:"failed"`
+		Results []struct {
+			Room   string    `json:"room"`
+			Status string    `json:"status"`
+			Error  *apiError `json:"error"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("%d %s", w.Code, w.Body.String())
+	}
+	if resp.Joined != 2 || resp.Failed != 1 || len(resp.Results) != 3 {
+		t.Fatalf("got %s", w.Body.String())
+	}
+	if r := resp.Results[1]; r.Room != "missing" || r.Status != "error" || r.Error == nil {
+		t.Fatalf("missing room: got %+v", r)
+	}
+	if !d.joinedRooms["lab"] || !d.joinedRooms["ops"] || d.joinedRooms["missing"] {
+		t.Fatalf("joined rooms: %v", d.joinedRooms)
+	}
+}
+
+func TestBulkJoin_Validation(t *testing.T) {
+	d := &Daemon{}
+	for body, want := range map[string]int{
+		`{}`:                       http.StatusBadRequest,
+		`{"rooms":[]}`:             http.StatusBadRequest,
+		`{"rooms":[{"room":"a"}]}`: http.StatusServiceUnavailable,
+		`{"tags":["ai"]}`:          http.StatusServiceUnavailable,
+	} {
+		w := httptest.NewRecorder()
+		d.handleBulkJoin(w, httptest.NewRequest("POST", "/rooms/join/bulk", strings.NewReader(body)))
+		if w.Code != want {
+			t.Errorf("%s: got %d, want %d", body, w.Code, want)
+		}
+	}
+}
+
+func TestTrackedSend_Validation(t *testing.T) {
+	d := &Daemon{acks: client.NewAckTracker(0), outbox: client.NewOutbox(10, 0)}
+	for _, tc := range []struct {
+		path string
+		want int
+	}{
+		{"/send?track=true&wait=true", http.StatusBadRequest},
+		{"/send?track=true", http.StatusServiceUnavailable}, // never queued
+		{"/send", http.StatusAccepted},
+	} {
+		w := httptest.NewRecorder()
+		d.handleSend(w, httptest.NewRequest("POST", tc.path, strings.NewReader(`{"room":"lab","text":"hi"}`)))
+		if w.Code != tc.want {
+			t.Errorf("%s: got %d, want %d", tc.path, w.Code, tc.want)
+		}
+	}
+
+	for path, want := range map[string]int{
+		"/acks":           http.StatusBadRequest,
+		"/acks?id=nosuch": http.StatusNotFound,
+	} {
+		w := httptest.NewRecorder()
+		d.handleAcks(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != want {
+			t.Errorf("%s: got %d, want %d", path, w.Code, want)
+		}
+	}
+}
+
 func TestCreateRoom_BadRequest(t *testing.T) {
 	d := &Daemon{apiToken: "tok", client: nil}
 
@@ -215,3 +730,667 @@ func TestCreateRoom_BadRequest(t *testing.T) {
 		t.Fatal("expected non-200 for bad request")
 	}
 }
+
+func TestHistory_ForwardsBeforeCursor(t *testing.T) {
+	var gotQuery string
+	relay := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotQuery = r.URL.RawQuery
+		w.Write([]byte(`{"messages":[
+			{"id":"m1","from_name":"alice","content":"{\"type\":\"text\",\"text\":\"older\"}","timestamp":1000},
+			{"id":"m2","from_name":"bob","content":"{\"type\":\"text\",\"text\":\"newer\"}","timestamp":2000}
+		]}`))
+	}))
+	defer relay.Close()
+
+	d := &Daemon{apiToken: "tok", relay: "ws://" + strings.TrimPrefix(relay.URL, "http://") + "/v1/ws"}
+
+	req := httptest.NewRequest("GET", "/history?room=test&limit=2&before=5000", nil)
+	w := httptest.NewRecorder()
+	d.handleHistory(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(gotQuery, "before=5000") || !strings.Contains(gotQuery, "limit=2") {
+		t.Fatalf("cursor not forwarded to relay: %s", gotQuery)
+	}
+	if got := w.Header().Get("X-Oldest-Timestamp"); got != "1000" {
+		t.Fatalf("X-Oldest-Timestamp: got %q, want 1000", got)
+	}
+}
+
+func TestHistory_JSONFormat(t *testing.T) {
+	relay := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"messages":[
+			{"id":"m2","from_name":"bob","content":"{\"type\":\"text\",\"text\":\"newer\"}","timestamp":2000},
+			{"id":"m1","from_name":"alice","content":"{\"type\":\"text\",\"text\":\"older\"}","timestamp":1000}
+		]}`))
+	}))
+	defer relay.Close()
+
+	d := &Daemon{apiToken: "tok", relay: "ws://" + strings.TrimPrefix(relay.URL, "http://") + "/v1/ws"}
+	w := httptest.NewRecorder()
+	d.handleHistory(w, httptest.NewRequest("GET", "/history?room=test&format=json", nil))
+
+	var resp struct {
+		Messages []exportRecord `json:"messages"`
+		Before   int64          `json:"before"`
+		BeforeID string         `json:"before_id"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("%v: %s", err, w.Body.String())
+	}
+	if len(resp.Messages) != 2 || resp.Messages[0].Text != "older" || resp.Messages[1].AgentName != "bob" {
+		t.Fatalf("expected the page oldest first, got %+v", resp.Messages)
+	}
+	if resp.Before != 1000 || resp.BeforeID != "m1" {
+		t.Fatalf("cursor: got %d/%q, want 1000/m1", resp.Before, resp.BeforeID)
+	}
+}
+
+func TestHistory_PagesByIDWithinAMillisecond(t *testing.T) {
+	var gotQuery string
+	relay := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotQuery = r.URL.RawQuery
+		w.Write([]byte(`{"messages":[
+			{"id":"m3","from_name":"bob","content":"{\"type\":\"text\",\"text\":\"c\"}","timestamp":2000},
+			{"id":"m2","from_name":"bob","content":"{\"type\":\"text\",\"text\":\"b\"}","timestamp":1000}
+		]}`))
+	}))
+	defer relay.Close()
+
+	d := &Daemon{apiToken: "tok", relay: "ws://" + strings.TrimPrefix(relay.URL, "http://") + "/v1/ws"}
+	w := httptest.NewRecorder()
+	d.handleHistory(w, httptest.NewRequest("GET", "/history?room=test&limit=2&before_id=m4", nil))
+
+	if !strings.Contains(gotQuery, "before_id=m4") {
+		t.Fatalf("before_id not forwarded to relay: %s", gotQuery)
+	}
+	// m1, also at 1000, is still to come: the cursor must be m2, not the timestamp.
+	if got := w.Header().Get("X-Oldest-ID"); got != "m2" {
+		t.Fatalf("X-Oldest-ID: got %q, want m2", got)
+	}
+	if !strings.Contains(w.Body.String(), "=== Older: --before-id m2 ===") {
+		t.Fatalf("page doesn't end with the ID cursor:\n%s", w.Body)
+	}
+}
+
+func TestHistory_InvalidBefore(t *testing.T) {
+	d := &Daemon{apiToken: "tok", relay: "wss://example.com/v1/ws"}
+
+	req := httptest.NewRequest("GET", "/history?room=test&before=yesterday", nil)
+	w := httptest.NewRecorder()
+	d.handleHistory(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+}
+
+func TestForIdentity_Routing(t *testing.T) {
+	d := &Daemon{apiToken: "tok", agentName: "primary"}
+	d.identities = map[string]*Daemon{
+		"alice": {agentName: "alice", parent: d},
+	}
+	handler := d.forIdentity(func(target *Daemon, w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(target.agentName))
+	})
+
+	cases := []struct {
+		header, query string
+		code          int
+		want          string
+	}{
+		{"", "", http.StatusOK, "primary"},
+		{"alice", "", http.StatusOK, "alice"},
+		{"", "alice", http.StatusOK, "alice"},
+		{"default", "", http.StatusOK, "primary"},
+		{"mallory", "", http.StatusNotFound, ""},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest("GET", "/status?identity="+tc.query, nil)
+		if tc.header != "" {
+			req.Header.Set("X-Agent-Identity", tc.header)
+		}
+		w := httptest.NewRecorder()
+		handler(w, req)
+		if w.Code != tc.code {
+			t.Fatalf("header=%q query=%q: expected %d, got %d", tc.header, tc.query, tc.code, w.Code)
+		}
+		if tc.want != "" && w.Body.String() != tc.want {
+			t.Fatalf("header=%q query=%q: routed to %q, want %q", tc.header, tc.query, w.Body.String(), tc.want)
+		}
+	}
+}
+
+func TestListen_UnixSocket(t *testing.T) {
+	dir := t.TempDir()
+	d := &Daemon{addr: "unix:", keyPath: filepath.Join(dir, "agent.key")}
+
+	ln, err := d.listen()
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	sock := filepath.Join(dir, "api.sock")
+	if d.addr != "unix:"+sock {
+		t.Fatalf("addr: got %s, want unix:%s", d.addr, sock)
+	}
+	info, err := os.Stat(sock)
+	if err != nil {
+		t.Fatalf("socket not created: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("socket permissions: got %o, want 0600", info.Mode().Perm())
+	}
+}
+
+func TestListen_UnixSocketInUse(t *testing.T) {
+	dir := t.TempDir()
+	sock := filepath.Join(dir, "api.sock")
+	d := &Daemon{addr: "unix:" + sock}
+
+	os.WriteFile(sock, []byte("not a socket"), 0600)
+	if _, err := d.listen(); err == nil {
+		t.Fatal("a regular file at the socket path was replaced")
+	}
+	if data, _ := os.ReadFile(sock); string(data) != "not a socket" {
+		t.Fatal("a regular file at the socket path was removed")
+	}
+	os.Remove(sock)
+
+	live, err := d.listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.listen(); err == nil {
+		t.Fatal("a live daemon's socket was replaced")
+	}
+	live.Close()
+
+	// Closed without cleanup, as after a crash: stale, so it is replaced.
+	ln, err := d.listen()
+	if err != nil {
+		t.Fatalf("stale socket not replaced: %v", err)
+	}
+	ln.Close()
+}
+
+func TestListen_PortZeroWritesAddr(t *testing.T) {
+	dir := t.TempDir()
+	d := &Daemon{addr: "127.0.0.1:0", keyPath: filepath.Join(dir, "agent.key")}
+
+	ln, err := d.listen()
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	if err := d.writeAddr(ln); err != nil {
+		t.Fatal(err)
+	}
+
+	if d.addr != ln.Addr().String() || strings.HasSuffix(d.addr, ":0") {
+		t.Fatalf("addr: got %s, want the bound %s", d.addr, ln.Addr())
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "api.addr"))
+	if err != nil || strings.TrimSpace(string(data)) != d.addr {
+		t.Fatalf("api.addr: got %q (%v), want %s", data, err, d.addr)
+	}
+}
+
+func TestCollect_EditAndDeleteBuffered(t *testing.T) {
+	d := &Daemon{
+		messages: []client.IncomingMessage{
+			{ID: "m1", Room: "r", From: "alice", Text: "wrong value"},
+			{ID: "m2", Room: "r", From: "alice", Text: "keep"},
+		},
+	}
+
+	d.applyRevision(client.IncomingMessage{Type: "message.edit", From: "alice", MessageID: "m1", Text: "right value", Revision: 2})
+	d.applyRevision(client.IncomingMessage{Type: "message.edit", From: "alice", MessageID: "m1", Text: "stale", Revision: 1})
+	if d.messages[0].Text != "right value" || d.messages[0].Revision != 2 {
+		t.Fatalf("edit not applied in order: %+v", d.messages[0])
+	}
+
+	d.applyRevision(client.IncomingMessage{Type: "message.delete", From: "alice", MessageID: "m2"})
+	if len(d.messages) != 1 || d.messages[0].ID != "m1" {
+		t.Fatalf("delete not applied: %+v", d.messages)
+	}
+
+	// Edits for messages no longer buffered are surfaced as events.
+	if d.applyRevision(client.IncomingMessage{Type: "message.edit", From: "alice", MessageID: "gone", Revision: 1}) {
+		t.Fatal("edit for unbuffered message should be buffered as an event")
+	}
+}
+
+func TestCollect_RevisionsOnlyFromSender(t *testing.T) {
+	d := &Daemon{
+		messages: []client.IncomingMessage{{ID: "m1", Room: "r", From: "alice", Text: "original"}},
+	}
+
+	if !d.applyRevision(client.IncomingMessage{Type: "message.edit", From: "mallory", MessageID: "m1", Text: "forged", Revision: 99}) {
+		t.Fatal("forged edit should be dropped, not buffered")
+	}
+	d.applyRevision(client.IncomingMessage{Type: "message.delete", From: "mallory", MessageID: "m1"})
+	if len(d.messages) != 1 || d.messages[0].Text != "original" || d.messages[0].Revision != 0 {
+		t.Fatalf("third party revised alice's message: %+v", d.messages)
+	}
+}
+
+func TestEdit_NotConnected(t *testing.T) {
+	d := &Daemon{apiToken: "tok"}
+
+	body := strings.NewReader(`{"room":"test","message_id":"m1","text":"fixed"}`)
+	req := httptest.NewRequest("POST", "/edit", body)
+	w := httptest.NewRecorder()
+	d.handleEdit(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", w.Code)
+	}
+}
+
+func TestStatus_TypingExpires(t *testing.T) {
+	d := &Daemon{
+		apiToken: "tok",
+		typing: map[string]map[string]typist{
+			"room-a": {
+				"id-alice": {name: "alice", at: time.Now()},
+				"id-bob":   {name: "bob", at: time.Now().Add(-time.Minute)},
+			},
+		},
+	}
+
+	req := httptest.NewRequest("GET", "/status", nil)
+	w := httptest.NewRecorder()
+	d.handleStatus(w, req)
+
+	var resp struct {
+		Typing map[string][]string `json:"typing"`
+	}
+	json.NewDecoder(w.Body).Decode(&resp)
+
+	if got := resp.Typing["room-a"]; len(got) != 1 || got[0] != "alice" {
+		t.Fatalf("expected only alice typing, got %v", got)
+	}
+}
+
+func TestNoteTyping_KeyedByAgentID(t *testing.T) {
+	d := &Daemon{}
+	d.noteTyping(client.TypingEvent{Room: "lab", From: "id-1", FromName: "alice", Active: true})
+	d.noteTyping(client.TypingEvent{Room: "lab", From: "id-2", FromName: "alice", Active: true})
+	d.noteTyping(client.TypingEvent{Room: "lab", From: "id-3", Active: true})
+	if got := d.activeTypers()["lab"]; strings.Join(got, ",") != "alice,alice,id-3" {
+		t.Fatalf("typing: %v", got)
+	}
+
+	// One alice stopping leaves the other's indicator alone.
+	d.noteTyping(client.TypingEvent{Room: "lab", From: "id-1", FromName: "alice"})
+	if got := d.activeTypers()["lab"]; strings.Join(got, ",") != "alice,id-3" {
+		t.Fatalf("after id-1 stopped: %v", got)
+	}
+}
+
+func TestRetryConnect_JitterWithinBounds(t *testing.T) {
+	origSleep, origJitter := sleep, jitter
+	defer func() { sleep, jitter = origSleep, origJitter }()
+
+	var slept, bounds []time.Duration
+	sleep = func(d time.Duration) { slept = append(slept, d) }
+	jitter = func(n int64) int64 {
+		bounds = append(bounds, time.Duration(n))
+		return n - 1 // worst case: just under the bound
+	}
+
+	failures := 10
+	d := &Daemon{relay: "wss://example.com/v1/ws"}
+	d.retryConnect(func() error {
+		if failures > 0 {
+			failures--
+			return fmt.Errorf("relay down")
+		}
+		return nil
+	})
+
+	if len(slept) != 11 {
+		t.Fatalf("expected 11 attempts, got %d", len(slept))
+	}
+	want := 2 * time.Second
+	for i := range slept {
+		if bounds[i] != want {
+			t.Fatalf("attempt %d: backoff %v, want %v", i, bounds[i], want)
+		}
+		if slept[i] < 0 || slept[i] >= bounds[i] {
+			t.Fatalf("attempt %d: slept %v outside [0, %v)", i, slept[i], bounds[i])
+		}
+		want *= 2
+		if want > maxBackoff {
+			want = maxBackoff
+		}
+	}
+}
+
+func TestRetryConnect_GivesUpAfterMaxAttempts(t *testing.T) {
+	origSleep := sleep
+	defer func() { sleep = origSleep }()
+	sleep = func(time.Duration) {}
+
+	attempts := 0
+	d := &Daemon{relay: "wss://example.com/v1/ws", maxReconnectAttempts: 3}
+	err := d.retryConnect(func() error {
+		attempts++
+		return fmt.Errorf("dial: connection refused")
+	})
+	if !errors.Is(err, errReconnectExhausted) || attempts != 3 {
+		t.Fatalf("expected to give up after 3 attempts: attempts=%d err=%v", attempts, err)
+	}
+
+	w := httptest.NewRecorder()
+	d.handleStatus(w, httptest.NewRequest("GET", "/status", nil))
+	var resp struct {
+		State string `json:"state"`
+	}
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp.State != "reconnect_exhausted" {
+		t.Fatalf("expected state reconnect_exhausted, got %q", resp.State)
+	}
+}
+
+func TestReconnectLoop_ExitsWhenExhausted(t *testing.T) {
+	origSleep, origExit := sleep, exit
+	defer func() { sleep, exit = origSleep, origExit }()
+	sleep = func(time.Duration) {}
+	code := make(chan int, 1)
+	exit = func(c int) { code <- c }
+
+	path := filepath.Join(t.TempDir(), "agent.key")
+	keys, err := keystore.LoadOrCreate(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Dir(path)
+	d := &Daemon{relay: deadRelay(t), keyPath: path, keys: keys, maxReconnectAttempts: 2, exitOnExhausted: true,
+		pidFile: filepath.Join(dir, "daemon.pid"), addr: "unix:" + filepath.Join(dir, "api.sock"),
+		lastSeen: map[string]int64{"lab": 1000}}
+	d.claimPIDFile()
+	os.WriteFile(filepath.Join(dir, "api.sock"), nil, 0600)
+	d.reconnectLoop()
+	select {
+	case c := <-code:
+		if c != ExitReconnectExhausted {
+			t.Fatalf("exit status %d, want %d", c, ExitReconnectExhausted)
+		}
+	default:
+		t.Fatal("expected the daemon to exit")
+	}
+	// Cleaned up as for agentnet stop.
+	for _, name := range []string{"daemon.pid", "api.sock"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s left behind: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(d.lastSeenPath()); err != nil {
+		t.Errorf("last seen not saved: %v", err)
+	}
+}
+
+func TestRetryConnect_StopsOnAuthRejection(t *testing.T) {
+	origSleep := sleep
+	defer func() { sleep = origSleep }()
+	sleep = func(time.Duration) {}
+
+	attempts := 0
+	d := &Daemon{relay: "wss://example.com/v1/ws"}
+	err := d.retryConnect(func() error {
+		attempts++
+		if attempts < 3 {
+			return fmt.Errorf("dial: connection refused")
+		}
+		return fmt.Errorf("%w: %w", client.ErrAuthRejected, &client.RelayError{Code: "BANNED", Message: "agent banned"})
+	})
+	if !errors.Is(err, client.ErrAuthRejected) || attempts != 3 {
+		t.Fatalf("expected to give up on the auth rejection: attempts=%d err=%v", attempts, err)
+	}
+
+	w := httptest.NewRecorder()
+	d.handleStatus(w, httptest.NewRequest("GET", "/status", nil))
+	var resp struct {
+		State          string           `json:"state"`
+		LastRelayError *relayErrorEvent `json:"last_relay_error"`
+	}
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp.State != "auth_failed" || resp.LastRelayError == nil || resp.LastRelayError.Code != "BANNED" {
+		t.Fatalf("unexpected status %+v", resp)
+	}
+}
+
+func TestRooms_PersistRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	d := &Daemon{keyPath: filepath.Join(dir, "agent.key"), joinedRooms: map[string]bool{"beta": true, "alpha": true}}
+	d.saveRooms()
+
+	data, err := os.ReadFile(filepath.Join(dir, "rooms.json"))
+	if err != nil {
+		t.Fatalf("rooms.json not written: %v", err)
+	}
+	if strings.Index(string(data), "alpha") > strings.Index(string(data), "beta") {
+		t.Fatalf("rooms should be saved sorted: %s", data)
+	}
+
+	restored := &Daemon{keyPath: d.keyPath, joinedRooms: make(map[string]bool)}
+	if err := restored.loadRooms(); err != nil {
+		t.Fatalf("loadRooms: %v", err)
+	}
+	if !restored.joinedRooms["alpha"] || !restored.joinedRooms["beta"] || len(restored.joinedRooms) != 2 {
+		t.Fatalf("rooms not restored: %v", restored.joinedRooms)
+	}
+}
+
+func TestRooms_LoadMissingFile(t *testing.T) {
+	d := &Daemon{keyPath: filepath.Join(t.TempDir(), "agent.key"), joinedRooms: make(map[string]bool)}
+	if err := d.loadRooms(); err != nil {
+		t.Fatalf("missing rooms.json should not error: %v", err)
+	}
+}
+
+func TestStream_DeliversFilteredMessages(t *testing.T) {
+	d := &Daemon{apiToken: "tok"}
+	srv := httptest.NewServer(http.HandlerFunc(d.handleStream))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "?room=room-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("content type: %s", ct)
+	}
+
+	// Wait for the handler to subscribe, then publish as collectMessages would.
+	for i := 0; ; i++ {
+		d.mu.RLock()
+		n := len(d.watchers)
+		d.mu.RUnlock()
+		if n == 1 {
+			break
+		}
+		if i > 100 {
+			t.Fatal("stream never subscribed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	d.mu.Lock()
+	for ch := range d.watchers {
+		ch <- client.IncomingMessage{Room: "room-b", Text: "skip me"}
+		ch <- client.IncomingMessage{Room: "room-a", Text: "hello"}
+	}
+	d.mu.Unlock()
+
+	buf := make([]byte, 512)
+	n, _ := resp.Body.Read(buf)
+	got := string(buf[:n])
+	if !strings.HasPrefix(got, "data: ") || !strings.Contains(got, `"text":"hello"`) {
+		t.Fatalf("unexpected event: %q", got)
+	}
+}
+
+func TestThreadOrder_RepliesFollowParent(t *testing.T) {
+	msgs := []RelayMessage{
+		{ID: "a", Timestamp: 1},
+		{ID: "b", Timestamp: 2},
+		{ID: "a1", InReplyTo: "a", Timestamp: 3},
+		{ID: "a1x", InReplyTo: "a1", Timestamp: 4},
+		{ID: "orphan", InReplyTo: "gone", Timestamp: 5},
+	}
+	ordered, depths := threadOrder(msgs)
+
+	var got []string
+	for i, m := range ordered {
+		got = append(got, fmt.Sprintf("%s:%d", m.ID, depths[i]))
+	}
+	want := "a:0 a1:1 a1x:2 b:0 orphan:0"
+	if strings.Join(got, " ") != want {
+		t.Fatalf("got %v, want %s", got, want)
+	}
+}
+
+func TestThreadOrder_CycleDoesNotDropMessages(t *testing.T) {
+	msgs := []RelayMessage{
+		{ID: "x", InReplyTo: "y"},
+		{ID: "y", InReplyTo: "x"},
+	}
+	ordered, _ := threadOrder(msgs)
+	if len(ordered) != 2 {
+		t.Fatalf("expected both messages, got %d", len(ordered))
+	}
+}
+
+func TestThreadOrder_KeepsMissingAndRepeatedIDs(t *testing.T) {
+	msgs := []RelayMessage{
+		{ID: "a", Content: "first a"},
+		{Content: "no id"},
+		{ID: "a", Content: "second a"},
+		{Content: "no id either"},
+		{ID: "r", InReplyTo: "a", Content: "reply"},
+		{ID: "s", InReplyTo: "", Content: "top"},
+	}
+	ordered, depths := threadOrder(msgs)
+
+	var got []string
+	for i, m := range ordered {
+		got = append(got, fmt.Sprintf("%s:%d", m.Content, depths[i]))
+	}
+	want := "first a:0|reply:1|no id:0|second a:0|no id either:0|top:0"
+	if strings.Join(got, "|") != want {
+		t.Fatalf("got %v, want %s", got, want)
+	}
+}
+
+func TestNew_MessageBufferSize(t *testing.T) {
+	d := New(Config{DataDir: t.TempDir()})
+	if d.bufferSize != defaultBufferSize || cap(d.messages) != defaultBufferSize {
+		t.Fatalf("default buffer: size=%d cap=%d", d.bufferSize, cap(d.messages))
+	}
+
+	d = New(Config{DataDir: t.TempDir(), MessageBufferSize: 50})
+	if d.bufferSize != 50 || cap(d.messages) != 50 {
+		t.Fatalf("configured buffer: size=%d cap=%d", d.bufferSize, cap(d.messages))
+	}
+	if id := d.newIdentity("other", nil); id.bufferSize != 50 {
+		t.Fatalf("identity should inherit buffer size, got %d", id.bufferSize)
+	}
+}
+
+func TestWriteOp_ReadOnlyForbidden(t *testing.T) {
+	d := &Daemon{readOnly: true}
+	h := d.writeOp(d.forIdentity((*Daemon).handleSend))
+
+	req := httptest.NewRequest("POST", "/send", strings.NewReader(`{"room":"test","text":"hello"}`))
+	w := httptest.NewRecorder()
+	h(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 in read-only mode, got %d", w.Code)
+	}
+
+	// Writable daemons fall through to the handler.
+	d.readOnly = false
+	w = httptest.NewRecorder()
+	h(w, httptest.NewRequest("POST", "/send", strings.NewReader(`{"room":"test","text":"hello"}`)))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 once writable, got %d", w.Code)
+	}
+}
+
+func TestHealthProbes(t *testing.T) {
+	d := &Daemon{apiToken: "tok"}
+
+	w := httptest.NewRecorder()
+	d.handleHealthz(w, httptest.NewRequest("GET", "/healthz", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("healthz: expected 200, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	d.handleReady(w, httptest.NewRequest("GET", "/ready", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("ready while disconnected: expected 503, got %d", w.Code)
+	}
+
+	d.client = &client.Client{}
+	w = httptest.NewRecorder()
+	d.handleReady(w, httptest.NewRequest("GET", "/ready", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("ready while connected: expected 200, got %d", w.Code)
+	}
+}
+
+func TestRotateKey_ReturnsOldAndNewIDs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.key")
+	keys, err := keystore.LoadOrCreate(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &Daemon{keyPath: path, keys: keys}
+
+	w := httptest.NewRecorder()
+	d.handleRotateKey(w, httptest.NewRequest("POST", "/key/rotate", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body)
+	}
+	var resp map[string]string
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp["old_agent_id"] != keys.AgentID() || resp["new_agent_id"] != d.keys.AgentID() || d.keys.AgentID() == keys.AgentID() {
+		t.Fatalf("unexpected rotation result: %v", resp)
+	}
+}
+
+func TestResolveToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api.token")
+	os.WriteFile(path, []byte("previous\n"), 0600)
+
+	if got := (&Daemon{apiToken: "fixed", stableToken: true}).resolveToken(path); got != "fixed" {
+		t.Fatalf("fixed token should win, got %q", got)
+	}
+	if got := (&Daemon{stableToken: true}).resolveToken(path); got != "previous" {
+		t.Fatalf("stable token should be reused, got %q", got)
+	}
+	if got := (&Daemon{}).resolveToken(path); got == "previous" || len(got) != 64 {
+		t.Fatalf("expected a fresh token, got %q", got)
+	}
+	if got := (&Daemon{stableToken: true}).resolveToken(filepath.Join(t.TempDir(), "missing")); len(got) != 64 {
+		t.Fatalf("missing token file should generate one, got %q", got)
+	}
+}
+
+func TestWriteOp_DryRunAllowedWhenReadOnly(t *testing.T) {
+	d := &Daemon{readOnly: true}
+	h := d.writeOp(d.forIdentity((*Daemon).handleSend))
+
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest("POST", "/send?dry_run=true", strings.NewReader(`{"room":"test","text":"hello"}`)))
+	if w.Code == http.StatusForbidden {
+		t.Fatal("dry runs transmit nothing and should not be blocked in read-only mode")
+	}
+}
@@ -0,0 +1,259 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/betta-lab/agentnet-openclaw/internal/client"
+	"github.com/betta-lab/agentnet-openclaw/internal/update"
+)
+
+// Diagnostics settings, replaceable in tests.
+var (
+	diagTimeout  = 10 * time.Second // bound on each network check
+	maxClockSkew = client.MaxClockSkew
+)
+
+// Diagnostic check outcomes.
+const (
+	checkPass = "pass"
+	checkWarn = "warn"
+	checkFail = "fail"
+	checkSkip = "skip"
+)
+
+// check is one line of the /diagnostics checklist.
+type check struct {
+	Name   string `json:"name"`
+	Status string `json:"status"` // pass, warn, fail or skip
+	Detail string `json:"detail"`
+	Hint   string `json:"hint,omitempty"` // what to do about a warn or fail
+}
+
+// handleDiagnostics runs the troubleshooting checks behind `agentnet doctor`.
+// Reaching this handler already proves the daemon is up and the token valid;
+// the rest covers the key file, the relay, the handshake, the clock and
+// updates. "ok" is false if any check failed.
+func (d *Daemon) handleDiagnostics(w http.ResponseWriter, r *http.Request) {
+	relay := d.relayURL()
+	checks := []check{
+		d.checkKeyFile(),
+		checkRelayReachable(relay, d.proxy),
+		d.checkHandshake(),
+		d.checkClockSkew(relay),
+		d.checkUpdate(),
+	}
+	ok := true
+	for _, c := range checks {
+		if c.Status == checkFail {
+			ok = false
+		}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ok":     ok,
+		"relay":  relay,
+		"checks": checks,
+	})
+}
+
+// checkKeyFile verifies the identity key exists and only its owner can read it.
+func (d *Daemon) checkKeyFile() check {
+	c := check{Name: "key_file"}
+	info, err := os.Stat(d.keyPath)
+	switch {
+	case os.IsNotExist(err):
+		c.Status, c.Detail = checkFail, d.keyPath+" does not exist"
+		c.Hint = "restore it from your backup; deleting it gives you a new agent ID"
+	case err != nil:
+		c.Status, c.Detail = checkFail, err.Error()
+	case runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0:
+		c.Status = checkFail
+		c.Detail = fmt.Sprintf("%s is readable by others (mode %04o)", d.keyPath, info.Mode().Perm())
+		c.Hint = "chmod 600 " + d.keyPath + ", and rotate the key (agentnet rotate-key --yes) if others may have read it"
+	default:
+		c.Status, c.Detail = checkPass, d.keyPath
+	}
+	return c
+}
+
+// checkRelayReachable opens a TCP connection to the relay's host and port, or
+// to the proxy's if one is in use.
+func checkRelayReachable(relay, proxy string) check {
+	c := check{Name: "relay_reachable"}
+	u, err := url.Parse(relay)
+	if err != nil || u.Host == "" {
+		c.Status, c.Detail = checkFail, "invalid relay URL: "+relay
+		c.Hint = "set AGENTNET_RELAY to a ws:// or wss:// URL"
+		return c
+	}
+	proxyFunc, err := client.ProxyFunc(proxy)
+	if err != nil {
+		c.Status, c.Detail = checkFail, err.Error()
+		c.Hint = "fix AGENTNET_PROXY"
+		return c
+	}
+	host, via := hostPort(u, map[string]string{"ws": "80", "wss": "443"}), ""
+	if proxyFunc != nil {
+		scheme := "https"
+		if u.Scheme == "ws" {
+			scheme = "http"
+		}
+		if p, _ := proxyFunc(&http.Request{URL: &url.URL{Scheme: scheme, Host: u.Host}}); p != nil {
+			host, via = hostPort(p, map[string]string{"http": "80", "socks5": "1080"}), "proxy "
+		}
+	}
+	conn, err := net.DialTimeout("tcp", host, diagTimeout)
+	if err != nil {
+		c.Status, c.Detail = checkFail, via+err.Error()
+		c.Hint = "check the relay URL (AGENTNET_RELAY), DNS and any firewall or proxy"
+		return c
+	}
+	conn.Close()
+	c.Status, c.Detail = checkPass, via+host
+	return c
+}
+
+// hostPort returns u's host and port, the port defaulting by scheme.
+func hostPort(u *url.URL, defaultPorts map[string]string) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	return net.JoinHostPort(u.Hostname(), defaultPorts[u.Scheme])
+}
+
+// checkHandshake reports on the relay session. A live connection passes;
+// otherwise a fresh handshake is attempted to surface the error.
+func (d *Daemon) checkHandshake() check {
+	c := check{Name: "handshake"}
+	d.mu.RLock()
+	connected, since := d.client != nil, d.connectedAt
+	keys, halted := d.keys, d.halted
+	d.mu.RUnlock()
+	if connected {
+		c.Status, c.Detail = checkPass, "connected since "+since.Format(time.RFC3339)
+		return c
+	}
+	if keys == nil {
+		c.Status, c.Detail = checkFail, "no key loaded"
+		return c
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), diagTimeout)
+	defer cancel()
+	probe, err := d.dial(ctx, d.relayURL(), keys)
+	if err != nil {
+		c.Status, c.Detail = checkFail, err.Error()
+		c.Hint = "see agentnet logs"
+		if errors.Is(err, client.ErrAuthRejected) {
+			c.Hint = "the relay rejected this key; check your system clock, or whether the relay has banned this agent"
+		}
+		return c
+	}
+	probe.Close()
+	c.Status, c.Detail = checkWarn, "handshake succeeds but the daemon is not connected"
+	c.Hint = "it should reconnect shortly"
+	if halted != "" {
+		c.Hint = "the daemon stopped reconnecting (" + halted + "); restart it"
+	}
+	return c
+}
+
+// checkClockSkew reports the local clock's offset from the relay's: as
+// measured in the handshake if connected to a relay that reports its time,
+// else from the Date header of the relay's HTTP endpoint.
+func (d *Daemon) checkClockSkew(relay string) check {
+	c := check{Name: "clock_skew"}
+	d.mu.RLock()
+	cl := d.client
+	d.mu.RUnlock()
+	skew, ok := time.Duration(0), false
+	if cl != nil {
+		skew, ok = cl.ClockSkew()
+	}
+	if !ok {
+		var err error
+		if skew, err = d.httpClockSkew(relay); err != nil {
+			c.Status, c.Detail = checkSkip, err.Error()
+			return c
+		}
+	}
+	skew = skew.Round(time.Second)
+	c.Detail = "local clock is " + client.DescribeClockSkew(skew)
+	if skew.Abs() > maxClockSkew {
+		c.Status = checkFail
+		c.Hint = "sync your system clock (enable NTP); relays reject signed timestamps that are too far off"
+		return c
+	}
+	c.Status = checkPass
+	return c
+}
+
+// httpClockSkew measures the local clock against the Date header of the
+// relay's HTTP endpoint, allowing for the round trip.
+func (d *Daemon) httpClockSkew(relay string) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), diagTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "HEAD", relayHTTPBase(relay), nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header = d.headersFor(relay)
+	start := time.Now()
+	resp, err := d.relayHTTPClient().Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("relay did not answer over HTTP: %w", err)
+	}
+	resp.Body.Close()
+	rtt := time.Since(start)
+	server, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return 0, errors.New("relay sent no Date header")
+	}
+	// Date has one-second resolution and was stamped mid-round-trip.
+	return start.Add(rtt / 2).Sub(server), nil
+}
+
+// checkUpdate reports whether a newer release is available, fetching the
+// latest release if the cache is stale.
+func (d *Daemon) checkUpdate() check {
+	c := check{Name: "update"}
+	root := d
+	if d.parent != nil {
+		root = d.parent
+	}
+	if root.noUpdateCheck {
+		c.Status, c.Detail = checkSkip, "update checks are disabled"
+		return c
+	}
+	root.mu.RLock()
+	stale := time.Since(root.latestVersionAt) > update.CacheTTL
+	root.mu.RUnlock()
+	if stale {
+		root.checkLatestVersion()
+	}
+	root.mu.RLock()
+	latest := root.latestVersion
+	root.mu.RUnlock()
+
+	current := strings.TrimPrefix(d.version, "v")
+	switch {
+	case latest == "":
+		c.Status, c.Detail = checkWarn, "could not fetch the latest release"
+		c.Hint = "check access to api.github.com, or set AGENTNET_NO_UPDATE_CHECK=1"
+	case latest != current && d.version != "dev":
+		c.Status, c.Detail = checkWarn, fmt.Sprintf("%s is available (running %s)", latest, d.version)
+		c.Hint = "run: agentnet version"
+	default:
+		c.Status, c.Detail = checkPass, "running "+d.version
+	}
+	return c
+}
@@ -0,0 +1,106 @@
+package daemon
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/betta-lab/agentnet-openclaw/internal/client"
+	"github.com/betta-lab/agentnet-openclaw/internal/keystore"
+)
+
+func TestCheckKeyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.key")
+	d := &Daemon{keyPath: path}
+	if c := d.checkKeyFile(); c.Status != checkFail || c.Hint == "" {
+		t.Fatalf("missing key: got %+v", c)
+	}
+	if _, err := keystore.LoadOrCreate(path); err != nil {
+		t.Fatal(err)
+	}
+	if c := d.checkKeyFile(); c.Status != checkPass {
+		t.Fatalf("fresh key: got %+v", c)
+	}
+	if runtime.GOOS == "windows" {
+		return
+	}
+	if err := os.Chmod(path, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if c := d.checkKeyFile(); c.Status != checkFail {
+		t.Fatalf("world-readable key: got %+v", c)
+	}
+}
+
+func TestCheckRelayReachable_DeadRelayFails(t *testing.T) {
+	if c := checkRelayReachable(deadRelay(t), client.ProxyNone); c.Status != checkFail || c.Hint == "" {
+		t.Fatalf("got %+v", c)
+	}
+	if c := checkRelayReachable("not a url", ""); c.Status != checkFail {
+		t.Fatalf("invalid URL: got %+v", c)
+	}
+}
+
+func TestCheckClockSkew_FromHTTPDate(t *testing.T) {
+	for offset, want := range map[time.Duration]string{
+		0:                checkPass,
+		-2 * time.Minute: checkFail, // the relay's clock is behind: ours is ahead
+	} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Date", time.Now().Add(offset).UTC().Format(http.TimeFormat))
+		}))
+		d := &Daemon{}
+		c := d.checkClockSkew("ws" + strings.TrimPrefix(srv.URL, "http") + "/v1/ws")
+		srv.Close()
+		if c.Status != want {
+			t.Fatalf("relay clock %v off: got %+v, want %s", offset, c, want)
+		}
+	}
+	if c := (&Daemon{}).checkClockSkew(deadRelay(t)); c.Status != checkSkip {
+		t.Fatalf("unreachable relay: got %+v", c)
+	}
+}
+
+func TestDiagnostics_DisconnectedDaemon(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.key")
+	keys, err := keystore.LoadOrCreate(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &Daemon{relay: handshakeRelay(t), keyPath: path, keys: keys, noUpdateCheck: true}
+
+	w := httptest.NewRecorder()
+	d.handleDiagnostics(w, httptest.NewRequest("GET", "/diagnostics", nil))
+	var resp struct {
+		OK     bool    `json:"ok"`
+		Checks []check `json:"checks"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]string)
+	for _, c := range resp.Checks {
+		got[c.Name] = c.Status
+	}
+	want := map[string]string{
+		"key_file":        checkPass,
+		"relay_reachable": checkPass,
+		"handshake":       checkWarn, // reachable, but the daemon itself isn't connected
+		"clock_skew":      checkPass,
+		"update":          checkSkip,
+	}
+	for name, status := range want {
+		if got[name] != status {
+			t.Fatalf("%s: got %q, want %q (%+v)", name, got[name], status, resp.Checks)
+		}
+	}
+	if !resp.OK {
+		t.Fatal("expected ok with no failed checks")
+	}
+}
@@ -0,0 +1,127 @@
+package daemon
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// exportPageSize is how many messages each relay request fetches during an export.
+const exportPageSize = 200
+
+// exportRecord is one message in a JSON export.
+type exportRecord struct {
+	ID        string `json:"id"`
+	Timestamp int64  `json:"timestamp"`
+	AgentID   string `json:"agent_id"`
+	AgentName string `json:"agent_name"`
+	Text      string `json:"text"`
+	InReplyTo string `json:"in_reply_to,omitempty"`
+}
+
+// handleExport streams a room's full history, newest first, as a JSON array or
+// CSV (timestamp, agent_id, agent_name, text). Pages are fetched from the relay
+// and written one at a time, so memory use doesn't grow with the room. Once
+// streaming has started a failure can't change the status code, so the
+// X-Export-Error trailer reports it; X-Export-Count gives the messages written.
+func (d *Daemon) handleExport(w http.ResponseWriter, r *http.Request) {
+	room := r.URL.Query().Get("room")
+	if room == "" {
+		httpError(w, "room parameter required", http.StatusBadRequest)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "csv" {
+		httpError(w, "format must be json or csv", http.StatusBadRequest)
+		return
+	}
+
+	q := url.Values{}
+	q.Set("limit", strconv.Itoa(exportPageSize))
+	// Fetch the first page before committing to a 200, so a missing room or
+	// unreachable relay is still reported with a proper status.
+	page, err := d.fetchHistory(room, q)
+	if err != nil {
+		httpErrorFor(w, err, err.(*historyError).status)
+		return
+	}
+
+	w.Header().Set("Trailer", "X-Export-Error, X-Export-Count")
+	var csvw *csv.Writer
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		csvw = csv.NewWriter(w)
+		csvw.Write([]string{"timestamp", "agent_id", "agent_name", "text"})
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("[\n"))
+	}
+
+	count := 0
+	for len(page) > 0 {
+		d.openHistory(room, page)
+		sort.SliceStable(page, func(i, j int) bool { return page[i].Timestamp > page[j].Timestamp })
+		for _, m := range page {
+			text := parseRelayContent(m.Content)
+			if csvw != nil {
+				ts := time.UnixMilli(m.Timestamp).UTC().Format(time.RFC3339Nano)
+				csvw.Write([]string{ts, m.AgentID, m.AgentName, text})
+				continue
+			}
+			line, _ := json.Marshal(exportRecord{
+				ID:        m.ID,
+				Timestamp: m.Timestamp,
+				AgentID:   m.AgentID,
+				AgentName: m.AgentName,
+				Text:      text,
+				InReplyTo: m.InReplyTo,
+			})
+			if count > 0 {
+				w.Write([]byte(",\n"))
+			}
+			w.Write(line)
+			count++
+		}
+		if csvw != nil {
+			count += len(page)
+			csvw.Flush()
+		}
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		if len(page) < exportPageSize {
+			break
+		}
+
+		// Continue from the oldest message of this page.
+		oldest := page[len(page)-1]
+		q.Set("before", strconv.FormatInt(oldest.Timestamp, 10))
+		q.Set("before_id", oldest.ID)
+		next, err := d.fetchHistory(room, q)
+		if err != nil {
+			log.Printf("export %s: %v", room, err)
+			w.Header().Set("X-Export-Error", err.Error())
+			break
+		}
+		for _, m := range next {
+			if m.ID == oldest.ID {
+				next = nil // relay ignored the cursor; stop rather than loop forever
+				break
+			}
+		}
+		page = next
+	}
+
+	if csvw == nil {
+		w.Write([]byte("\n]\n"))
+	}
+	w.Header().Set("X-Export-Count", strconv.Itoa(count))
+}
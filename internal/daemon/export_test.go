@@ -0,0 +1,89 @@
+package daemon
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// pagedRelay serves n messages (timestamps 1..n) newest first, honouring the
+// limit and before cursors like the relay's REST API.
+func pagedRelay(t *testing.T, n int) *Daemon {
+	t.Helper()
+	relay := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		before, _ := strconv.Atoi(r.URL.Query().Get("before"))
+		if before == 0 {
+			before = n + 1
+		}
+		var msgs []RelayMessage
+		for ts := before - 1; ts >= 1 && len(msgs) < limit; ts-- {
+			msgs = append(msgs, RelayMessage{
+				ID:        fmt.Sprintf("m%d", ts),
+				AgentID:   "id-alice",
+				AgentName: "alice",
+				Content:   fmt.Sprintf(`{"type":"text","text":"msg, %d"}`, ts),
+				Timestamp: int64(ts),
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"messages": msgs})
+	}))
+	t.Cleanup(relay.Close)
+	return &Daemon{relay: "ws://" + strings.TrimPrefix(relay.URL, "http://") + "/v1/ws"}
+}
+
+func TestExport_JSONPagesThroughHistory(t *testing.T) {
+	d := pagedRelay(t, 2*exportPageSize+50)
+
+	w := httptest.NewRecorder()
+	d.handleExport(w, httptest.NewRequest("GET", "/export?room=lab", nil))
+
+	var records []exportRecord
+	if err := json.Unmarshal(w.Body.Bytes(), &records); err != nil {
+		t.Fatalf("export is not valid JSON: %v", err)
+	}
+	if len(records) != 2*exportPageSize+50 {
+		t.Fatalf("got %d records, want %d", len(records), 2*exportPageSize+50)
+	}
+	for i := 1; i < len(records); i++ {
+		if records[i].Timestamp != records[i-1].Timestamp-1 {
+			t.Fatalf("gap or duplicate at %d: %d after %d", i, records[i].Timestamp, records[i-1].Timestamp)
+		}
+	}
+	trailer := w.Result().Trailer
+	if trailer.Get("X-Export-Count") != strconv.Itoa(len(records)) || trailer.Get("X-Export-Error") != "" {
+		t.Fatalf("unexpected trailer %v", trailer)
+	}
+}
+
+func TestExport_CSV(t *testing.T) {
+	d := pagedRelay(t, 3)
+
+	w := httptest.NewRecorder()
+	d.handleExport(w, httptest.NewRequest("GET", "/export?room=lab&format=csv", nil))
+
+	rows, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 4 || strings.Join(rows[0], ",") != "timestamp,agent_id,agent_name,text" {
+		t.Fatalf("unexpected CSV %v", rows)
+	}
+	if rows[1][1] != "id-alice" || rows[1][2] != "alice" || rows[1][3] != "msg, 3" {
+		t.Fatalf("unexpected row %v", rows[1])
+	}
+}
+
+func TestExport_BadFormat(t *testing.T) {
+	d := &Daemon{}
+	w := httptest.NewRecorder()
+	d.handleExport(w, httptest.NewRequest("GET", "/export?room=lab&format=xml", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+}
@@ -0,0 +1,165 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/betta-lab/agentnet-openclaw/internal/client"
+	"github.com/betta-lab/agentnet-openclaw/internal/keystore"
+)
+
+// Relay failover timing, replaceable in tests.
+var (
+	failbackInterval = 5 * time.Minute  // how often a daemon on a fallback relay retries the primary
+	failbackTimeout  = 15 * time.Second // bound on each attempt
+)
+
+// splitRelays parses a comma-separated relay list, primary first.
+func splitRelays(s string) []string {
+	var relays []string
+	for _, r := range strings.Split(s, ",") {
+		if r = strings.TrimSpace(r); r != "" {
+			relays = append(relays, r)
+		}
+	}
+	return relays
+}
+
+// relayList returns the configured relays, primary first.
+func (d *Daemon) relayList() []string {
+	if len(d.relays) == 0 {
+		return []string{d.relay}
+	}
+	return d.relays
+}
+
+// relayURL returns the relay in use, or the one to be tried next.
+func (d *Daemon) relayURL() string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.relay
+}
+
+// dial connects to relay with this daemon's connection options.
+func (d *Daemon) dial(ctx context.Context, relay string, keys *keystore.Keys) (*client.Client, error) {
+	return client.ConnectWithOptions(ctx, relay, keys.AgentID(), d.name(), keys.PrivateKey, d.connectOptions(relay))
+}
+
+// probe checks that relay answers a handshake, without completing one.
+func (d *Daemon) probe(ctx context.Context, relay string, keys *keystore.Keys) error {
+	return client.Probe(ctx, relay, keys.AgentID(), d.name(), keys.PrivateKey, d.connectOptions(relay))
+}
+
+// connectOptions returns this daemon's options for connecting to relay.
+func (d *Daemon) connectOptions(relay string) client.ConnectOptions {
+	return client.ConnectOptions{
+		BufferSize:   d.bufferSize,
+		PingInterval: d.pingInterval,
+		Compression:  d.compression,
+		Header:       d.headersFor(relay),
+		Proxy:        d.proxy,
+
+		MaxPoWDifficulty: d.maxPoWDifficulty,
+	}
+}
+
+// newRelayHTTPClient builds the client for the relay's REST API, using the
+// same proxy as the relay connection.
+func (d *Daemon) newRelayHTTPClient() *http.Client {
+	proxy, err := client.ProxyFunc(d.proxy)
+	if err != nil {
+		// Start refuses an invalid proxy; fail requests rather than bypass it.
+		proxy = func(*http.Request) (*url.URL, error) { return nil, err }
+	}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.Proxy = proxy
+	return &http.Client{Transport: tr}
+}
+
+// relayHTTPClient returns the client for the relay's REST API.
+func (d *Daemon) relayHTTPClient() *http.Client {
+	if d.relayHTTP == nil {
+		return http.DefaultClient
+	}
+	return d.relayHTTP
+}
+
+// headersFor returns the headers to send to relay: the configured ones for
+// the primary, none for a failover relay, which mustn't see the primary's
+// credentials.
+func (d *Daemon) headersFor(relay string) http.Header {
+	if relay != d.relayList()[0] {
+		return nil
+	}
+	return d.relayHeaders.Clone()
+}
+
+// relayHeader converts configured relay headers to an http.Header, or nil
+// if there are none.
+func relayHeader(headers map[string]string) http.Header {
+	if len(headers) == 0 {
+		return nil
+	}
+	h := make(http.Header, len(headers))
+	for name, value := range headers {
+		h.Set(name, value)
+	}
+	return h
+}
+
+// dialRelays connects to the first relay that accepts, in configured order,
+// and returns which one it was. An auth rejection is returned at once: the
+// same key will not fare better elsewhere, and the caller must see it to halt.
+func (d *Daemon) dialRelays(keys *keystore.Keys) (*client.Client, string, error) {
+	var errs []string
+	for _, relay := range d.relayList() {
+		c, err := d.dial(context.Background(), relay, keys)
+		if err == nil {
+			return c, relay, nil
+		}
+		if errors.Is(err, client.ErrAuthRejected) || len(d.relayList()) == 1 {
+			return nil, "", err
+		}
+		log.Printf("relay %s unreachable: %v", relay, err)
+		errs = append(errs, relay+": "+err.Error())
+	}
+	return nil, "", fmt.Errorf("no relay reachable (%s)", strings.Join(errs, "; "))
+}
+
+// failBack periodically checks whether the primary relay is reachable again
+// while c is connected to a fallback. Probes stop at the relay's challenge,
+// so no proof-of-work is spent and no session left behind. Once one
+// succeeds, c is closed so the reconnect loop, which tries relays in order,
+// moves back to the primary.
+func (d *Daemon) failBack(c *client.Client, keys *keystore.Keys) {
+	done := make(chan struct{})
+	go func() {
+		c.Wait()
+		close(done)
+	}()
+	primary := d.relayList()[0]
+	ticker := time.NewTicker(failbackInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), failbackTimeout)
+		err := d.probe(ctx, primary, keys)
+		cancel()
+		if err != nil {
+			continue
+		}
+		log.Printf("primary relay %s is reachable again; failing back", primary)
+		c.Close()
+		return
+	}
+}
@@ -0,0 +1,144 @@
+package daemon
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/betta-lab/agentnet-openclaw/internal/keystore"
+)
+
+// handshakeRelay accepts any agent and then idles until the client leaves.
+func handshakeRelay(t *testing.T) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		ws.ReadMessage() // hello
+		ws.WriteJSON(map[string]interface{}{"type": "pow.challenge", "challenge": "c", "difficulty": 1})
+		ws.ReadMessage() // hello.pow
+		ws.WriteJSON(map[string]string{"type": "welcome"})
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+// deadRelay returns a relay URL nothing listens on.
+func deadRelay(t *testing.T) string {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+	srv.Close()
+	return url
+}
+
+func TestSplitRelays(t *testing.T) {
+	got := splitRelays(" wss://a/v1/ws, ,wss://b/v1/ws ")
+	if len(got) != 2 || got[0] != "wss://a/v1/ws" || got[1] != "wss://b/v1/ws" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestDialRelays_FallsThroughToNextRelay(t *testing.T) {
+	keys, err := keystore.LoadOrCreate(filepath.Join(t.TempDir(), "agent.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	secondary := handshakeRelay(t)
+	d := &Daemon{relays: []string{deadRelay(t), secondary}}
+
+	c, relay, err := d.dialRelays(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if relay != secondary {
+		t.Fatalf("connected to %s, want the secondary", relay)
+	}
+}
+
+func TestFailBack_ClosesFallbackOncePrimaryIsBack(t *testing.T) {
+	old := failbackInterval
+	failbackInterval = 20 * time.Millisecond
+	defer func() { failbackInterval = old }()
+
+	keys, err := keystore.LoadOrCreate(filepath.Join(t.TempDir(), "agent.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sessions atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		ws.ReadMessage() // hello
+		ws.WriteJSON(map[string]interface{}{"type": "pow.challenge", "challenge": "c", "difficulty": 1})
+		if _, _, err := ws.ReadMessage(); err == nil { // hello.pow
+			sessions.Add(1)
+		}
+	}))
+	defer srv.Close()
+	primary, secondary := "ws"+strings.TrimPrefix(srv.URL, "http"), handshakeRelay(t)
+	d := &Daemon{relays: []string{primary, secondary}}
+	c, err := d.dial(t.Context(), secondary, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go d.failBack(c, keys)
+	done := make(chan struct{})
+	go func() {
+		c.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		c.Close()
+		t.Fatal("fallback connection was not closed although the primary is reachable")
+	}
+	if n := sessions.Load(); n != 0 {
+		t.Fatalf("probes completed %d handshakes with the primary", n)
+	}
+}
+
+func TestHeadersFor_OnlyThePrimary(t *testing.T) {
+	d := &Daemon{
+		relays:       []string{"wss://primary/v1/ws", "wss://fallback/v1/ws"},
+		relayHeaders: relayHeader(map[string]string{"X-Api-Key": "secret"}),
+	}
+	if got := d.headersFor("wss://primary/v1/ws").Get("X-Api-Key"); got != "secret" {
+		t.Fatalf("primary got X-Api-Key %q", got)
+	}
+	if h := d.headersFor("wss://fallback/v1/ws"); h != nil {
+		t.Fatalf("fallback relay was sent %v", h)
+	}
+	if opts := d.connectOptions("wss://fallback/v1/ws"); opts.Header != nil {
+		t.Fatalf("fallback relay dialled with %v", opts.Header)
+	}
+}
+
+func TestRelayHeader(t *testing.T) {
+	if relayHeader(nil) != nil {
+		t.Fatal("no headers should give a nil header")
+	}
+	h := relayHeader(map[string]string{"x-api-key": "k", "Authorization": "Bearer t"})
+	if h.Get("X-Api-Key") != "k" || h.Get("Authorization") != "Bearer t" {
+		t.Fatalf("got %v", h)
+	}
+}
@@ -0,0 +1,128 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+
+	"github.com/betta-lab/agentnet-openclaw/internal/keystore"
+)
+
+// senderFilter decides which inbound senders reach the message buffer.
+// Matching is on agent ID, never display name, since names aren't unique.
+// A non-empty allowlist admits only its members; the blocklist always wins.
+type senderFilter struct {
+	Allow []string `json:"allow"`
+	Block []string `json:"block"`
+}
+
+func (f senderFilter) accepts(agentID string) bool {
+	for _, id := range f.Block {
+		if id == agentID {
+			return false
+		}
+	}
+	if len(f.Allow) == 0 {
+		return true
+	}
+	for _, id := range f.Allow {
+		if id == agentID {
+			return true
+		}
+	}
+	return false
+}
+
+// update adds or removes agentID from the named list ("allow" or "block").
+func (f *senderFilter) update(action, list, agentID string) error {
+	var ids *[]string
+	switch list {
+	case "allow":
+		ids = &f.Allow
+	case "block":
+		ids = &f.Block
+	default:
+		return fmt.Errorf("list must be allow or block")
+	}
+
+	kept := make([]string, 0, len(*ids)+1)
+	for _, id := range *ids {
+		if id != agentID {
+			kept = append(kept, id)
+		}
+	}
+	switch action {
+	case "add":
+		kept = append(kept, agentID)
+		sort.Strings(kept)
+	case "remove":
+	default:
+		return fmt.Errorf("action must be add or remove")
+	}
+	*ids = kept
+	return nil
+}
+
+func (d *Daemon) filterPath() string {
+	return d.statePath("filter.json")
+}
+
+// loadFilter restores the sender filter saved by a previous run.
+func (d *Daemon) loadFilter() error {
+	data, err := os.ReadFile(d.filterPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var f senderFilter
+	if err := json.Unmarshal(data, &f); err != nil {
+		return fmt.Errorf("%s: %w", d.filterPath(), err)
+	}
+	d.mu.Lock()
+	d.filter = f
+	d.mu.Unlock()
+	return nil
+}
+
+// saveFilter persists the sender filter. Failures are logged, not fatal.
+func (d *Daemon) saveFilter() {
+	d.mu.RLock()
+	data, _ := json.MarshalIndent(d.filter, "", "  ")
+	d.mu.RUnlock()
+	if err := keystore.WriteFileAtomic(d.filterPath(), data, 0600); err != nil {
+		log.Printf("save filter: %v", err)
+	}
+}
+
+// handleFilter lists the sender filter (GET) or adds/removes an agent ID (POST).
+func (d *Daemon) handleFilter(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		var req struct {
+			Action string `json:"action"` // "add" or "remove"
+			List   string `json:"list"`   // "allow" or "block"
+			Agent  string `json:"agent"`  // agent ID
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Agent == "" {
+			httpError(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		d.mu.Lock()
+		err := d.filter.update(req.Action, req.List, req.Agent)
+		d.mu.Unlock()
+		if err != nil {
+			httpErrorFor(w, err, http.StatusBadRequest)
+			return
+		}
+		d.saveFilter()
+	}
+
+	d.mu.RLock()
+	f := senderFilter{Allow: append([]string{}, d.filter.Allow...), Block: append([]string{}, d.filter.Block...)}
+	d.mu.RUnlock()
+	json.NewEncoder(w).Encode(f)
+}
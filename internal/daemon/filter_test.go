@@ -0,0 +1,69 @@
+package daemon
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSenderFilter_Accepts(t *testing.T) {
+	open := senderFilter{}
+	if !open.accepts("anyone") {
+		t.Fatal("empty filter should accept everyone")
+	}
+
+	blocked := senderFilter{Block: []string{"spammer"}}
+	if blocked.accepts("spammer") || !blocked.accepts("friend") {
+		t.Fatal("blocklist should drop only listed agents")
+	}
+
+	allowed := senderFilter{Allow: []string{"friend", "spammer"}, Block: []string{"spammer"}}
+	if !allowed.accepts("friend") || allowed.accepts("stranger") {
+		t.Fatal("allowlist should admit only listed agents")
+	}
+	if allowed.accepts("spammer") {
+		t.Fatal("blocklist should win over allowlist")
+	}
+}
+
+func TestSenderFilter_UpdateIdempotent(t *testing.T) {
+	var f senderFilter
+	f.update("add", "block", "b")
+	f.update("add", "block", "a")
+	f.update("add", "block", "a")
+	if strings.Join(f.Block, ",") != "a,b" {
+		t.Fatalf("blocklist: %v", f.Block)
+	}
+	f.update("remove", "block", "a")
+	if strings.Join(f.Block, ",") != "b" {
+		t.Fatalf("blocklist after remove: %v", f.Block)
+	}
+	if err := f.update("add", "maybe", "x"); err == nil {
+		t.Fatal("unknown list should error")
+	}
+}
+
+func TestHandleFilter_PersistsAndLists(t *testing.T) {
+	dir := t.TempDir()
+	d := &Daemon{keyPath: filepath.Join(dir, "agent.key")}
+
+	req := httptest.NewRequest("POST", "/filter", strings.NewReader(`{"action":"add","list":"block","agent":"spammer"}`))
+	w := httptest.NewRecorder()
+	d.handleFilter(w, req)
+
+	var got senderFilter
+	json.NewDecoder(w.Body).Decode(&got)
+	if len(got.Block) != 1 || got.Block[0] != "spammer" {
+		t.Fatalf("unexpected filter: %+v", got)
+	}
+
+	restored := &Daemon{keyPath: d.keyPath}
+	if err := restored.loadFilter(); err != nil {
+		t.Fatalf("loadFilter: %v", err)
+	}
+	if restored.filter.accepts("spammer") {
+		t.Fatal("filter not persisted")
+	}
+}
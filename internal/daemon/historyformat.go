@@ -0,0 +1,101 @@
+package daemon
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// historyTemplates are the built-in /history?format= templates, each applied
+// to one message; renderHistory ends each with a newline.
+var historyTemplates = map[string]string{
+	"plain":    `[{{.ts}}] {{.name}}: {{.text}}`,
+	"chatml":   "<|im_start|>user name={{oneline (chatml .name)}}\n{{chatml .text}}<|im_end|>",
+	"markdown": "**{{.name}}** · {{.ts}}\n\n{{.text}}\n",
+}
+
+// historyFuncs are available to history templates; json quotes a value, for
+// JSON-per-line output such as {"from":{{json .name}},"text":{{json .text}}}.
+// chatml strips ChatML's turn markers and oneline joins lines, so a peer's
+// name or text can't end its turn and start one of its own.
+var historyFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"chatml": func(s string) string {
+		for strings.Contains(s, "<|im_start|>") || strings.Contains(s, "<|im_end|>") {
+			s = chatmlMarkers.Replace(s)
+		}
+		return s
+	},
+	"oneline": func(s string) string {
+		return strings.Join(strings.Fields(s), " ")
+	},
+}
+
+var chatmlMarkers = strings.NewReplacer("<|im_start|>", "", "<|im_end|>", "")
+
+// parseHistoryFormat returns the template for format: a built-in name, or
+// else a text/template applied to each message.
+func parseHistoryFormat(format string) (*template.Template, error) {
+	text, ok := historyTemplates[format]
+	if !ok {
+		if !strings.Contains(format, "{{") {
+			names := make([]string, 0, len(historyTemplates))
+			for name := range historyTemplates {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("unknown format %q: use json, %s, or a template such as {{.name}}: {{.text}}", format, strings.Join(names, ", "))
+		}
+		text = format
+	}
+	// Misspelled fields fail instead of printing "<no value>" into a prompt,
+	// found by a trial run before anything is fetched.
+	tmpl, err := template.New("history").Funcs(historyFuncs).Option("missingkey=error").Parse(text)
+	if err == nil {
+		err = tmpl.Execute(io.Discard, historyRecord("room", RelayMessage{ID: "id", AgentID: "agent", Content: "text"}))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("bad format template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// renderHistory applies tmpl to msgs, oldest first. The fields are ts, name,
+// id, text, room, agent_id and in_reply_to (empty unless a reply).
+func renderHistory(tmpl *template.Template, room string, msgs []RelayMessage) ([]byte, error) {
+	msgs = append([]RelayMessage(nil), msgs...)
+	sort.SliceStable(msgs, func(i, j int) bool { return msgs[i].Timestamp < msgs[j].Timestamp })
+	var buf bytes.Buffer
+	for _, m := range msgs {
+		if err := tmpl.Execute(&buf, historyRecord(room, m)); err != nil {
+			return nil, fmt.Errorf("format template: %w", err)
+		}
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+// historyRecord is the data a history template is applied to for m.
+func historyRecord(room string, m RelayMessage) map[string]interface{} {
+	name := m.AgentName
+	if name == "" {
+		name = m.AgentID
+	}
+	return map[string]interface{}{
+		"ts":          time.UnixMilli(m.Timestamp).UTC().Format("2006-01-02 15:04:05"),
+		"name":        name,
+		"id":          m.ID,
+		"text":        parseRelayContent(m.Content),
+		"room":        room,
+		"agent_id":    m.AgentID,
+		"in_reply_to": m.InReplyTo,
+	}
+}
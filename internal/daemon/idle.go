@@ -0,0 +1,167 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/betta-lab/agentnet-openclaw/internal/keystore"
+)
+
+// maxIdleSweepInterval bounds how often idle rooms are looked for; shorter
+// timeouts are checked twice per timeout.
+const maxIdleSweepInterval = time.Minute
+
+// MinIdleRoomTimeout is the shortest Config.IdleRoomTimeout; New raises
+// shorter ones to it.
+const MinIdleRoomTimeout = time.Minute
+
+// noteRoomActive records that room was just joined or had an inbound
+// message, restarting its idle timeout. Must be called with d.mu held.
+func (d *Daemon) noteRoomActive(room string, now time.Time) {
+	if d.roomActivity == nil {
+		d.roomActivity = make(map[string]time.Time)
+	}
+	d.roomActivity[room] = now
+}
+
+// idleRooms returns the joined, unpinned rooms with no inbound message for
+// idleRoomTimeout. Rooms not seen yet, such as those rejoined at startup,
+// start their timeout now.
+func (d *Daemon) idleRooms(now time.Time) []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var idle []string
+	for room := range d.joinedRooms {
+		if d.pinnedRooms[room] {
+			continue
+		}
+		last, ok := d.roomActivity[room]
+		if !ok {
+			d.noteRoomActive(room, now)
+			continue
+		}
+		if now.Sub(last) >= d.idleRoomTimeout {
+			idle = append(idle, room)
+		}
+	}
+	sort.Strings(idle)
+	return idle
+}
+
+// leaveIdleRooms leaves the rooms idleRooms reports, as /rooms/leave would.
+// It does nothing while disconnected: rooms that go idle meanwhile are
+// rejoined on reconnect and left at the next sweep after it.
+func (d *Daemon) leaveIdleRooms(now time.Time) {
+	d.mu.RLock()
+	c := d.client
+	d.mu.RUnlock()
+	if c == nil {
+		return
+	}
+	for _, room := range d.idleRooms(now) {
+		if err := c.LeaveRoom(room); err != nil {
+			log.Printf("leave idle room %s: %v", room, err)
+			continue
+		}
+		log.Printf("left %s after %s without messages", room, d.idleRoomTimeout)
+		d.mu.Lock()
+		delete(d.joinedRooms, room)
+		delete(d.roomActivity, room)
+		d.mu.Unlock()
+		d.saveRooms()
+		d.setRoomToken(room, "")
+	}
+}
+
+// idleLoop leaves idle rooms until the process exits. It returns at once if
+// idleRoomTimeout is 0.
+func (d *Daemon) idleLoop() {
+	if d.idleRoomTimeout <= 0 {
+		return
+	}
+	ticker := time.NewTicker(min(d.idleRoomTimeout/2, maxIdleSweepInterval))
+	defer ticker.Stop()
+	for now := range ticker.C {
+		d.leaveIdleRooms(now)
+	}
+}
+
+// pinnedRoomsPath is where rooms exempt from idle leaving are kept.
+func (d *Daemon) pinnedRoomsPath() string {
+	return d.statePath("pinned_rooms.json")
+}
+
+// loadPinnedRooms restores the rooms pinned in a previous run.
+func (d *Daemon) loadPinnedRooms() error {
+	data, err := os.ReadFile(d.pinnedRoomsPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var rooms []string
+	if err := json.Unmarshal(data, &rooms); err != nil {
+		return fmt.Errorf("%s: %w", d.pinnedRoomsPath(), err)
+	}
+	d.mu.Lock()
+	d.pinnedRooms = make(map[string]bool, len(rooms))
+	for _, room := range rooms {
+		d.pinnedRooms[room] = true
+	}
+	d.mu.Unlock()
+	return nil
+}
+
+// pinnedList returns the pinned rooms, sorted.
+func (d *Daemon) pinnedList() []string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	rooms := make([]string, 0, len(d.pinnedRooms))
+	for room := range d.pinnedRooms {
+		rooms = append(rooms, room)
+	}
+	sort.Strings(rooms)
+	return rooms
+}
+
+// setPinned pins or unpins room and persists the set. Failures to save are
+// logged, not fatal.
+func (d *Daemon) setPinned(room string, pinned bool) {
+	d.mu.Lock()
+	if pinned {
+		if d.pinnedRooms == nil {
+			d.pinnedRooms = make(map[string]bool)
+		}
+		d.pinnedRooms[room] = true
+	} else {
+		delete(d.pinnedRooms, room)
+	}
+	d.mu.Unlock()
+	data, _ := json.MarshalIndent(d.pinnedList(), "", "  ")
+	if err := keystore.WriteFileAtomic(d.pinnedRoomsPath(), data, 0600); err != nil {
+		log.Printf("save pinned rooms: %v", err)
+	}
+}
+
+// handleRoomPin lists pinned rooms (GET), or pins a room so idle leaving
+// never leaves it (POST {"room": ...}); "remove": true unpins it.
+func (d *Daemon) handleRoomPin(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		var req struct {
+			Room   string `json:"room"`
+			Remove bool   `json:"remove"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Room == "" {
+			httpError(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		d.setPinned(req.Room, !req.Remove)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"rooms": d.pinnedList()})
+}
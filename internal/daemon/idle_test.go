@@ -0,0 +1,83 @@
+package daemon
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIdleRooms(t *testing.T) {
+	now := time.Now()
+	d := &Daemon{
+		idleRoomTimeout: time.Hour,
+		joinedRooms:     map[string]bool{"quiet": true, "busy": true, "pinned": true, "rejoined": true},
+		pinnedRooms:     map[string]bool{"pinned": true},
+		roomActivity: map[string]time.Time{
+			"quiet":  now.Add(-2 * time.Hour),
+			"busy":   now.Add(-time.Minute),
+			"pinned": now.Add(-2 * time.Hour),
+		},
+	}
+	if got := d.idleRooms(now); !slices.Equal(got, []string{"quiet"}) {
+		t.Fatalf("got %v", got)
+	}
+	// A room without activity, rejoined at startup, starts its timeout now.
+	if !d.roomActivity["rejoined"].Equal(now) {
+		t.Fatal("expected the rejoined room's timeout to start")
+	}
+	if got := d.idleRooms(now.Add(time.Hour)); !slices.Equal(got, []string{"busy", "quiet", "rejoined"}) {
+		t.Fatalf("an hour later: got %v", got)
+	}
+}
+
+func TestNew_IdleRoomTimeoutMinimum(t *testing.T) {
+	for timeout, want := range map[time.Duration]time.Duration{
+		0:               0,
+		time.Nanosecond: MinIdleRoomTimeout,
+		time.Second:     MinIdleRoomTimeout,
+		6 * time.Hour:   6 * time.Hour,
+	} {
+		if got := New(Config{DataDir: t.TempDir(), IdleRoomTimeout: timeout}).idleRoomTimeout; got != want {
+			t.Errorf("%v: got %v, want %v", timeout, got, want)
+		}
+	}
+}
+
+func TestRoomPin_Persists(t *testing.T) {
+	dir := t.TempDir()
+	d := &Daemon{keyPath: filepath.Join(dir, "agent.key")}
+	pin := func(body string) []string {
+		w := httptest.NewRecorder()
+		d.handleRoomPin(w, httptest.NewRequest("POST", "/rooms/pin", strings.NewReader(body)))
+		var resp struct {
+			Rooms []string `json:"rooms"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp.Rooms
+	}
+	pin(`{"room":"ops"}`)
+	if got := pin(`{"room":"lab"}`); !slices.Equal(got, []string{"lab", "ops"}) {
+		t.Fatalf("got %v", got)
+	}
+	if got := pin(`{"room":"ops","remove":true}`); !slices.Equal(got, []string{"lab"}) {
+		t.Fatalf("after unpinning: got %v", got)
+	}
+
+	restarted := &Daemon{keyPath: d.keyPath}
+	if err := restarted.loadPinnedRooms(); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(restarted.pinnedList(), []string{"lab"}) {
+		t.Fatalf("after restart: got %v", restarted.pinnedList())
+	}
+
+	w := httptest.NewRecorder()
+	d.handleRoomPin(w, httptest.NewRequest("POST", "/rooms/pin", strings.NewReader(`{}`)))
+	if w.Code != 400 {
+		t.Fatalf("missing room: got %d, want 400", w.Code)
+	}
+}
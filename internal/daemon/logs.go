@@ -0,0 +1,148 @@
+package daemon
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Daemon log file settings.
+const (
+	logFileName     = "daemon.log"
+	maxLogFileSize  = 10 << 20 // rotate to daemon.log.1 beyond this
+	defaultLogLines = 200
+	maxLogLines     = 10000
+	logPollInterval = 500 * time.Millisecond
+)
+
+// logFile appends to a file, moving it to path+".1" (replacing any older
+// one) and starting afresh once it would exceed max bytes.
+type logFile struct {
+	mu   sync.Mutex
+	path string
+	max  int64
+	f    *os.File
+	size int64
+}
+
+func openLogFile(path string, max int64) (*logFile, error) {
+	l := &logFile{path: path, max: max}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *logFile) open() error {
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.f, l.size = f, info.Size()
+	return nil
+}
+
+func (l *logFile) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.size > 0 && l.size+int64(len(p)) > l.max {
+		l.f.Close()
+		os.Rename(l.path, l.path+".1")
+		if err := l.open(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := l.f.Write(p)
+	l.size += int64(n)
+	return n, err
+}
+
+// handleLogs returns the last ?lines= lines of the daemon log (default 200).
+// With ?follow=true it keeps the response open and streams lines as they are
+// written, following the file across rotation.
+func (d *Daemon) handleLogs(w http.ResponseWriter, r *http.Request) {
+	if d.logPath == "" {
+		httpError(w, "daemon is not logging to a file (start it with AGENTNET_LOG_FILE=1)", http.StatusNotFound)
+		return
+	}
+	lines := defaultLogLines
+	if v := r.URL.Query().Get("lines"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > maxLogLines {
+			httpError(w, "lines must be between 0 and 10000", http.StatusBadRequest)
+			return
+		}
+		lines = n
+	}
+
+	data, err := os.ReadFile(d.logPath)
+	if err != nil && !os.IsNotExist(err) {
+		httpErrorFor(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(tailLines(data, lines))
+	offset := int64(len(data))
+
+	flusher, ok := w.(http.Flusher)
+	if r.URL.Query().Get("follow") != "true" || !ok {
+		return
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(logPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+		info, err := os.Stat(d.logPath)
+		if err != nil {
+			continue
+		}
+		if info.Size() < offset {
+			offset = 0 // rotated: the file started over
+		}
+		if info.Size() == offset {
+			continue
+		}
+		f, err := os.Open(d.logPath)
+		if err != nil {
+			continue
+		}
+		n, _ := io.Copy(w, io.NewSectionReader(f, offset, info.Size()-offset))
+		f.Close()
+		offset += n
+		flusher.Flush()
+	}
+}
+
+// tailLines returns the last n lines of data.
+func tailLines(data []byte, n int) []byte {
+	if n == 0 {
+		return nil
+	}
+	i := len(data)
+	if i > 0 && data[i-1] == '\n' {
+		i-- // the final newline doesn't start another line
+	}
+	for ; n > 0; n-- {
+		j := bytes.LastIndexByte(data[:i], '\n')
+		if j < 0 {
+			return data
+		}
+		i = j
+	}
+	return data[i+1:]
+}
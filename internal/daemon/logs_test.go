@@ -0,0 +1,50 @@
+package daemon
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLogFile_Rotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), logFileName)
+	lf, err := openLogFile(path, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lf.Write([]byte("first line 123\n"))
+	lf.Write([]byte("second line 45\n")) // would exceed 20 bytes
+
+	old, _ := os.ReadFile(path + ".1")
+	cur, _ := os.ReadFile(path)
+	if string(old) != "first line 123\n" || string(cur) != "second line 45\n" {
+		t.Fatalf("rotated %q, current %q", old, cur)
+	}
+}
+
+func TestLogs_Tail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), logFileName)
+	os.WriteFile(path, []byte("one\ntwo\nthree\n"), 0600)
+	d := &Daemon{logPath: path}
+
+	w := httptest.NewRecorder()
+	d.handleLogs(w, httptest.NewRequest("GET", "/logs?lines=2", nil))
+	if w.Body.String() != "two\nthree\n" {
+		t.Fatalf("unexpected tail %q", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	d.handleLogs(w, httptest.NewRequest("GET", "/logs", nil))
+	if w.Body.String() != "one\ntwo\nthree\n" {
+		t.Fatalf("short file should be returned whole, got %q", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	(&Daemon{}).handleLogs(w, httptest.NewRequest("GET", "/logs", nil))
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "AGENTNET_LOG_FILE") {
+		t.Fatalf("expected 404 with a hint when file logging is off, got %d %q", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,113 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// daemonRunning reports whether pid is a live agentnet process; tests
+// replace it.
+var daemonRunning = isDaemonProcess
+
+// isDaemonProcess reports whether a process with this PID exists and, where
+// /proc says what it runs, runs the same program as this one. That tells a
+// PID reused by something else after a crash from a running daemon.
+func isDaemonProcess(pid int) bool {
+	if !processAlive(pid) {
+		return false
+	}
+	self, err := os.ReadFile("/proc/self/comm")
+	if err != nil {
+		return true // no /proc: a live process is all we can tell
+	}
+	comm, err := os.ReadFile(fmt.Sprintf("/proc/%d/comm", pid))
+	if err != nil {
+		return !os.IsNotExist(err) // gone since, or hidden from us
+	}
+	return string(comm) == string(self)
+}
+
+// processAlive reports whether a process with this PID exists.
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		return true // FindProcess already failed for a dead one
+	}
+	// Signal 0 checks for existence; EPERM means it exists but isn't ours.
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// claimPIDFile records this process in the PID file, refusing to start
+// while it names another running daemon. The file is linked into place
+// complete and only if absent, so of two daemons starting together only one
+// gets it; a stale one (its process gone, or garbage) is removed and claimed
+// again. One naming this process, as left by
+// "nohup agentnet daemon & echo $! > ...", is ours already. Failures to
+// write, e.g. on a read-only mount, are logged, not fatal.
+func (d *Daemon) claimPIDFile() error {
+	if d.pidFile == "" {
+		return nil
+	}
+	own := strconv.Itoa(os.Getpid())
+	tmp, err := os.CreateTemp(filepath.Dir(d.pidFile), "."+filepath.Base(d.pidFile)+".tmp-*")
+	if err != nil {
+		log.Printf("could not write PID file: %v", err)
+		return nil
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.WriteString(own)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		log.Printf("could not write PID file: %v", err)
+		return nil
+	}
+
+	for attempt := 0; attempt < 3; attempt++ {
+		err := os.Link(tmp.Name(), d.pidFile)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			log.Printf("could not write PID file: %v", err)
+			return nil
+		}
+		data, err := os.ReadFile(d.pidFile)
+		if err != nil {
+			continue // removed since
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		if err == nil && pid == os.Getpid() {
+			return nil
+		}
+		if err == nil && pid > 0 && daemonRunning(pid) {
+			return fmt.Errorf("daemon already running (pid %d, per %s); stop it first, or give this one its own data dir", pid, d.pidFile)
+		}
+		os.Remove(d.pidFile) // stale
+	}
+	return fmt.Errorf("could not claim %s: another daemon is starting", d.pidFile)
+}
+
+// removePIDFile deletes the PID file on a clean stop, unless another
+// process has claimed it since.
+func (d *Daemon) removePIDFile() {
+	if d.pidFile == "" {
+		return
+	}
+	data, err := os.ReadFile(d.pidFile)
+	if err == nil && strings.TrimSpace(string(data)) == strconv.Itoa(os.Getpid()) {
+		os.Remove(d.pidFile)
+	}
+}
@@ -0,0 +1,85 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestClaimPIDFile(t *testing.T) {
+	old := daemonRunning
+	defer func() { daemonRunning = old }()
+	running := map[int]bool{4242: true}
+	daemonRunning = func(pid int) bool { return running[pid] }
+
+	path := filepath.Join(t.TempDir(), "daemon.pid")
+	d := &Daemon{pidFile: path}
+	own := strconv.Itoa(os.Getpid())
+	if err := d.claimPIDFile(); err != nil {
+		t.Fatalf("missing file: %v", err)
+	}
+	for name, content := range map[string]string{
+		"own pid": own,
+		"stale":   "4343",
+		"garbage": "not a pid",
+	} {
+		os.WriteFile(path, []byte(content), 0600)
+		if err := d.claimPIDFile(); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if data, _ := os.ReadFile(path); string(data) != own {
+			t.Fatalf("%s: file holds %q, want this process", name, data)
+		}
+	}
+
+	os.WriteFile(path, []byte("4242\n"), 0600)
+	if err := d.claimPIDFile(); err == nil || !strings.Contains(err.Error(), "daemon already running (pid 4242") {
+		t.Fatalf("live daemon: got %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "4242\n" {
+		t.Fatalf("live daemon's file replaced with %q", data)
+	}
+	if err := (&Daemon{}).claimPIDFile(); err != nil {
+		t.Fatalf("disabled: %v", err)
+	}
+	if tmps, _ := filepath.Glob(filepath.Join(filepath.Dir(path), ".daemon.pid.tmp-*")); len(tmps) != 0 {
+		t.Fatalf("temporary files left: %v", tmps)
+	}
+}
+
+func TestIsDaemonProcess(t *testing.T) {
+	if !isDaemonProcess(os.Getpid()) {
+		t.Fatal("this process should count as running")
+	}
+	if isDaemonProcess(2147483646) {
+		t.Fatal("a PID nothing has should not")
+	}
+	// The go tool that started the test binary runs a different program.
+	if _, err := os.Stat("/proc/self/comm"); err == nil && isDaemonProcess(os.Getppid()) {
+		t.Fatal("another program's process counted as a daemon")
+	}
+}
+
+func TestPIDFile_WriteAndRemove(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "daemon.pid")
+	d := &Daemon{pidFile: path}
+	d.claimPIDFile()
+	if data, _ := os.ReadFile(path); string(data) != strconv.Itoa(os.Getpid()) {
+		t.Fatalf("got %q", data)
+	}
+	d.removePIDFile()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("PID file kept: %v", err)
+	}
+
+	// A file claimed by another daemon since is left alone.
+	os.WriteFile(path, []byte("1"), 0600)
+	d.removePIDFile()
+	if _, err := os.Stat(path); err != nil {
+		t.Fatal("removed another daemon's PID file")
+	}
+
+	(&Daemon{}).claimPIDFile() // disabled: no file anywhere
+}
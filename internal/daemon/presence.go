@@ -0,0 +1,95 @@
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/betta-lab/agentnet-openclaw/internal/client"
+)
+
+// Presence limits.
+const (
+	maxPresenceIDs = 100
+	presenceWindow = 5 * time.Minute // recent activity that counts as online when inferring
+)
+
+// noteActive records that agentID did something at ts (Unix milliseconds).
+// Must be called with d.mu held.
+func (d *Daemon) noteActive(agentID string, ts int64) {
+	if agentID == "" {
+		return
+	}
+	if d.lastActive == nil {
+		d.lastActive = make(map[string]int64)
+	}
+	if ts > d.lastActive[agentID] {
+		d.lastActive[agentID] = ts
+	}
+}
+
+// handlePresence reports whether the agents in ?ids=a,b,c are online. The
+// relay is asked first; relays without presence support get an answer
+// inferred from what this daemon has seen: an agent is online if it is a
+// member of a room we're in or sent a message or typing event within
+// presenceWindow. "source" says which applies.
+func (d *Daemon) handlePresence(w http.ResponseWriter, r *http.Request) {
+	var ids []string
+	for _, id := range strings.Split(r.URL.Query().Get("ids"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		httpError(w, "ids parameter required", http.StatusBadRequest)
+		return
+	}
+	if len(ids) > maxPresenceIDs {
+		httpError(w, "too many ids", http.StatusBadRequest)
+		return
+	}
+
+	d.mu.RLock()
+	c := d.client
+	d.mu.RUnlock()
+	if c == nil {
+		notConnected(w)
+		return
+	}
+
+	online, err := c.Presence(ids)
+	if err == nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{"source": "relay", "online": online})
+		return
+	}
+	if !errors.Is(err, client.ErrPresenceUnsupported) {
+		httpErrorFor(w, err, http.StatusBadGateway)
+		return
+	}
+
+	members := map[string]bool{}
+	for _, room := range c.JoinedRooms() {
+		for _, m := range c.Members(room) {
+			members[m.ID] = true
+		}
+	}
+	cutoff := time.Now().Add(-presenceWindow).UnixMilli()
+	online = make(map[string]bool, len(ids))
+	lastSeen := map[string]int64{}
+	d.mu.RLock()
+	for _, id := range ids {
+		seen := d.lastActive[id]
+		online[id] = members[id] || seen >= cutoff
+		if seen > 0 {
+			lastSeen[id] = seen
+		}
+	}
+	d.mu.RUnlock()
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"source":    "inferred",
+		"online":    online,
+		"last_seen": lastSeen,
+	})
+}
@@ -0,0 +1,32 @@
+package daemon
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNoteActive_KeepsNewest(t *testing.T) {
+	d := &Daemon{}
+	d.noteActive("alice", 2000)
+	d.noteActive("alice", 1000) // replayed older message
+	d.noteActive("", 3000)
+	if d.lastActive["alice"] != 2000 || len(d.lastActive) != 1 {
+		t.Fatalf("unexpected activity %v", d.lastActive)
+	}
+}
+
+func TestPresence_RequiresIDs(t *testing.T) {
+	d := &Daemon{}
+	w := httptest.NewRecorder()
+	d.handlePresence(w, httptest.NewRequest("GET", "/presence?ids=,", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	d.handlePresence(w, httptest.NewRequest("GET", "/presence?ids=alice", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 when not connected, got %d", w.Code)
+	}
+}
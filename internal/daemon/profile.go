@@ -0,0 +1,125 @@
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/betta-lab/agentnet-openclaw/internal/client"
+	"github.com/betta-lab/agentnet-openclaw/internal/keystore"
+)
+
+// profilePath is where a name chosen with /profile is kept. It takes
+// precedence over AGENTNET_NAME so a rename survives restarts.
+func (d *Daemon) profilePath() string {
+	return d.statePath("profile.json")
+}
+
+type profile struct {
+	Name string `json:"name"`
+}
+
+// loadProfile restores a display name set by a previous run.
+func (d *Daemon) loadProfile() error {
+	data, err := os.ReadFile(d.profilePath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var p profile
+	if err := json.Unmarshal(data, &p); err != nil {
+		return fmt.Errorf("%s: %w", d.profilePath(), err)
+	}
+	if err := client.ValidateName(p.Name); err != nil {
+		return fmt.Errorf("%s: %w", d.profilePath(), err)
+	}
+	d.mu.Lock()
+	d.agentName = p.Name
+	d.mu.Unlock()
+	return nil
+}
+
+// saveProfile persists the display name.
+func (d *Daemon) saveProfile(name string) error {
+	data, _ := json.MarshalIndent(profile{Name: name}, "", "  ")
+	return keystore.WriteFileAtomic(d.profilePath(), data, 0600)
+}
+
+// name returns the agent's display name.
+func (d *Daemon) name() string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.agentName
+}
+
+// identityName returns the AGENTNET_IDENTITIES name of an extra identity,
+// which unlike its display name never changes, or "" for the primary.
+func (d *Daemon) identityName() string {
+	if d.parent == nil {
+		return ""
+	}
+	return strings.TrimSuffix(filepath.Base(d.keyPath), ".key")
+}
+
+// handleProfile returns the display name (GET) or changes it on the relay
+// and persists it (PUT {"name":"..."}).
+func (d *Daemon) handleProfile(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		json.NewEncoder(w).Encode(profile{Name: d.name()})
+		return
+	case http.MethodPut, http.MethodPost:
+	default:
+		httpError(w, "GET or PUT only", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req profile
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if err := client.ValidateName(req.Name); err != nil {
+		httpErrorFor(w, err, http.StatusBadRequest)
+		return
+	}
+	d.mu.RLock()
+	c := d.client
+	d.mu.RUnlock()
+	if c == nil {
+		notConnected(w)
+		return
+	}
+	if err := c.SetName(req.Name); err != nil {
+		status := http.StatusBadGateway
+		switch {
+		case errors.Is(err, client.ErrReadOnly):
+			status = http.StatusForbidden
+		case errors.Is(err, client.ErrInvalidName):
+			status = http.StatusBadRequest
+		case errors.Is(err, client.ErrProfileUnsupported):
+			status = http.StatusNotImplemented
+		}
+		httpErrorFor(w, err, status)
+		return
+	}
+
+	d.mu.Lock()
+	old := d.agentName
+	d.agentName = req.Name
+	d.mu.Unlock()
+	log.Printf("agent name: %s → %s", old, req.Name)
+	if err := d.saveProfile(req.Name); err != nil {
+		log.Printf("save profile: %v", err)
+		httpErrorFor(w, fmt.Errorf("renamed, but not saved for the next start: %w", err), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(profile{Name: req.Name})
+}
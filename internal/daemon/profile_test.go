@@ -0,0 +1,57 @@
+package daemon
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProfile_GetAndValidate(t *testing.T) {
+	d := &Daemon{agentName: "alice"}
+
+	w := httptest.NewRecorder()
+	d.handleProfile(w, httptest.NewRequest("GET", "/profile", nil))
+	if !strings.Contains(w.Body.String(), `"name":"alice"`) {
+		t.Fatalf("got %s", w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	d.handleProfile(w, httptest.NewRequest("PUT", "/profile", strings.NewReader(`{"name":"@bob"}`)))
+	if w.Code != 400 || !strings.Contains(w.Body.String(), codeInvalidName) {
+		t.Fatalf("invalid name: got %d %s", w.Code, w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	d.handleProfile(w, httptest.NewRequest("PUT", "/profile", strings.NewReader(`{"name":"bob"}`)))
+	if w.Code != 503 {
+		t.Fatalf("disconnected: got %d %s", w.Code, w.Body)
+	}
+	if d.name() != "alice" {
+		t.Fatalf("name changed to %q without the relay", d.name())
+	}
+}
+
+func TestProfile_SurvivesRestart(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "agent.key")
+	d := &Daemon{keyPath: keyPath, agentName: "alice"}
+	if err := d.saveProfile("bob"); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := &Daemon{keyPath: keyPath, agentName: "alice"} // AGENTNET_NAME unchanged
+	if err := restarted.loadProfile(); err != nil {
+		t.Fatal(err)
+	}
+	if restarted.name() != "bob" {
+		t.Fatalf("got %q, want the saved name", restarted.name())
+	}
+}
+
+func TestIdentityName(t *testing.T) {
+	root := &Daemon{keyPath: "/data/agent.key"}
+	id := &Daemon{keyPath: "/data/identities/scout.key", parent: root, agentName: "Renamed Scout"}
+	if root.identityName() != "" || id.identityName() != "scout" {
+		t.Fatalf("got %q and %q", root.identityName(), id.identityName())
+	}
+}
@@ -0,0 +1,102 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/betta-lab/agentnet-openclaw/internal/client"
+	"github.com/betta-lab/agentnet-openclaw/internal/keystore"
+)
+
+// defaultOutboxSize is the outbound queue size used when QueueWhileDisconnected
+// is set without an explicit OutboundQueueSize.
+const defaultOutboxSize = 100
+
+// outboxPath is where sends still waiting for a connection are kept, so they
+// survive a daemon restart. Their content is stored unencrypted.
+func (d *Daemon) outboxPath() string {
+	return d.statePath("outbox.json")
+}
+
+// loadOutbox restores messages queued by a previous run and persists the
+// queue from then on.
+func (d *Daemon) loadOutbox() error {
+	if d.outbox == nil {
+		return nil
+	}
+	defer d.outbox.SetOnChange(d.saveOutbox)
+	data, err := os.ReadFile(d.outboxPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var msgs []client.QueuedMessage
+	if err := json.Unmarshal(data, &msgs); err != nil {
+		return fmt.Errorf("%s: %w", d.outboxPath(), err)
+	}
+	d.outbox.Restore(msgs)
+	if len(msgs) > 0 {
+		log.Printf("restored %d queued messages", len(msgs))
+	}
+	return nil
+}
+
+// saveOutbox persists the outbound queue. Failures are logged, not fatal.
+func (d *Daemon) saveOutbox() {
+	d.outboxMu.Lock()
+	defer d.outboxMu.Unlock()
+	data, _ := json.MarshalIndent(d.outbox.Pending(), "", "  ")
+	if err := keystore.WriteFileAtomic(d.outboxPath(), data, 0600); err != nil {
+		log.Printf("save outbox: %v", err)
+	}
+}
+
+// handleQueue lists the sends waiting for a connection (GET), or resends
+// ({"action":"flush"}) or discards ({"action":"clear"}) them (POST).
+func (d *Daemon) handleQueue(w http.ResponseWriter, r *http.Request) {
+	if d.outbox == nil {
+		httpError(w, "outbound queue is disabled (start the daemon with AGENTNET_QUEUE_WHILE_DISCONNECTED=1)", http.StatusNotFound)
+		return
+	}
+	if r.Method != http.MethodPost {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"queued":   d.outbox.Len(),
+			"dropped":  d.outbox.Dropped(),
+			"messages": d.outbox.Pending(),
+		})
+		return
+	}
+
+	var req struct {
+		Action string `json:"action"` // "flush" or "clear"
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	switch req.Action {
+	case "flush":
+		d.mu.RLock()
+		c := d.client
+		d.mu.RUnlock()
+		if c == nil {
+			notConnected(w)
+			return
+		}
+		n, err := c.FlushOutbox()
+		if err != nil {
+			httpErrorFor(w, fmt.Errorf("resent %d, the rest stay queued: %w", n, err), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"sent": n, "queued": d.outbox.Len()})
+	case "clear":
+		json.NewEncoder(w).Encode(map[string]interface{}{"cleared": d.outbox.Clear()})
+	default:
+		httpError(w, "action must be flush or clear", http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,167 @@
+package daemon
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/betta-lab/agentnet-openclaw/internal/keystore"
+	"github.com/gorilla/websocket"
+)
+
+func TestOutbox_PersistsAcrossRestart(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "agent.key")
+	d := &Daemon{keyPath: keyPath, outboxSize: 5}
+	d.outbox = d.newOutbox()
+	if err := d.loadOutbox(); err != nil {
+		t.Fatal(err)
+	}
+	id, err := d.outbox.Enqueue("test", map[string]interface{}{"type": "text", "text": "hello"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := &Daemon{keyPath: keyPath, outboxSize: 5}
+	restarted.outbox = restarted.newOutbox()
+	if err := restarted.loadOutbox(); err != nil {
+		t.Fatal(err)
+	}
+	pending := restarted.outbox.Pending()
+	if len(pending) != 1 || pending[0].ID != id || pending[0].Content["text"] != "hello" {
+		t.Fatalf("expected the queued message back under its ID, got %+v", pending)
+	}
+
+	restarted.outbox.Clear()
+	again := &Daemon{keyPath: keyPath, outboxSize: 5}
+	again.outbox = again.newOutbox()
+	again.loadOutbox()
+	if again.outbox.Len() != 0 {
+		t.Fatalf("cleared queue came back with %d messages", again.outbox.Len())
+	}
+}
+
+func TestQueue_ListAndClear(t *testing.T) {
+	d := &Daemon{outboxSize: 5}
+	d.outbox = d.newOutbox()
+	d.outbox.Enqueue("test", map[string]interface{}{"type": "text", "text": "hello"}, "")
+
+	w := httptest.NewRecorder()
+	d.handleQueue(w, httptest.NewRequest("GET", "/queue", nil))
+	var list struct {
+		Queued   int `json:"queued"`
+		Messages []struct {
+			ID   string `json:"id"`
+			Room string `json:"room"`
+		} `json:"messages"`
+	}
+	json.NewDecoder(w.Body).Decode(&list)
+	if list.Queued != 1 || len(list.Messages) != 1 || list.Messages[0].Room != "test" {
+		t.Fatalf("unexpected listing %+v", list)
+	}
+
+	// Flushing needs a connection.
+	w = httptest.NewRecorder()
+	d.handleQueue(w, httptest.NewRequest("POST", "/queue", strings.NewReader(`{"action":"flush"}`)))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 flushing while disconnected, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	d.handleQueue(w, httptest.NewRequest("POST", "/queue", strings.NewReader(`{"action":"clear"}`)))
+	var cleared map[string]int
+	json.NewDecoder(w.Body).Decode(&cleared)
+	if cleared["cleared"] != 1 || d.outbox.Len() != 0 {
+		t.Fatalf("expected 1 cleared, got %v (%d left)", cleared, d.outbox.Len())
+	}
+}
+
+func TestQueue_DisabledByDefault(t *testing.T) {
+	d := New(Config{DataDir: t.TempDir()})
+	if d.outbox != nil {
+		t.Fatal("queueing should be opt-in")
+	}
+	w := httptest.NewRecorder()
+	d.handleQueue(w, httptest.NewRequest("GET", "/queue", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", w.Code)
+	}
+	if d := New(Config{DataDir: t.TempDir(), QueueWhileDisconnected: true}); d.outbox == nil {
+		t.Fatal("QueueWhileDisconnected should enable the queue")
+	}
+}
+
+func TestOutbox_ReadOnlyDaemonSendsNothing(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "agent.key")
+	keys, err := keystore.LoadOrCreate(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queued := &Daemon{keyPath: keyPath, outboxSize: 5}
+	queued.outbox = queued.newOutbox()
+	queued.loadOutbox()
+	queued.outbox.Enqueue("test", map[string]interface{}{"type": "text", "text": "hello"}, "")
+
+	sent := make(chan string, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		ws.ReadMessage() // hello
+		ws.WriteJSON(map[string]interface{}{"type": "pow.challenge", "challenge": "c", "difficulty": 1})
+		ws.ReadMessage() // hello.pow
+		ws.WriteJSON(map[string]string{"type": "welcome"})
+		for {
+			var msg struct {
+				Type string `json:"type"`
+			}
+			if err := ws.ReadJSON(&msg); err != nil {
+				return
+			}
+			if msg.Type != "ping" {
+				sent <- msg.Type
+			}
+		}
+	}))
+	defer srv.Close()
+
+	// Restarted read-only over the persisted queue.
+	d := &Daemon{
+		keyPath:     keyPath,
+		keys:        keys,
+		relay:       "ws" + strings.TrimPrefix(srv.URL, "http"),
+		joinedRooms: map[string]bool{},
+		readOnly:    true,
+		outboxSize:  5,
+	}
+	d.outbox = d.newOutbox()
+	if err := d.loadOutbox(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.connectAndRejoin(); err != nil {
+		t.Fatal(err)
+	}
+	defer d.client.Close()
+
+	w := httptest.NewRecorder()
+	d.writeOp(d.handleQueue)(w, httptest.NewRequest("POST", "/queue", strings.NewReader(`{"action":"flush"}`)))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("flush: got %d, want 403", w.Code)
+	}
+	if _, err := d.client.FlushOutbox(); err == nil {
+		t.Fatal("a read-only client flushed its outbox")
+	}
+	select {
+	case typ := <-sent:
+		t.Fatalf("read-only daemon sent %q", typ)
+	case <-time.After(200 * time.Millisecond):
+	}
+	if d.outbox.Len() != 1 {
+		t.Fatalf("queue has %d messages, want it kept", d.outbox.Len())
+	}
+}
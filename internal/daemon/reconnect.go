@@ -0,0 +1,50 @@
+package daemon
+
+import (
+	"log"
+	"net/http"
+	"time"
+)
+
+// ReconnectWait is how long /reconnect waits for the new connection before
+// reporting the status anyway.
+const ReconnectWait = 30 * time.Second
+
+// reconnectWait is ReconnectWait, replaceable in tests.
+var reconnectWait = ReconnectWait
+
+// handleReconnect drops the relay connection so reconnectLoop dials again and
+// rejoins, for a connection that is open but no longer answered. Unlike a
+// restart it keeps the message buffer and PID. It responds with /status once
+// reconnected, or after reconnectWait while still reconnecting.
+func (d *Daemon) handleReconnect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httpError(w, "POST only", http.StatusMethodNotAllowed)
+		return
+	}
+	d.mu.RLock()
+	old, halted := d.client, d.halted
+	d.mu.RUnlock()
+	if halted != "" {
+		httpError(w, "the daemon stopped reconnecting ("+halted+"); restart it", http.StatusConflict)
+		return
+	}
+	if old == nil {
+		notConnected(w) // reconnectLoop is already at it
+		return
+	}
+
+	log.Printf("reconnect requested; dropping the relay connection")
+	old.Close()
+	deadline := time.Now().Add(reconnectWait)
+	for time.Now().Before(deadline) {
+		d.mu.RLock()
+		c := d.client
+		d.mu.RUnlock()
+		if c != nil && c != old {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	d.handleStatus(w, r)
+}
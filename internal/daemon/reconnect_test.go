@@ -0,0 +1,76 @@
+package daemon
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/betta-lab/agentnet-openclaw/internal/keystore"
+)
+
+func TestReconnect_ReplacesConnection(t *testing.T) {
+	origSleep := sleep
+	defer func() { sleep = origSleep }()
+	sleep = func(time.Duration) {}
+
+	d := New(Config{DataDir: t.TempDir(), RelayURL: handshakeRelay(t)})
+	keys, err := keystore.LoadOrCreate(d.keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.keys = keys
+	if err := d.connectAndRejoin(); err != nil {
+		t.Fatal(err)
+	}
+	old := d.client
+	stopped := make(chan struct{})
+	go func() {
+		d.reconnectLoop()
+		close(stopped)
+	}()
+	defer func() {
+		d.mu.Lock()
+		d.halted = "test done" // stop reconnectLoop after the next drop
+		c := d.client
+		d.mu.Unlock()
+		if c != nil {
+			c.Close()
+		}
+		<-stopped
+	}()
+
+	w := httptest.NewRecorder()
+	d.handleReconnect(w, httptest.NewRequest("POST", "/reconnect", nil))
+	var resp struct {
+		Connected bool   `json:"connected"`
+		State     string `json:"state"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("%v: %s", err, w.Body)
+	}
+	if !resp.Connected || resp.State != "connected" {
+		t.Fatalf("got %s", w.Body)
+	}
+	d.mu.RLock()
+	replaced := d.client != old
+	d.mu.RUnlock()
+	if !replaced {
+		t.Fatal("expected a new relay connection")
+	}
+}
+
+func TestReconnect_NotConnected(t *testing.T) {
+	d := &Daemon{}
+	w := httptest.NewRecorder()
+	d.handleReconnect(w, httptest.NewRequest("POST", "/reconnect", nil))
+	if w.Code != 503 {
+		t.Fatalf("got %d, want 503", w.Code)
+	}
+	d.halted = "BANNED"
+	w = httptest.NewRecorder()
+	d.handleReconnect(w, httptest.NewRequest("POST", "/reconnect", nil))
+	if w.Code != 409 {
+		t.Fatalf("halted: got %d, want 409", w.Code)
+	}
+}
@@ -0,0 +1,93 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/betta-lab/agentnet-openclaw/internal/client"
+	"github.com/betta-lab/agentnet-openclaw/internal/keystore"
+)
+
+// idSet remembers the most recent message IDs so messages replayed on
+// rejoin aren't delivered twice.
+type idSet struct {
+	ids   map[string]struct{}
+	order []string
+	max   int
+}
+
+// add records id and reports whether it was new. The oldest ID is forgotten
+// once max are held.
+func (s *idSet) add(id string) bool {
+	if s.ids == nil {
+		s.ids = make(map[string]struct{})
+	}
+	if _, ok := s.ids[id]; ok {
+		return false
+	}
+	if s.max > 0 && len(s.order) >= s.max {
+		delete(s.ids, s.order[0])
+		s.order = s.order[1:]
+	}
+	s.ids[id] = struct{}{}
+	s.order = append(s.order, id)
+	return true
+}
+
+// noteSeen records msg's ID and timestamp for resuming after a reconnect and
+// reports whether the message is new. The timestamp is the sender's, so it
+// is capped at the local time: a sender with a clock running ahead would
+// otherwise move the cursor past messages not yet seen. Must be called with
+// d.mu held.
+func (d *Daemon) noteSeen(msg client.IncomingMessage) bool {
+	if msg.ID != "" {
+		d.seenIDs.max = d.bufferLimit()
+		if !d.seenIDs.add(msg.ID) {
+			return false
+		}
+	}
+	if ts := min(msg.Timestamp, time.Now().UnixMilli()); msg.Room != "" && ts > d.lastSeen[msg.Room] {
+		if d.lastSeen == nil {
+			d.lastSeen = make(map[string]int64)
+		}
+		d.lastSeen[msg.Room] = ts
+	}
+	return true
+}
+
+// lastSeenPath is where per-room resume cursors are persisted.
+func (d *Daemon) lastSeenPath() string {
+	return d.statePath("last_seen.json")
+}
+
+// loadLastSeen restores resume cursors saved by a previous run.
+func (d *Daemon) loadLastSeen() error {
+	data, err := os.ReadFile(d.lastSeenPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var seen map[string]int64
+	if err := json.Unmarshal(data, &seen); err != nil {
+		return fmt.Errorf("%s: %w", d.lastSeenPath(), err)
+	}
+	d.mu.Lock()
+	d.lastSeen = seen
+	d.mu.Unlock()
+	return nil
+}
+
+// saveLastSeen persists resume cursors. Failures are logged, not fatal.
+func (d *Daemon) saveLastSeen() {
+	d.mu.RLock()
+	data, _ := json.MarshalIndent(d.lastSeen, "", "  ")
+	d.mu.RUnlock()
+	if err := keystore.WriteFileAtomic(d.lastSeenPath(), data, 0600); err != nil {
+		log.Printf("save last seen: %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package daemon
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/betta-lab/agentnet-openclaw/internal/client"
+)
+
+func TestIDSet_EvictsOldest(t *testing.T) {
+	s := idSet{max: 2}
+	if !s.add("a") || !s.add("b") || s.add("a") {
+		t.Fatal("duplicate should be reported")
+	}
+	s.add("c") // evicts "a"
+	if !s.add("a") {
+		t.Fatal("evicted ID should be accepted again")
+	}
+}
+
+func TestNoteSeen_DedupsAndTracksCursor(t *testing.T) {
+	d := &Daemon{}
+	if !d.noteSeen(client.IncomingMessage{ID: "m1", Room: "r", Timestamp: 100}) {
+		t.Fatal("first sighting should be new")
+	}
+	d.noteSeen(client.IncomingMessage{ID: "m0", Room: "r", Timestamp: 50}) // late, older replay
+	if d.noteSeen(client.IncomingMessage{ID: "m1", Room: "r", Timestamp: 100}) {
+		t.Fatal("replayed message should be dropped")
+	}
+	if d.lastSeen["r"] != 100 {
+		t.Fatalf("cursor should track the newest timestamp, got %d", d.lastSeen["r"])
+	}
+}
+
+func TestNoteSeen_CursorNotPastNow(t *testing.T) {
+	d := &Daemon{}
+	future := time.Now().Add(time.Hour).UnixMilli()
+	d.noteSeen(client.IncomingMessage{ID: "m1", Room: "r", Timestamp: future})
+	if d.lastSeen["r"] >= future || d.lastSeen["r"] > time.Now().UnixMilli() {
+		t.Fatalf("cursor %d moved past now by a clock running ahead", d.lastSeen["r"])
+	}
+}
+
+func TestLastSeen_PersistRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	d := &Daemon{keyPath: filepath.Join(dir, "agent.key"), lastSeen: map[string]int64{"r": 1700000000000}}
+	d.saveLastSeen()
+
+	restored := &Daemon{keyPath: filepath.Join(dir, "agent.key")}
+	if err := restored.loadLastSeen(); err != nil {
+		t.Fatal(err)
+	}
+	if restored.lastSeen["r"] != 1700000000000 {
+		t.Fatalf("cursor not restored: %v", restored.lastSeen)
+	}
+}
@@ -0,0 +1,108 @@
+package daemon
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/btcsuite/btcutil/base58"
+
+	"github.com/betta-lab/agentnet-openclaw/internal/client"
+	"github.com/betta-lab/agentnet-openclaw/internal/keystore"
+)
+
+// handleRoomKey lists rooms with an end-to-end key (GET, never returning key
+// material) or provisions one (POST). A POST takes a base58 key shared
+// out-of-band, "generate" to create one (returned once so it can be shared),
+// or "remove" to return the room to plaintext.
+func (d *Daemon) handleRoomKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		d.mu.RLock()
+		rooms := make([]string, 0, len(d.roomKeys))
+		for room := range d.roomKeys {
+			rooms = append(rooms, room)
+		}
+		d.mu.RUnlock()
+		sort.Strings(rooms)
+		json.NewEncoder(w).Encode(map[string]interface{}{"rooms": rooms})
+		return
+	}
+
+	var req struct {
+		Room     string `json:"room"`
+		Key      string `json:"key"`
+		Generate bool   `json:"generate"`
+		Remove   bool   `json:"remove"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Room == "" {
+		httpError(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	var key []byte
+	switch {
+	case req.Remove:
+	case req.Generate:
+		key = make([]byte, keystore.RoomKeySize)
+		rand.Read(key)
+	default:
+		key = base58.Decode(req.Key)
+		if len(key) != keystore.RoomKeySize {
+			httpError(w, "key must be a base58-encoded 32-byte key", http.StatusBadRequest)
+			return
+		}
+	}
+
+	d.mu.Lock()
+	if d.roomKeys == nil {
+		d.roomKeys = make(map[string][]byte)
+	}
+	if key == nil {
+		delete(d.roomKeys, req.Room)
+	} else {
+		d.roomKeys[req.Room] = key
+	}
+	keys := make(map[string][]byte, len(d.roomKeys))
+	for room, k := range d.roomKeys {
+		keys[room] = k
+	}
+	c := d.client
+	d.mu.Unlock()
+
+	if err := keystore.SaveRoomKeys(d.statePath("room_keys.json"), keys); err != nil {
+		httpError(w, "save room keys: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if c != nil {
+		c.SetRoomKey(req.Room, key)
+	}
+
+	resp := map[string]string{"status": "ok", "room": req.Room}
+	if req.Generate {
+		resp["key"] = base58.Encode(key)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// openHistory decrypts relay history for a room with a key, as live messages
+// are decrypted. Content that doesn't decrypt is left as received.
+func (d *Daemon) openHistory(room string, msgs []RelayMessage) {
+	d.mu.RLock()
+	key := d.roomKeys[room]
+	d.mu.RUnlock()
+	if key == nil {
+		return
+	}
+	for i, m := range msgs {
+		var c struct {
+			Type string `json:"type"`
+		}
+		if json.Unmarshal([]byte(m.Content), &c) != nil || c.Type != "encrypted" {
+			continue
+		}
+		if plain, err := client.OpenContent(room, key, json.RawMessage(m.Content)); err == nil {
+			msgs[i].Content = string(plain)
+		}
+	}
+}
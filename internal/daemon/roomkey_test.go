@@ -0,0 +1,126 @@
+package daemon
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/betta-lab/agentnet-openclaw/internal/keystore"
+)
+
+func TestHandleRoomKey_GeneratePersistsAndHidesKey(t *testing.T) {
+	dir := t.TempDir()
+	d := &Daemon{keyPath: filepath.Join(dir, "agent.key")}
+
+	req := httptest.NewRequest("POST", "/rooms/key", strings.NewReader(`{"room":"secret","generate":true}`))
+	w := httptest.NewRecorder()
+	d.handleRoomKey(w, req)
+
+	var resp map[string]string
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp["key"] == "" {
+		t.Fatalf("generated key not returned: %v", resp)
+	}
+
+	keys, err := keystore.LoadRoomKeys(filepath.Join(dir, "room_keys.json"))
+	if err != nil || len(keys["secret"]) != keystore.RoomKeySize {
+		t.Fatalf("key not persisted: %v %v", keys, err)
+	}
+
+	w = httptest.NewRecorder()
+	d.handleRoomKey(w, httptest.NewRequest("GET", "/rooms/key", nil))
+	if body := w.Body.String(); strings.Contains(body, resp["key"]) || !strings.Contains(body, "secret") {
+		t.Fatalf("listing should name the room without the key: %s", body)
+	}
+
+	req = httptest.NewRequest("POST", "/rooms/key", strings.NewReader(`{"room":"secret","remove":true}`))
+	d.handleRoomKey(httptest.NewRecorder(), req)
+	if keys, _ := keystore.LoadRoomKeys(filepath.Join(dir, "room_keys.json")); len(keys) != 0 {
+		t.Fatalf("key not removed: %v", keys)
+	}
+}
+
+func TestHandleRoomKey_InvalidKey(t *testing.T) {
+	d := &Daemon{keyPath: filepath.Join(t.TempDir(), "agent.key")}
+	req := httptest.NewRequest("POST", "/rooms/key", strings.NewReader(`{"room":"secret","key":"abc"}`))
+	w := httptest.NewRecorder()
+	d.handleRoomKey(w, req)
+	if w.Code != 400 {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+}
+
+// sealed encrypts a text message for room the way a keyed client sends it,
+// as the relay stores it in history.
+func sealed(t *testing.T, room string, key []byte, text string) string {
+	t.Helper()
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, _ := json.Marshal(map[string]string{"type": "text", "text": text})
+	nonce := make([]byte, aead.NonceSize())
+	content, _ := json.Marshal(map[string]string{
+		"type":       "encrypted",
+		"alg":        "aes-256-gcm",
+		"nonce":      base64.StdEncoding.EncodeToString(nonce),
+		"ciphertext": base64.StdEncoding.EncodeToString(aead.Seal(nil, nonce, plain, []byte(room))),
+	})
+	return string(content)
+}
+
+func TestHistory_DecryptsKeyedRoom(t *testing.T) {
+	key := make([]byte, keystore.RoomKeySize)
+	msgs, _ := json.Marshal(map[string]interface{}{"messages": []RelayMessage{
+		{ID: "m1", AgentName: "alice", Content: sealed(t, "secret", key, "the plan"), Timestamp: 1000},
+	}})
+	relay := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(msgs)
+	}))
+	defer relay.Close()
+	d := &Daemon{
+		relay:    "ws://" + strings.TrimPrefix(relay.URL, "http://") + "/v1/ws",
+		roomKeys: map[string][]byte{"secret": key},
+	}
+
+	for _, format := range []string{"", "json", "plain"} {
+		w := httptest.NewRecorder()
+		d.handleHistory(w, httptest.NewRequest("GET", "/history?room=secret&format="+format, nil))
+		if body := w.Body.String(); !strings.Contains(body, "the plan") || strings.Contains(body, "ciphertext") {
+			t.Errorf("format %q: history not decrypted:\n%s", format, body)
+		}
+	}
+}
+
+func TestExport_DecryptsKeyedRoom(t *testing.T) {
+	key := make([]byte, keystore.RoomKeySize)
+	msgs, _ := json.Marshal(map[string]interface{}{"messages": []RelayMessage{
+		{ID: "m1", AgentName: "alice", Content: sealed(t, "secret", key, "the plan"), Timestamp: 1000},
+	}})
+	relay := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(msgs)
+	}))
+	defer relay.Close()
+	d := &Daemon{
+		relay:    "ws://" + strings.TrimPrefix(relay.URL, "http://") + "/v1/ws",
+		roomKeys: map[string][]byte{"secret": key},
+	}
+
+	for _, format := range []string{"json", "csv"} {
+		w := httptest.NewRecorder()
+		d.handleExport(w, httptest.NewRequest("GET", "/export?room=secret&format="+format, nil))
+		if body := w.Body.String(); !strings.Contains(body, "the plan") || strings.Contains(body, "ciphertext") {
+			t.Errorf("%s export not decrypted:\n%s", format, body)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/betta-lab/agentnet-openclaw/internal/keystore"
+)
+
+// roomTokensPath is where invite tokens for gated rooms are kept, so they can
+// be presented again when rejoining after a reconnect or restart.
+func (d *Daemon) roomTokensPath() string {
+	return d.statePath("room_tokens.json")
+}
+
+// loadRoomTokens restores invite tokens saved by a previous run.
+func (d *Daemon) loadRoomTokens() error {
+	data, err := os.ReadFile(d.roomTokensPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var tokens map[string]string
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return fmt.Errorf("%s: %w", d.roomTokensPath(), err)
+	}
+	d.mu.Lock()
+	d.roomTokens = tokens
+	d.mu.Unlock()
+	return nil
+}
+
+// setRoomToken records (or, with an empty token, forgets) the invite token for
+// room and persists the set. Failures to save are logged, not fatal.
+func (d *Daemon) setRoomToken(room, token string) {
+	d.mu.Lock()
+	if token == "" {
+		if _, ok := d.roomTokens[room]; !ok {
+			d.mu.Unlock()
+			return
+		}
+		delete(d.roomTokens, room)
+	} else {
+		if d.roomTokens == nil {
+			d.roomTokens = make(map[string]string)
+		}
+		d.roomTokens[room] = token
+	}
+	data, _ := json.MarshalIndent(d.roomTokens, "", "  ")
+	d.mu.Unlock()
+	if err := keystore.WriteFileAtomic(d.roomTokensPath(), data, 0600); err != nil {
+		log.Printf("save room tokens: %v", err)
+	}
+}
@@ -0,0 +1,31 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRoomTokens_PersistAcrossRestart(t *testing.T) {
+	dir := t.TempDir()
+	d := &Daemon{keyPath: filepath.Join(dir, "agent.key")}
+	d.setRoomToken("private", "s3cret")
+	d.setRoomToken("other", "x")
+	d.setRoomToken("other", "") // left the room
+
+	info, err := os.Stat(d.roomTokensPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("token file mode %v, want 0600", info.Mode().Perm())
+	}
+
+	restored := &Daemon{keyPath: d.keyPath}
+	if err := restored.loadRoomTokens(); err != nil {
+		t.Fatal(err)
+	}
+	if len(restored.roomTokens) != 1 || restored.roomTokens["private"] != "s3cret" {
+		t.Fatalf("restored %v", restored.roomTokens)
+	}
+}
@@ -0,0 +1,233 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// JSON-RPC 2.0 error codes. API errors use rpcServerError with the REST
+// error code and HTTP status in data.
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcServerError    = -32000
+)
+
+// rpcReadLimit is the largest request frame /rpc accepts; a bigger one
+// closes the socket.
+const rpcReadLimit = 1 << 20
+
+// rpcMethod is a JSON-RPC method backed by the REST handler for the same
+// operation, so both surfaces validate and fail identically.
+type rpcMethod struct {
+	httpMethod string
+	handler    func(*Daemon, http.ResponseWriter, *http.Request)
+	write      bool // refused in read-only mode, like writeOp
+}
+
+var rpcMethods = map[string]rpcMethod{
+	"status":   {"GET", (*Daemon).handleStatus, false},
+	"join":     {"POST", (*Daemon).handleJoinRoom, false},
+	"leave":    {"POST", (*Daemon).handleLeaveRoom, false},
+	"send":     {"POST", (*Daemon).handleSend, true},
+	"messages": {"GET", (*Daemon).handleMessages, false},
+}
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"` // absent for notifications
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// rpcConn is one /rpc WebSocket. Requests are served one at a time, in
+// order; writes are serialized with subscription pushes.
+type rpcConn struct {
+	ws         *websocket.Conn
+	mu         sync.Mutex
+	subscribed bool // guarded by mu
+}
+
+func (c *rpcConn) write(v interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ws.WriteJSON(v)
+}
+
+func (c *rpcConn) reply(id json.RawMessage, result json.RawMessage, rpcErr *rpcError) {
+	if id == nil {
+		return // a notification gets no response
+	}
+	resp := map[string]interface{}{"jsonrpc": "2.0", "id": id}
+	if rpcErr != nil {
+		resp["error"] = rpcErr
+	} else {
+		resp["result"] = result
+	}
+	c.write(resp)
+}
+
+// handleRPC serves JSON-RPC 2.0 over a WebSocket. status, join, leave, send
+// and messages take the same parameters (body fields and query options
+// alike) and return the same results as their REST endpoints. subscribe,
+// with an optional {"room":...}, pushes each incoming message as a "message"
+// notification until the socket closes, replacing /messages polling. Auth
+// and identity come from the upgrade request's headers, as for any endpoint.
+func (d *Daemon) handleRPC(w http.ResponseWriter, r *http.Request) {
+	ws, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+	if err != nil {
+		return // Upgrade has replied
+	}
+	defer ws.Close()
+	ws.SetReadLimit(rpcReadLimit)
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	conn := &rpcConn{ws: ws}
+	for {
+		_, data, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		var req rpcRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			conn.reply(json.RawMessage("null"), nil, &rpcError{Code: rpcParseError, Message: "parse error"})
+			continue
+		}
+		if req.JSONRPC != "2.0" || req.Method == "" {
+			conn.reply(orNull(req.ID), nil, &rpcError{Code: rpcInvalidRequest, Message: `invalid request: want {"jsonrpc":"2.0","method":...}`})
+			continue
+		}
+		if req.Method == "subscribe" {
+			go d.rpcSubscribe(ctx, conn, req) // pushes until the socket closes
+			continue
+		}
+		// One at a time, so a client's requests take effect (and are
+		// answered) in the order it sent them.
+		d.serveRPC(ctx, conn, req)
+	}
+}
+
+func (d *Daemon) serveRPC(ctx context.Context, conn *rpcConn, req rpcRequest) {
+	m, ok := rpcMethods[req.Method]
+	if !ok {
+		conn.reply(req.ID, nil, &rpcError{Code: rpcMethodNotFound, Message: "method not found: " + req.Method})
+		return
+	}
+
+	httpReq, _ := http.NewRequestWithContext(ctx, m.httpMethod, "/rpc/"+req.Method+"?"+rpcQuery(req.Params), bytes.NewReader(req.Params))
+	rec := &rpcRecorder{header: http.Header{}, status: http.StatusOK}
+	h := func(w http.ResponseWriter, r *http.Request) { m.handler(d, w, r) }
+	if m.write {
+		h = d.writeOp(h)
+	}
+	h(rec, httpReq)
+
+	body := bytes.TrimSpace(rec.body.Bytes())
+	if rec.status >= 400 {
+		var apiErr struct {
+			Error apiError `json:"error"`
+		}
+		json.Unmarshal(body, &apiErr)
+		conn.reply(req.ID, nil, &rpcError{
+			Code:    rpcServerError,
+			Message: apiErr.Error.Message,
+			Data:    map[string]interface{}{"code": apiErr.Error.Code, "status": rec.status},
+		})
+		return
+	}
+	if !json.Valid(body) {
+		body, _ = json.Marshal(string(body)) // plain-text endpoints
+	}
+	conn.reply(req.ID, body, nil)
+}
+
+// rpcSubscribe starts pushing incoming messages, optionally for one room.
+func (d *Daemon) rpcSubscribe(ctx context.Context, conn *rpcConn, req rpcRequest) {
+	var params struct {
+		Room string `json:"room"`
+	}
+	if len(req.Params) > 0 {
+		json.Unmarshal(req.Params, &params)
+	}
+	conn.mu.Lock()
+	already := conn.subscribed
+	conn.subscribed = true
+	conn.mu.Unlock()
+	if already {
+		conn.reply(req.ID, nil, &rpcError{Code: rpcServerError, Message: "already subscribed on this connection",
+			Data: map[string]interface{}{"code": codeConflict, "status": http.StatusConflict}})
+		return
+	}
+
+	msgs, stop := d.watch()
+	defer stop()
+	conn.reply(req.ID, json.RawMessage(`{"subscribed":true}`), nil)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case m := <-msgs:
+			if params.Room != "" && !strings.EqualFold(m.Room, params.Room) {
+				continue
+			}
+			if conn.write(map[string]interface{}{"jsonrpc": "2.0", "method": "message", "params": m}) != nil {
+				return
+			}
+		}
+	}
+}
+
+// rpcQuery copies the scalar params into a query string, for the REST
+// options read from the URL such as room and peek for messages, or wait and
+// dry_run for send. The params are also the request body.
+func rpcQuery(params json.RawMessage) string {
+	var fields map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(params))
+	dec.UseNumber() // keep timestamps out of exponent notation
+	if dec.Decode(&fields) != nil {
+		return ""
+	}
+	q := url.Values{}
+	for k, v := range fields {
+		switch v.(type) {
+		case string, json.Number, bool:
+			q.Set(k, fmt.Sprint(v))
+		}
+	}
+	return q.Encode()
+}
+
+// orNull returns id, or JSON null when a request had none.
+func orNull(id json.RawMessage) json.RawMessage {
+	if id == nil {
+		return json.RawMessage("null")
+	}
+	return id
+}
+
+// rpcRecorder captures a REST handler's response for an RPC call.
+type rpcRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *rpcRecorder) Header() http.Header         { return r.header }
+func (r *rpcRecorder) Write(b []byte) (int, error) { return r.body.Write(b) }
+func (r *rpcRecorder) WriteHeader(status int)      { r.status = status }
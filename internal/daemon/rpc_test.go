@@ -0,0 +1,154 @@
+package daemon
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/betta-lab/agentnet-openclaw/internal/client"
+)
+
+// rpcDial connects to a daemon's /rpc endpoint.
+func rpcDial(t *testing.T, d *Daemon, token string) (*websocket.Conn, *http.Response, error) {
+	t.Helper()
+	srv := httptest.NewServer(d.requireAuth(d.forIdentity((*Daemon).handleRPC)))
+	t.Cleanup(srv.Close)
+	h := http.Header{"Authorization": {"Bearer " + token}}
+	return websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), h)
+}
+
+type rpcResponse struct {
+	ID     int             `json:"id"`
+	Method string          `json:"method"`
+	Result json.RawMessage `json:"result"`
+	Params json.RawMessage `json:"params"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Data    struct {
+			Code   string `json:"code"`
+			Status int    `json:"status"`
+		} `json:"data"`
+	} `json:"error"`
+}
+
+func rpcCall(t *testing.T, ws *websocket.Conn, id int, method string, params interface{}) rpcResponse {
+	t.Helper()
+	if err := ws.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "id": id, "method": method, "params": params}); err != nil {
+		t.Fatal(err)
+	}
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var resp rpcResponse
+	if err := ws.ReadJSON(&resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestRPC_CallsMatchREST(t *testing.T) {
+	d := &Daemon{apiToken: "tok", agentName: "alice", relay: "wss://example.com/v1/ws"}
+	ws, _, err := rpcDial(t, d, "tok")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	resp := rpcCall(t, ws, 1, "status", nil)
+	var st struct {
+		Connected bool   `json:"connected"`
+		AgentName string `json:"agent_name"`
+	}
+	if resp.Error != nil || json.Unmarshal(resp.Result, &st) != nil || st.Connected || st.AgentName != "alice" {
+		t.Fatalf("status: got %+v", resp)
+	}
+
+	resp = rpcCall(t, ws, 2, "send", map[string]string{"room": "lab", "text": "hi"})
+	if resp.ID != 2 || resp.Error == nil || resp.Error.Code != rpcServerError ||
+		resp.Error.Data.Code != codeNotConnected || resp.Error.Data.Status != http.StatusServiceUnavailable {
+		t.Fatalf("send while disconnected: got %+v", resp)
+	}
+
+	resp = rpcCall(t, ws, 3, "reboot", nil)
+	if resp.Error == nil || resp.Error.Code != rpcMethodNotFound {
+		t.Fatalf("unknown method: got %+v", resp)
+	}
+}
+
+func TestRPC_SubscribePushesMessages(t *testing.T) {
+	d := &Daemon{apiToken: "tok"}
+	ws, _, err := rpcDial(t, d, "tok")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	if resp := rpcCall(t, ws, 1, "subscribe", map[string]string{"room": "lab"}); resp.Error != nil {
+		t.Fatalf("subscribe: %+v", resp)
+	}
+	d.mu.Lock()
+	for ch := range d.watchers {
+		ch <- client.IncomingMessage{ID: "m1", Room: "other", Text: "skip"}
+		ch <- client.IncomingMessage{ID: "m2", Room: "lab", Text: "hello"}
+	}
+	d.mu.Unlock()
+
+	var note rpcResponse
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if err := ws.ReadJSON(&note); err != nil {
+		t.Fatal(err)
+	}
+	var msg client.IncomingMessage
+	json.Unmarshal(note.Params, &msg)
+	if note.Method != "message" || msg.ID != "m2" {
+		t.Fatalf("got %+v", note)
+	}
+}
+
+func TestRPC_ServesRequestsInOrder(t *testing.T) {
+	d := &Daemon{apiToken: "tok"}
+	ws, _, err := rpcDial(t, d, "tok")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	for id := 1; id <= 20; id++ {
+		method := "status"
+		if id%2 == 0 {
+			method = "messages"
+		}
+		if err := ws.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "id": id, "method": method}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for want := 1; want <= 20; want++ {
+		var resp rpcResponse
+		if err := ws.ReadJSON(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.ID != want {
+			t.Fatalf("got response %d, want %d", resp.ID, want)
+		}
+	}
+
+	// An oversized frame closes the socket.
+	ws.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "id": 21, "method": "send",
+		"params": map[string]string{"room": "lab", "text": strings.Repeat("x", rpcReadLimit)}})
+	if _, _, err := ws.ReadMessage(); err == nil {
+		t.Fatal("expected the connection to close")
+	}
+}
+
+func TestRPC_RequiresToken(t *testing.T) {
+	d := &Daemon{apiToken: "tok"}
+	_, resp, err := rpcDial(t, d, "wrong")
+	if err == nil || resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %v", err)
+	}
+}
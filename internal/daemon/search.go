@@ -0,0 +1,95 @@
+package daemon
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Search limits.
+const (
+	maxSearchHits  = 100
+	snippetContext = 40 // bytes of text kept on each side of a match
+)
+
+// searchHit is one message matching a /search query.
+type searchHit struct {
+	ID        string `json:"id"`
+	Room      string `json:"room"`
+	From      string `json:"from"`
+	FromName  string `json:"from_name,omitempty"`
+	Timestamp int64  `json:"timestamp"`
+	Snippet   string `json:"snippet"`
+}
+
+// handleSearch finds buffered messages whose text contains q (case-insensitive),
+// newest first, optionally limited to one room. Unlike /messages it does not
+// clear the buffer. At most maxSearchHits are returned; total counts all matches.
+func (d *Daemon) handleSearch(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query().Get("q")
+	if q == "" {
+		httpError(w, "q parameter required", http.StatusBadRequest)
+		return
+	}
+	room := r.URL.Query().Get("room")
+	needle := strings.ToLower(q)
+
+	d.mu.RLock()
+	hits := []searchHit{}
+	total := 0
+	now := time.Now()
+	for i := len(d.messages) - 1; i >= 0; i-- {
+		m := d.messages[i]
+		if (room != "" && m.Room != room) || d.expired(m, now) {
+			continue
+		}
+		at := strings.Index(strings.ToLower(m.Text), needle)
+		if at < 0 {
+			continue
+		}
+		total++
+		if len(hits) < maxSearchHits {
+			hits = append(hits, searchHit{
+				ID:        m.ID,
+				Room:      m.Room,
+				From:      m.From,
+				FromName:  m.FromName,
+				Timestamp: m.Timestamp,
+				Snippet:   snippet(m.Text, at, len(needle)),
+			})
+		}
+	}
+	d.mu.RUnlock()
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"total": total,
+		"hits":  hits,
+	})
+}
+
+// snippet returns text around the match at [at, at+n), with "…" marking cuts.
+// Offsets come from the lowercased text; if lowercasing changed the length
+// (rare non-ASCII cases) the snippet falls back to the start of the text.
+func snippet(text string, at, n int) string {
+	if len(strings.ToLower(text)) != len(text) {
+		at, n = 0, 0
+	}
+	start, end := at-snippetContext, at+n+snippetContext
+	prefix, suffix := "…", "…"
+	if start <= 0 {
+		start, prefix = 0, ""
+	}
+	if end >= len(text) {
+		end, suffix = len(text), ""
+	}
+	// Don't cut through a multi-byte character.
+	for start > 0 && !utf8.RuneStart(text[start]) {
+		start--
+	}
+	for end < len(text) && !utf8.RuneStart(text[end]) {
+		end++
+	}
+	return prefix + text[start:end] + suffix
+}
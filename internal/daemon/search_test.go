@@ -0,0 +1,68 @@
+package daemon
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/betta-lab/agentnet-openclaw/internal/client"
+)
+
+func TestSearch_CaseInsensitiveNewestFirst(t *testing.T) {
+	d := &Daemon{messages: []client.IncomingMessage{
+		{ID: "m1", Room: "a", From: "x", Text: "deploy token ABC123 is live"},
+		{ID: "m2", Room: "b", From: "y", Text: "nothing here"},
+		{ID: "m3", Room: "a", From: "z", Text: "rotated abc123 this morning"},
+	}}
+
+	w := httptest.NewRecorder()
+	d.handleSearch(w, httptest.NewRequest("GET", "/search?q=abc123", nil))
+	var resp struct {
+		Total int         `json:"total"`
+		Hits  []searchHit `json:"hits"`
+	}
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp.Total != 2 || len(resp.Hits) != 2 || resp.Hits[0].ID != "m3" || resp.Hits[1].ID != "m1" {
+		t.Fatalf("unexpected hits: %+v", resp)
+	}
+	if len(d.messages) != 3 {
+		t.Fatal("search must not clear the buffer")
+	}
+
+	w = httptest.NewRecorder()
+	d.handleSearch(w, httptest.NewRequest("GET", "/search?q=abc123&room=b", nil))
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp.Total != 0 || len(resp.Hits) != 0 {
+		t.Fatalf("room filter ignored: %+v", resp)
+	}
+}
+
+func TestSearch_CapsHits(t *testing.T) {
+	d := &Daemon{}
+	for i := 0; i < maxSearchHits+5; i++ {
+		d.messages = append(d.messages, client.IncomingMessage{Room: "r", Text: "match"})
+	}
+	w := httptest.NewRecorder()
+	d.handleSearch(w, httptest.NewRequest("GET", "/search?q=MATCH", nil))
+	var resp struct {
+		Total int         `json:"total"`
+		Hits  []searchHit `json:"hits"`
+	}
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp.Total != maxSearchHits+5 || len(resp.Hits) != maxSearchHits {
+		t.Fatalf("total=%d hits=%d", resp.Total, len(resp.Hits))
+	}
+}
+
+func TestSnippet_TrimsAroundMatch(t *testing.T) {
+	text := strings.Repeat("a", 100) + "needle" + strings.Repeat("b", 100)
+	got := snippet(text, 100, len("needle"))
+	want := "…" + strings.Repeat("a", snippetContext) + "needle" + strings.Repeat("b", snippetContext) + "…"
+	if got != want {
+		t.Fatalf("got %q", got)
+	}
+	if got := snippet("short needle", 6, 6); got != "short needle" {
+		t.Fatalf("short text should not be cut: %q", got)
+	}
+}
@@ -0,0 +1,86 @@
+package daemon
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCert writes a self-signed certificate and key into dir.
+func writeTestCert(t *testing.T, dir string) (certPath, keyPath string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "agentnet-test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+
+	certPath = filepath.Join(dir, "cert.pem")
+	keyPath = filepath.Join(dir, "key.pem")
+	os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return certPath, keyPath
+}
+
+func TestServerTLSConfig_ServerOnly(t *testing.T) {
+	cert, key := writeTestCert(t, t.TempDir())
+	d := &Daemon{tlsCert: cert, tlsKey: key}
+
+	cfg, err := d.serverTLSConfig()
+	if err != nil {
+		t.Fatalf("serverTLSConfig: %v", err)
+	}
+	if len(cfg.Certificates) != 1 {
+		t.Fatal("server certificate not loaded")
+	}
+	if cfg.ClientAuth != tls.NoClientCert {
+		t.Fatal("client certificates should not be required without a client CA")
+	}
+}
+
+func TestServerTLSConfig_MutualTLS(t *testing.T) {
+	cert, key := writeTestCert(t, t.TempDir())
+	d := &Daemon{tlsCert: cert, tlsKey: key, tlsClientCA: cert}
+
+	cfg, err := d.serverTLSConfig()
+	if err != nil {
+		t.Fatalf("serverTLSConfig: %v", err)
+	}
+	if cfg.ClientAuth != tls.RequireAndVerifyClientCert || cfg.ClientCAs == nil {
+		t.Fatal("client CA should require verified client certificates")
+	}
+}
+
+func TestServerTLSConfig_BadClientCA(t *testing.T) {
+	dir := t.TempDir()
+	cert, key := writeTestCert(t, dir)
+	bogus := filepath.Join(dir, "bogus.pem")
+	os.WriteFile(bogus, []byte("not a cert"), 0600)
+
+	d := &Daemon{tlsCert: cert, tlsKey: key, tlsClientCA: bogus}
+	if _, err := d.serverTLSConfig(); err == nil {
+		t.Fatal("expected error for client CA without certificates")
+	}
+}
@@ -0,0 +1,183 @@
+package daemon
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/betta-lab/agentnet-openclaw/internal/client"
+)
+
+// Webhook delivery limits.
+const (
+	webhookQueueSize = 256 // pending deliveries; the oldest is dropped on overflow
+	webhookAttempts  = 5   // tries per message before giving up
+)
+
+// webhook POSTs incoming messages to a configured URL. It is shared by every
+// identity; deliveries from extra identities carry an X-Agent-Identity header.
+type webhook struct {
+	mu      sync.Mutex
+	url     string
+	secret  []byte
+	queue   []webhookDelivery
+	dropped int64         // deliveries lost to queue overflow or exhausted retries
+	wake    chan struct{} // signals run that the queue is non-empty
+	client  *http.Client
+}
+
+type webhookDelivery struct {
+	identity string
+	body     []byte
+}
+
+func newWebhook(url, secret string) *webhook {
+	return &webhook{
+		url:    url,
+		secret: []byte(secret),
+		wake:   make(chan struct{}, 1),
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// setURL changes the delivery URL; an empty URL disables delivery and discards the queue.
+func (wh *webhook) setURL(u string) {
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+	wh.url = u
+	if u == "" {
+		wh.queue = nil
+	}
+}
+
+// enqueue schedules msg for delivery. It never blocks collection.
+func (wh *webhook) enqueue(identity string, msg client.IncomingMessage) {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	wh.mu.Lock()
+	if wh.url == "" {
+		wh.mu.Unlock()
+		return
+	}
+	if len(wh.queue) >= webhookQueueSize {
+		wh.queue = wh.queue[1:]
+		wh.dropped++
+	}
+	wh.queue = append(wh.queue, webhookDelivery{identity: identity, body: body})
+	wh.mu.Unlock()
+
+	select {
+	case wh.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run delivers queued messages in order until the process exits.
+func (wh *webhook) run() {
+	for range wh.wake {
+		for {
+			wh.mu.Lock()
+			if len(wh.queue) == 0 {
+				wh.mu.Unlock()
+				break
+			}
+			next := wh.queue[0]
+			wh.queue = wh.queue[1:]
+			u := wh.url
+			wh.mu.Unlock()
+
+			if err := wh.deliver(u, next); err != nil {
+				log.Printf("webhook: %v", err)
+				wh.mu.Lock()
+				wh.dropped++
+				wh.mu.Unlock()
+			}
+		}
+	}
+}
+
+// deliver POSTs one message, retrying network errors and 5xx responses with
+// exponential backoff. 4xx responses are not retried.
+func (wh *webhook) deliver(u string, d webhookDelivery) error {
+	backoff := time.Second
+	var lastErr error
+	for attempt := 1; attempt <= webhookAttempts; attempt++ {
+		req, err := http.NewRequest("POST", u, bytes.NewReader(d.body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if len(wh.secret) > 0 {
+			req.Header.Set("X-AgentNet-Signature", signWebhook(wh.secret, d.body))
+		}
+		if d.identity != "" {
+			req.Header.Set("X-Agent-Identity", d.identity)
+		}
+		resp, err := wh.client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode < 500 {
+				if resp.StatusCode >= 400 {
+					return fmt.Errorf("delivery rejected: %s", resp.Status)
+				}
+				return nil
+			}
+			err = fmt.Errorf("server error: %s", resp.Status)
+		}
+		lastErr = err
+		if attempt < webhookAttempts {
+			sleep(backoff)
+			backoff *= 2
+		}
+	}
+	return fmt.Errorf("giving up after %d attempts: %w", webhookAttempts, lastErr)
+}
+
+// signWebhook returns the X-AgentNet-Signature value for body: "sha256=" and
+// the hex HMAC-SHA256 of the raw request body under the shared secret.
+func signWebhook(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// handleWebhook shows the webhook state (GET) or sets or clears the URL (POST {"url": ...}).
+// The shared secret is only configurable at startup and is never returned.
+func (d *Daemon) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	wh := d.webhook
+	if r.Method == http.MethodPost {
+		var req struct {
+			URL string `json:"url"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httpError(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if req.URL != "" {
+			if u, err := url.Parse(req.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				httpError(w, "url must be an absolute http(s) URL", http.StatusBadRequest)
+				return
+			}
+		}
+		wh.setURL(req.URL)
+	}
+
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"url":     wh.url,
+		"signed":  len(wh.secret) > 0,
+		"queued":  len(wh.queue),
+		"dropped": wh.dropped,
+	})
+}
@@ -0,0 +1,93 @@
+package daemon
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/betta-lab/agentnet-openclaw/internal/client"
+)
+
+func TestWebhook_DeliverSignsBody(t *testing.T) {
+	var gotSig, gotIdentity string
+	var gotBody []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotSig = r.Header.Get("X-AgentNet-Signature")
+		gotIdentity = r.Header.Get("X-Agent-Identity")
+		gotBody, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	wh := newWebhook(srv.URL, "s3cret")
+	body := []byte(`{"room":"r","text":"hi"}`)
+	if err := wh.deliver(srv.URL, webhookDelivery{identity: "bot", body: body}); err != nil {
+		t.Fatal(err)
+	}
+	if string(gotBody) != string(body) || gotIdentity != "bot" {
+		t.Fatalf("unexpected delivery: body=%s identity=%q", gotBody, gotIdentity)
+	}
+	if gotSig != signWebhook([]byte("s3cret"), body) {
+		t.Fatalf("signature mismatch: %s", gotSig)
+	}
+}
+
+func TestWebhook_RetriesServerErrors(t *testing.T) {
+	origSleep := sleep
+	defer func() { sleep = origSleep }()
+	var slept []time.Duration
+	sleep = func(d time.Duration) { slept = append(slept, d) }
+
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer srv.Close()
+
+	wh := newWebhook(srv.URL, "")
+	if err := wh.deliver(srv.URL, webhookDelivery{body: []byte(`{}`)}); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 || len(slept) != 2 || slept[1] != 2*slept[0] {
+		t.Fatalf("calls=%d backoff=%v", calls, slept)
+	}
+}
+
+func TestWebhook_NoRetryOnClientError(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	if err := newWebhook(srv.URL, "").deliver(srv.URL, webhookDelivery{body: []byte(`{}`)}); err == nil || calls != 1 {
+		t.Fatalf("expected a single failed attempt, got calls=%d err=%v", calls, err)
+	}
+}
+
+func TestWebhook_QueueDropsOldest(t *testing.T) {
+	wh := newWebhook("http://example.invalid/hook", "")
+	for i := 0; i < webhookQueueSize+2; i++ {
+		wh.enqueue("", client.IncomingMessage{ID: string(rune('a' + i%26))})
+	}
+	if len(wh.queue) != webhookQueueSize || wh.dropped != 2 {
+		t.Fatalf("queue=%d dropped=%d", len(wh.queue), wh.dropped)
+	}
+	var head client.IncomingMessage
+	json.Unmarshal(wh.queue[0].body, &head)
+	if head.ID != "c" {
+		t.Fatalf("oldest entries should be dropped first, head is %s", wh.queue[0].body)
+	}
+
+	wh.setURL("")
+	wh.enqueue("", client.IncomingMessage{ID: "x"})
+	if len(wh.queue) != 0 {
+		t.Fatal("disabled webhook should not queue")
+	}
+}
@@ -0,0 +1,171 @@
+package keystore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/btcsuite/btcutil/base58"
+)
+
+// exportWarning heads every export, since the file is as good as the key.
+const exportWarning = "SECRET: this is an AgentNet private key. Anyone who has it can act as this agent. Never share it or commit it."
+
+// Passphrase encryption of exports: PBKDF2-SHA256 into an AES-256-GCM key.
+const (
+	exportKDF        = "pbkdf2-sha256"
+	exportIterations = 600000
+	maxIterations    = 10 * exportIterations // bounds the work a crafted export can demand
+	exportCipher     = "aes-256-gcm"
+)
+
+// Import errors.
+var (
+	ErrPassphraseRequired = errors.New("export is passphrase-encrypted; a passphrase is required")
+	ErrWrongPassphrase    = errors.New("wrong passphrase, or the export is damaged")
+)
+
+// exportFile is the export format. Exactly one of PrivateKey and Encrypted
+// is set.
+type exportFile struct {
+	Warning    string        `json:"warning"`
+	AgentID    string        `json:"agent_id"`
+	PrivateKey string        `json:"private_key,omitempty"` // base58, as in the key file
+	Encrypted  *encryptedKey `json:"encrypted,omitempty"`
+}
+
+// encryptedKey is the private key sealed with a passphrase; byte fields
+// encode as base64.
+type encryptedKey struct {
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Cipher     string `json:"cipher"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// exportAEAD derives the AES-256-GCM cipher for passphrase and salt.
+func exportAEAD(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, iterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Export returns keys in a form Import accepts on another machine,
+// encrypted with passphrase unless it is empty.
+func Export(keys *Keys, passphrase string) ([]byte, error) {
+	f := exportFile{Warning: exportWarning, AgentID: keys.AgentID()}
+	if passphrase == "" {
+		f.PrivateKey = base58.Encode(keys.PrivateKey)
+	} else {
+		enc := &encryptedKey{KDF: exportKDF, Iterations: exportIterations, Salt: make([]byte, 16), Cipher: exportCipher}
+		rand.Read(enc.Salt)
+		aead, err := exportAEAD(passphrase, enc.Salt, enc.Iterations)
+		if err != nil {
+			return nil, err
+		}
+		enc.Nonce = make([]byte, aead.NonceSize())
+		rand.Read(enc.Nonce)
+		// The agent ID is authenticated too, so it can't be swapped.
+		enc.Ciphertext = aead.Seal(nil, enc.Nonce, keys.PrivateKey.Seed(), []byte(f.AgentID))
+		f.Encrypted = enc
+	}
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// decodeExport reads keys from an export, decrypting them with passphrase
+// if it is encrypted.
+func decodeExport(data []byte, passphrase string) (*Keys, error) {
+	var f exportFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("not an agentnet key export: %w", err)
+	}
+	var priv ed25519.PrivateKey
+	switch enc := f.Encrypted; {
+	case enc != nil:
+		if passphrase == "" {
+			return nil, ErrPassphraseRequired
+		}
+		if enc.KDF != exportKDF || enc.Cipher != exportCipher || enc.Iterations <= 0 || enc.Iterations > maxIterations {
+			return nil, fmt.Errorf("unsupported export encryption %s/%s", enc.KDF, enc.Cipher)
+		}
+		aead, err := exportAEAD(passphrase, enc.Salt, enc.Iterations)
+		if err != nil {
+			return nil, err
+		}
+		if len(enc.Nonce) != aead.NonceSize() {
+			return nil, ErrWrongPassphrase
+		}
+		seed, err := aead.Open(nil, enc.Nonce, enc.Ciphertext, []byte(f.AgentID))
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return nil, ErrWrongPassphrase
+		}
+		priv = ed25519.NewKeyFromSeed(seed)
+	case f.PrivateKey != "":
+		b := base58.Decode(f.PrivateKey)
+		if len(b) != ed25519.PrivateKeySize {
+			return nil, fmt.Errorf("invalid private key length %d", len(b))
+		}
+		priv = ed25519.PrivateKey(b)
+	default:
+		return nil, errors.New("not an agentnet key export: no key")
+	}
+	keys := &Keys{PublicKey: priv.Public().(ed25519.PublicKey), PrivateKey: priv}
+	if f.AgentID != "" && keys.AgentID() != f.AgentID {
+		return nil, fmt.Errorf("export is damaged: key is for %s, not %s", keys.AgentID(), f.AgentID)
+	}
+	return keys, nil
+}
+
+// Import installs the key in export data at path, decrypting it with
+// passphrase if needed. An existing key file for another agent is kept and
+// ErrKeyExists returned, unless force is set; it is then backed up as by
+// Rotate. Importing the key already there changes nothing.
+func Import(path string, data []byte, passphrase string, force bool) (*Keys, error) {
+	keys, err := decodeExport(data, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if err := install(path, keys, force); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// install writes keys to path, with Import's rules for an existing key file.
+func install(path string, keys *Keys, force bool) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	if _, err := os.Lstat(path); err == nil {
+		if old, err := Load(path); err == nil && old.AgentID() == keys.AgentID() {
+			return nil
+		}
+		if !force {
+			return fmt.Errorf("%s: %w", path, ErrKeyExists)
+		}
+		if err := backup(path); err != nil {
+			return err
+		}
+	}
+	return save(path, keys.PrivateKey)
+}
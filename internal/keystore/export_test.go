@@ -0,0 +1,106 @@
+package keystore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExportImport_RoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	keys, err := LoadOrCreate(filepath.Join(dir, "laptop.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, passphrase := range []string{"", "correct horse"} {
+		data, err := Export(keys, passphrase)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), "SECRET") {
+			t.Fatal("export carries no warning")
+		}
+		if passphrase != "" && strings.Contains(string(data), `"private_key"`) {
+			t.Fatal("encrypted export contains the plain key")
+		}
+
+		path := filepath.Join(dir, "server"+passphrase, "agent.key")
+		got, err := Import(path, data, passphrase, false)
+		if err != nil {
+			t.Fatalf("passphrase %q: %v", passphrase, err)
+		}
+		loaded, err := Load(path)
+		if err != nil || got.AgentID() != keys.AgentID() || loaded.AgentID() != keys.AgentID() {
+			t.Fatalf("passphrase %q: imported a different key (%v)", passphrase, err)
+		}
+	}
+}
+
+func TestImport_Passphrase(t *testing.T) {
+	keys, _ := LoadOrCreate(filepath.Join(t.TempDir(), "agent.key"))
+	data, err := Export(keys, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "agent.key")
+	if _, err := Import(path, data, "", false); !errors.Is(err, ErrPassphraseRequired) {
+		t.Fatalf("no passphrase: got %v", err)
+	}
+	if _, err := Import(path, data, "wrong", false); !errors.Is(err, ErrWrongPassphrase) {
+		t.Fatalf("wrong passphrase: got %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("a failed import wrote the key file")
+	}
+}
+
+func TestImport_RefusesToOverwrite(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "agent.key")
+	existing, _ := LoadOrCreate(path)
+	other, _ := LoadOrCreate(filepath.Join(dir, "other.key"))
+	data, _ := Export(other, "")
+
+	if _, err := Import(path, data, "", false); !errors.Is(err, ErrKeyExists) {
+		t.Fatalf("expected ErrKeyExists, got %v", err)
+	}
+	if kept, _ := Load(path); kept.AgentID() != existing.AgentID() {
+		t.Fatal("existing key replaced without force")
+	}
+
+	// The same key again is a no-op, not a conflict.
+	same, _ := Export(existing, "")
+	if _, err := Import(path, same, "", false); err != nil {
+		t.Fatalf("reimporting the same key: %v", err)
+	}
+
+	if _, err := Import(path, data, "", true); err != nil {
+		t.Fatal(err)
+	}
+	if now, _ := Load(path); now.AgentID() != other.AgentID() {
+		t.Fatal("force did not install the key")
+	}
+	backups, _ := filepath.Glob(path + ".bak-*")
+	if len(backups) != 1 {
+		t.Fatalf("expected a backup of the old key, got %v", backups)
+	}
+}
+
+func TestImport_RejectsDamagedExports(t *testing.T) {
+	keys, _ := LoadOrCreate(filepath.Join(t.TempDir(), "agent.key"))
+	data, _ := Export(keys, "")
+	tampered := strings.Replace(string(data), keys.AgentID(), "someoneElse", 1)
+	for name, in := range map[string]string{
+		"not json":  "nope",
+		"no key":    `{"agent_id":"x"}`,
+		"wrong id":  tampered,
+		"short key": `{"private_key":"abc"}`,
+	} {
+		if _, err := Import(filepath.Join(t.TempDir(), "agent.key"), []byte(in), "", false); err == nil {
+			t.Fatalf("%s: expected an error", name)
+		}
+	}
+}
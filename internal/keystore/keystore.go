@@ -4,8 +4,12 @@ import (
 	"crypto/ed25519"
 	"crypto/rand"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/btcsuite/btcutil/base58"
 )
@@ -31,29 +35,203 @@ func LoadOrCreate(path string) (*Keys, error) {
 		return nil, err
 	}
 
-	data, err := os.ReadFile(path)
-	if err == nil {
-		var sk storedKey
-		if err := json.Unmarshal(data, &sk); err != nil {
-			return nil, err
-		}
-		privBytes := base58.Decode(sk.PrivateKey)
-		priv := ed25519.PrivateKey(privBytes)
-		pub := priv.Public().(ed25519.PublicKey)
-		return &Keys{PublicKey: pub, PrivateKey: priv}, nil
+	if _, err := os.Stat(path); err == nil {
+		return Load(path)
 	}
+	return generate(path)
+}
+
+// ErrKeyExists is returned by Create when path already holds a key.
+var ErrKeyExists = errors.New("key file already exists")
 
-	// Generate new keypair
+// Create writes a new keypair to path, creating its directory, and fails
+// with ErrKeyExists rather than replace an existing file.
+func Create(path string) (*Keys, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	if _, err := os.Lstat(path); err == nil {
+		return nil, fmt.Errorf("%s: %w", path, ErrKeyExists)
+	}
+	return generate(path)
+}
+
+// generate writes a freshly generated keypair to path.
+func generate(path string) (*Keys, error) {
 	pub, priv, err := ed25519.GenerateKey(rand.Reader)
 	if err != nil {
 		return nil, err
 	}
+	if err := save(path, priv); err != nil {
+		return nil, err
+	}
+	return &Keys{PublicKey: pub, PrivateKey: priv}, nil
+}
 
+// save writes priv to the key file at path.
+func save(path string, priv ed25519.PrivateKey) error {
 	sk := storedKey{PrivateKey: base58.Encode(priv)}
-	data, _ = json.MarshalIndent(sk, "", "  ")
-	if err := os.WriteFile(path, data, 0600); err != nil {
+	data, _ := json.MarshalIndent(sk, "", "  ")
+	return WriteFileAtomic(path, data, 0600)
+}
+
+// Rotate replaces the keypair at path with a freshly generated one. The old
+// key file is kept as "<path>.bak-<UTC timestamp>" (with a "-N" suffix if
+// that is taken) so it can be restored.
+func Rotate(path string) (*Keys, error) {
+	if err := backup(path); err != nil {
 		return nil, err
 	}
+	return generate(path)
+}
 
+// backup copies the key file at path to "<path>.bak-<UTC timestamp>". The
+// name is claimed exclusively first, so two backups in the same second get
+// "-2", "-3"... rather than one overwriting the other.
+func backup(path string) error {
+	old, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	base := path + ".bak-" + time.Now().UTC().Format("20060102T150405Z")
+	backup := base
+	for n := 2; ; n++ {
+		f, err := os.OpenFile(backup, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err == nil {
+			f.Close()
+			break
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("back up key: %w", err)
+		}
+		backup = fmt.Sprintf("%s-%d", base, n)
+	}
+	if err := WriteFileAtomic(backup, old, 0600); err != nil {
+		os.Remove(backup)
+		return fmt.Errorf("back up key: %w", err)
+	}
+	return nil
+}
+
+// syncFile flushes a temporary file before it is renamed into place; replaceable in tests.
+var syncFile = (*os.File).Sync
+
+// WriteFileAtomic writes data to a temporary file in path's directory, syncs
+// it, and renames it over path, so a crash leaves either the old or the new
+// contents and never a truncated file.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp) // no-op once renamed
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		return err
+	}
+	if err := syncFile(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Load reads an existing key file.
+func Load(path string) (*Keys, error) {
+	sk, err := readStored(path)
+	if err != nil {
+		return nil, err
+	}
+	privBytes := base58.Decode(sk.PrivateKey)
+	if len(privBytes) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("%s: invalid private key length %d", path, len(privBytes))
+	}
+	priv := ed25519.PrivateKey(privBytes)
+	pub := priv.Public().(ed25519.PublicKey)
 	return &Keys{PublicKey: pub, PrivateKey: priv}, nil
 }
+
+// readStored reads the key file at path as stored.
+func readStored(path string) (*storedKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var sk storedKey
+	if err := json.Unmarshal(data, &sk); err != nil {
+		return nil, err
+	}
+	return &sk, nil
+}
+
+// LoadDir loads every "<name>.key" file in dir, keyed by name.
+// A missing directory yields an empty map.
+func LoadDir(dir string) (map[string]*Keys, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return map[string]*Keys{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]*Keys)
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".key" {
+			continue
+		}
+		k, err := Load(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		keys[strings.TrimSuffix(e.Name(), ".key")] = k
+	}
+	return keys, nil
+}
+
+// RoomKeySize is the length of a symmetric room encryption key.
+const RoomKeySize = 32
+
+// LoadRoomKeys reads the symmetric room keys (room → key) stored at path.
+// A missing file yields an empty map.
+func LoadRoomKeys(path string) (map[string][]byte, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return map[string][]byte{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var stored map[string]string
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, err
+	}
+	keys := make(map[string][]byte, len(stored))
+	for room, enc := range stored {
+		key := base58.Decode(enc)
+		if len(key) != RoomKeySize {
+			return nil, fmt.Errorf("%s: room %s: invalid key length %d", path, room, len(key))
+		}
+		keys[room] = key
+	}
+	return keys, nil
+}
+
+// SaveRoomKeys writes room keys to path with owner-only permissions.
+func SaveRoomKeys(path string, keys map[string][]byte) error {
+	stored := make(map[string]string, len(keys))
+	for room, key := range keys {
+		stored[room] = base58.Encode(key)
+	}
+	data, _ := json.MarshalIndent(stored, "", "  ")
+	return WriteFileAtomic(path, data, 0600)
+}
@@ -2,6 +2,7 @@ package keystore
 
 import (
 	"crypto/ed25519"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
@@ -105,3 +106,174 @@ func TestLoadOrCreate_CorruptedFile(t *testing.T) {
 		t.Fatal("should error on corrupted key file")
 	}
 }
+
+func TestLoadDir_MultipleIdentities(t *testing.T) {
+	dir := t.TempDir()
+	alice, _ := LoadOrCreate(filepath.Join(dir, "alice.key"))
+	bob, _ := LoadOrCreate(filepath.Join(dir, "bob.key"))
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("ignored"), 0600)
+
+	keys, err := LoadDir(dir)
+	if err != nil {
+		t.Fatalf("LoadDir: %v", err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("expected 2 identities, got %d", len(keys))
+	}
+	if keys["alice"].AgentID() != alice.AgentID() || keys["bob"].AgentID() != bob.AgentID() {
+		t.Fatal("loaded identities do not match created keys")
+	}
+}
+
+func TestLoadDir_Missing(t *testing.T) {
+	keys, err := LoadDir(filepath.Join(t.TempDir(), "nope"))
+	if err != nil {
+		t.Fatalf("missing dir should not error: %v", err)
+	}
+	if len(keys) != 0 {
+		t.Fatalf("expected no identities, got %d", len(keys))
+	}
+}
+
+func TestRoomKeys_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "room_keys.json")
+	key := make([]byte, RoomKeySize)
+	key[0] = 42
+
+	if err := SaveRoomKeys(path, map[string][]byte{"secret-room": key}); err != nil {
+		t.Fatalf("SaveRoomKeys: %v", err)
+	}
+	info, _ := os.Stat(path)
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("room key file permissions: got %o, want 0600", info.Mode().Perm())
+	}
+
+	keys, err := LoadRoomKeys(path)
+	if err != nil {
+		t.Fatalf("LoadRoomKeys: %v", err)
+	}
+	if got := keys["secret-room"]; len(got) != RoomKeySize || got[0] != 42 {
+		t.Fatalf("room key not restored: %v", got)
+	}
+}
+
+func TestRoomKeys_Missing(t *testing.T) {
+	keys, err := LoadRoomKeys(filepath.Join(t.TempDir(), "room_keys.json"))
+	if err != nil || len(keys) != 0 {
+		t.Fatalf("expected empty keys, got %v, %v", keys, err)
+	}
+}
+
+func TestCreate_RefusesExistingKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "new", "agent.key")
+	keys, err := Create(path)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	loaded, err := Load(path)
+	if err != nil || loaded.AgentID() != keys.AgentID() {
+		t.Fatalf("Load after Create: %v", err)
+	}
+
+	if _, err := Create(path); !errors.Is(err, ErrKeyExists) {
+		t.Fatalf("expected ErrKeyExists, got %v", err)
+	}
+	if again, _ := Load(path); again.AgentID() != keys.AgentID() {
+		t.Fatal("existing key was replaced")
+	}
+}
+
+func TestRotate_BacksUpOldKey(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "agent.key")
+	old, err := LoadOrCreate(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := Rotate(path)
+	if err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	if rotated.AgentID() == old.AgentID() {
+		t.Fatal("rotation should produce a new identity")
+	}
+
+	current, err := Load(path)
+	if err != nil || current.AgentID() != rotated.AgentID() {
+		t.Fatalf("key file should hold the new key: %v", err)
+	}
+	backups, _ := filepath.Glob(path + ".bak-*")
+	if len(backups) != 1 {
+		t.Fatalf("expected one backup, got %v", backups)
+	}
+	if backup, err := Load(backups[0]); err != nil || backup.AgentID() != old.AgentID() {
+		t.Fatalf("backup should hold the old key: %v", err)
+	}
+}
+
+func TestRotate_KeepsEveryBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.key")
+	keys, err := Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]bool{keys.AgentID(): true}
+	for i := 0; i < 2; i++ { // within the same second
+		if keys, err = Rotate(path); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			want[keys.AgentID()] = true
+		}
+	}
+	backups, _ := filepath.Glob(path + ".bak-*")
+	got := map[string]bool{}
+	for _, b := range backups {
+		if k, err := Load(b); err == nil {
+			got[k.AgentID()] = true
+		}
+	}
+	if len(backups) != 2 {
+		t.Fatalf("backups %v hold %v, want both earlier keys", backups, got)
+	}
+	for id := range want {
+		if !got[id] {
+			t.Fatalf("backup of %s lost", id)
+		}
+	}
+}
+
+func TestRotate_MissingKey(t *testing.T) {
+	if _, err := Rotate(filepath.Join(t.TempDir(), "agent.key")); err == nil {
+		t.Fatal("rotating a missing key should fail")
+	}
+}
+
+func TestWriteFileAtomic_FailedWriteKeepsOldKey(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "agent.key")
+	old, err := LoadOrCreate(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a crash after a partial write: the sync before rename fails.
+	origSync := syncFile
+	defer func() { syncFile = origSync }()
+	syncFile = func(f *os.File) error {
+		f.Truncate(3)
+		return errors.New("disk full")
+	}
+	if _, err := Rotate(path); err == nil {
+		t.Fatal("expected rotate to fail")
+	}
+
+	current, err := Load(path)
+	if err != nil || current.AgentID() != old.AgentID() {
+		t.Fatalf("old key should be intact: %v", err)
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(dir, ".agent.key.tmp-*")); len(leftovers) != 0 {
+		t.Fatalf("temp files left behind: %v", leftovers)
+	}
+}
@@ -0,0 +1,131 @@
+package keystore
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	_ "embed"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// bip39English is the BIP-39 English wordlist, 2048 words in index order.
+//
+//go:embed bip39_english.txt
+var bip39English string
+
+var (
+	wordList  = strings.Fields(bip39English)
+	wordIndex = func() map[string]int {
+		m := make(map[string]int, len(wordList))
+		for i, w := range wordList {
+			m[w] = i
+		}
+		return m
+	}()
+)
+
+// MnemonicWords is the length of a backup phrase: 256 bits of entropy and
+// an 8-bit checksum, 11 bits per word.
+const MnemonicWords = 24
+
+// ErrInvalidMnemonic is returned for a phrase with unknown words, the wrong
+// length or a bad checksum.
+var ErrInvalidMnemonic = errors.New("invalid backup phrase")
+
+// encodeMnemonic returns the BIP-39 phrase for 32 bytes of entropy.
+func encodeMnemonic(entropy []byte) string {
+	sum := sha256.Sum256(entropy)
+	bits := append(append([]byte(nil), entropy...), sum[0]) // 264 bits: 24 words of 11
+	words := make([]string, MnemonicWords)
+	for i := range words {
+		idx := 0
+		for b := i * 11; b < i*11+11; b++ {
+			idx = idx<<1 | int(bits[b/8]>>(7-b%8)&1)
+		}
+		words[i] = wordList[idx]
+	}
+	return strings.Join(words, " ")
+}
+
+// decodeMnemonic checks a phrase's words and checksum and returns the 32
+// bytes of entropy it encodes. Case and spacing don't matter.
+func decodeMnemonic(mnemonic string) ([]byte, error) {
+	words := strings.Fields(strings.ToLower(mnemonic))
+	if len(words) != MnemonicWords {
+		return nil, fmt.Errorf("%w: %d words, want %d", ErrInvalidMnemonic, len(words), MnemonicWords)
+	}
+	bits := make([]byte, 33)
+	for i, w := range words {
+		idx, ok := wordIndex[w]
+		if !ok {
+			return nil, fmt.Errorf("%w: word %d (%q) is not in the word list", ErrInvalidMnemonic, i+1, w)
+		}
+		for j := 0; j < 11; j++ {
+			if idx>>(10-j)&1 == 1 {
+				b := i*11 + j
+				bits[b/8] |= 1 << (7 - b%8)
+			}
+		}
+	}
+	if sum := sha256.Sum256(bits[:32]); sum[0] != bits[32] {
+		return nil, fmt.Errorf("%w: checksum mismatch (a word is wrong or out of order)", ErrInvalidMnemonic)
+	}
+	return bits[:32], nil
+}
+
+// NewMnemonic returns a random 24-word BIP-39 phrase.
+func NewMnemonic() (string, error) {
+	entropy := make([]byte, 32)
+	if _, err := rand.Read(entropy); err != nil {
+		return "", err
+	}
+	return encodeMnemonic(entropy), nil
+}
+
+// MnemonicFor returns the phrase for keys: their 32-byte Ed25519 seed as
+// the BIP-39 entropy, so every key has one and it restores the same key.
+func MnemonicFor(keys *Keys) string {
+	return encodeMnemonic(keys.PrivateKey.Seed())
+}
+
+// KeysFromMnemonic returns the keypair whose seed the phrase encodes.
+func KeysFromMnemonic(mnemonic string) (*Keys, error) {
+	seed, err := decodeMnemonic(mnemonic)
+	if err != nil {
+		return nil, err
+	}
+	priv := ed25519.NewKeyFromSeed(seed)
+	return &Keys{PublicKey: priv.Public().(ed25519.PublicKey), PrivateKey: priv}, nil
+}
+
+// CreateWithMnemonic is Create that also returns the new key's phrase.
+func CreateWithMnemonic(path string) (*Keys, string, error) {
+	keys, err := Create(path)
+	if err != nil {
+		return nil, "", err
+	}
+	return keys, MnemonicFor(keys), nil
+}
+
+// Restore installs the key for mnemonic at path, as Import does.
+func Restore(path, mnemonic string, force bool) (*Keys, error) {
+	keys, err := KeysFromMnemonic(mnemonic)
+	if err != nil {
+		return nil, err
+	}
+	if err := install(path, keys, force); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Mnemonic returns the phrase for the key at path.
+func Mnemonic(path string) (string, error) {
+	keys, err := Load(path)
+	if err != nil {
+		return "", err
+	}
+	return MnemonicFor(keys), nil
+}
@@ -0,0 +1,106 @@
+package keystore
+
+import (
+	"encoding/hex"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWordList(t *testing.T) {
+	if len(wordList) != 2048 || wordList[0] != "abandon" || wordList[2047] != "zoo" {
+		t.Fatalf("word list: %d words, %q..%q", len(wordList), wordList[0], wordList[len(wordList)-1])
+	}
+}
+
+func TestMnemonic_BIP39Vectors(t *testing.T) {
+	// BIP-39 English vectors for 256 bits of entropy.
+	for entropy, want := range map[string]string{
+		"0000000000000000000000000000000000000000000000000000000000000000": strings.Repeat("abandon ", 23) + "art",
+		"7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f": strings.Repeat("legal winner thank year wave sausage worth useful ", 2) +
+			"legal winner thank year wave sausage worth title",
+		"ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff": strings.Repeat("zoo ", 23) + "vote",
+	} {
+		b, _ := hex.DecodeString(entropy)
+		if got := encodeMnemonic(b); got != want {
+			t.Fatalf("%s: got %q", entropy, got)
+		}
+		back, err := decodeMnemonic(want)
+		if err != nil || hex.EncodeToString(back) != entropy {
+			t.Fatalf("%s: decoded %x, %v", entropy, back, err)
+		}
+	}
+}
+
+func TestMnemonic_Invalid(t *testing.T) {
+	for name, phrase := range map[string]string{
+		"too short":    "abandon abandon art",
+		"unknown word": strings.Repeat("abandon ", 23) + "bitcoin",
+		"checksum":     strings.Repeat("abandon ", 24),
+	} {
+		if _, err := KeysFromMnemonic(phrase); !errors.Is(err, ErrInvalidMnemonic) {
+			t.Fatalf("%s: got %v", name, err)
+		}
+	}
+}
+
+func TestMnemonic_CreateAndRestore(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "agent.key")
+	keys, phrase, err := CreateWithMnemonic(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(strings.Fields(phrase)) != MnemonicWords {
+		t.Fatalf("phrase %q", phrase)
+	}
+	if got, err := Mnemonic(path); err != nil || got != phrase {
+		t.Fatalf("Mnemonic: %q, %v", got, err)
+	}
+
+	// Restoring elsewhere, however it was written down, gives the same key.
+	restored, err := Restore(filepath.Join(dir, "elsewhere.key"), "  "+strings.ToUpper(phrase)+"\n", false)
+	if err != nil || restored.AgentID() != keys.AgentID() {
+		t.Fatalf("Restore: %v", err)
+	}
+
+	// A different existing key needs force.
+	other := filepath.Join(dir, "other.key")
+	LoadOrCreate(other)
+	if _, err := Restore(other, phrase, false); !errors.Is(err, ErrKeyExists) {
+		t.Fatalf("expected ErrKeyExists, got %v", err)
+	}
+	if _, err := Restore(other, phrase, true); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := Load(other); got.AgentID() != keys.AgentID() {
+		t.Fatal("force did not restore the key")
+	}
+}
+
+func TestMnemonic_AnyKeyRoundTrips(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "agent.key")
+	keys, err := LoadOrCreate(path) // generated, not from a phrase
+	if err != nil {
+		t.Fatal(err)
+	}
+	phrase, err := Mnemonic(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back, err := KeysFromMnemonic(phrase); err != nil || back.AgentID() != keys.AgentID() {
+		t.Fatalf("phrase restores another key: %v", err)
+	}
+
+	// Moving the key with export/import keeps its phrase.
+	data, _ := Export(keys, "")
+	moved := filepath.Join(dir, "moved.key")
+	if _, err := Import(moved, data, "", false); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := Mnemonic(moved); err != nil || got != phrase {
+		t.Fatalf("imported key's phrase: %q, %v", got, err)
+	}
+}
@@ -0,0 +1,129 @@
+// Package update finds the latest agentnet release on GitHub, caching the
+// answer in the data dir so the daemon and CLI share one lookup and back off
+// when GitHub rate limits them.
+package update
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/betta-lab/agentnet-openclaw/internal/keystore"
+)
+
+// Cache timing.
+const (
+	CacheTTL       = 6 * time.Hour    // a cached release is used for this long
+	FailureBackoff = 15 * time.Minute // wait after a failed lookup GitHub gave no delay for
+)
+
+// CacheFile is the cache's name in the data dir.
+const CacheFile = "version.cache"
+
+// Lookup settings, replaceable in tests.
+var (
+	releaseURL = "https://api.github.com/repos/betta-lab/agentnet-openclaw/releases/latest"
+	timeout    = 10 * time.Second
+)
+
+// ErrBackoff is returned while an earlier failure or rate limit says to wait
+// and nothing is cached.
+var ErrBackoff = errors.New("waiting before checking GitHub again")
+
+type cache struct {
+	Latest     string    `json:"latest,omitempty"`
+	CheckedAt  time.Time `json:"checked_at"`
+	RetryAfter time.Time `json:"retry_after,omitempty"` // no lookups before this
+}
+
+// Latest returns the latest release version, without a leading "v", and when
+// it was fetched. A cached answer younger than CacheTTL is returned without
+// asking GitHub; so is an older one while backing off after a failure, which
+// honors GitHub's Retry-After and rate-limit reset headers.
+func Latest(dataDir, userAgent string) (string, time.Time, error) {
+	path := filepath.Join(dataDir, CacheFile)
+	var c cache
+	if data, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(data, &c)
+	}
+	now := time.Now()
+	if c.Latest != "" && now.Sub(c.CheckedAt) < CacheTTL {
+		return c.Latest, c.CheckedAt, nil
+	}
+	if now.Before(c.RetryAfter) {
+		if c.Latest != "" {
+			return c.Latest, c.CheckedAt, nil
+		}
+		return "", time.Time{}, fmt.Errorf("%w (until %s)", ErrBackoff, c.RetryAfter.Format(time.Kitchen))
+	}
+
+	latest, retryAfter, err := fetch(userAgent)
+	if err != nil {
+		c.RetryAfter = now.Add(FailureBackoff)
+		if retryAfter > 0 {
+			c.RetryAfter = now.Add(retryAfter)
+		}
+		save(path, c)
+		if c.Latest != "" {
+			return c.Latest, c.CheckedAt, nil
+		}
+		return "", time.Time{}, err
+	}
+	c = cache{Latest: latest, CheckedAt: now}
+	save(path, c)
+	return c.Latest, c.CheckedAt, nil
+}
+
+// fetch asks GitHub for the latest release. When refused, it also returns
+// how long GitHub asked to wait, if it said.
+func fetch(userAgent string) (string, time.Duration, error) {
+	req, _ := http.NewRequest("GET", releaseURL, nil)
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := (&http.Client{Timeout: timeout}).Do(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", retryAfter(resp.Header), fmt.Errorf("GitHub returned %s", resp.Status)
+	}
+	var rel struct {
+		TagName string `json:"tag_name"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&rel); err != nil {
+		return "", 0, err
+	}
+	if rel.TagName == "" {
+		return "", 0, errors.New("GitHub returned no release tag")
+	}
+	return strings.TrimPrefix(rel.TagName, "v"), 0, nil
+}
+
+// retryAfter reads how long to wait from Retry-After (seconds) or, once the
+// rate limit is used up, X-RateLimit-Reset (Unix seconds).
+func retryAfter(h http.Header) time.Duration {
+	if s, err := strconv.Atoi(h.Get("Retry-After")); err == nil && s > 0 {
+		return time.Duration(s) * time.Second
+	}
+	if h.Get("X-RateLimit-Remaining") == "0" {
+		if reset, err := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			if wait := time.Until(time.Unix(reset, 0)); wait > 0 {
+				return wait
+			}
+		}
+	}
+	return 0
+}
+
+// save writes the cache, ignoring failure: a read-only data dir only costs
+// extra lookups.
+func save(path string, c cache) {
+	data, _ := json.Marshal(c)
+	keystore.WriteFileAtomic(path, data, 0600)
+}
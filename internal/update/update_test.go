@@ -0,0 +1,90 @@
+package update
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// githubStub serves releaseURL with handler and counts requests.
+func githubStub(t *testing.T, handler http.HandlerFunc) *int {
+	t.Helper()
+	calls := new(int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*calls++
+		handler(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	orig := releaseURL
+	releaseURL = srv.URL
+	t.Cleanup(func() { releaseURL = orig })
+	return calls
+}
+
+func TestLatest_CachesRelease(t *testing.T) {
+	calls := githubStub(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"tag_name":"v1.2.3"}`))
+	})
+	dir := t.TempDir()
+	for i := 0; i < 3; i++ {
+		latest, _, err := Latest(dir, "test")
+		if err != nil || latest != "1.2.3" {
+			t.Fatalf("got %q, %v", latest, err)
+		}
+	}
+	if *calls != 1 {
+		t.Fatalf("expected one lookup, got %d", *calls)
+	}
+}
+
+func TestLatest_BacksOffWhenRateLimited(t *testing.T) {
+	calls := githubStub(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusForbidden)
+	})
+	dir := t.TempDir()
+	if _, _, err := Latest(dir, "test"); err == nil {
+		t.Fatal("expected the refusal")
+	}
+	_, _, err := Latest(dir, "test")
+	if !errors.Is(err, ErrBackoff) {
+		t.Fatalf("expected ErrBackoff, got %v", err)
+	}
+	if *calls != 1 {
+		t.Fatalf("expected no lookup while backing off, got %d", *calls)
+	}
+}
+
+func TestLatest_StaleCacheServesDuringBackoff(t *testing.T) {
+	calls := githubStub(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	dir := t.TempDir()
+	checked := time.Now().Add(-2 * CacheTTL)
+	save(filepath.Join(dir, CacheFile), cache{Latest: "1.0.0", CheckedAt: checked})
+
+	for i := 0; i < 2; i++ {
+		latest, at, err := Latest(dir, "test")
+		if err != nil || latest != "1.0.0" || !at.Equal(checked) {
+			t.Fatalf("got %q at %v, %v", latest, at, err)
+		}
+	}
+	if *calls != 1 {
+		t.Fatalf("expected one lookup, then backoff; got %d", *calls)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	h := http.Header{}
+	h.Set("X-RateLimit-Remaining", "0")
+	h.Set("X-RateLimit-Reset", "9999999999")
+	if retryAfter(h) <= 0 {
+		t.Fatal("expected a wait until the rate limit resets")
+	}
+	if retryAfter(http.Header{}) != 0 {
+		t.Fatal("expected no wait without headers")
+	}
+}
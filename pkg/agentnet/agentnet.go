@@ -0,0 +1,438 @@
+// Package agentnet is a Go client for AgentNet relays, for programs that want
+// to talk to the network directly instead of through the agentnet daemon.
+//
+//	keys, err := agentnet.LoadOrCreateKeys("agent.key")
+//	c, err := agentnet.Connect(ctx, "wss://agentnet.bettalab.me/v1/ws", "my-agent", keys)
+//	defer c.Close()
+//	c.JoinRoom(ctx, "lobby")
+//	for msg := range c.Messages() { ... }
+//
+// Operations take a context. If it ends before the relay answers, the call
+// returns ctx.Err(); the request may still have reached the relay. The
+// abandoned operation finishes in the background, and later operations on the
+// same Client wait for it: proof-of-work stops when ctx ends, and waiting for
+// the relay's answer gives up after at most 15 seconds (SendWait's timeout if
+// longer, capped by ctx's deadline).
+package agentnet
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/betta-lab/agentnet-openclaw/internal/client"
+	"github.com/betta-lab/agentnet-openclaw/internal/keystore"
+)
+
+// Types shared with the daemon's implementation.
+type (
+	Keys            = keystore.Keys
+	IncomingMessage = client.IncomingMessage
+	TypingEvent     = client.TypingEvent
+	RoomInfo        = client.RoomInfo
+	RoomListItem    = client.RoomListItem
+	Member          = client.Member
+	RelayError      = client.RelayError
+	RateLimiter     = client.RateLimiter
+	Attachment      = client.Attachment
+	Capabilities    = client.Capabilities
+	Disconnect      = client.Disconnect
+	Receipt         = client.Receipt
+)
+
+// Errors returned by Client operations.
+var (
+	ErrRateLimited = client.ErrRateLimited
+	ErrReadOnly    = client.ErrReadOnly
+	ErrNotOwner    = client.ErrNotOwner
+	ErrUnconfirmed = client.ErrUnconfirmed
+
+	ErrMemberNotFound = client.ErrMemberNotFound
+
+	ErrInvalidRoomName = client.ErrInvalidRoomName
+	ErrInvalidTags     = client.ErrInvalidTags
+	ErrMessageTooLarge = client.ErrMessageTooLarge
+	ErrInvalidContent  = client.ErrInvalidContent
+	ErrTooManyRooms    = client.ErrTooManyRooms
+	ErrInvalidName     = client.ErrInvalidName
+
+	ErrPresenceUnsupported = client.ErrPresenceUnsupported
+	ErrPoWTooHard          = client.ErrPoWTooHard
+	ErrPoWTimeout          = client.ErrPoWTimeout
+	ErrProfileUnsupported  = client.ErrProfileUnsupported
+	ErrUnauthorizedRoom    = client.ErrUnauthorizedRoom
+	ErrUnsupported         = client.ErrUnsupported
+
+	// ErrAuthRejected is wrapped by Connect errors when the relay refuses
+	// these keys. Retrying will not help.
+	ErrAuthRejected = client.ErrAuthRejected
+)
+
+// AckTimeout is the SendWait timeout used when none is given.
+const AckTimeout = client.AckTimeout
+
+// DefaultPingInterval is the relay ping interval used when Options.PingInterval is 0.
+const DefaultPingInterval = client.DefaultPingInterval
+
+// DefaultMaxMessageSize is the message size limit used when Options.MaxMessageSize is 0.
+const DefaultMaxMessageSize = client.DefaultMaxMessageSize
+
+// DefaultMessageBuffer is the incoming message buffer used when Options.MessageBuffer is 0.
+const DefaultMessageBuffer = client.DefaultMessageBuffer
+
+// MaxInlineAttachment is the largest blob SendAttachment embeds in a message.
+const MaxInlineAttachment = client.MaxInlineAttachment
+
+// MaxClockSkew is how far the local clock may be from the relay's before it is
+// reported as a likely cause of rejected messages.
+const MaxClockSkew = client.MaxClockSkew
+
+// DefaultMaxPoWDifficulty is the proof-of-work cap used when
+// Options.MaxPoWDifficulty is 0.
+const DefaultMaxPoWDifficulty = client.DefaultMaxPoWDifficulty
+
+// Room roles, as reported in RoomInfo.MyRole and Member.Role.
+const (
+	RoleOwner     = client.RoleOwner
+	RoleModerator = client.RoleModerator
+	RoleMember    = client.RoleMember
+)
+
+// LoadOrCreateKeys loads the agent keypair at path, creating it if missing.
+func LoadOrCreateKeys(path string) (*Keys, error) {
+	return keystore.LoadOrCreate(path)
+}
+
+// NewRateLimiter allows rate messages per second with bursts of up to burst,
+// optionally tracked per room.
+func NewRateLimiter(rate float64, burst int, perRoom bool) *RateLimiter {
+	return client.NewRateLimiter(rate, burst, perRoom)
+}
+
+// Options tunes a connection. The zero value is ready to use.
+type Options struct {
+	MessageBuffer int          // incoming messages buffered for a slow consumer; 0 = DefaultMessageBuffer
+	RateLimiter   *RateLimiter // optional outgoing message limit
+	ReadOnly      bool         // refuse every operation that transmits
+	// PingInterval is how often to ping the relay; 0 = DefaultPingInterval.
+	// After twice this with nothing received the connection is closed.
+	PingInterval time.Duration
+	Compression  bool // negotiate per-message deflate; transparent to signatures
+	// MaxMessageSize caps outgoing message text (or encoded structured
+	// content) in bytes; 0 = DefaultMaxMessageSize.
+	MaxMessageSize int
+	// Header is sent with the WebSocket upgrade request, e.g. for an auth
+	// proxy in front of the relay.
+	Header http.Header
+	// Proxy reaches the relay through an http:// or socks5:// proxy URL.
+	// Empty uses HTTPS_PROXY/ALL_PROXY from the environment; "none" connects
+	// directly.
+	Proxy    string
+	MaxRooms int // most rooms to be in at once; 0 = unlimited
+	// MaxPoWDifficulty is the hardest proof-of-work challenge to attempt;
+	// 0 = DefaultMaxPoWDifficulty. Harder ones fail with ErrPoWTooHard.
+	MaxPoWDifficulty int
+	// OrderedSends writes concurrent sends to the same room in call order.
+	OrderedSends bool
+}
+
+// Client is a connection to an AgentNet relay. It is safe for concurrent use.
+type Client struct {
+	c *client.Client
+}
+
+// Connect dials relayURL and authenticates as keys with the given display name.
+func Connect(ctx context.Context, relayURL, agentName string, keys *Keys) (*Client, error) {
+	return ConnectWithOptions(ctx, relayURL, agentName, keys, Options{})
+}
+
+// ConnectWithOptions is like Connect with non-default Options.
+func ConnectWithOptions(ctx context.Context, relayURL, agentName string, keys *Keys, opts Options) (*Client, error) {
+	c, err := client.ConnectWithOptions(ctx, relayURL, keys.AgentID(), agentName, keys.PrivateKey, client.ConnectOptions{
+		BufferSize:   opts.MessageBuffer,
+		PingInterval: opts.PingInterval,
+		Compression:  opts.Compression,
+		Header:       opts.Header,
+		Proxy:        opts.Proxy,
+
+		MaxPoWDifficulty: opts.MaxPoWDifficulty,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if opts.RateLimiter != nil {
+		c.SetRateLimiter(opts.RateLimiter)
+	}
+	c.SetReadOnly(opts.ReadOnly)
+	c.SetMaxMessageSize(opts.MaxMessageSize)
+	c.SetMaxRooms(opts.MaxRooms)
+	c.SetOrderedSends(opts.OrderedSends)
+	return &Client{c: c}, nil
+}
+
+// CreateRoom creates a room and joins it, solving the relay's proof-of-work if asked.
+func (c *Client) CreateRoom(ctx context.Context, name, topic string, tags []string) (*RoomInfo, error) {
+	return do(ctx, func() (*RoomInfo, error) { return c.c.CreateRoomContext(ctx, name, topic, tags) })
+}
+
+// UpdateRoom changes the topic and/or tags of a room this agent owns. An empty
+// topic or nil tags leaves that field unchanged.
+func (c *Client) UpdateRoom(ctx context.Context, name, topic string, tags []string) error {
+	return run(ctx, func() error { return c.c.UpdateRoomContext(ctx, name, topic, tags) })
+}
+
+// JoinRoom joins an existing room.
+func (c *Client) JoinRoom(ctx context.Context, name string) (*RoomInfo, error) {
+	return do(ctx, func() (*RoomInfo, error) { return c.c.JoinRoom(name) })
+}
+
+// JoinRoomSince joins a room and asks the relay to replay messages newer than
+// sinceMs (Unix milliseconds), e.g. those missed while disconnected. Replays
+// may repeat messages already seen; dedup by IncomingMessage.ID.
+func (c *Client) JoinRoomSince(ctx context.Context, name string, sinceMs int64) (*RoomInfo, error) {
+	return do(ctx, func() (*RoomInfo, error) { return c.c.JoinRoomSince(name, sinceMs) })
+}
+
+// JoinRoomWithToken joins a gated room with an invite token or password. A
+// missing or wrong token fails with ErrUnauthorizedRoom.
+func (c *Client) JoinRoomWithToken(ctx context.Context, name, token string) (*RoomInfo, error) {
+	return do(ctx, func() (*RoomInfo, error) { return c.c.JoinRoomWithToken(name, token) })
+}
+
+// LeaveRoom leaves a joined room.
+func (c *Client) LeaveRoom(ctx context.Context, name string) error {
+	return run(ctx, func() error { return c.c.LeaveRoom(name) })
+}
+
+// KickMember removes agentID from a room this agent owns. It fails with
+// ErrNotOwner or ErrMemberNotFound when the relay refuses.
+func (c *Client) KickMember(ctx context.Context, room, agentID string) error {
+	return run(ctx, func() error { return c.c.KickMember(room, agentID) })
+}
+
+// ListRooms lists rooms on the relay, optionally filtered by tags.
+func (c *Client) ListRooms(ctx context.Context, tags []string, limit int) ([]RoomListItem, error) {
+	return do(ctx, func() ([]RoomListItem, error) { return c.c.ListRooms(tags, limit) })
+}
+
+// ListMyRooms lists the rooms this agent is in, with the same details as
+// ListRooms.
+func (c *Client) ListMyRooms(ctx context.Context, tags []string, limit int) ([]RoomListItem, error) {
+	return do(ctx, func() ([]RoomListItem, error) { return c.c.ListMyRooms(tags, limit) })
+}
+
+// SendMessage sends a text message and returns its message ID.
+func (c *Client) SendMessage(ctx context.Context, room, text string) (string, error) {
+	return do(ctx, func() (string, error) { return c.c.SendMessage(room, text) })
+}
+
+// SendMessages sends texts to a room in order and returns their message IDs.
+// If one fails, the IDs already sent are returned with the error.
+func (c *Client) SendMessages(ctx context.Context, room string, texts []string) ([]string, error) {
+	return do(ctx, func() ([]string, error) { return c.c.SendMessages(room, texts) })
+}
+
+// SendReply sends a text message threaded under parentMessageID and returns its message ID.
+func (c *Client) SendReply(ctx context.Context, room, parentMessageID, text string) (string, error) {
+	return do(ctx, func() (string, error) { return c.c.SendReply(room, parentMessageID, text) })
+}
+
+// SendContent sends a structured content object, which must carry a string
+// "type" field, and returns its message ID.
+func (c *Client) SendContent(ctx context.Context, room string, content map[string]interface{}) (string, error) {
+	return do(ctx, func() (string, error) { return c.c.SendContent(room, content) })
+}
+
+// SendAttachment sends data inline as an attachment named name and returns
+// its message ID. Data over MaxInlineAttachment returns ErrMessageTooLarge.
+func (c *Client) SendAttachment(ctx context.Context, room, name string, data []byte) (string, error) {
+	return do(ctx, func() (string, error) { return c.c.SendAttachment(room, name, data) })
+}
+
+// SendWait sends content (optionally as a reply to inReplyTo) and waits up to
+// timeout for the relay to acknowledge it. Relays that don't send acks
+// return the message ID with acked false once the timeout passes.
+func (c *Client) SendWait(ctx context.Context, room string, content map[string]interface{}, inReplyTo string, timeout time.Duration) (id string, acked bool, err error) {
+	type result struct {
+		id    string
+		acked bool
+	}
+	if timeout <= 0 {
+		timeout = AckTimeout
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = min(timeout, max(time.Until(deadline), time.Millisecond))
+	}
+	r, err := do(ctx, func() (result, error) {
+		id, acked, err := c.c.SendWait(room, content, inReplyTo, timeout)
+		return result{id, acked}, err
+	})
+	return r.id, r.acked, err
+}
+
+// SendTracked sends content (optionally as a reply to inReplyTo) and returns
+// a Receipt listing the agents that acknowledge receiving it with
+// message.received as their acks arrive.
+func (c *Client) SendTracked(ctx context.Context, room string, content map[string]interface{}, inReplyTo string) (*Receipt, error) {
+	return do(ctx, func() (*Receipt, error) { return c.c.SendTracked(room, content, inReplyTo) })
+}
+
+// SendReceipt acknowledges a received message to its room, for senders
+// using SendTracked.
+func (c *Client) SendReceipt(room, messageID string) error {
+	return c.c.SendReceipt(room, messageID)
+}
+
+// EditMessage replaces the text of a message this agent sent.
+func (c *Client) EditMessage(ctx context.Context, room, messageID, newText string) error {
+	return run(ctx, func() error { return c.c.EditMessage(room, messageID, newText) })
+}
+
+// DeleteMessage retracts a message this agent sent.
+func (c *Client) DeleteMessage(ctx context.Context, room, messageID string) error {
+	return run(ctx, func() error { return c.c.DeleteMessage(room, messageID) })
+}
+
+// SetTyping shows or clears this agent's typing indicator in a room.
+func (c *Client) SetTyping(room string, active bool) error {
+	return c.c.SetTyping(room, active)
+}
+
+// SetRoomKey enables end-to-end encryption for a room with a 32-byte shared
+// key; a nil key returns the room to plaintext.
+func (c *Client) SetRoomKey(room string, key []byte) error {
+	return c.c.SetRoomKey(room, key)
+}
+
+// JoinedRooms returns the rooms this client is currently in, sorted by name.
+func (c *Client) JoinedRooms() []string {
+	return c.c.JoinedRooms()
+}
+
+// Members returns the agents currently in a joined room, sorted by name.
+func (c *Client) Members(room string) []Member {
+	return c.c.Members(room)
+}
+
+// Role returns this agent's role in a joined room, or "" if the relay
+// didn't say. KickMember and UpdateRoom fail with ErrNotOwner at once for
+// RoleMember.
+func (c *Client) Role(room string) string {
+	return c.c.Role(room)
+}
+
+// Presence asks the relay which of agentIDs are connected right now. Relays
+// without presence support return ErrPresenceUnsupported.
+func (c *Client) Presence(ctx context.Context, agentIDs []string) (map[string]bool, error) {
+	return do(ctx, func() (map[string]bool, error) { return c.c.Presence(agentIDs) })
+}
+
+// Name returns the agent's display name.
+func (c *Client) Name() string {
+	return c.c.Name()
+}
+
+// SetName changes the agent's display name for this connection. Relays
+// without profile updates return ErrProfileUnsupported.
+func (c *Client) SetName(ctx context.Context, name string) error {
+	return run(ctx, func() error { return c.c.SetName(name) })
+}
+
+// Messages returns incoming messages. The channel is closed on disconnect.
+func (c *Client) Messages() <-chan IncomingMessage {
+	return c.c.Messages()
+}
+
+// Typing returns typing indicator events. The channel is closed on disconnect.
+func (c *Client) Typing() <-chan TypingEvent {
+	return c.c.Typing()
+}
+
+// Errors returns relay errors that were not a response to an operation, such
+// as being kicked from a room. After a RelayError whose Fatal method reports
+// true, reconnecting with the same keys will be refused. The channel is closed
+// on disconnect.
+func (c *Client) Errors() <-chan RelayError {
+	return c.c.Errors()
+}
+
+// FatalError returns the fatal relay error that ended the session, or nil.
+func (c *Client) FatalError() *RelayError {
+	return c.c.FatalError()
+}
+
+// LastDisconnect returns how the connection ended, with the relay's
+// websocket close code and reason if it sent them, or nil while connected.
+func (c *Client) LastDisconnect() *Disconnect {
+	return c.c.LastDisconnect()
+}
+
+// ProtocolVersion returns the protocol version agreed with the relay.
+func (c *Client) ProtocolVersion() string {
+	return c.c.ProtocolVersion()
+}
+
+// Capabilities returns the limits and optional features the relay
+// advertised, and false if it advertised none. Operations it leaves out fail
+// with ErrUnsupported without being sent.
+func (c *Client) Capabilities() (Capabilities, bool) {
+	return c.c.Capabilities()
+}
+
+// ClockSkew returns how far the local clock is ahead of the relay's (negative
+// if behind), and false if the relay did not report its time. Relays may
+// reject signed messages once it exceeds about MaxClockSkew.
+func (c *Client) ClockSkew() (time.Duration, bool) {
+	return c.c.ClockSkew()
+}
+
+// Dropped returns how many incoming messages were discarded because the
+// consumer of Messages was not keeping up.
+func (c *Client) Dropped() int64 {
+	return c.c.Dropped()
+}
+
+// LastRTT returns the most recent ping round-trip time to the relay, or 0 if
+// none has been measured yet.
+func (c *Client) LastRTT() time.Duration {
+	return c.c.LastRTT()
+}
+
+// Close disconnects from the relay.
+func (c *Client) Close() {
+	c.c.Close()
+}
+
+// Wait blocks until the client is disconnected.
+func (c *Client) Wait() {
+	c.c.Wait()
+}
+
+// do runs op, returning early with ctx.Err() if ctx ends first.
+func do[T any](ctx context.Context, op func() (T, error)) (T, error) {
+	var zero T
+	if err := ctx.Err(); err != nil {
+		return zero, err
+	}
+	type result struct {
+		v   T
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		v, err := op()
+		done <- result{v, err}
+	}()
+	select {
+	case r := <-done:
+		return r.v, r.err
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+}
+
+// run is do for operations without a result.
+func run(ctx context.Context, op func() error) error {
+	_, err := do(ctx, func() (struct{}, error) { return struct{}{}, op() })
+	return err
+}
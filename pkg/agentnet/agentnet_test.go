@@ -0,0 +1,108 @@
+package agentnet
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestDo_ReturnsWhenContextEnds(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	block := make(chan struct{})
+	defer close(block)
+	_, err := do(ctx, func() (string, error) {
+		<-block
+		return "late", nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline error, got %v", err)
+	}
+}
+
+func TestDo_SkipsOpWhenAlreadyCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	called := false
+	if err := run(ctx, func() error { called = true; return nil }); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected canceled, got %v", err)
+	}
+	if called {
+		t.Fatal("op should not run on a cancelled context")
+	}
+}
+
+func TestConnect_CancelledContext(t *testing.T) {
+	keys, err := LoadOrCreateKeys(filepath.Join(t.TempDir(), "agent.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Connect(ctx, "ws://127.0.0.1:1/v1/ws", "test", keys); err == nil {
+		t.Fatal("expected error connecting with a cancelled context")
+	}
+}
+
+func TestCreateRoom_CancelStopsProofOfWork(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		ws.ReadMessage() // hello
+		ws.WriteJSON(map[string]interface{}{"type": "pow.challenge", "challenge": "c", "difficulty": 1})
+		ws.ReadMessage() // hello.pow
+		ws.WriteJSON(map[string]string{"type": "welcome"})
+		for {
+			var msg struct {
+				Type  string `json:"type"`
+				Room  string `json:"room"`
+				Nonce string `json:"nonce"`
+			}
+			if err := ws.ReadJSON(&msg); err != nil {
+				return
+			}
+			switch msg.Type {
+			case "room.create":
+				// Far too hard to solve before the caller gives up.
+				ws.WriteJSON(map[string]interface{}{"type": "pow.challenge", "room": msg.Room, "nonce": msg.Nonce, "challenge": "c", "difficulty": 60})
+			case "room.join":
+				ws.WriteJSON(map[string]interface{}{"type": "room.joined", "room": msg.Room, "nonce": msg.Nonce, "members": []string{}})
+			}
+		}
+	}))
+	defer srv.Close()
+	keys, err := LoadOrCreateKeys(filepath.Join(t.TempDir(), "agent.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := ConnectWithOptions(context.Background(), "ws"+strings.TrimPrefix(srv.URL, "http"), "test", keys, Options{MaxPoWDifficulty: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.CreateRoom(ctx, "lab", "", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline error, got %v", err)
+	}
+
+	// The abandoned create must let go of the connection promptly.
+	ctx, cancel = context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if _, err := c.JoinRoom(ctx, "other"); err != nil {
+		t.Fatalf("join after a cancelled create: %v", err)
+	}
+}